@@ -0,0 +1,127 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/menta2k/local-nginx-ingress/pkg/errors"
+	"github.com/menta2k/local-nginx-ingress/pkg/health"
+	provider "github.com/menta2k/local-nginx-ingress/pkg/provider/docker"
+)
+
+// bundleEntry is one file of a debug bundle
+type bundleEntry struct {
+	name string
+	data []byte
+}
+
+// debugBundleHandler serves a tar.gz with everything needed to diagnose the
+// controller: the applied nginx config, the managed containers, health,
+// reload status and the recent warnings and errors
+func debugBundleHandler(p *provider.Provider, hm *health.HealthMonitor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entries, err := debugBundleEntries(p, hm)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		now := time.Now()
+		bundle, err := writeDebugBundle(entries, now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="ingress-bundle-%s.tar.gz"`, now.UTC().Format("20060102-150405")))
+		w.Write(bundle)
+	}
+}
+
+// debugBundleEntries collects the files of a debug bundle. A config that
+// hasn't been written yet is left out rather than failing the bundle.
+func debugBundleEntries(p *provider.Provider, hm *health.HealthMonitor) ([]bundleEntry, error) {
+	var entries []bundleEntry
+
+	config, err := p.ReadAppliedConfig()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read nginx config: %w", err)
+	}
+	if err == nil {
+		entries = append(entries, bundleEntry{name: "nginx.conf", data: config})
+	}
+
+	routes := provider.RoutesFromConfig(p.GetCurrentConfig())
+	if routes == nil {
+		routes = []provider.RouteStatus{}
+	}
+	for _, file := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"containers.json", bundleContainers(p.GetContainers())},
+		{"invalid-containers.json", p.InvalidContainers()},
+		{"routes.json", routes},
+		{"health.json", hm.Report()},
+		{"reload-status.json", p.GetReloadStatus()},
+		{"errors.json", errors.RecentErrors()},
+	} {
+		data, err := json.MarshalIndent(file.value, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", file.name, err)
+		}
+		entries = append(entries, bundleEntry{name: file.name, data: data})
+	}
+	return entries, nil
+}
+
+// bundleContainers copies the managed containers without auth credentials
+func bundleContainers(containers []*provider.ContainerData) []provider.ContainerData {
+	copied := make([]provider.ContainerData, 0, len(containers))
+	for _, container := range containers {
+		data := *container
+		if container.Config != nil {
+			config := *container.Config
+			config.Middleware.Auth.Users = nil
+			data.Config = &config
+		}
+		copied = append(copied, data)
+	}
+	return copied
+}
+
+// writeDebugBundle packs entries into a gzipped tar
+func writeDebugBundle(entries []bundleEntry, modTime time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	for _, entry := range entries {
+		header := &tar.Header{
+			Name:    entry.name,
+			Mode:    0644,
+			Size:    int64(len(entry.data)),
+			ModTime: modTime,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", entry.name, err)
+		}
+		if _, err := tw.Write(entry.data); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", entry.name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -2,10 +2,15 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -18,13 +23,47 @@ import (
 )
 
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(runValidate())
+	}
+	if len(os.Args) > 1 && os.Args[1] == "status" {
+		os.Exit(runStatus(os.Args[2:]))
+	}
+	
+	os.Exit(run())
+}
+
+// run starts the controller and blocks until shutdown, returning the exit code
+func run() int {
+	// Plain-text tags instead of emoji, for log aggregators and terminals
+	// that can't render them
+	if getEnvOrDefault("NO_EMOJI", "false") == "true" {
+		errors.SetNoEmoji(true)
+		log.SetOutput(errors.PlainTextWriter(os.Stderr))
+	}
+	
 	// Set up panic recovery
 	defer errors.Recover("main")
 	
+	// Critical errors request a graceful shutdown instead of exiting in place
+	criticalChan := make(chan *errors.StructuredError, 1)
+	errors.DefaultHandler.SetShutdownFunc(func(err *errors.StructuredError) {
+		select {
+		case criticalChan <- err:
+		default:
+		}
+	})
+	
+	// Retry and circuit breaker overrides for every error handler
+	resilience := resilienceFromEnv()
+	errors.DefaultHandler.ApplyResilienceConfig(resilience)
+	
 	// Configure error handler for graceful degradation instead of immediate exit
 	errorHandler := errors.NewErrorHandler()
 	errorHandler.SetExitOnCritical(false) // Allow graceful recovery
 	errorHandler.SetRetryConfig(3, 5*time.Second)
+	errorHandler.ApplyResilienceConfig(resilience)
 	
 	ctx := context.Background()
 	pool := safe.NewPool(ctx)
@@ -33,6 +72,12 @@ func main() {
 
 	// Initialize health monitor
 	healthMonitor := health.NewHealthMonitor()
+	healthMonitor.SetResilienceConfig(resilience)
+	healthMonitor.SetAuth(health.AuthConfig{
+		Username:    os.Getenv("ADMIN_USERNAME"),
+		Password:    os.Getenv("ADMIN_PASSWORD"),
+		BearerToken: os.Getenv("ADMIN_TOKEN"),
+	})
 	if err := healthMonitor.Start(); err != nil {
 		errors.Warning("Failed to start health monitor", err, "health")
 	}
@@ -47,54 +92,87 @@ func main() {
 		return nginx.CreateDefaultDirectories()
 	}, "startup", "creating necessary directories"); err != nil {
 		errors.Critical("Failed to create directories after retries", err, "startup")
-		return
+		return 1
 	}
 
+	// Permissions of generated certificate files
+	certPerms := nginx.DefaultCertPermissions()
+	uid, gid, err := provider.ParseFileOwner(os.Getenv("FILE_OWNER"))
+	if err != nil {
+		errors.Critical("Invalid FILE_OWNER", err, "startup")
+		return 1
+	}
+	certPerms.UID, certPerms.GID = uid, gid
+	if keyMode := os.Getenv("SSL_KEY_MODE"); keyMode != "" {
+		mode, err := provider.ParseFileMode(keyMode)
+		if err != nil {
+			errors.Critical("Invalid SSL_KEY_MODE", err, "startup")
+			return 1
+		}
+		certPerms.KeyMode = mode
+	}
+
+	// Default certificate of TLS hosts, generated when missing
+	defaultCertPath := getEnvOrDefault("DEFAULT_CERT_PATH", nginx.DefaultSSLCertPath)
+	defaultKeyPath := getEnvOrDefault("DEFAULT_KEY_PATH", nginx.DefaultSSLKeyPath)
+
 	// Generate default SSL certificate with retry
 	if err := errorHandler.HandleWithRetry(func() error {
-		return nginx.GenerateDefaultSSLCert()
+		return nginx.GenerateSSLCert(defaultCertPath, defaultKeyPath, certPerms)
 	}, "startup", "generating SSL certificate"); err != nil {
 		errors.Warning("Failed to generate SSL certificate, continuing without it", err, "startup")
 		// Continue without SSL - not critical for basic functionality
 	}
+	
+	// Without a default certificate every TLS host would fail to load, so
+	// turn TLS off once here instead of failing host by host later
+	disableTLS := !nginx.SSLCertAvailable(defaultCertPath, defaultKeyPath)
+	if disableTLS {
+		errors.ErrorMsg(fmt.Sprintf("No default SSL certificate at %s, TLS is disabled for all hosts and they are served over HTTP only", defaultCertPath), nil, "startup")
+	}
 
 	// Create nginx manager
 	nginxManager := nginx.NewManager(nginx.Config{
 		BinaryPath:  getEnvOrDefault("NGINX_BINARY", "nginx"),
 		ConfigPath:  "/etc/nginx/nginx.conf",
 		PidFilePath: "/var/run/nginx.pid",
+		WorkerProcesses: getEnvOrDefault("WORKER_PROCESSES", "auto"),
+		Resilience:  resilience,
 	})
 
+	// A wrong NGINX_BINARY is a configuration error, fail before anything
+	// retries running it
+	if err := nginxManager.CheckBinary(); err != nil {
+		errors.Critical("Nginx binary is not usable, check NGINX_BINARY", err, "startup")
+		return 1
+	}
+
 	log.Println("🔍 Testing nginx configuration...")
 	
-	// Create Docker client with retry
-	var cli *client.Client
+	// Create Docker clients with retry
+	var cli provider.DockerAPI
+	var clients []*client.Client
 	if err := errorHandler.HandleWithRetry(func() error {
 		var err error
-		cli, err = client.NewClientWithOpts(
-			client.FromEnv,
-			client.WithAPIVersionNegotiation(),
-		)
+		cli, clients, err = newDockerAPI()
 		return err
 	}, "docker", "creating Docker client"); err != nil {
 		errors.Critical("Failed to create Docker client after retries", err, "docker")
-		return
+		return 1
 	}
 	defer func() {
-		if cli != nil {
-			if err := cli.Close(); err != nil {
+		for _, c := range clients {
+			if err := c.Close(); err != nil {
 				errors.Warning("Failed to close Docker client", err, "docker")
 			}
 		}
 	}()
 
-	// Test Docker connection with retry
-	if err := errorHandler.HandleWithRetry(func() error {
-		_, err := cli.Info(ctx)
-		return err
-	}, "docker", "testing Docker connection"); err != nil {
-		errors.Critical("Failed to connect to Docker after retries", err, "docker")
-		return
+	// Wait for Docker with its own startup window, it may come up after us
+	startupTimeout := getEnvDuration("DOCKER_STARTUP_TIMEOUT", provider.DefaultDockerStartupTimeout)
+	if err := provider.WaitForDocker(ctx, cli, startupTimeout); err != nil {
+		errors.Critical("Failed to connect to Docker", err, "docker")
+		return 1
 	}
 	log.Printf("✅ Docker socket is accessible")
 
@@ -111,8 +189,11 @@ func main() {
 		return nil
 	}, 15*time.Second)
 
+	// Surface retry failures and an open circuit breaker as degraded health
+	healthMonitor.WatchErrorHandler("error-handler", errorHandler, 15*time.Second)
+
 	// Create custom onConfigChange callback that uses nginx manager
-	onConfigChangeWithReload := func(config *provider.NginxConfig) {
+	onConfigChangeWithReload := func(config *provider.NginxConfig, _ provider.ConfigDiff) {
 		log.Printf("📝 Nginx configuration updated with %d upstreams and %d servers",
 			len(config.Upstreams), len(config.Servers))
 
@@ -136,6 +217,44 @@ func main() {
 		NginxBinary:     getEnvOrDefault("NGINX_BINARY", "nginx"),
 		ReloadCommand:   []string{"nginx", "-s", "reload"}, // Still used for config testing
 		SnippetCacheDir: getEnvOrDefault("SNIPPET_CACHE_DIR", "/tmp/nginx-ingress-snippets"),
+		DisableSnippetCache: getEnvOrDefault("DISABLE_SNIPPET_CACHE", "false") == "true",
+		ServerSnippetPolicy:        getEnvOrDefault("SERVER_SNIPPET_POLICY", "fail-open"),
+		ConfigurationSnippetPolicy: getEnvOrDefault("CONFIGURATION_SNIPPET_POLICY", "fail-open"),
+		LabelMatchMode:  getEnvOrDefault("LABEL_MATCH_MODE", "any"),
+		ExcludeContainerPatterns: splitEnvList(os.Getenv("EXCLUDE_CONTAINERS")),
+		EmptyConfigMode: getEnvOrDefault("EMPTY_CONFIG_MODE", "empty"),
+		Resolver:        getEnvOrDefault("DNS_RESOLVER", "127.0.0.11"),
+		UpstreamResolveMode: getEnvOrDefault("UPSTREAM_RESOLVE_MODE", "continuous"),
+		BindAddress:     os.Getenv("BIND_ADDRESS"),
+		ProxyProtocol:   getEnvOrDefault("PROXY_PROTOCOL", "false") == "true",
+		DisableTLS:      disableTLS,
+		TrustedProxies:  splitEnvList(os.Getenv("TRUSTED_PROXIES")),
+		SSLProtocols:    splitEnvList(os.Getenv("SSL_PROTOCOLS")),
+		SSLCiphers:      os.Getenv("SSL_CIPHERS"),
+		DefaultCertPath: defaultCertPath,
+		DefaultKeyPath:  defaultKeyPath,
+		ProxyCacheDir:   getEnvOrDefault("PROXY_CACHE_DIR", "/var/cache/nginx/ingress"),
+		UpstreamZoneSize: os.Getenv("UPSTREAM_ZONE_SIZE"),
+		SkipConfigTest:  getEnvOrDefault("SKIP_CONFIG_TEST", "false") == "true",
+		DockerTimeout:   getEnvDuration("DOCKER_TIMEOUT", provider.DefaultDockerTimeout),
+		InspectConcurrency: getEnvInt("INSPECT_CONCURRENCY", 4),
+		RestartingGracePeriod: getEnvDuration("RESTARTING_GRACE_PERIOD", 2*time.Minute),
+		InvalidContainerPolicy: getEnvOrDefault("INVALID_CONTAINER_POLICY", "warn"),
+		ReadinessMode:   getEnvOrDefault("READINESS_MODE", "off"),
+		ReadinessTimeout: getEnvDuration("READINESS_TIMEOUT", provider.DefaultReadinessTimeout),
+		WatchNetworkEvents: getEnvOrDefault("WATCH_NETWORK_EVENTS", "false") == "true",
+		EventDebounce:   getEnvDuration("EVENT_DEBOUNCE", provider.DefaultEventDebounce),
+		FileMode:        os.Getenv("FILE_MODE"),
+		FileOwner:       os.Getenv("FILE_OWNER"),
+		LabelFile:       os.Getenv("LABEL_FILE"),
+		LogRenderedConfig: getEnvOrDefault("LOG_RENDERED_CONFIG", "false") == "true",
+		ConfigHistoryDir:  os.Getenv("CONFIG_HISTORY_DIR"),
+		ConfigHistoryLimit: getEnvInt("CONFIG_HISTORY_LIMIT", provider.DefaultConfigHistoryLimit),
+		DefaultBackendStatus: getEnvInt("DEFAULT_BACKEND_STATUS", 404),
+		DisableDefaultBackend: getEnvOrDefault("DISABLE_DEFAULT_BACKEND", "false") == "true",
+		LabelDefaults:   labelDefaultsFromEnv(),
+		Resilience:      resilience,
+		RetryAfter:      getEnvInt("UNAVAILABLE_RETRY_AFTER", provider.DefaultRetryAfter),
 		OnConfigChange:  onConfigChangeWithReload,
 		OnError:         onProviderError,
 	}
@@ -144,24 +263,95 @@ func main() {
 	dockerProvider, err := provider.NewProvider(cli, providerConfig)
 	if err != nil {
 		errors.Critical("Failed to create Docker provider", err, "provider")
-		return
+		return 1
 	}
 
+	// Containers skipped for invalid labels make health degraded
+	healthMonitor.RegisterStatusComponent("containers", func() (health.HealthStatus, error) {
+		if invalid := dockerProvider.InvalidContainers(); len(invalid) > 0 {
+			return health.Degraded, fmt.Errorf("%d container(s) skipped with invalid configuration, see /admin/invalid-containers", len(invalid))
+		}
+		return health.Healthy, nil
+	}, 15*time.Second)
+
+	// Admin endpoints
+	healthMonitor.RegisterAdminHandler("/admin/reload-status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, dockerProvider.GetReloadStatus())
+	})
+	healthMonitor.RegisterAdminHandler("/admin/routes", func(w http.ResponseWriter, r *http.Request) {
+		routes := provider.RoutesFromConfig(dockerProvider.GetCurrentConfig())
+		if routes == nil {
+			routes = []provider.RouteStatus{}
+		}
+		writeJSON(w, routes)
+	})
+	healthMonitor.RegisterAdminHandler("/admin/invalid-containers", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, dockerProvider.InvalidContainers())
+	})
+	healthMonitor.RegisterAdminHandler("/admin/snippets", func(w http.ResponseWriter, r *http.Request) {
+		cached, err := dockerProvider.ListCachedSnippets()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, cached)
+	})
+	healthMonitor.RegisterAdminHandler("/admin/snippets/stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, dockerProvider.SnippetCacheStats())
+	})
+	healthMonitor.RegisterAdminHandler("/admin/snippets/validate", func(w http.ResponseWriter, r *http.Request) {
+		results, err := dockerProvider.ValidateCachedSnippets()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, results)
+	})
+	healthMonitor.RegisterAdminHandler("/debug/bundle", debugBundleHandler(dockerProvider, healthMonitor))
+	healthMonitor.RegisterAdminHandler("/admin/pause", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		dockerProvider.Pause()
+		writeJSON(w, map[string]bool{"paused": true})
+	})
+	healthMonitor.RegisterAdminHandler("/admin/resume", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := dockerProvider.Resume(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]bool{"paused": false})
+	})
+
 	log.Println("✅ Nginx configuration is valid")
 
 	// Display configuration
 	log.Println("📋 Configuration:")
 	log.Printf("   • Nginx config: %s", providerConfig.NginxConfigPath)
 	log.Printf("   • Nginx binary: %s", providerConfig.NginxBinary)
-	log.Printf("   • Docker socket: %s", getEnvOrDefault("DOCKER_HOST", "unix:///var/run/docker.sock"))
+	if hosts := splitEnvList(os.Getenv("DOCKER_HOSTS")); len(hosts) > 0 {
+		log.Printf("   • Docker hosts: %s", strings.Join(hosts, ", "))
+	} else {
+		log.Printf("   • Docker socket: %s", getEnvOrDefault("DOCKER_HOST", "unix:///var/run/docker.sock"))
+	}
 
+	// In wait mode, hold nginx back until every host has a reachable backend
+	if err := dockerProvider.WaitForBackends(); err != nil {
+		errors.Warning("Backends not ready, starting nginx anyway", err, "startup")
+	}
+	
 	// Start nginx process with retry
 	log.Println("🚀 Starting nginx process...")
 	if err := errorHandler.HandleWithRetry(func() error {
 		return nginxManager.Start()
 	}, "nginx", "starting nginx process"); err != nil {
 		errors.Critical("Failed to start nginx after retries", err, "nginx")
-		return
+		return 1
 	}
 
 	// Start provider in a goroutine with error handling
@@ -192,11 +382,25 @@ func main() {
 	containers := dockerProvider.GetContainers()
 	displayContainerStatus(containers)
 
-	// Wait for shutdown signal
-	<-sigChan
+	// Wait for shutdown signal or a critical error
+	exitCode := 0
+	select {
+	case <-sigChan:
+	case err := <-criticalChan:
+		log.Printf("💥 Critical error: %v", err)
+		exitCode = 1
+	}
 	fmt.Println()
 	log.Println("🛑 Shutting down gracefully...")
 
+	// Freeze reconciliation and let an in-flight reload finish, so nothing
+	// reloads nginx after it is stopped
+	if dockerProvider.Quiesce(10 * time.Second) {
+		log.Println("✅ Docker provider paused")
+	} else {
+		log.Println("⚠️ Timed out waiting for an in-flight configuration update")
+	}
+
 	// Stop nginx gracefully
 	if err := nginxManager.Stop(); err != nil {
 		errors.Warning("Error stopping nginx", err, "nginx")
@@ -211,13 +415,133 @@ func main() {
 		log.Println("✅ Docker provider stopped successfully")
 	}
 
-	// Stop goroutine pool
-	pool.Stop()
+	// Stop goroutine pool, without hanging on routines that never return
+	if !pool.StopWithTimeout(10 * time.Second) {
+		log.Println("⚠️ Some background routines did not stop in time")
+	}
 
 	log.Println("👋 Local Nginx Ingress Controller stopped")
+	return exitCode
 }
 
 
+// runValidate checks the labels of running containers and prints a report
+// without starting nginx. It returns the process exit code.
+func runValidate() int {
+	cli, clients, err := newDockerAPI()
+	if err != nil {
+		log.Printf("❌ Failed to create Docker client: %v", err)
+		return 2
+	}
+	defer func() {
+		for _, c := range clients {
+			c.Close()
+		}
+	}()
+
+	matchMode, err := provider.ParseLabelMatchMode(getEnvOrDefault("LABEL_MATCH_MODE", "any"))
+	if err != nil {
+		log.Printf("❌ %v", err)
+		return 2
+	}
+
+	excludePatterns := splitEnvList(os.Getenv("EXCLUDE_CONTAINERS"))
+	if err := provider.ValidateExcludePatterns(excludePatterns); err != nil {
+		log.Printf("❌ %v", err)
+		return 2
+	}
+
+	var fileLabels map[string]map[string]string
+	if path := os.Getenv("LABEL_FILE"); path != "" {
+		labelFile, err := provider.NewLabelFile(path)
+		if err != nil {
+			log.Printf("❌ %v", err)
+			return 2
+		}
+		fileLabels = labelFile.Labels()
+	}
+
+	labelDefaults := labelDefaultsFromEnv()
+	if err := labelDefaults.Validate(); err != nil {
+		log.Printf("❌ %v", err)
+		return 2
+	}
+
+	results, err := provider.ValidateContainers(context.Background(), cli, provider.ListOptions{
+		MatchMode:       matchMode,
+		Defaults:        labelDefaults,
+		FileLabels:      fileLabels,
+		ExcludePatterns: excludePatterns,
+	})
+	if err != nil {
+		log.Printf("❌ Failed to validate containers: %v", err)
+		return 2
+	}
+
+	fmt.Print(provider.FormatValidationReport(results))
+
+	for _, result := range results {
+		if !result.Valid() {
+			return 1
+		}
+	}
+	return 0
+}
+
+// runStatus fetches the routes of a running controller from its admin
+// endpoint and prints them as a table, or as JSON with --json
+func runStatus(args []string) int {
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print routes as JSON")
+	adminURL := flags.String("url", getEnvOrDefault("ADMIN_URL", "http://localhost:8080"), "admin endpoint of the running controller")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(*adminURL, "/")+"/admin/routes", nil)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		return 2
+	}
+	if token := os.Getenv("ADMIN_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if username := os.Getenv("ADMIN_USERNAME"); username != "" {
+		req.SetBasicAuth(username, os.Getenv("ADMIN_PASSWORD"))
+	}
+
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		log.Printf("❌ Failed to reach controller at %s: %v", *adminURL, err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("❌ Controller returned %s", resp.Status)
+		return 1
+	}
+
+	var routes []provider.RouteStatus
+	if err := json.NewDecoder(resp.Body).Decode(&routes); err != nil {
+		log.Printf("❌ Failed to decode routes: %v", err)
+		return 1
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(routes); err != nil {
+			log.Printf("❌ %v", err)
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Print(provider.FormatRouteTable(routes))
+	return 0
+}
+
 // onProviderError is called when provider encounters an error
 func onProviderError(err error) {
 	errors.ErrorMsg("Provider encountered an error", err, "provider")
@@ -251,6 +575,150 @@ func displayContainerStatus(containers []*provider.ContainerData) {
 	}
 }
 
+// splitEnvList splits a comma-separated environment value, dropping empty entries
+func splitEnvList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// labelDefaultsFromEnv reads the defaults for omitted protocol, port, path
+// and priority labels; unset values keep the built-in defaults
+func labelDefaultsFromEnv() provider.LabelDefaults {
+	return provider.LabelDefaults{
+		Protocol: os.Getenv("DEFAULT_PROTOCOL"),
+		Port:     getEnvInt("DEFAULT_PORT", 0),
+		Path:     os.Getenv("DEFAULT_PATH"),
+		Priority: getEnvInt("DEFAULT_PRIORITY", 0),
+	}
+}
+
+// getEnvDuration reads a duration like "90s" from the environment, falling
+// back to defaultValue when unset or invalid
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("⚠️ Invalid %s=%q, using %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
+// newDockerAPI connects to every daemon listed in DOCKER_HOSTS, aggregated
+// into one API, or to the daemon of the standard DOCKER_HOST environment
+// when it is unset. The clients are returned so they can be closed.
+func newDockerAPI() (provider.DockerAPI, []*client.Client, error) {
+	clientConfig := provider.ClientConfig{
+		Host:      os.Getenv("DOCKER_HOST"),
+		TLSVerify: os.Getenv("DOCKER_TLS_VERIFY") != "",
+		CertPath:  os.Getenv("DOCKER_CERT_PATH"),
+	}
+	
+	hosts := splitEnvList(os.Getenv("DOCKER_HOSTS"))
+	if len(hosts) == 0 {
+		cli, err := provider.NewClient(clientConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+		return cli, []*client.Client{cli}, nil
+	}
+	
+	// Containers of remote hosts are routed through their published ports
+	// unless every host's container network is routable from nginx
+	routeByContainerIP := getEnvOrDefault("DOCKER_HOSTS_ROUTING", "published") == "container-ip"
+	
+	var clients []*client.Client
+	var endpoints []provider.DockerEndpoint
+	for _, host := range hosts {
+		hostConfig := clientConfig
+		hostConfig.Host = host
+		cli, err := provider.NewClient(hostConfig)
+		if err != nil {
+			for _, c := range clients {
+				c.Close()
+			}
+			return nil, nil, fmt.Errorf("docker host %s: %w", host, err)
+		}
+		clients = append(clients, cli)
+		endpoint := provider.DockerEndpoint{Host: host, API: cli}
+		if !routeByContainerIP {
+			endpoint.Address = provider.EndpointAddress(host)
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	
+	api, err := provider.NewMultiDockerAPI(endpoints)
+	if err != nil {
+		return nil, nil, err
+	}
+	return api, clients, nil
+}
+
+// resilienceFromEnv reads retry and circuit breaker overrides. Unset or
+// invalid values are zero and keep each handler's built-in default.
+func resilienceFromEnv() errors.ResilienceConfig {
+	return errors.ResilienceConfig{
+		RetryAttempts:           getEnvPositiveInt("RETRY_ATTEMPTS"),
+		RetryDelay:              getEnvPositiveDuration("RETRY_DELAY"),
+		ErrorThreshold:          getEnvPositiveInt("ERROR_THRESHOLD"),
+		CircuitFailureThreshold: getEnvPositiveInt("CIRCUIT_FAILURE_THRESHOLD"),
+		CircuitTimeout:          getEnvPositiveDuration("CIRCUIT_TIMEOUT"),
+	}
+}
+
+// getEnvPositiveInt reads an integer greater than zero, returning 0 when the
+// variable is unset or invalid
+func getEnvPositiveInt(key string) int {
+	n := getEnvInt(key, 0)
+	if n < 0 {
+		log.Printf("⚠️ Invalid %s=%d, must be positive, using the default", key, n)
+		return 0
+	}
+	return n
+}
+
+// getEnvPositiveDuration reads a duration greater than zero, returning 0 when
+// the variable is unset or invalid
+func getEnvPositiveDuration(key string) time.Duration {
+	d := getEnvDuration(key, 0)
+	if d < 0 {
+		log.Printf("⚠️ Invalid %s=%s, must be positive, using the default", key, d)
+		return 0
+	}
+	return d
+}
+
+// getEnvInt returns an integer environment variable or the default when it is
+// unset or not a number
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("⚠️ Invalid %s=%q, using %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+// writeJSON writes value as a JSON response
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		errors.Warning("Failed to encode admin response", err, "health")
+	}
+}
+
 // getEnvOrDefault returns environment variable value or default
 func getEnvOrDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -0,0 +1,63 @@
+package errors
+
+import (
+	"io"
+	"strings"
+	"sync/atomic"
+)
+
+// emojiTags replaces the emoji used in log messages with plain-text tags.
+// Emoji with a variation selector come first so the selector is dropped too.
+var emojiTags = strings.NewReplacer(
+	"ℹ️", "[INFO]",
+	"⚠️", "[WARN]",
+	"ℹ", "[INFO]",
+	"⚠", "[WARN]",
+	"✅", "[OK]",
+	"❌", "[ERROR]",
+	"💥", "[CRIT]",
+	"❓", "[UNKNOWN]",
+	"🔄", "[RETRY]",
+	"🐳", "[START]",
+	"🚀", "[START]",
+	"🔍", "[CHECK]",
+	"📝", "[CONFIG]",
+	"📋", "[INFO]",
+	"📡", "[INFO]",
+	"📊", "[INFO]",
+	"🛑", "[STOP]",
+	"👋", "[STOP]",
+)
+
+// noEmoji makes severity prefixes plain-text tags
+var noEmoji atomic.Bool
+
+// SetNoEmoji switches log prefixes from emoji to plain-text tags such as
+// [OK], [WARN] and [CRIT], for log aggregators and terminals that can't
+// render emoji
+func SetNoEmoji(enabled bool) {
+	noEmoji.Store(enabled)
+}
+
+// PlainText replaces the emoji of a log message with plain-text tags
+func PlainText(message string) string {
+	return emojiTags.Replace(message)
+}
+
+// plainTextWriter replaces emoji with plain-text tags before writing
+type plainTextWriter struct {
+	w io.Writer
+}
+
+func (p plainTextWriter) Write(b []byte) (int, error) {
+	if _, err := io.WriteString(p.w, PlainText(string(b))); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// PlainTextWriter wraps w so that emoji written to it become plain-text
+// tags, e.g. for log.SetOutput
+func PlainTextWriter(w io.Writer) io.Writer {
+	return plainTextWriter{w: w}
+}
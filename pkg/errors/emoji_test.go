@@ -0,0 +1,84 @@
+package errors
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPlainText(t *testing.T) {
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{"✅ Nginx configuration written", "[OK] Nginx configuration written"},
+		{"⚠️ retrying", "[WARN] retrying"},
+		{"⚠ retrying", "[WARN] retrying"},
+		{"ℹ️ info", "[INFO] info"},
+		{"💥 crashed", "[CRIT] crashed"},
+		{"❌ failed", "[ERROR] failed"},
+		{"🐳 Starting controller", "[START] Starting controller"},
+		{"🛑 Shutting down", "[STOP] Shutting down"},
+		{"no emoji here", "no emoji here"},
+		{"🔄 reload ✅ done", "[RETRY] reload [OK] done"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			if got := PlainText(tt.message); got != tt.want {
+				t.Errorf("PlainText(%q) = %q, want %q", tt.message, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlainTextWriter(t *testing.T) {
+	var buf bytes.Buffer
+	message := "✅ Nginx configuration written\n"
+	n, err := PlainTextWriter(&buf).Write([]byte(message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(message) {
+		t.Errorf("Write returned %d, want the %d bytes given", n, len(message))
+	}
+	if got := buf.String(); got != "[OK] Nginx configuration written\n" {
+		t.Errorf("wrote %q", got)
+	}
+}
+
+func TestSeverityPrefix(t *testing.T) {
+	tests := []struct {
+		severity ErrorSeverity
+		emoji    string
+		tag      string
+	}{
+		{SeverityInfo, "ℹ️", "[INFO]"},
+		{SeverityWarning, "⚠️", "[WARN]"},
+		{SeverityError, "❌", "[ERROR]"},
+		{SeverityCritical, "💥", "[CRIT]"},
+	}
+
+	for _, noEmoji := range []bool{false, true} {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s/no emoji %v", severityName(tt.severity), noEmoji), func(t *testing.T) {
+				SetNoEmoji(noEmoji)
+				t.Cleanup(func() { SetNoEmoji(false) })
+				logged := captureLog(t)
+				eh := newTestHandler()
+				eh.SetShutdownFunc(func(*StructuredError) {})
+
+				eh.Handle(eh.NewError("failed", nil, tt.severity, "test"))
+				want, unwanted := tt.emoji, tt.tag
+				if noEmoji {
+					want, unwanted = tt.tag, tt.emoji
+				}
+				first, _, _ := strings.Cut(logged.String(), "\n")
+				if !strings.Contains(first, want+" [") || strings.Contains(first, unwanted) {
+					t.Errorf("log lacks the %q prefix:\n%s", want, first)
+				}
+			})
+		}
+	}
+}
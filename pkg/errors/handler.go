@@ -1,12 +1,14 @@
 package errors
 
 import (
+	stderrors "errors"
 	"fmt"
 	"log"
 	"os"
 	"runtime"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
@@ -44,6 +46,30 @@ func (e *StructuredError) Unwrap() error {
 	return e.Cause
 }
 
+// nonRetryableError marks an error that retrying can't fix
+type nonRetryableError struct {
+	err error
+}
+
+func (e *nonRetryableError) Error() string { return e.err.Error() }
+func (e *nonRetryableError) Unwrap() error { return e.err }
+
+// NonRetryable marks err so HandleWithRetry gives up on it immediately, for
+// failures such as configuration errors that the next attempt would repeat
+func NonRetryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &nonRetryableError{err: err}
+}
+
+// IsNonRetryable reports whether err, or an error it wraps, was marked with
+// NonRetryable
+func IsNonRetryable(err error) bool {
+	var target *nonRetryableError
+	return stderrors.As(err, &target)
+}
+
 // ErrorHandler manages error handling and recovery
 type ErrorHandler struct {
 	exitOnCritical    bool
@@ -51,19 +77,50 @@ type ErrorHandler struct {
 	retryDelay       time.Duration
 	circuitBreaker   *CircuitBreaker
 	errorThreshold   int // Number of errors before triggering circuit breaker
+	
+	// Handlers are shared by goroutines, countMu guards the error count
+	countMu          sync.Mutex
 	errorCount       int // Current error count
 	lastResetTime    time.Time
+	resetWindow      time.Duration // Interval after which the error count and circuit breaker reset
+	now              func() time.Time
+	shutdownFunc     func(*StructuredError) // Invoked on critical errors when exitOnCritical is set
+}
+
+// DefaultResetWindow is how long errors count towards degraded mode by default
+const DefaultResetWindow = 5 * time.Minute
+
+// ErrorHandlerOption configures an ErrorHandler at construction
+type ErrorHandlerOption func(*ErrorHandler)
+
+// WithResetWindow sets the interval after which the error count resets
+func WithResetWindow(window time.Duration) ErrorHandlerOption {
+	return func(eh *ErrorHandler) {
+		eh.resetWindow = window
+	}
+}
+
+// WithClock replaces time.Now, mainly for tests
+func WithClock(now func() time.Time) ErrorHandlerOption {
+	return func(eh *ErrorHandler) {
+		eh.now = now
+	}
 }
 
 // NewErrorHandler creates a new error handler
-func NewErrorHandler() *ErrorHandler {
+func NewErrorHandler(opts ...ErrorHandlerOption) *ErrorHandler {
 	eh := &ErrorHandler{
 		exitOnCritical:  true,
 		retryAttempts:   3,
 		retryDelay:     5 * time.Second,
 		errorThreshold: 10, // Allow 10 errors before circuit breaking
-		lastResetTime:  time.Now(),
+		resetWindow:    DefaultResetWindow,
+		now:            time.Now,
 	}
+	for _, opt := range opts {
+		opt(eh)
+	}
+	eh.lastResetTime = eh.now()
 	eh.circuitBreaker = NewCircuitBreaker(3, 30*time.Second) // 3 failures, 30s timeout
 	return eh
 }
@@ -73,25 +130,87 @@ func (eh *ErrorHandler) SetExitOnCritical(exit bool) {
 	eh.exitOnCritical = exit
 }
 
+// SetShutdownFunc configures the callback invoked on critical errors when
+// exitOnCritical is set. The default asks the process to terminate gracefully
+// by sending itself SIGTERM.
+func (eh *ErrorHandler) SetShutdownFunc(fn func(*StructuredError)) {
+	eh.shutdownFunc = fn
+}
+
 // SetRetryConfig configures retry behavior
 func (eh *ErrorHandler) SetRetryConfig(attempts int, delay time.Duration) {
 	eh.retryAttempts = attempts
 	eh.retryDelay = delay
 }
 
+// ResilienceConfig overrides the retry and circuit breaker settings of an
+// ErrorHandler. Zero fields keep the handler's current value.
+type ResilienceConfig struct {
+	RetryAttempts           int           // Attempts per operation including the first (1 disables retries)
+	RetryDelay              time.Duration // Base delay of the quadratic backoff between attempts
+	ErrorThreshold          int           // Errors before warnings escalate; half of it means degraded mode
+	CircuitFailureThreshold int           // Consecutive failed operations that open the circuit breaker
+	CircuitTimeout          time.Duration // How long the circuit stays open before a trial operation
+}
+
+// ApplyResilienceConfig sets the non-zero fields of config on the handler
+func (eh *ErrorHandler) ApplyResilienceConfig(config ResilienceConfig) {
+	if config.RetryAttempts > 0 {
+		eh.retryAttempts = config.RetryAttempts - 1
+	}
+	if config.RetryDelay > 0 {
+		eh.retryDelay = config.RetryDelay
+	}
+	if config.ErrorThreshold > 0 {
+		eh.errorThreshold = config.ErrorThreshold
+	}
+	if config.CircuitFailureThreshold > 0 || config.CircuitTimeout > 0 {
+		eh.circuitBreaker.SetConfig(config.CircuitFailureThreshold, config.CircuitTimeout)
+	}
+}
+
 // SetErrorThreshold configures error threshold for degraded mode detection
 func (eh *ErrorHandler) SetErrorThreshold(threshold int) {
 	eh.errorThreshold = threshold
 }
 
+// SetResetWindow configures the interval after which the error count and
+// circuit breaker are reset
+func (eh *ErrorHandler) SetResetWindow(window time.Duration) {
+	eh.resetWindow = window
+}
+
+// resetIfExpired clears the error count and circuit breaker once the reset
+// window has passed since the last reset. It must be called with countMu held.
+func (eh *ErrorHandler) resetIfExpired() {
+	if eh.now().Sub(eh.lastResetTime) <= eh.resetWindow {
+		return
+	}
+	eh.errorCount = 0
+	eh.lastResetTime = eh.now()
+	eh.circuitBreaker.Reset()
+}
+
+// countError counts an error in the current reset window and returns the count
+func (eh *ErrorHandler) countError() int {
+	eh.countMu.Lock()
+	defer eh.countMu.Unlock()
+	eh.resetIfExpired()
+	eh.errorCount++
+	return eh.errorCount
+}
+
 // GetErrorCount returns the current error count
 func (eh *ErrorHandler) GetErrorCount() int {
+	eh.countMu.Lock()
+	defer eh.countMu.Unlock()
+	eh.resetIfExpired()
 	return eh.errorCount
 }
 
 // IsInDegradedMode returns true if the system is in degraded mode
 func (eh *ErrorHandler) IsInDegradedMode() bool {
-	return eh.errorCount > eh.errorThreshold/2
+	return eh.GetErrorCount() > eh.errorThreshold/2
 }
 
 // GetCircuitBreakerState returns the current circuit breaker state
@@ -124,15 +243,8 @@ func (eh *ErrorHandler) Handle(err *StructuredError) {
 	// Log the error
 	eh.logError(err)
 	
-	// Increment error count for tracking
-	eh.errorCount++
-	
-	// Reset error count periodically (every 5 minutes)
-	if time.Since(eh.lastResetTime) > 5*time.Minute {
-		eh.errorCount = 0
-		eh.lastResetTime = time.Now()
-		eh.circuitBreaker.Reset() // Reset circuit breaker periodically
-	}
+	// Reset error count periodically (every reset window), then count this error
+	errorCount := eh.countError()
 	
 	// Take action based on severity
 	switch err.Severity {
@@ -141,28 +253,47 @@ func (eh *ErrorHandler) Handle(err *StructuredError) {
 	case SeverityWarning:
 		// Log warning, continue execution
 		// Check if we're getting too many warnings
-		if eh.errorCount > eh.errorThreshold {
-			log.Printf("⚠️ High warning count (%d), consider investigating", eh.errorCount)
+		if errorCount > eh.errorThreshold {
+			log.Printf("⚠️ High warning count (%d), consider investigating", errorCount)
 		}
 	case SeverityError:
 		// Log error, may affect functionality but continue
 		// Consider degraded mode if too many errors
-		if eh.errorCount > eh.errorThreshold/2 {
-			log.Printf("❌ High error count (%d), system may be in degraded state", eh.errorCount)
+		if errorCount > eh.errorThreshold/2 {
+			log.Printf("❌ High error count (%d), system may be in degraded state", errorCount)
 		}
 	case SeverityCritical:
 		// Log critical error, may exit application
 		if eh.exitOnCritical {
 			log.Printf("💥 Critical error encountered, shutting down gracefully...")
-			os.Exit(1)
+			if eh.shutdownFunc != nil {
+				eh.shutdownFunc(err)
+			} else {
+				requestShutdown(err)
+			}
 		} else {
 			log.Printf("💥 Critical error encountered but continuing due to graceful recovery mode")
 		}
 	}
 }
 
-// HandleWithRetry attempts to retry a function on error with circuit breaker protection
+// requestShutdown is the default shutdown callback: it signals the process so
+// the application's signal handling can run its normal graceful shutdown
+func requestShutdown(err *StructuredError) {
+	process, findErr := os.FindProcess(os.Getpid())
+	if findErr == nil {
+		findErr = process.Signal(syscall.SIGTERM)
+	}
+	if findErr != nil {
+		log.Printf("💥 Failed to request shutdown: %v", findErr)
+	}
+}
+
+// HandleWithRetry attempts to retry a function on error with circuit breaker
+// protection. Errors marked with NonRetryable end the attempts right away.
 func (eh *ErrorHandler) HandleWithRetry(operation func() error, component string, description string) error {
+	attempts := 0
+	
 	// Use circuit breaker to protect against cascading failures
 	returnErr := eh.circuitBreaker.Execute(func() error {
 		var lastErr error
@@ -178,6 +309,7 @@ func (eh *ErrorHandler) HandleWithRetry(operation func() error, component string
 				time.Sleep(backoffDelay)
 			}
 			
+			attempts++
 			if err := operation(); err != nil {
 				lastErr = err
 				structuredErr := eh.NewError(
@@ -187,6 +319,9 @@ func (eh *ErrorHandler) HandleWithRetry(operation func() error, component string
 					component,
 				)
 				eh.logError(structuredErr)
+				if IsNonRetryable(err) {
+					break
+				}
 				continue
 			}
 			
@@ -203,10 +338,10 @@ func (eh *ErrorHandler) HandleWithRetry(operation func() error, component string
 	
 	if returnErr != nil {
 		// Increment error count for potential circuit breaking at higher level
-		eh.errorCount++
+		eh.countError()
 		
 		finalErr := eh.NewError(
-			fmt.Sprintf("Failed %s after %d attempts", description, eh.retryAttempts+1),
+			fmt.Sprintf("Failed %s after %d attempts", description, attempts),
 			returnErr,
 			SeverityError,
 			component,
@@ -216,7 +351,9 @@ func (eh *ErrorHandler) HandleWithRetry(operation func() error, component string
 	}
 	
 	// Reset error count on success
+	eh.countMu.Lock()
 	eh.errorCount = 0
+	eh.countMu.Unlock()
 	return nil
 }
 
@@ -250,6 +387,7 @@ func (eh *ErrorHandler) logError(err *StructuredError) {
 	
 	// Basic error information
 	log.Printf("%s [%s] %s: %s", severity, timestamp, err.Component, err.Error())
+	recordError(err)
 	
 	// Add context if available
 	if len(err.Context) > 0 {
@@ -271,20 +409,27 @@ func (eh *ErrorHandler) logError(err *StructuredError) {
 	}
 }
 
-// getSeverityEmoji returns an emoji for the error severity
+// getSeverityEmoji returns an emoji for the error severity, or its
+// plain-text tag in no-emoji mode
 func (eh *ErrorHandler) getSeverityEmoji(severity ErrorSeverity) string {
+	var emoji string
 	switch severity {
 	case SeverityInfo:
-		return "ℹ️"
+		emoji = "ℹ️"
 	case SeverityWarning:
-		return "⚠️"
+		emoji = "⚠️"
 	case SeverityError:
-		return "❌"
+		emoji = "❌"
 	case SeverityCritical:
-		return "💥"
+		emoji = "💥"
 	default:
-		return "❓"
+		emoji = "❓"
+	}
+	
+	if noEmoji.Load() {
+		return PlainText(emoji)
 	}
+	return emoji
 }
 
 // Convenience functions
@@ -308,6 +453,25 @@ func (eh *ErrorHandler) Critical(message string, cause error, component string)
 	eh.Handle(err)
 }
 
+// WarningWithContext handles a warning carrying additional context fields
+func (eh *ErrorHandler) WarningWithContext(message string, cause error, component string, context map[string]interface{}) {
+	eh.handleWithContext(message, cause, SeverityWarning, component, context)
+}
+
+// ErrorWithContext handles an error carrying additional context fields
+func (eh *ErrorHandler) ErrorWithContext(message string, cause error, component string, context map[string]interface{}) {
+	eh.handleWithContext(message, cause, SeverityError, component, context)
+}
+
+// handleWithContext builds a structured error with the given context and handles it
+func (eh *ErrorHandler) handleWithContext(message string, cause error, severity ErrorSeverity, component string, context map[string]interface{}) {
+	err := eh.NewError(message, cause, severity, component)
+	for key, value := range context {
+		err.AddContext(key, value)
+	}
+	eh.Handle(err)
+}
+
 // AddContext adds context information to an error
 func (e *StructuredError) AddContext(key string, value interface{}) *StructuredError {
 	e.Context[key] = value
@@ -373,11 +537,24 @@ func NewCircuitBreaker(failureThreshold int, timeout time.Duration) *CircuitBrea
 	}
 }
 
-// Execute runs the operation through the circuit breaker
-func (cb *CircuitBreaker) Execute(operation func() error) error {
+// SetConfig changes the failure threshold and open timeout; values <= 0
+// keep the current setting
+func (cb *CircuitBreaker) SetConfig(failureThreshold int, timeout time.Duration) {
 	cb.mu.Lock()
 	defer cb.mu.Unlock()
 	
+	if failureThreshold > 0 {
+		cb.failureThreshold = failureThreshold
+	}
+	if timeout > 0 {
+		cb.timeout = timeout
+	}
+}
+
+// Execute runs the operation through the circuit breaker. The lock isn't held
+// while the operation runs, so operations may themselves use the breaker.
+func (cb *CircuitBreaker) Execute(operation func() error) error {
+	cb.mu.Lock()
 	// Check if circuit should be reset from open to half-open
 	if cb.state == Open && time.Since(cb.lastFailureTime) > cb.timeout {
 		cb.state = HalfOpen
@@ -386,12 +563,17 @@ func (cb *CircuitBreaker) Execute(operation func() error) error {
 	
 	// Fail fast if circuit is open
 	if cb.state == Open {
+		cb.mu.Unlock()
 		return fmt.Errorf("circuit breaker is open")
 	}
+	cb.mu.Unlock()
 	
 	// Execute the operation
 	err := operation()
 	
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	
 	// Handle result
 	if err != nil {
 		cb.failureCount++
@@ -0,0 +1,284 @@
+package errors
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable clock for WithClock
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestHandler(opts ...ErrorHandlerOption) *ErrorHandler {
+	eh := NewErrorHandler(opts...)
+	eh.SetExitOnCritical(false)
+	return eh
+}
+
+func TestErrorCountResetWindow(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  time.Duration
+		advance time.Duration
+		want    int
+	}{
+		{"within window", time.Minute, 30 * time.Second, 3},
+		{"at window", time.Minute, time.Minute, 3},
+		{"past window", time.Minute, time.Minute + time.Second, 0},
+		{"default window", 0, 4 * time.Minute, 3},
+		{"past default window", 0, DefaultResetWindow + time.Second, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Unix(1700000000, 0)}
+			opts := []ErrorHandlerOption{WithClock(clock.Now)}
+			if tt.window > 0 {
+				opts = append(opts, WithResetWindow(tt.window))
+			}
+			eh := newTestHandler(opts...)
+
+			for i := 0; i < 3; i++ {
+				eh.Handle(eh.NewError("failed", fmt.Errorf("boom"), SeverityError, "test"))
+			}
+			clock.Advance(tt.advance)
+			if got := eh.GetErrorCount(); got != tt.want {
+				t.Errorf("GetErrorCount() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetResetWindow(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	eh := newTestHandler(WithClock(clock.Now))
+	eh.SetResetWindow(10 * time.Second)
+
+	eh.Handle(eh.NewError("failed", nil, SeverityError, "test"))
+	clock.Advance(11 * time.Second)
+	eh.Handle(eh.NewError("failed", nil, SeverityError, "test"))
+
+	if got := eh.GetErrorCount(); got != 1 {
+		t.Errorf("GetErrorCount() = %d, want 1 after the window reset", got)
+	}
+}
+
+func TestDegradedMode(t *testing.T) {
+	eh := newTestHandler()
+	eh.SetErrorThreshold(4)
+
+	for i := 1; i <= 3; i++ {
+		eh.Handle(eh.NewError("failed", nil, SeverityError, "test"))
+		if got, want := eh.IsInDegradedMode(), i > 2; got != want {
+			t.Errorf("after %d errors IsInDegradedMode() = %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestHandleConcurrently(t *testing.T) {
+	eh := newTestHandler()
+	const goroutines, perGoroutine = 8, 25
+
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perGoroutine; j++ {
+				eh.Handle(eh.NewError("failed", nil, SeverityInfo, "test"))
+				eh.IsInDegradedMode()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := eh.GetErrorCount(); got != goroutines*perGoroutine {
+		t.Errorf("GetErrorCount() = %d, want %d", got, goroutines*perGoroutine)
+	}
+}
+
+func TestHandleWithRetryStopsOnNonRetryable(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		calls int
+	}{
+		{"retryable", fmt.Errorf("temporary"), 3},
+		{"non-retryable", NonRetryable(fmt.Errorf("binary not found")), 1},
+		{"wrapped non-retryable", fmt.Errorf("reload: %w", NonRetryable(fmt.Errorf("binary not found"))), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eh := newTestHandler()
+			eh.SetRetryConfig(2, time.Millisecond)
+
+			calls := 0
+			err := eh.HandleWithRetry(func() error {
+				calls++
+				return tt.err
+			}, "test", "running")
+			if err == nil {
+				t.Fatal("expected HandleWithRetry to fail")
+			}
+			if calls != tt.calls {
+				t.Errorf("operation ran %d times, want %d", calls, tt.calls)
+			}
+		})
+	}
+}
+
+// captureLog redirects the standard logger to a buffer for the rest of the test
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	previous := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(previous) })
+	return &buf
+}
+
+func TestHandleWithContext(t *testing.T) {
+	tests := []struct {
+		name     string
+		handle   func(eh *ErrorHandler, context map[string]interface{})
+		severity string
+	}{
+		{"warning", func(eh *ErrorHandler, context map[string]interface{}) {
+			eh.WarningWithContext("failed to inspect container", fmt.Errorf("boom"), "docker-provider", context)
+		}, "warning"},
+		{"error", func(eh *ErrorHandler, context map[string]interface{}) {
+			eh.ErrorWithContext("failed to inspect container", fmt.Errorf("boom"), "docker-provider", context)
+		}, "error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logged := captureLog(t)
+			eh := newTestHandler()
+			tt.handle(eh, map[string]interface{}{"container": "web", "event": "start"})
+
+			if !strings.Contains(logged.String(), "Context: map[container:web event:start]") {
+				t.Errorf("log lacks the context:\n%s", logged)
+			}
+			if got := eh.GetErrorCount(); got != 1 {
+				t.Errorf("GetErrorCount() = %d, want 1", got)
+			}
+			recent := RecentErrors()
+			if last := recent[len(recent)-1]; last.Severity != tt.severity || last.Component != "docker-provider" {
+				t.Errorf("last recent error = %+v, want a %s from docker-provider", last, tt.severity)
+			}
+		})
+	}
+}
+
+func TestCriticalErrorShutdown(t *testing.T) {
+	tests := []struct {
+		name         string
+		exit         bool
+		severity     ErrorSeverity
+		wantShutdown bool
+	}{
+		{"critical error requests shutdown", true, SeverityCritical, true},
+		{"critical error in recovery mode", false, SeverityCritical, false},
+		{"error never shuts down", true, SeverityError, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eh := NewErrorHandler()
+			eh.SetExitOnCritical(tt.exit)
+			var shutdown []*StructuredError
+			eh.SetShutdownFunc(func(err *StructuredError) { shutdown = append(shutdown, err) })
+
+			err := eh.NewError("config lost", fmt.Errorf("boom"), tt.severity, "test")
+			eh.Handle(err)
+
+			if got := len(shutdown) > 0; got != tt.wantShutdown {
+				t.Fatalf("shutdown requested = %v, want %v", got, tt.wantShutdown)
+			}
+			if tt.wantShutdown && shutdown[0] != err {
+				t.Errorf("shutdown called with %v, want %v", shutdown[0], err)
+			}
+		})
+	}
+}
+
+func TestApplyResilienceConfig(t *testing.T) {
+	// settings are an ErrorHandler's retry and circuit breaker settings
+	type settings struct {
+		retryAttempts    int
+		retryDelay       time.Duration
+		errorThreshold   int
+		failureThreshold int
+		circuitTimeout   time.Duration
+	}
+	defaults := settings{3, 5 * time.Second, 10, 3, 30 * time.Second}
+
+	tests := []struct {
+		name   string
+		config ResilienceConfig
+		want   settings
+	}{
+		{"zero keeps defaults", ResilienceConfig{}, defaults},
+		{"retries", ResilienceConfig{RetryAttempts: 5, RetryDelay: time.Second}, settings{4, time.Second, 10, 3, 30 * time.Second}},
+		{"single attempt disables retries", ResilienceConfig{RetryAttempts: 1}, settings{0, 5 * time.Second, 10, 3, 30 * time.Second}},
+		{"error threshold", ResilienceConfig{ErrorThreshold: 20}, settings{3, 5 * time.Second, 20, 3, 30 * time.Second}},
+		{"circuit threshold only", ResilienceConfig{CircuitFailureThreshold: 5}, settings{3, 5 * time.Second, 10, 5, 30 * time.Second}},
+		{"circuit timeout only", ResilienceConfig{CircuitTimeout: time.Minute}, settings{3, 5 * time.Second, 10, 3, time.Minute}},
+		{
+			name:   "everything",
+			config: ResilienceConfig{RetryAttempts: 3, RetryDelay: time.Millisecond, ErrorThreshold: 4, CircuitFailureThreshold: 2, CircuitTimeout: time.Second},
+			want:   settings{2, time.Millisecond, 4, 2, time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eh := newTestHandler()
+			eh.ApplyResilienceConfig(tt.config)
+
+			got := settings{eh.retryAttempts, eh.retryDelay, eh.errorThreshold, eh.circuitBreaker.failureThreshold, eh.circuitBreaker.timeout}
+			if got != tt.want {
+				t.Errorf("settings = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyResilienceConfigOpensCircuit(t *testing.T) {
+	eh := newTestHandler()
+	eh.ApplyResilienceConfig(ResilienceConfig{RetryAttempts: 1, CircuitFailureThreshold: 1, CircuitTimeout: time.Hour})
+
+	calls := 0
+	failing := func() error {
+		calls++
+		return fmt.Errorf("boom")
+	}
+	eh.HandleWithRetry(failing, "test", "running")
+	if got := eh.GetCircuitBreakerState(); got != Open {
+		t.Fatalf("circuit state = %v after one failed operation, want open", got)
+	}
+	eh.HandleWithRetry(failing, "test", "running")
+	if calls != 1 {
+		t.Errorf("operation ran %d times, want 1 with no retries and an open circuit", calls)
+	}
+}
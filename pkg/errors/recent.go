@@ -0,0 +1,69 @@
+package errors
+
+import (
+	"sync"
+	"time"
+)
+
+// recentErrorLimit is how many warnings and errors RecentErrors keeps
+const recentErrorLimit = 100
+
+// ErrorRecord is a logged warning, error or critical error kept for diagnostics
+type ErrorRecord struct {
+	Time      time.Time `json:"time"`
+	Severity  string    `json:"severity"`
+	Component string    `json:"component"`
+	Message   string    `json:"message"`
+}
+
+// recentErrors holds the last warnings and errors of every handler, oldest first
+var recentErrors struct {
+	mu      sync.Mutex
+	records []ErrorRecord
+}
+
+// recordError remembers a warning or worse for RecentErrors
+func recordError(err *StructuredError) {
+	if err.Severity < SeverityWarning {
+		return
+	}
+
+	recentErrors.mu.Lock()
+	defer recentErrors.mu.Unlock()
+	recentErrors.records = append(recentErrors.records, ErrorRecord{
+		Time:      err.Timestamp,
+		Severity:  severityName(err.Severity),
+		Component: err.Component,
+		Message:   err.Error(),
+	})
+	if overflow := len(recentErrors.records) - recentErrorLimit; overflow > 0 {
+		recentErrors.records = append([]ErrorRecord(nil), recentErrors.records[overflow:]...)
+	}
+}
+
+// RecentErrors returns the last warnings and errors logged by any handler,
+// oldest first
+func RecentErrors() []ErrorRecord {
+	recentErrors.mu.Lock()
+	defer recentErrors.mu.Unlock()
+
+	records := make([]ErrorRecord, len(recentErrors.records))
+	copy(records, recentErrors.records)
+	return records
+}
+
+// severityName returns the lower-case name of a severity
+func severityName(severity ErrorSeverity) string {
+	switch severity {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	case SeverityCritical:
+		return "critical"
+	default:
+		return "unknown"
+	}
+}
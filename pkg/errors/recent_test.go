@@ -0,0 +1,79 @@
+package errors
+
+import (
+	"fmt"
+	"testing"
+)
+
+// resetRecentErrors empties RecentErrors for the rest of the test
+func resetRecentErrors(t *testing.T) {
+	recentErrors.mu.Lock()
+	previous := recentErrors.records
+	recentErrors.records = nil
+	recentErrors.mu.Unlock()
+	t.Cleanup(func() {
+		recentErrors.mu.Lock()
+		recentErrors.records = previous
+		recentErrors.mu.Unlock()
+	})
+}
+
+func TestRecentErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		severity ErrorSeverity
+		count    int
+		want     int
+		wantName string
+	}{
+		{"info not kept", SeverityInfo, 3, 0, ""},
+		{"warnings", SeverityWarning, 3, 3, "warning"},
+		{"errors", SeverityError, 1, 1, "error"},
+		{"critical", SeverityCritical, 1, 1, "critical"},
+		{"oldest dropped past the limit", SeverityError, recentErrorLimit + 5, recentErrorLimit, "error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetRecentErrors(t)
+			captureLog(t)
+			eh := newTestHandler()
+			eh.SetShutdownFunc(func(*StructuredError) {})
+
+			for i := 0; i < tt.count; i++ {
+				eh.Handle(eh.NewError(fmt.Sprintf("failure %d", i), fmt.Errorf("boom"), tt.severity, "docker-provider"))
+			}
+
+			recent := RecentErrors()
+			if len(recent) != tt.want {
+				t.Fatalf("%d recent errors, want %d", len(recent), tt.want)
+			}
+			if tt.want == 0 {
+				return
+			}
+			// Oldest first, ending with the last one logged
+			first, last := recent[0], recent[len(recent)-1]
+			if want := fmt.Sprintf("failure %d: boom", tt.count-tt.want); first.Message != want {
+				t.Errorf("oldest message = %q, want %q", first.Message, want)
+			}
+			if want := fmt.Sprintf("failure %d: boom", tt.count-1); last.Message != want {
+				t.Errorf("newest message = %q, want %q", last.Message, want)
+			}
+			if last.Severity != tt.wantName || last.Component != "docker-provider" || last.Time.IsZero() {
+				t.Errorf("newest record = %+v, want a timestamped %s from docker-provider", last, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestRecentErrorsCopied(t *testing.T) {
+	resetRecentErrors(t)
+	captureLog(t)
+	eh := newTestHandler()
+	eh.Handle(eh.NewError("failed", nil, SeverityError, "test"))
+
+	RecentErrors()[0].Message = "changed"
+	if got := RecentErrors()[0].Message; got != "failed" {
+		t.Errorf("message = %q after changing a returned copy", got)
+	}
+}
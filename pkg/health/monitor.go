@@ -2,8 +2,12 @@ package health
 
 import (
 	"context"
+	"crypto/subtle"
 	"fmt"
+	"math/rand"
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -28,6 +32,7 @@ type ComponentHealth struct {
 	LastError      error
 	CheckInterval  time.Duration
 	HealthChecker  func() error
+	StatusChecker  func() (HealthStatus, error) // Reports a status directly instead of counting failures
 }
 
 // HealthMonitor monitors the health of various system components
@@ -38,6 +43,21 @@ type HealthMonitor struct {
 	cancel        context.CancelFunc
 	errorHandler  *errors.ErrorHandler
 	healthServer  *http.Server
+	mux           *http.ServeMux
+	auth          AuthConfig
+}
+
+// AuthConfig protects the admin endpoints with basic auth and/or a bearer token.
+// When neither is set the endpoints are unauthenticated.
+type AuthConfig struct {
+	Username    string
+	Password    string
+	BearerToken string
+}
+
+// Enabled reports whether any credentials are configured
+func (a AuthConfig) Enabled() bool {
+	return a.Username != "" || a.BearerToken != ""
 }
 
 // NewHealthMonitor creates a new health monitor
@@ -58,7 +78,8 @@ func NewHealthMonitor() *HealthMonitor {
 	// Set up health check HTTP server
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", hm.healthHandler)
-	mux.HandleFunc("/health/detailed", hm.detailedHealthHandler)
+	mux.HandleFunc("/health/detailed", hm.requireAuth(hm.detailedHealthHandler))
+	hm.mux = mux
 	
 	hm.healthServer = &http.Server{
 		Addr:    ":8080",
@@ -68,6 +89,66 @@ func NewHealthMonitor() *HealthMonitor {
 	return hm
 }
 
+// SetAuth configures credentials required by the admin endpoints. /health
+// stays unauthenticated so orchestrators can probe it.
+func (hm *HealthMonitor) SetAuth(auth AuthConfig) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	hm.auth = auth
+}
+
+// SetResilienceConfig overrides the retry and circuit breaker settings of
+// the monitor's own operations
+func (hm *HealthMonitor) SetResilienceConfig(config errors.ResilienceConfig) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	hm.errorHandler.ApplyResilienceConfig(config)
+}
+
+// RegisterAdminHandler adds an authenticated admin endpoint to the health server
+func (hm *HealthMonitor) RegisterAdminHandler(pattern string, handler http.HandlerFunc) {
+	hm.mux.HandleFunc(pattern, hm.requireAuth(handler))
+}
+
+// requireAuth wraps a handler so it only runs for authorized requests
+func (hm *HealthMonitor) requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hm.mu.RLock()
+		auth := hm.auth
+		hm.mu.RUnlock()
+		
+		if !auth.Enabled() || authorized(auth, r) {
+			next(w, r)
+			return
+		}
+		
+		if auth.Username != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="nginx-ingress admin"`)
+		}
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+	}
+}
+
+// authorized checks the request's basic auth credentials or bearer token
+func authorized(auth AuthConfig, r *http.Request) bool {
+	if auth.BearerToken != "" {
+		if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found &&
+			subtle.ConstantTimeCompare([]byte(token), []byte(auth.BearerToken)) == 1 {
+			return true
+		}
+	}
+	
+	if auth.Username != "" {
+		if username, password, ok := r.BasicAuth(); ok &&
+			subtle.ConstantTimeCompare([]byte(username), []byte(auth.Username)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(password), []byte(auth.Password)) == 1 {
+			return true
+		}
+	}
+	
+	return false
+}
+
 // RegisterComponent registers a component for health monitoring
 func (hm *HealthMonitor) RegisterComponent(name string, checker func() error, interval time.Duration) {
 	hm.mu.Lock()
@@ -87,6 +168,48 @@ func (hm *HealthMonitor) RegisterComponent(name string, checker func() error, in
 	go hm.monitorComponent(component)
 }
 
+// RegisterStatusComponent registers a component whose checker reports its
+// status directly, for internal state that is degraded rather than failing
+func (hm *HealthMonitor) RegisterStatusComponent(name string, checker func() (HealthStatus, error), interval time.Duration) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	
+	component := &ComponentHealth{
+		Name:          name,
+		Status:        Healthy,
+		CheckInterval: interval,
+		StatusChecker: checker,
+		LastCheckTime: time.Now(),
+	}
+	
+	hm.components[name] = component
+	
+	go hm.monitorComponent(component)
+}
+
+// WatchErrorHandler registers an error handler as a pseudo-component that is
+// degraded while the handler is in degraded mode or its circuit breaker is
+// not closed
+func (hm *HealthMonitor) WatchErrorHandler(name string, eh *errors.ErrorHandler, interval time.Duration) {
+	hm.RegisterStatusComponent(name, func() (HealthStatus, error) {
+		return errorHandlerStatus(eh)
+	}, interval)
+}
+
+// errorHandlerStatus maps an error handler's internal state to a health status
+func errorHandlerStatus(eh *errors.ErrorHandler) (HealthStatus, error) {
+	switch eh.GetCircuitBreakerState() {
+	case errors.Open:
+		return Degraded, fmt.Errorf("circuit breaker is open")
+	case errors.HalfOpen:
+		return Degraded, fmt.Errorf("circuit breaker is half-open")
+	}
+	if eh.IsInDegradedMode() {
+		return Degraded, fmt.Errorf("error count %d is above the degraded threshold", eh.GetErrorCount())
+	}
+	return Healthy, nil
+}
+
 // Start starts the health monitor
 func (hm *HealthMonitor) Start() error {
 	defer errors.Recover("health-monitor")
@@ -122,17 +245,46 @@ func (hm *HealthMonitor) Stop() error {
 	return nil
 }
 
-// monitorComponent monitors a single component
+// Jitter spreads out checks of components registered with the same interval
+const (
+	checkJitterFraction = 0.1             // Up to 10% of the interval per tick
+	maxCheckJitter      = 5 * time.Second // Cap for long intervals
+)
+
+// checkJitter returns a random delay in [0, min(interval*fraction, maxCheckJitter))
+func checkJitter(interval time.Duration) time.Duration {
+	limit := time.Duration(float64(interval) * checkJitterFraction)
+	if limit > maxCheckJitter {
+		limit = maxCheckJitter
+	}
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(limit)))
+}
+
+// initialCheckDelay returns a random delay in [0, interval) before the first check
+func initialCheckDelay(interval time.Duration) time.Duration {
+	if interval <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(interval)))
+}
+
+// monitorComponent monitors a single component. The first check runs after a
+// random delay within one interval and every later check after the interval
+// plus a small jitter, so components don't probe in lockstep.
 func (hm *HealthMonitor) monitorComponent(component *ComponentHealth) {
 	defer errors.Recover("health-monitor")
 	
-	ticker := time.NewTicker(component.CheckInterval)
-	defer ticker.Stop()
+	timer := time.NewTimer(initialCheckDelay(component.CheckInterval))
+	defer timer.Stop()
 	
 	for {
 		select {
-		case <-ticker.C:
+		case <-timer.C:
 			hm.checkComponent(component)
+			timer.Reset(component.CheckInterval + checkJitter(component.CheckInterval))
 		case <-hm.ctx.Done():
 			return
 		}
@@ -146,6 +298,11 @@ func (hm *HealthMonitor) checkComponent(component *ComponentHealth) {
 	hm.mu.Lock()
 	defer hm.mu.Unlock()
 	
+	if component.StatusChecker != nil {
+		hm.checkStatusComponent(component)
+		return
+	}
+	
 	err := component.HealthChecker()
 	component.LastCheckTime = time.Now()
 	
@@ -172,6 +329,29 @@ func (hm *HealthMonitor) checkComponent(component *ComponentHealth) {
 	}
 }
 
+// checkStatusComponent records the status reported by a status checker.
+// Must be called with hm.mu held.
+func (hm *HealthMonitor) checkStatusComponent(component *ComponentHealth) {
+	status, err := component.StatusChecker()
+	component.LastCheckTime = time.Now()
+	
+	if status != component.Status {
+		if status == Healthy {
+			hm.errorHandler.Info(fmt.Sprintf("%s recovered", component.Name), "health")
+		} else {
+			hm.errorHandler.Warning(fmt.Sprintf("%s is degraded", component.Name), err, "health")
+		}
+	}
+	
+	if status == Healthy {
+		component.ErrorCount = 0
+	} else {
+		component.ErrorCount++
+	}
+	component.Status = status
+	component.LastError = err
+}
+
 // GetComponentHealth returns the health status of a specific component
 func (hm *HealthMonitor) GetComponentHealth(name string) (*ComponentHealth, bool) {
 	hm.mu.RLock()
@@ -187,6 +367,60 @@ func (hm *HealthMonitor) GetComponentHealth(name string) (*ComponentHealth, bool
 	return &copy, true
 }
 
+// ComponentReport is the JSON form of a component's health
+type ComponentReport struct {
+	Name       string    `json:"name"`
+	Status     string    `json:"status"`
+	ErrorCount int       `json:"error_count"`
+	LastError  string    `json:"last_error,omitempty"`
+	LastCheck  time.Time `json:"last_check"`
+}
+
+// HealthReport is the overall health and that of every component
+type HealthReport struct {
+	OverallStatus string            `json:"overall_status"`
+	Components    []ComponentReport `json:"components"`
+}
+
+// Report returns the current health of the system and its components,
+// sorted by component name
+func (hm *HealthMonitor) Report() HealthReport {
+	report := HealthReport{OverallStatus: hm.GetOverallHealth().String()}
+	
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+	for name, component := range hm.components {
+		entry := ComponentReport{
+			Name:       name,
+			Status:     component.Status.String(),
+			ErrorCount: component.ErrorCount,
+			LastCheck:  component.LastCheckTime,
+		}
+		if component.LastError != nil {
+			entry.LastError = component.LastError.Error()
+		}
+		report.Components = append(report.Components, entry)
+	}
+	sort.Slice(report.Components, func(i, j int) bool {
+		return report.Components[i].Name < report.Components[j].Name
+	})
+	return report
+}
+
+// String returns the lower-case name of a status
+func (s HealthStatus) String() string {
+	switch s {
+	case Healthy:
+		return "healthy"
+	case Degraded:
+		return "degraded"
+	case Unhealthy:
+		return "unhealthy"
+	default:
+		return "unknown"
+	}
+}
+
 // GetOverallHealth returns the overall system health
 func (hm *HealthMonitor) GetOverallHealth() HealthStatus {
 	hm.mu.RLock()
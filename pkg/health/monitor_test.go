@@ -0,0 +1,198 @@
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/menta2k/local-nginx-ingress/pkg/errors"
+)
+
+func TestAdminAuth(t *testing.T) {
+	basic := AuthConfig{Username: "admin", Password: "secret"}
+	token := AuthConfig{BearerToken: "tok3n"}
+	both := AuthConfig{Username: "admin", Password: "secret", BearerToken: "tok3n"}
+
+	tests := []struct {
+		name          string
+		auth          AuthConfig
+		path          string
+		setup         func(r *http.Request)
+		wantStatus    int
+		wantChallenge bool
+	}{
+		{name: "no auth configured", path: "/admin", wantStatus: http.StatusOK},
+		{name: "health stays open", auth: both, path: "/health", wantStatus: http.StatusOK},
+		{name: "basic auth missing", auth: basic, path: "/admin", wantStatus: http.StatusUnauthorized, wantChallenge: true},
+		{
+			name: "basic auth valid", auth: basic, path: "/admin",
+			setup:      func(r *http.Request) { r.SetBasicAuth("admin", "secret") },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "basic auth wrong password", auth: basic, path: "/admin",
+			setup:      func(r *http.Request) { r.SetBasicAuth("admin", "wrong") },
+			wantStatus: http.StatusUnauthorized, wantChallenge: true,
+		},
+		{
+			name: "bearer token valid", auth: token, path: "/admin",
+			setup:      func(r *http.Request) { r.Header.Set("Authorization", "Bearer tok3n") },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "bearer token wrong", auth: token, path: "/admin",
+			setup:      func(r *http.Request) { r.Header.Set("Authorization", "Bearer other") },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "token accepted alongside basic auth", auth: both, path: "/health/detailed",
+			setup:      func(r *http.Request) { r.Header.Set("Authorization", "Bearer tok3n") },
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hm := NewHealthMonitor()
+			hm.SetAuth(tt.auth)
+			hm.RegisterAdminHandler("/admin", func(w http.ResponseWriter, r *http.Request) {})
+
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.setup != nil {
+				tt.setup(r)
+			}
+			w := httptest.NewRecorder()
+			hm.mux.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("WWW-Authenticate") != ""; got != tt.wantChallenge {
+				t.Errorf("WWW-Authenticate sent = %v, want %v", got, tt.wantChallenge)
+			}
+		})
+	}
+}
+
+func TestCheckJitter(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		max      time.Duration
+	}{
+		{"zero interval", 0, 0},
+		{"short interval", 10 * time.Second, time.Second},
+		{"capped long interval", 10 * time.Minute, maxCheckJitter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if got := checkJitter(tt.interval); got < 0 || (got > 0 && got >= tt.max) {
+					t.Fatalf("checkJitter(%s) = %s, want in [0, %s)", tt.interval, got, tt.max)
+				}
+				if got := initialCheckDelay(tt.interval); got < 0 || (tt.interval > 0 && got >= tt.interval) {
+					t.Fatalf("initialCheckDelay(%s) = %s, want in [0, %s)", tt.interval, got, tt.interval)
+				}
+			}
+		})
+	}
+}
+
+func TestWatchErrorHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		setup      func(eh *errors.ErrorHandler)
+		wantStatus HealthStatus
+		wantError  string
+	}{
+		{"healthy handler", func(eh *errors.ErrorHandler) {}, Healthy, ""},
+		{"degraded mode", func(eh *errors.ErrorHandler) {
+			for i := 0; i < 3; i++ {
+				eh.Error("failed", fmt.Errorf("boom"), "test")
+			}
+		}, Degraded, "error count 3 is above the degraded threshold"},
+		{"circuit breaker open", func(eh *errors.ErrorHandler) {
+			eh.HandleWithRetry(func() error { return fmt.Errorf("boom") }, "test", "running")
+		}, Degraded, "circuit breaker is open"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eh := errors.NewErrorHandler()
+			eh.SetExitOnCritical(false)
+			eh.ApplyResilienceConfig(errors.ResilienceConfig{
+				RetryAttempts:           1,
+				ErrorThreshold:          4,
+				CircuitFailureThreshold: 1,
+				CircuitTimeout:          time.Hour,
+			})
+			tt.setup(eh)
+
+			hm := NewHealthMonitor()
+			t.Cleanup(func() { hm.Stop() })
+			hm.WatchErrorHandler("resilience", eh, time.Hour)
+			component := hm.components["resilience"]
+			hm.checkComponent(component)
+
+			got, _ := hm.GetComponentHealth("resilience")
+			if got.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", got.Status, tt.wantStatus)
+			}
+			gotError := ""
+			if got.LastError != nil {
+				gotError = got.LastError.Error()
+			}
+			if gotError != tt.wantError {
+				t.Errorf("last error = %q, want %q", gotError, tt.wantError)
+			}
+			if overall := hm.GetOverallHealth(); overall != tt.wantStatus {
+				t.Errorf("overall health = %s, want %s", overall, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		want     string
+		wantErr  string
+		overall  string
+	}{
+		{"healthy", 0, "healthy", "", "healthy"},
+		{"one failure", 1, "healthy", "boom", "healthy"},
+		{"degraded", 2, "degraded", "boom", "degraded"},
+		{"unhealthy", 5, "unhealthy", "boom", "unhealthy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hm := NewHealthMonitor()
+			t.Cleanup(func() { hm.Stop() })
+			hm.RegisterComponent("nginx", func() error { return fmt.Errorf("boom") }, time.Hour)
+			hm.RegisterComponent("docker", func() error { return nil }, time.Hour)
+			for i := 0; i < tt.failures; i++ {
+				hm.checkComponent(hm.components["nginx"])
+			}
+
+			report := hm.Report()
+			if report.OverallStatus != tt.overall {
+				t.Errorf("overall status = %q, want %q", report.OverallStatus, tt.overall)
+			}
+			if len(report.Components) != 2 || report.Components[0].Name != "docker" || report.Components[1].Name != "nginx" {
+				t.Fatalf("components = %+v, want docker and nginx in order", report.Components)
+			}
+			if docker := report.Components[0]; docker.Status != "healthy" || docker.ErrorCount != 0 || docker.LastError != "" {
+				t.Errorf("docker = %+v, want healthy", docker)
+			}
+			nginx := report.Components[1]
+			if nginx.Status != tt.want || nginx.ErrorCount != tt.failures || nginx.LastError != tt.wantErr {
+				t.Errorf("nginx = %+v, want %s with %d errors and last error %q", nginx, tt.want, tt.failures, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package nginx
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+)
+
+// Default paths of the self-signed certificate generated at startup
+const (
+	DefaultSSLCertPath = "/etc/nginx/ssl/default.crt"
+	DefaultSSLKeyPath  = "/etc/nginx/ssl/default.key"
+)
+
+// DefaultSSLCertAvailable reports whether the default certificate and key
+// exist and can be read
+func DefaultSSLCertAvailable() bool {
+	return SSLCertAvailable(DefaultSSLCertPath, DefaultSSLKeyPath)
+}
+
+// SSLCertAvailable reports whether the certificate and key exist and can be read
+func SSLCertAvailable(certPath, keyPath string) bool {
+	for _, path := range []string{certPath, keyPath} {
+		file, err := os.Open(path)
+		if err != nil {
+			return false
+		}
+		file.Close()
+	}
+	return true
+}
+
+// writeSelfSignedCert creates the same self-signed localhost certificate as
+// the openssl command with crypto/x509, for images without openssl
+func writeSelfSignedCert(certPath, keyPath string) error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Country:      []string{"US"},
+			Province:     []string{"State"},
+			Locality:     []string{"City"},
+			Organization: []string{"Organization"},
+			CommonName:   "localhost",
+		},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return fmt.Errorf("failed to write key: %w", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+	return nil
+}
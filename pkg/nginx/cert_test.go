@@ -0,0 +1,134 @@
+package nginx
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSSLCertAvailable(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := filepath.Join(dir, "default.crt"), filepath.Join(dir, "default.key")
+	for _, path := range []string{cert, key} {
+		if err := os.WriteFile(path, []byte("test"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	missing := filepath.Join(dir, "missing")
+
+	tests := []struct {
+		name      string
+		cert, key string
+		want      bool
+	}{
+		{"both readable", cert, key, true},
+		{"missing certificate", missing, key, false},
+		{"missing key", cert, missing, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SSLCertAvailable(tt.cert, tt.key); got != tt.want {
+				t.Errorf("SSLCertAvailable(%s, %s) = %v, want %v", tt.cert, tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateSSLCertWithoutOpenSSL(t *testing.T) {
+	t.Setenv("PATH", t.TempDir()) // no openssl to run
+
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "default.crt"), filepath.Join(dir, "default.key")
+	if err := GenerateSSLCert(certPath, keyPath, DefaultCertPermissions()); err != nil {
+		t.Fatalf("GenerateSSLCert: %v", err)
+	}
+	if !SSLCertAvailable(certPath, keyPath) {
+		t.Fatal("certificate not available after generation")
+	}
+
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("generated certificate and key don't match: %v", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Subject.CommonName != "localhost" || cert.VerifyHostname("localhost") != nil {
+		t.Errorf("certificate is for %q, want localhost", cert.Subject.CommonName)
+	}
+}
+
+func TestGenerateSSLCertFailure(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		cert, key string
+		wantErr   string
+	}{
+		{"directory can't be created", filepath.Join(file, "default.crt"), filepath.Join(file, "default.key"), "failed to create certificate directory"},
+		{"key can't be written", filepath.Join(dir, "default.crt"), dir, "in-process: failed to write key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := GenerateSSLCert(tt.cert, tt.key, DefaultCertPermissions())
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("GenerateSSLCert error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerateSSLCertPaths(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	dir := t.TempDir()
+	existingCert, existingKey := filepath.Join(dir, "existing.crt"), filepath.Join(dir, "existing.key")
+	for _, path := range []string{existingCert, existingKey} {
+		if err := os.WriteFile(path, []byte("existing"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		cert, key    string
+		wantExisting bool
+	}{
+		{"new directory", filepath.Join(dir, "tls", "default.crt"), filepath.Join(dir, "tls", "default.key"), false},
+		{"separate key directory", filepath.Join(dir, "certs", "default.crt"), filepath.Join(dir, "private", "default.key"), false},
+		{"existing certificate kept", existingCert, existingKey, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := GenerateSSLCert(tt.cert, tt.key, DefaultCertPermissions()); err != nil {
+				t.Fatalf("GenerateSSLCert: %v", err)
+			}
+			data, err := os.ReadFile(tt.cert)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(data) == "existing"; got != tt.wantExisting {
+				t.Errorf("existing certificate kept = %v, want %v", got, tt.wantExisting)
+			}
+			if !tt.wantExisting {
+				if _, err := tls.LoadX509KeyPair(tt.cert, tt.key); err != nil {
+					t.Errorf("generated certificate and key don't match: %v", err)
+				}
+			}
+		})
+	}
+}
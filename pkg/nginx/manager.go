@@ -6,6 +6,10 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
 	"sync"
 	"syscall"
 	"time"
@@ -13,11 +17,26 @@ import (
 	"github.com/menta2k/local-nginx-ingress/pkg/errors"
 )
 
+// ErrBinaryNotFound is returned when the nginx binary doesn't exist or isn't
+// executable
+var ErrBinaryNotFound = fmt.Errorf("nginx binary not found")
+
+// CheckBinary verifies that the nginx binary exists and is executable. The
+// error is non-retryable: a wrong binary path is a configuration error.
+func CheckBinary(path string) error {
+	if _, err := exec.LookPath(path); err != nil {
+		return errors.NonRetryable(fmt.Errorf("%w: %v", ErrBinaryNotFound, err))
+	}
+	return nil
+}
+
 // Manager manages the nginx process lifecycle
 type Manager struct {
 	binaryPath   string
 	configPath   string
 	pidFilePath  string
+	cmdTimeout   time.Duration
+	workers      string
 	cmd          *exec.Cmd
 	ctx          context.Context
 	cancel       context.CancelFunc
@@ -32,6 +51,17 @@ type Config struct {
 	BinaryPath  string // Path to nginx binary
 	ConfigPath  string // Path to main nginx.conf
 	PidFilePath string // Path to nginx.pid file
+	
+	// CommandTimeout bounds nginx -t invocations (default: 15s)
+	CommandTimeout time.Duration
+	
+	// WorkerProcesses sets worker_processes with -g: "auto" for one worker
+	// per available CPU or a number. Empty leaves it to nginx.conf.
+	WorkerProcesses string
+	
+	// Resilience overrides the retry and circuit breaker settings of nginx
+	// operations (default: 2 retries 3s apart)
+	Resilience errors.ResilienceConfig
 }
 
 // NewManager creates a new nginx manager
@@ -48,16 +78,22 @@ func NewManager(config Config) *Manager {
 	if config.PidFilePath == "" {
 		config.PidFilePath = "/var/run/nginx.pid"
 	}
+	if config.CommandTimeout <= 0 {
+		config.CommandTimeout = 15 * time.Second
+	}
 	
 	// Create error handler for nginx operations
 	errorHandler := errors.NewErrorHandler()
 	errorHandler.SetExitOnCritical(false) // Allow graceful recovery
 	errorHandler.SetRetryConfig(2, 3*time.Second)
+	errorHandler.ApplyResilienceConfig(config.Resilience)
 	
 	return &Manager{
 		binaryPath:   config.BinaryPath,
 		configPath:   config.ConfigPath,
 		pidFilePath:  config.PidFilePath,
+		cmdTimeout:   config.CommandTimeout,
+		workers:      config.WorkerProcesses,
 		ctx:          ctx,
 		cancel:       cancel,
 		stopChan:     make(chan struct{}, 1),
@@ -78,6 +114,12 @@ func (m *Manager) Start() error {
 		return err
 	}
 	
+	// A missing binary is a configuration error, not worth retrying
+	if err := m.CheckBinary(); err != nil {
+		m.errorHandler.Error("Nginx binary is not usable", err, "nginx")
+		return err
+	}
+	
 	// Test configuration first with retry
 	if err := m.errorHandler.HandleWithRetry(func() error {
 		return m.testConfig()
@@ -86,8 +128,13 @@ func (m *Manager) Start() error {
 		return fmt.Errorf("nginx configuration test failed: %w", err)
 	}
 	
+	directives, err := m.globalDirectives()
+	if err != nil {
+		return err
+	}
+	
 	// Create nginx command
-	m.cmd = exec.CommandContext(m.ctx, m.binaryPath, "-g", "daemon off;")
+	m.cmd = exec.CommandContext(m.ctx, m.binaryPath, "-g", directives)
 	
 	// Set up process group to handle child processes
 	m.cmd.SysProcAttr = &syscall.SysProcAttr{
@@ -98,7 +145,7 @@ func (m *Manager) Start() error {
 	m.cmd.Stdout = os.Stdout
 	m.cmd.Stderr = os.Stderr
 	
-	log.Printf("Starting nginx process: %s -g 'daemon off;'", m.binaryPath)
+	log.Printf("Starting nginx process: %s -g '%s'", m.binaryPath, directives)
 	
 	// Start process with retry
 	if err := m.errorHandler.HandleWithRetry(func() error {
@@ -217,6 +264,52 @@ func (m *Manager) Reload() error {
 	return nil
 }
 
+// workerProcessesDirective matches a worker_processes directive in nginx.conf
+var workerProcessesDirective = regexp.MustCompile(`(?m)^\s*worker_processes\s`)
+
+// globalDirectives returns the -g directives nginx is started with. A
+// worker_processes already in nginx.conf takes precedence, since nginx
+// rejects the duplicate.
+func (m *Manager) globalDirectives() (string, error) {
+	workers, err := ParseWorkerProcesses(m.workers)
+	if err != nil {
+		return "", err
+	}
+	if workers > 0 {
+		if content, err := os.ReadFile(m.configPath); err == nil && workerProcessesDirective.Match(content) {
+			log.Printf("Warning: worker_processes is set in %s, ignoring the configured %q", m.configPath, m.workers)
+			workers = 0
+		}
+	}
+	return buildGlobalDirectives(workers), nil
+}
+
+// buildGlobalDirectives renders the -g argument; workers of 0 leaves
+// worker_processes to nginx.conf
+func buildGlobalDirectives(workers int) string {
+	directives := "daemon off;"
+	if workers > 0 {
+		directives += fmt.Sprintf(" worker_processes %d;", workers)
+	}
+	return directives
+}
+
+// ParseWorkerProcesses resolves a worker process setting to a count: "auto"
+// is the number of CPUs available to the process, empty is 0 (unset)
+func ParseWorkerProcesses(value string) (int, error) {
+	switch value {
+	case "":
+		return 0, nil
+	case "auto":
+		return runtime.NumCPU(), nil
+	}
+	workers, err := strconv.Atoi(value)
+	if err != nil || workers < 1 {
+		return 0, fmt.Errorf("invalid worker processes %q, must be auto or a positive number", value)
+	}
+	return workers, nil
+}
+
 // IsRunning returns true if nginx is running
 func (m *Manager) IsRunning() bool {
 	m.mu.RLock()
@@ -224,10 +317,26 @@ func (m *Manager) IsRunning() bool {
 	return m.running
 }
 
-// testConfig tests the nginx configuration
+// CheckBinary verifies that the manager's nginx binary is usable
+func (m *Manager) CheckBinary() error {
+	return CheckBinary(m.binaryPath)
+}
+
+// testConfig tests the nginx configuration. A missing binary fails without
+// running the test, as a non-retryable error.
 func (m *Manager) testConfig() error {
-	cmd := exec.Command(m.binaryPath, "-t")
+	if err := m.CheckBinary(); err != nil {
+		return err
+	}
+	
+	ctx, cancel := context.WithTimeout(context.Background(), m.cmdTimeout)
+	defer cancel()
+	
+	cmd := exec.CommandContext(ctx, m.binaryPath, "-t")
 	if output, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			output = []byte(fmt.Sprintf("timed out after %v", m.cmdTimeout))
+		}
 		configErr := fmt.Errorf("configuration test failed: %s", string(output))
 		m.errorHandler.Warning("Nginx configuration test failed", configErr, "nginx")
 		return configErr
@@ -279,21 +388,55 @@ func CreateDefaultDirectories() error {
 	return nil
 }
 
+// CertPermissions controls the modes and owner of the generated certificate
+// files. A UID or GID of -1 leaves that part of the ownership unchanged.
+type CertPermissions struct {
+	KeyMode  os.FileMode
+	CertMode os.FileMode
+	UID      int
+	GID      int
+}
+
+// DefaultCertPermissions returns 0600 for the key and 0644 for the certificate
+func DefaultCertPermissions() CertPermissions {
+	return CertPermissions{KeyMode: 0600, CertMode: 0644, UID: -1, GID: -1}
+}
+
 // GenerateDefaultSSLCert generates a default self-signed SSL certificate
 func GenerateDefaultSSLCert() error {
+	return GenerateDefaultSSLCertWithPermissions(DefaultCertPermissions())
+}
+
+// GenerateDefaultSSLCertWithPermissions generates a default self-signed SSL
+// certificate with the given file modes and owner
+func GenerateDefaultSSLCertWithPermissions(perms CertPermissions) error {
+	return GenerateSSLCert(DefaultSSLCertPath, DefaultSSLKeyPath, perms)
+}
+
+// GenerateSSLCert generates a self-signed SSL certificate at certPath and
+// keyPath with the given file modes and owner. It uses openssl and falls back
+// to generating the certificate in-process when openssl fails.
+func GenerateSSLCert(certPath, keyPath string, perms CertPermissions) error {
 	defer errors.Recover("nginx-ssl")
 	
-	certPath := "/etc/nginx/ssl/default.crt"
-	keyPath := "/etc/nginx/ssl/default.key"
 	errorHandlerInstance := errors.NewErrorHandler()
 	
 	// Skip if certificate already exists
-	if _, err := os.Stat(certPath); err == nil {
+	if SSLCertAvailable(certPath, keyPath) {
 		errorHandlerInstance.Info("SSL certificate already exists, skipping generation", "nginx")
 		return nil
 	}
 	
-	log.Println("📋 Generating default SSL certificate...")
+	log.Printf("📋 Generating default SSL certificate at %s...", certPath)
+	
+	// Custom paths may live outside the directories created at startup
+	for _, dir := range []string{filepath.Dir(certPath), filepath.Dir(keyPath)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			dirErr := fmt.Errorf("failed to create certificate directory %s: %w", dir, err)
+			errorHandlerInstance.Error("Failed to create SSL certificate directory", dirErr, "nginx")
+			return dirErr
+		}
+	}
 	
 	cmd := exec.Command("openssl", "req", "-x509", "-nodes", "-newkey", "rsa:2048", "-days", "365",
 		"-keyout", keyPath,
@@ -301,22 +444,34 @@ func GenerateDefaultSSLCert() error {
 		"-subj", "/C=US/ST=State/L=City/O=Organization/CN=localhost")
 	
 	if err := cmd.Run(); err != nil {
-		certErr := fmt.Errorf("failed to generate SSL certificate: %w", err)
-		errorHandlerInstance.Error("Failed to generate SSL certificate", certErr, "nginx")
-		return certErr
+		log.Printf("⚠️ openssl failed (%v), generating the certificate in-process", err)
+		if genErr := writeSelfSignedCert(certPath, keyPath); genErr != nil {
+			certErr := fmt.Errorf("failed to generate SSL certificate: openssl: %v, in-process: %w", err, genErr)
+			errorHandlerInstance.Error("Failed to generate SSL certificate", certErr, "nginx")
+			return certErr
+		}
 	}
 	
 	// Set proper permissions
-	if err := os.Chmod(keyPath, 0600); err != nil {
+	if err := os.Chmod(keyPath, perms.KeyMode); err != nil {
 		permErr := fmt.Errorf("failed to set key file permissions: %w", err)
 		errorHandlerInstance.Warning("Failed to set SSL key permissions", permErr, "nginx")
 		return permErr
 	}
-	if err := os.Chmod(certPath, 0644); err != nil {
+	if err := os.Chmod(certPath, perms.CertMode); err != nil {
 		permErr := fmt.Errorf("failed to set cert file permissions: %w", err)
 		errorHandlerInstance.Warning("Failed to set SSL cert permissions", permErr, "nginx")
 		return permErr
 	}
+	if perms.UID >= 0 || perms.GID >= 0 {
+		for _, path := range []string{keyPath, certPath} {
+			if err := os.Chown(path, perms.UID, perms.GID); err != nil {
+				ownerErr := fmt.Errorf("failed to change owner of %s: %w", path, err)
+				errorHandlerInstance.Warning("Failed to set SSL file owner", ownerErr, "nginx")
+				return ownerErr
+			}
+		}
+	}
 	
 	log.Println("✅ Default SSL certificate generated")
 	errorHandlerInstance.Info("SSL certificate generated successfully", "nginx")
@@ -0,0 +1,177 @@
+package nginx
+
+import (
+	stderrors "errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/menta2k/local-nginx-ingress/pkg/errors"
+)
+
+func TestCheckBinary(t *testing.T) {
+	dir := t.TempDir()
+	executable := filepath.Join(dir, "nginx")
+	if err := os.WriteFile(executable, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	plain := filepath.Join(dir, "nginx.conf")
+	if err := os.WriteFile(plain, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{"executable", executable, false},
+		{"in PATH", "sh", false},
+		{"missing", filepath.Join(dir, "missing"), true},
+		{"not executable", plain, true},
+		{"missing in PATH", "no-such-nginx-binary", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckBinary(tt.path)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("CheckBinary(%q) = %v", tt.path, err)
+				}
+				return
+			}
+			if !stderrors.Is(err, ErrBinaryNotFound) {
+				t.Errorf("CheckBinary(%q) = %v, want ErrBinaryNotFound", tt.path, err)
+			}
+			if !errors.IsNonRetryable(err) {
+				t.Errorf("CheckBinary(%q) = %v, want a non-retryable error", tt.path, err)
+			}
+		})
+	}
+}
+
+// writeScript writes an executable shell script to dir and returns its path
+func writeScript(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigTestTimeout(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{name: "passing test", body: "exit 0"},
+		{name: "failing test", body: "echo 'bad directive'; exit 1", wantErr: "bad directive"},
+		{name: "hanging binary", body: "exec sleep 10", wantErr: "timed out after 100ms"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			binary := writeScript(t, dir, strings.ReplaceAll(tt.name, " ", "-"), tt.body)
+			m := NewManager(Config{BinaryPath: binary, CommandTimeout: 100 * time.Millisecond})
+
+			started := time.Now()
+			err := m.testConfig()
+			if elapsed := time.Since(started); elapsed > 5*time.Second {
+				t.Errorf("testConfig took %v", elapsed)
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("testConfig() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("testConfig() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerateSSLCertPermissions(t *testing.T) {
+	tests := []struct {
+		name  string
+		perms CertPermissions
+	}{
+		{"defaults", DefaultCertPermissions()},
+		{"restricted", CertPermissions{KeyMode: 0400, CertMode: 0640, UID: os.Getuid(), GID: os.Getgid()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			certPath, keyPath := filepath.Join(dir, "ssl", "default.crt"), filepath.Join(dir, "ssl", "default.key")
+			if err := GenerateSSLCert(certPath, keyPath, tt.perms); err != nil {
+				t.Fatalf("GenerateSSLCert: %v", err)
+			}
+
+			for path, want := range map[string]os.FileMode{certPath: tt.perms.CertMode, keyPath: tt.perms.KeyMode} {
+				info, err := os.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := info.Mode().Perm(); got != want {
+					t.Errorf("%s has mode %o, want %o", filepath.Base(path), got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGlobalDirectives(t *testing.T) {
+	auto := fmt.Sprintf("daemon off; worker_processes %d;", runtime.NumCPU())
+
+	tests := []struct {
+		name      string
+		workers   string
+		nginxConf string
+		want      string
+		wantErr   bool
+	}{
+		{name: "unset", want: "daemon off;"},
+		{name: "number", workers: "4", want: "daemon off; worker_processes 4;"},
+		{name: "auto", workers: "auto", want: auto},
+		{name: "nginx.conf takes precedence", workers: "4", nginxConf: "user nginx;\n  worker_processes 2;\n", want: "daemon off;"},
+		{name: "commented directive ignored", workers: "4", nginxConf: "# worker_processes 2;\n", want: "daemon off; worker_processes 4;"},
+		{name: "zero", workers: "0", wantErr: true},
+		{name: "invalid", workers: "many", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "nginx.conf")
+			if tt.nginxConf != "" {
+				if err := os.WriteFile(configPath, []byte(tt.nginxConf), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			m := NewManager(Config{ConfigPath: configPath, WorkerProcesses: tt.workers})
+
+			got, err := m.globalDirectives()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("globalDirectives() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("globalDirectives: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("globalDirectives() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
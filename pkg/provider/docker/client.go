@@ -0,0 +1,184 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/system"
+	"github.com/docker/docker/client"
+)
+
+// DockerAPI is the subset of the Docker client used by the provider, so
+// tests can inject a fake instead of talking to a real daemon
+type DockerAPI interface {
+	ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error)
+	ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error)
+	CopyFromContainer(ctx context.Context, containerID, srcPath string) (io.ReadCloser, container.PathStat, error)
+	Events(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error)
+	Info(ctx context.Context) (system.Info, error)
+}
+
+// The Docker SDK client satisfies DockerAPI
+var _ DockerAPI = (*client.Client)(nil)
+
+// ClientConfig selects the Docker daemon and its TLS settings. Empty fields
+// fall back to DOCKER_HOST, DOCKER_TLS_VERIFY and DOCKER_CERT_PATH.
+type ClientConfig struct {
+	Host      string // Daemon address, e.g. unix:///var/run/docker.sock or tcp://docker:2376
+	TLSVerify bool   // Verify the daemon certificate against ca.pem in CertPath
+	CertPath  string // Directory with ca.pem, cert.pem and key.pem for TLS
+}
+
+// ClientOptions returns the Docker client options for the config: the
+// environment first, then the configured host and TLS settings on top
+func (c ClientConfig) ClientOptions() ([]client.Opt, error) {
+	if c.TLSVerify && c.CertPath == "" {
+		return nil, fmt.Errorf("docker TLS verification needs a certificate path")
+	}
+	
+	opts := []client.Opt{client.FromEnv}
+	if c.Host != "" {
+		opts = append(opts, client.WithHost(c.Host))
+	}
+	if c.CertPath != "" {
+		opts = append(opts, client.WithTLSClientConfig(
+			filepath.Join(c.CertPath, "ca.pem"),
+			filepath.Join(c.CertPath, "cert.pem"),
+			filepath.Join(c.CertPath, "key.pem"),
+		))
+		if !c.TLSVerify {
+			opts = append(opts, skipTLSVerify)
+		}
+	}
+	return append(opts, client.WithAPIVersionNegotiation()), nil
+}
+
+// NewClient creates a Docker client for the config
+func NewClient(c ClientConfig) (*client.Client, error) {
+	opts, err := c.ClientOptions()
+	if err != nil {
+		return nil, err
+	}
+	return client.NewClientWithOpts(opts...)
+}
+
+// skipTLSVerify keeps the client certificate but doesn't verify the daemon's,
+// like DOCKER_CERT_PATH without DOCKER_TLS_VERIFY
+func skipTLSVerify(c *client.Client) error {
+	transport, ok := c.HTTPClient().Transport.(*http.Transport)
+	if !ok || transport.TLSClientConfig == nil {
+		return fmt.Errorf("cannot disable TLS verification on transport %T", c.HTTPClient().Transport)
+	}
+	transport.TLSClientConfig.InsecureSkipVerify = true
+	return nil
+}
+
+// DefaultDockerTimeout bounds each Docker API request
+const DefaultDockerTimeout = 10 * time.Second
+
+// timeoutDockerAPI bounds every request-response call to the Docker API with
+// a per-call timeout, retrying a timed-out call once, so a slow daemon yields
+// an error instead of stalling reconciliation. The event stream and file
+// copies are long-lived and passed through unchanged.
+type timeoutDockerAPI struct {
+	DockerAPI
+	timeout time.Duration
+}
+
+// WithTimeout wraps api so list, inspect and info calls time out after timeout
+func WithTimeout(api DockerAPI, timeout time.Duration) DockerAPI {
+	if timeout <= 0 {
+		return api
+	}
+	return &timeoutDockerAPI{DockerAPI: api, timeout: timeout}
+}
+
+// DefaultDockerStartupTimeout is how long startup waits for Docker to answer
+const DefaultDockerStartupTimeout = 2 * time.Minute
+
+// Backoff between Docker probes while waiting for it at startup
+const (
+	dockerStartupDelay    = time.Second
+	dockerStartupMaxDelay = 10 * time.Second
+)
+
+// WaitForDocker probes the Docker API until it answers, backing off between
+// attempts, so a controller booting before the daemon waits for it instead
+// of giving up. It returns the last error once timeout has passed; a timeout
+// <= 0 tries once.
+func WaitForDocker(ctx context.Context, api DockerAPI, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	delay := dockerStartupDelay
+	for attempt := 1; ; attempt++ {
+		callCtx, cancel := context.WithTimeout(ctx, DefaultDockerTimeout)
+		_, err := api.Info(callCtx)
+		cancel()
+		if err == nil {
+			if attempt > 1 {
+				log.Printf("Docker answered after %d attempts", attempt)
+			}
+			return nil
+		}
+		
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("docker not reachable within %v (%d attempts): %w", timeout, attempt, err)
+		}
+		wait := min(delay, remaining)
+		log.Printf("Docker not reachable yet, retrying in %v: %v", wait, err)
+		
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay = min(delay*2, dockerStartupMaxDelay)
+	}
+}
+
+// dockerCallAttempts is how often a timed-out call is tried in total
+const dockerCallAttempts = 2
+
+// withTimeout runs call with a per-attempt timeout, retrying after timeouts
+// while the parent context is still live
+func withTimeout[T any](ctx context.Context, timeout time.Duration, operation string, call func(context.Context) (T, error)) (T, error) {
+	var result T
+	var err error
+	for attempt := 1; attempt <= dockerCallAttempts; attempt++ {
+		callCtx, cancel := context.WithTimeout(ctx, timeout)
+		result, err = call(callCtx)
+		timedOut := callCtx.Err() == context.DeadlineExceeded
+		cancel()
+		
+		if err == nil || !timedOut || ctx.Err() != nil {
+			return result, err
+		}
+		log.Printf("Docker %s timed out after %v (attempt %d/%d)", operation, timeout, attempt, dockerCallAttempts)
+	}
+	return result, fmt.Errorf("docker %s timed out after %v: %w", operation, timeout, err)
+}
+
+func (t *timeoutDockerAPI) ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+	return withTimeout(ctx, t.timeout, "container list", func(ctx context.Context) ([]container.Summary, error) {
+		return t.DockerAPI.ContainerList(ctx, options)
+	})
+}
+
+func (t *timeoutDockerAPI) ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error) {
+	return withTimeout(ctx, t.timeout, "container inspect", func(ctx context.Context) (container.InspectResponse, error) {
+		return t.DockerAPI.ContainerInspect(ctx, containerID)
+	})
+}
+
+func (t *timeoutDockerAPI) Info(ctx context.Context) (system.Info, error) {
+	return withTimeout(ctx, t.timeout, "info", func(ctx context.Context) (system.Info, error) {
+		return t.DockerAPI.Info(ctx)
+	})
+}
@@ -0,0 +1,313 @@
+package docker
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/system"
+	"github.com/docker/docker/client"
+)
+
+// slowDocker is a fakeDocker whose list, inspect and info calls take
+// delays[i] on the i-th call (the last delay repeating), or until their
+// context ends
+type slowDocker struct {
+	*fakeDocker
+	delays []time.Duration
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (s *slowDocker) wait(ctx context.Context) error {
+	s.mu.Lock()
+	delay := s.delays[min(s.calls, len(s.delays)-1)]
+	s.calls++
+	s.mu.Unlock()
+
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *slowDocker) ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+	if err := s.wait(ctx); err != nil {
+		return nil, err
+	}
+	return s.fakeDocker.ContainerList(ctx, options)
+}
+
+func (s *slowDocker) ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error) {
+	if err := s.wait(ctx); err != nil {
+		return container.InspectResponse{}, err
+	}
+	return s.fakeDocker.ContainerInspect(ctx, containerID)
+}
+
+func TestWithTimeout(t *testing.T) {
+	const timeout = 20 * time.Millisecond
+	web := fakeContainer{Name: "web", IP: "172.18.0.2", Labels: map[string]string{LabelEnable: "true", LabelHost: "web.test"}}
+
+	operations := []struct {
+		name string
+		call func(ctx context.Context, api DockerAPI) error
+	}{
+		{"list", func(ctx context.Context, api DockerAPI) error {
+			_, err := api.ContainerList(ctx, container.ListOptions{})
+			return err
+		}},
+		{"inspect", func(ctx context.Context, api DockerAPI) error {
+			_, err := api.ContainerInspect(ctx, web.id())
+			return err
+		}},
+	}
+	tests := []struct {
+		name      string
+		delays    []time.Duration
+		wantErr   string
+		wantCalls int
+	}{
+		{"fast daemon", []time.Duration{0}, "", 1},
+		{"slow once is retried", []time.Duration{time.Second, 0}, "", 2},
+		{"slow daemon times out", []time.Duration{time.Second}, "timed out after 20ms", dockerCallAttempts},
+	}
+
+	for _, op := range operations {
+		for _, tt := range tests {
+			t.Run(op.name+"/"+tt.name, func(t *testing.T) {
+				slow := &slowDocker{fakeDocker: newFakeDocker(web), delays: tt.delays}
+				started := time.Now()
+				err := op.call(context.Background(), WithTimeout(slow, timeout))
+
+				checkError(t, err, tt.wantErr)
+				if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("err = %v, want it to wrap the deadline", err)
+				}
+				if slow.calls != tt.wantCalls {
+					t.Errorf("%d calls, want %d", slow.calls, tt.wantCalls)
+				}
+				if elapsed := time.Since(started); elapsed > 500*time.Millisecond {
+					t.Errorf("call took %v despite the %v timeout", elapsed, timeout)
+				}
+			})
+		}
+	}
+}
+
+func TestWithTimeoutParentCancelled(t *testing.T) {
+	slow := &slowDocker{fakeDocker: newFakeDocker(), delays: []time.Duration{time.Second}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := WithTimeout(slow, time.Minute).ContainerList(ctx, container.ListOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want the parent's cancellation", err)
+	}
+	if slow.calls != 1 {
+		t.Errorf("%d calls, want no retry once the parent is done", slow.calls)
+	}
+}
+
+func TestWithTimeoutDisabled(t *testing.T) {
+	docker := newFakeDocker()
+	if api := WithTimeout(docker, 0); api != DockerAPI(docker) {
+		t.Errorf("WithTimeout(api, 0) = %T, want api unwrapped", api)
+	}
+}
+
+// testCertificatePEM returns a self-signed CA certificate and its key, PEM
+// encoded
+func testCertificatePEM(t testing.TB) (cert, key []byte) {
+	t.Helper()
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "docker"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &private.PublicKey, private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeDockerCerts writes a self-signed certificate to dir as ca.pem,
+// cert.pem and key.pem, the layout of DOCKER_CERT_PATH
+func writeDockerCerts(t *testing.T, dir string) {
+	t.Helper()
+	cert, key := testCertificatePEM(t)
+	files := map[string][]byte{"ca.pem": cert, "cert.pem": cert, "key.pem": key}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestClientOptions(t *testing.T) {
+	certs := t.TempDir()
+	writeDockerCerts(t, certs)
+	empty := t.TempDir()
+
+	tests := []struct {
+		name       string
+		env        string // DOCKER_HOST
+		config     ClientConfig
+		wantErr    string
+		wantHost   string
+		wantTLS    bool
+		wantVerify bool
+	}{
+		{"environment fallback", "tcp://env.test:2375", ClientConfig{}, "", "tcp://env.test:2375", false, false},
+		{"default socket", "", ClientConfig{}, "", client.DefaultDockerHost, false, false},
+		{"host overrides environment", "tcp://env.test:2375", ClientConfig{Host: "tcp://docker.test:2375"}, "", "tcp://docker.test:2375", false, false},
+		{"unix socket", "", ClientConfig{Host: "unix:///run/user/1000/docker.sock"}, "", "unix:///run/user/1000/docker.sock", false, false},
+		{"verified TLS", "", ClientConfig{Host: "tcp://docker.test:2376", TLSVerify: true, CertPath: certs}, "", "tcp://docker.test:2376", true, true},
+		{"unverified TLS", "", ClientConfig{Host: "tcp://docker.test:2376", CertPath: certs}, "", "tcp://docker.test:2376", true, false},
+		{"verification without certificates", "", ClientConfig{Host: "tcp://docker.test:2376", TLSVerify: true}, "needs a certificate path", "", false, false},
+		{"missing certificates", "", ClientConfig{Host: "tcp://docker.test:2376", TLSVerify: true, CertPath: empty}, "ca.pem", "", false, false},
+		{"invalid host", "", ClientConfig{Host: "docker.test"}, "unable to parse docker host", "", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DOCKER_HOST", tt.env)
+			t.Setenv("DOCKER_TLS_VERIFY", "")
+			t.Setenv("DOCKER_CERT_PATH", "")
+			t.Setenv("DOCKER_API_VERSION", "")
+
+			// The client wraps its transport once every option is applied,
+			// so a last option captures it as the config's options left it
+			var transport *http.Transport
+			capture := func(c *client.Client) error {
+				transport, _ = c.HTTPClient().Transport.(*http.Transport)
+				return nil
+			}
+			opts, err := tt.config.ClientOptions()
+			var cli *client.Client
+			if err == nil {
+				cli, err = client.NewClientWithOpts(append(opts, capture)...)
+			}
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+			defer cli.Close()
+
+			if got := cli.DaemonHost(); got != tt.wantHost {
+				t.Errorf("DaemonHost() = %q, want %q", got, tt.wantHost)
+			}
+			if transport == nil {
+				t.Fatal("options left no *http.Transport")
+			}
+			tlsConfig := transport.TLSClientConfig
+			if got := tlsConfig != nil && len(tlsConfig.Certificates) > 0; got != tt.wantTLS {
+				t.Fatalf("client certificate configured = %v, want %v", got, tt.wantTLS)
+			}
+			if !tt.wantTLS {
+				return
+			}
+			if tlsConfig.RootCAs == nil {
+				t.Error("daemon CA not loaded")
+			}
+			if got := !tlsConfig.InsecureSkipVerify; got != tt.wantVerify {
+				t.Errorf("daemon certificate verified = %v, want %v", got, tt.wantVerify)
+			}
+		})
+	}
+}
+
+// startingDocker is a fakeDocker whose Info fails until it was called more
+// than failures times, like a daemon still booting
+type startingDocker struct {
+	*fakeDocker
+	failures int
+	calls    int
+}
+
+func (s *startingDocker) Info(ctx context.Context) (system.Info, error) {
+	s.calls++
+	if s.calls <= s.failures {
+		return system.Info{}, errors.New("connection refused")
+	}
+	return s.fakeDocker.Info(ctx)
+}
+
+func TestWaitForDocker(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		timeout   time.Duration
+		wantErr   string
+		wantCalls int
+		minWait   time.Duration
+	}{
+		{"answering", 0, time.Minute, "", 1, 0},
+		{"no timeout tries once", 0, 0, "", 1, 0},
+		{"down without timeout", 1, 0, "(1 attempts): connection refused", 1, 0},
+		{"comes up during the window", 2, time.Minute, "", 3, dockerStartupDelay * 3},
+		// Waits 1s, then the remaining 0.5s instead of the 2s backoff
+		{"down for the whole window", 100, 1500 * time.Millisecond, "not reachable within 1.5s (3 attempts)", 3, 1500 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			docker := &startingDocker{fakeDocker: newFakeDocker(), failures: tt.failures}
+			started := time.Now()
+			err := WaitForDocker(context.Background(), docker, tt.timeout)
+
+			checkError(t, err, tt.wantErr)
+			if docker.calls != tt.wantCalls {
+				t.Errorf("%d probes, want %d", docker.calls, tt.wantCalls)
+			}
+			if elapsed := time.Since(started); elapsed < tt.minWait || elapsed > tt.minWait+time.Second {
+				t.Errorf("waited %v, want about %v", elapsed, tt.minWait)
+			}
+		})
+	}
+}
+
+func TestWaitForDockerCancelled(t *testing.T) {
+	docker := &startingDocker{fakeDocker: newFakeDocker(), failures: 100}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := WaitForDocker(ctx, docker, time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the context's", err)
+	}
+	if docker.calls != 1 {
+		t.Errorf("%d probes, want 1 before the context ended", docker.calls)
+	}
+}
@@ -0,0 +1,215 @@
+package docker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Compose labels identifying the service a container is a replica of
+const (
+	composeProjectLabel = "com.docker.compose.project"
+	composeServiceLabel = "com.docker.compose.service"
+)
+
+// routeGroup is one location of a host: the container whose settings it
+// uses and further replicas of the same service that join its upstream
+type routeGroup struct {
+	primary  *ContainerData
+	replicas []*ContainerData
+}
+
+// resolveRouteConflicts groups the containers of one host by the location
+// path they claim. Replicas of the same service share a single location and
+// upstream. When different services claim the same path, the one with the
+// highest priority (then the first by name) keeps it and the others are
+// skipped with a warning naming both containers.
+func resolveRouteConflicts(host string, containers []*ContainerData) []routeGroup {
+	sorted := make([]*ContainerData, len(containers))
+	copy(sorted, containers)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Config.Priority != sorted[j].Config.Priority {
+			return sorted[i].Config.Priority > sorted[j].Config.Priority
+		}
+		return sorted[i].Config.ContainerName < sorted[j].Config.ContainerName
+	})
+
+	var groups []routeGroup
+	byPath := make(map[string]int) // route path -> index into groups
+	for _, container := range sorted {
+		path := routePath(container.Config)
+		index, claimed := byPath[path]
+		if !claimed {
+			byPath[path] = len(groups)
+			groups = append(groups, routeGroup{primary: container})
+			continue
+		}
+
+		group := &groups[index]
+		if sameService(group.primary, container) {
+			group.replicas = append(group.replicas, container)
+			continue
+		}
+		fmt.Printf("Warning: route conflict on %s%s: containers %s and %s point at different services, keeping %s\n",
+			host, path, group.primary.Config.ContainerName, container.Config.ContainerName, group.primary.Config.ContainerName)
+	}
+
+	return groups
+}
+
+// routePath returns the location path a container's route ends up on
+func routePath(config *ContainerConfig) string {
+	dynamic := config.UpstreamHost != "" && !config.FastCGI.Enabled
+	if !config.PreservePath && !dynamic && !strings.HasSuffix(config.Path, "/") {
+		return config.Path + "/"
+	}
+	return config.Path
+}
+
+// sameService reports whether two containers are replicas of one service:
+// the same compose project and service, or otherwise the same image
+func sameService(a, b *ContainerData) bool {
+	if a.Service != "" || b.Service != "" {
+		return a.Service == b.Service
+	}
+	return a.Image != "" && a.Image == b.Image
+}
+
+// composeService returns "project/service" from a container's compose labels
+func composeService(labels map[string]string) string {
+	service := labels[composeServiceLabel]
+	if service == "" {
+		return ""
+	}
+	return labels[composeProjectLabel] + "/" + service
+}
+
+// mergeDuplicateServers merges servers whose names nginx treats as the same
+// (server_name is case-insensitive), e.g. while a container relabeled from
+// App.local to app.local is being replaced. Locations are combined with the
+// higher priority winning a shared path. Servers using different
+// certificates or server snippets can't be merged and return an error.
+// Aliases that are another server's name or an earlier server's alias are
+// then dropped, since nginx ignores every later claim to a name.
+func mergeDuplicateServers(config *NginxConfig) error {
+	sort.SliceStable(config.Servers, func(i, j int) bool {
+		return config.Servers[i].ServerName < config.Servers[j].ServerName
+	})
+	
+	var merged []ServerConfig
+	byName := make(map[string]int) // lower-cased name -> index into merged
+	dropped := false
+	for _, server := range config.Servers {
+		name := strings.ToLower(server.ServerName)
+		index, exists := byName[name]
+		if !exists {
+			byName[name] = len(merged)
+			merged = append(merged, server)
+			continue
+		}
+		
+		target := &merged[index]
+		if err := mergeServer(target, server); err != nil {
+			return fmt.Errorf("servers %s and %s conflict: %w", target.ServerName, server.ServerName, err)
+		}
+		fmt.Printf("Warning: merged server %s into %s, server names are case-insensitive\n", server.ServerName, target.ServerName)
+		target.ServerName = name
+		dropped = true
+	}
+	
+	config.Servers = merged
+	if dropped {
+		pruneUnusedUpstreams(config)
+	}
+	dropDuplicateAliases(config)
+	return nil
+}
+
+// dropDuplicateAliases removes aliases claimed elsewhere: a name that is a
+// server's own name stays with that server, and an alias listed by several
+// servers stays with the first by name. Each dropped alias is warned about.
+func dropDuplicateAliases(config *NginxConfig) {
+	owner := make(map[string]string, len(config.Servers)) // lower-cased name -> server
+	for _, server := range config.Servers {
+		owner[strings.ToLower(server.ServerName)] = server.ServerName
+	}
+	
+	for i := range config.Servers {
+		server := &config.Servers[i]
+		aliases := server.Aliases[:0]
+		for _, alias := range server.Aliases {
+			name := strings.ToLower(alias)
+			if claimedBy, claimed := owner[name]; claimed && claimedBy != server.ServerName {
+				fmt.Printf("Warning: alias %s of host %s is already a name of host %s, dropping it from %s\n",
+					alias, server.ServerName, claimedBy, server.ServerName)
+				continue
+			}
+			owner[name] = server.ServerName
+			aliases = append(aliases, alias)
+		}
+		server.Aliases = aliases
+	}
+}
+
+// pruneUnusedUpstreams removes upstreams no location refers to anymore
+func pruneUnusedUpstreams(config *NginxConfig) {
+	used := make(map[string]bool)
+	for _, server := range config.Servers {
+		for _, location := range server.Locations {
+			used[location.Upstream] = true
+		}
+	}
+	
+	upstreams := config.Upstreams[:0]
+	for _, upstream := range config.Upstreams {
+		if used[upstream.Name] {
+			upstreams = append(upstreams, upstream)
+		}
+	}
+	config.Upstreams = upstreams
+}
+
+// mergeServer folds other into server
+func mergeServer(server *ServerConfig, other ServerConfig) error {
+	switch {
+	case server.SSL.Enabled && other.SSL.Enabled && server.SSL.Certificate != other.SSL.Certificate:
+		return fmt.Errorf("different certificates %s and %s", server.SSL.Certificate, other.SSL.Certificate)
+	case !server.SSL.Enabled && other.SSL.Enabled:
+		server.SSL = other.SSL
+	}
+	
+	switch {
+	case server.ServerSnippet != "" && other.ServerSnippet != "" && server.ServerSnippet != other.ServerSnippet:
+		return fmt.Errorf("different server snippets")
+	case server.ServerSnippet == "":
+		server.ServerSnippet = other.ServerSnippet
+	}
+	
+	mergeClientTimeouts(&server.ClientTimeouts, other.ClientTimeouts)
+	server.Aliases = appendAliases(server.Aliases, server.ServerName, other.Aliases...)
+	
+	listen := stringSet(server.Listen)
+	for _, address := range other.Listen {
+		if !listen[address] {
+			server.Listen = append(server.Listen, address)
+		}
+	}
+	
+	byPath := make(map[string]int, len(server.Locations))
+	for i, location := range server.Locations {
+		byPath[location.Path] = i
+	}
+	for _, location := range other.Locations {
+		i, exists := byPath[location.Path]
+		if !exists {
+			byPath[location.Path] = len(server.Locations)
+			server.Locations = append(server.Locations, location)
+			continue
+		}
+		if location.Priority > server.Locations[i].Priority {
+			server.Locations[i] = location
+		}
+	}
+	
+	return nil
+}
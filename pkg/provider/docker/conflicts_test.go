@@ -0,0 +1,241 @@
+package docker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveRouteConflicts(t *testing.T) {
+	// container returns a container of app.test routing path, with image
+	// and compose service set when not empty
+	container := func(name, path, image, service, priority string) *ContainerData {
+		labels := hostLabels("app.test", map[string]string{LabelPath: path})
+		if priority != "" {
+			labels[LabelPriority] = priority
+		}
+		c := newTestContainer(t, name, "10.0.0.2", labels)
+		c.Image, c.Service = image, service
+		return c
+	}
+
+	tests := []struct {
+		name       string
+		containers []*ContainerData
+		want       [][]string // per route: primary, then replicas
+	}{
+		{
+			name:       "distinct paths",
+			containers: []*ContainerData{container("api", "/api", "api:1", "", ""), container("web", "/", "web:1", "", "")},
+			want:       [][]string{{"api"}, {"web"}},
+		},
+		{
+			name:       "replicas of one image merged",
+			containers: []*ContainerData{container("api-2", "/api", "api:1", "", ""), container("api-1", "/api", "api:1", "", "")},
+			want:       [][]string{{"api-1", "api-2"}},
+		},
+		{
+			name: "replicas of one compose service merged",
+			containers: []*ContainerData{
+				container("shop-api-1", "/api", "api:1", "shop/api", ""),
+				container("shop-api-2", "/api", "api:2", "shop/api", ""),
+			},
+			want: [][]string{{"shop-api-1", "shop-api-2"}},
+		},
+		{
+			name: "same image in different compose services conflicts",
+			containers: []*ContainerData{
+				container("shop-api", "/api", "api:1", "shop/api", ""),
+				container("blog-api", "/api", "api:1", "blog/api", ""),
+			},
+			want: [][]string{{"blog-api"}},
+		},
+		{
+			name:       "conflict keeps the first by name",
+			containers: []*ContainerData{container("b", "/api", "b:1", "", ""), container("a", "/api", "a:1", "", "")},
+			want:       [][]string{{"a"}},
+		},
+		{
+			name:       "conflict keeps the higher priority",
+			containers: []*ContainerData{container("a", "/api", "a:1", "", ""), container("b", "/api", "b:1", "", "200")},
+			want:       [][]string{{"b"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][]string
+			for _, group := range resolveRouteConflicts("app.test", tt.containers) {
+				names := []string{group.primary.Config.ContainerName}
+				for _, replica := range group.replicas {
+					names = append(names, replica.Config.ContainerName)
+				}
+				got = append(got, names)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("routes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeDuplicateServers(t *testing.T) {
+	location := func(path, upstream string, priority int) LocationConfig {
+		return LocationConfig{Path: path, Upstream: upstream, Priority: priority}
+	}
+	tls := func(cert string) SSLConfig {
+		return SSLConfig{Enabled: true, Certificate: cert}
+	}
+
+	tests := []struct {
+		name          string
+		servers       []ServerConfig
+		want          []ServerConfig
+		wantUpstreams []string
+		wantErr       string
+	}{
+		{
+			name: "distinct names kept",
+			servers: []ServerConfig{
+				{ServerName: "b.test", Locations: []LocationConfig{location("/", "b", 100)}},
+				{ServerName: "a.test", Locations: []LocationConfig{location("/", "a", 100)}},
+			},
+			want: []ServerConfig{
+				{ServerName: "a.test", Locations: []LocationConfig{location("/", "a", 100)}},
+				{ServerName: "b.test", Locations: []LocationConfig{location("/", "b", 100)}},
+			},
+			// nothing merged, nothing pruned
+			wantUpstreams: []string{"a", "b", "new", "old"},
+		},
+		{
+			name: "names differing in case merge",
+			servers: []ServerConfig{
+				{ServerName: "app.test", Locations: []LocationConfig{location("/", "new", 100)}},
+				{ServerName: "App.test", Locations: []LocationConfig{location("/api", "old", 100)}},
+			},
+			want: []ServerConfig{
+				{ServerName: "app.test", Locations: []LocationConfig{location("/api", "old", 100), location("/", "new", 100)}},
+			},
+			wantUpstreams: []string{"new", "old"},
+		},
+		{
+			name: "higher priority wins a shared path",
+			servers: []ServerConfig{
+				{ServerName: "App.test", Locations: []LocationConfig{location("/", "old", 100)}},
+				{ServerName: "app.test", Locations: []LocationConfig{location("/", "new", 200)}},
+			},
+			want: []ServerConfig{
+				{ServerName: "app.test", Locations: []LocationConfig{location("/", "new", 200)}},
+			},
+			wantUpstreams: []string{"new"},
+		},
+		{
+			name: "first claim wins a shared path at equal priority",
+			servers: []ServerConfig{
+				{ServerName: "app.test", Locations: []LocationConfig{location("/", "new", 100)}},
+				{ServerName: "App.test", Locations: []LocationConfig{location("/", "old", 100)}},
+			},
+			want: []ServerConfig{
+				{ServerName: "app.test", Locations: []LocationConfig{location("/", "old", 100)}},
+			},
+			wantUpstreams: []string{"old"},
+		},
+		{
+			name: "TLS adopted and listen addresses combined",
+			servers: []ServerConfig{
+				{ServerName: "App.test", Listen: []string{"80"}, Locations: []LocationConfig{location("/", "old", 100)}},
+				{ServerName: "app.test", Listen: []string{"80", "443 ssl"}, SSL: tls("app.crt"), Locations: []LocationConfig{location("/", "old", 100)}},
+			},
+			want: []ServerConfig{
+				{ServerName: "app.test", Listen: []string{"80", "443 ssl"}, SSL: tls("app.crt"), Locations: []LocationConfig{location("/", "old", 100)}},
+			},
+			wantUpstreams: []string{"old"},
+		},
+		{
+			name: "alias naming another server dropped",
+			servers: []ServerConfig{
+				{ServerName: "a.test", Aliases: []string{"B.test", "www.a.test"}, Locations: []LocationConfig{location("/", "a", 100)}},
+				{ServerName: "b.test", Locations: []LocationConfig{location("/", "b", 100)}},
+			},
+			want: []ServerConfig{
+				{ServerName: "a.test", Aliases: []string{"www.a.test"}, Locations: []LocationConfig{location("/", "a", 100)}},
+				{ServerName: "b.test", Locations: []LocationConfig{location("/", "b", 100)}},
+			},
+			// nothing merged, nothing pruned
+			wantUpstreams: []string{"a", "b", "new", "old"},
+		},
+		{
+			name: "same alias on two hosts",
+			servers: []ServerConfig{
+				{ServerName: "b.test", Aliases: []string{"shared.test"}, Locations: []LocationConfig{location("/", "b", 100)}},
+				{ServerName: "a.test", Aliases: []string{"Shared.test", "www.a.test"}, Locations: []LocationConfig{location("/", "a", 100)}},
+			},
+			want: []ServerConfig{
+				{ServerName: "a.test", Aliases: []string{"Shared.test", "www.a.test"}, Locations: []LocationConfig{location("/", "a", 100)}},
+				{ServerName: "b.test", Aliases: []string{}, Locations: []LocationConfig{location("/", "b", 100)}},
+			},
+			wantUpstreams: []string{"a", "b", "new", "old"},
+		},
+		{
+			name: "different certificates conflict",
+			servers: []ServerConfig{
+				{ServerName: "App.test", SSL: tls("old.crt")},
+				{ServerName: "app.test", SSL: tls("new.crt")},
+			},
+			wantErr: "different certificates old.crt and new.crt",
+		},
+		{
+			name: "different server snippets conflict",
+			servers: []ServerConfig{
+				{ServerName: "App.test", ServerSnippet: "return 404;"},
+				{ServerName: "app.test", ServerSnippet: "return 410;"},
+			},
+			wantErr: "different server snippets",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &NginxConfig{Servers: tt.servers}
+			for _, name := range []string{"a", "b", "new", "old"} {
+				config.Upstreams = append(config.Upstreams, UpstreamConfig{Name: name})
+			}
+
+			err := mergeDuplicateServers(config)
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(config.Servers, tt.want) {
+				t.Errorf("servers = %+v\nwant %+v", config.Servers, tt.want)
+			}
+			if got := upstreamNames(config); !reflect.DeepEqual(got, tt.wantUpstreams) {
+				t.Errorf("upstreams = %v, want %v", got, tt.wantUpstreams)
+			}
+		})
+	}
+}
+
+func TestNoServerNameRenderedTwice(t *testing.T) {
+	rendered := renderTestConfig(t, DefaultGeneratorOptions(),
+		newTestContainer(t, "a", "10.0.0.2", map[string]string{LabelHost: "a.test", LabelHostAliases: "shared.test"}),
+		newTestContainer(t, "b", "10.0.0.3", map[string]string{LabelHost: "b.test", LabelHostAliases: "shared.test"}),
+	)
+
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(rendered, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "server_name ") {
+			continue
+		}
+		for _, name := range strings.Fields(strings.TrimSuffix(strings.TrimPrefix(line, "server_name "), ";")) {
+			if seen[name] {
+				t.Errorf("server name %s rendered twice:\n%s", name, rendered)
+			}
+			seen[name] = true
+		}
+	}
+	if !seen["shared.test"] {
+		t.Errorf("shared alias dropped from every host:\n%s", rendered)
+	}
+}
@@ -0,0 +1,144 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCORSAllowOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		origins string
+		want    string // Access-Control-Allow-Origin value, "" for none
+		wantMap []string
+	}{
+		{name: "no origins"},
+		{name: "wildcard", origins: "*", want: "'*'"},
+		{name: "wildcard among origins", origins: "https://a.test,*", want: "'*'"},
+		{
+			name:    "single origin",
+			origins: "https://a.test",
+			want:    "'$cors_origin_",
+			wantMap: []string{`"https://a.test" $http_origin;`},
+		},
+		{
+			name:    "several origins",
+			origins: "https://a.test, https://b.test/",
+			want:    "'$cors_origin_",
+			wantMap: []string{`"https://a.test" $http_origin;`, `"https://b.test" $http_origin;`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := map[string]string{LabelHost: "app.test", LabelCORS: "true"}
+			if tt.origins != "" {
+				labels[LabelCORS+".origins"] = tt.origins
+			}
+			rendered := renderTestConfig(t, DefaultGeneratorOptions(), newTestContainer(t, "app", "10.0.0.2", labels))
+			location := locationBlock(t, rendered, "/")
+			preflight := location[strings.Index(location, "if ($request_method = OPTIONS)"):]
+
+			// One header in the location and one in the preflight block
+			if got := strings.Count(location, "Access-Control-Allow-Origin"); tt.want != "" && got != 2 || tt.want == "" && got != 0 {
+				t.Fatalf("Access-Control-Allow-Origin headers = %d:\n%s", got, location)
+			}
+			if tt.want != "" && !strings.Contains(preflight, "add_header 'Access-Control-Allow-Origin' "+tt.want) {
+				t.Errorf("preflight lacks origin %s:\n%s", tt.want, preflight)
+			}
+			if got, want := strings.Contains(rendered, "map $http_origin"), len(tt.wantMap) > 0; got != want {
+				t.Errorf("origin map rendered = %v, want %v:\n%s", got, want, rendered)
+			}
+			for _, entry := range tt.wantMap {
+				if !strings.Contains(rendered, entry) {
+					t.Errorf("origin map lacks %s:\n%s", entry, rendered)
+				}
+			}
+		})
+	}
+}
+
+func TestCORSPreflightAnsweredByNginx(t *testing.T) {
+	rendered := renderTestConfig(t, DefaultGeneratorOptions(), newTestContainer(t, "app", "10.0.0.2", map[string]string{
+		LabelHost: "app.test", LabelCORS: "true", LabelCORS + ".origins": "https://a.test",
+		LabelCORS + ".methods": "GET,POST",
+	}))
+	location := locationBlock(t, rendered, "/")
+
+	start := strings.Index(location, "if ($request_method = OPTIONS) {")
+	if start < 0 {
+		t.Fatalf("no preflight block:\n%s", location)
+	}
+	preflight := location[start : start+strings.Index(location[start:], "}")]
+	for _, want := range []string{
+		"Access-Control-Allow-Methods' 'GET,POST'",
+		"Access-Control-Allow-Headers",
+		"Access-Control-Max-Age",
+		"return 204;",
+	} {
+		if !strings.Contains(preflight, want) {
+			t.Errorf("preflight block lacks %q:\n%s", want, preflight)
+		}
+	}
+	if strings.Index(location, "return 204;") > strings.Index(location, "proxy_pass") {
+		t.Errorf("preflight is answered after proxying:\n%s", location)
+	}
+}
+
+func TestCORSOriginMapsShared(t *testing.T) {
+	labels := func(host, origins string) map[string]string {
+		return map[string]string{LabelHost: host, LabelCORS: "true", LabelCORS + ".origins": origins}
+	}
+	config := generateTestConfig(t, DefaultGeneratorOptions(),
+		newTestContainer(t, "a", "10.0.0.2", labels("a.test", "https://x.test,https://y.test")),
+		newTestContainer(t, "b", "10.0.0.3", labels("b.test", "https://y.test,https://x.test")),
+		newTestContainer(t, "c", "10.0.0.4", labels("c.test", "https://z.test")),
+	)
+
+	if len(config.Maps) != 2 {
+		t.Fatalf("maps = %+v, want one per distinct origin list", config.Maps)
+	}
+	origin := make(map[string]string)
+	for _, server := range config.Servers {
+		origin[server.ServerName] = server.Locations[0].CORSOrigin
+	}
+	if origin["a.test"] != origin["b.test"] || origin["a.test"] == origin["c.test"] {
+		t.Errorf("origin variables = %v", origin)
+	}
+}
+
+func TestCORSOriginInjectionRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		origins string
+		wantErr string
+	}{
+		{"quote breaks out of the map", `http://a.com";return"x`, "contains forbidden characters"},
+		{"single quote", `http://a.com'`, "contains forbidden characters"},
+		{"semicolon", "http://a.com;", "contains forbidden characters"},
+		{"braces", "http://a.com}{", "contains forbidden characters"},
+		{"whitespace", "http://a.com\tx", "contains forbidden characters"},
+		{"query", "http://a.com?x", "must be scheme://host[:port]"},
+		{"fragment", "https://a.com#x", "must be scheme://host[:port]"},
+		{"user info", "https://user@a.com", "must be scheme://host[:port]"},
+		{"upper-case scheme", "HTTPS://a.com", "must be scheme://host[:port]"},
+		{"valid origin", "https://a.com:8443", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := GenerateConfigFromLabels(map[string]map[string]string{
+				"app": {LabelEnable: "true", LabelHost: "app.test", LabelCORS: "true", LabelCORS + ".origins": tt.origins},
+			})
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+			rendered, err := RenderNginxConfig(config, testTemplatePath)
+			if err != nil {
+				t.Fatalf("RenderNginxConfig: %v", err)
+			}
+			checkContains(t, rendered, []string{`"` + tt.origins + `" $http_origin;`}, nil)
+		})
+	}
+}
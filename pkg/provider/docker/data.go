@@ -4,10 +4,15 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/client"
+	"github.com/menta2k/local-nginx-ingress/pkg/safe"
 )
 
 // ContainerData represents a Docker container with nginx ingress configuration
@@ -16,27 +21,168 @@ type ContainerData struct {
 	IPAddress   string
 	NetworkName string
 	Status      string
+	Image       string
+	Service     string // compose "project/service", empty outside compose
+	Restarting  bool   // restarting; kept in its upstream marked down
+	Unready     bool   // not accepting connections yet at startup; marked down
+	
+	// fingerprint identifies the labels and address the config was extracted
+	// from (empty = unknown, the container's host is never cached)
+	fingerprint string
+}
+
+// InvalidContainer is a container with ingress labels that was skipped
+// because its configuration couldn't be extracted or failed validation
+type InvalidContainer struct {
+	ContainerID   string `json:"container_id"`
+	ContainerName string `json:"container_name"`
+	Error         string `json:"error"`
+}
+
+// InvalidContainerPolicy decides what happens when containers have invalid
+// ingress labels
+type InvalidContainerPolicy string
+
+const (
+	// InvalidContainerWarn skips invalid containers with a warning
+	InvalidContainerWarn InvalidContainerPolicy = "warn"
+	// InvalidContainerStrict refuses the update so nginx keeps the last good
+	// config, and fails startup without one
+	InvalidContainerStrict InvalidContainerPolicy = "strict"
+)
+
+// ParseInvalidContainerPolicy parses an invalid container policy, defaulting to warn
+func ParseInvalidContainerPolicy(value string) (InvalidContainerPolicy, error) {
+	switch policy := InvalidContainerPolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case "":
+		return InvalidContainerWarn, nil
+	case InvalidContainerWarn, InvalidContainerStrict:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid container policy %q, must be warn or strict", value)
+	}
+}
+
+// LabelMatchMode controls which containers are considered for nginx ingress
+type LabelMatchMode string
+
+const (
+	// MatchAnyLabel matches containers with any nginx.ingress.* label
+	MatchAnyLabel LabelMatchMode = "any"
+	// MatchEnableLabel matches only containers with nginx.ingress.enable set to true
+	MatchEnableLabel LabelMatchMode = "enable"
+	// MatchHostLabel matches only containers with an nginx.ingress.host label
+	MatchHostLabel LabelMatchMode = "host"
+)
+
+// ParseLabelMatchMode parses a label match mode, defaulting to MatchAnyLabel
+func ParseLabelMatchMode(value string) (LabelMatchMode, error) {
+	switch mode := LabelMatchMode(strings.ToLower(value)); mode {
+	case "":
+		return MatchAnyLabel, nil
+	case MatchAnyLabel, MatchEnableLabel, MatchHostLabel:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid label match mode %q, must be any, enable or host", value)
+	}
+}
+
+// ListOptions controls how containers are discovered
+type ListOptions struct {
+	MatchMode LabelMatchMode
+	
+	// FileLabels maps container names to labels read from a label file,
+	// merged under the containers' own Docker labels
+	FileLabels map[string]map[string]string
+	
+	// ExcludePatterns are glob patterns (e.g. "infra-*") matched against
+	// container names; matching containers are ignored
+	ExcludePatterns []string
+	
+	// Defaults apply to labels a container omits (zero = package defaults)
+	Defaults LabelDefaults
+	
+	// InspectConcurrency bounds concurrent container inspects (default: 1)
+	InspectConcurrency int
+	
+	// InspectCache reuses inspect results of containers whose state and
+	// networks haven't changed since the last listing (nil = always inspect)
+	InspectCache *InspectCache
+	
+	// Backends routes containers not reachable at their container IP, such
+	// as those of remote Docker hosts (nil = container IP and port)
+	Backends BackendResolver
+}
+
+// ValidateExcludePatterns checks that every exclude pattern is a valid glob
+func ValidateExcludePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// isExcluded reports whether a container name matches any exclude pattern
+func isExcluded(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
 }
 
 // ListContainers retrieves all containers and extracts nginx ingress configurations
-func ListContainers(ctx context.Context, cli *client.Client) ([]*ContainerData, error) {
+func ListContainers(ctx context.Context, cli DockerAPI, opts ListOptions) ([]*ContainerData, error) {
+	containerData, _, err := listContainers(ctx, cli, opts)
+	return containerData, err
+}
+
+// listContainers is ListContainers that also returns the containers skipped
+// because of invalid ingress labels
+func listContainers(ctx context.Context, cli DockerAPI, opts ListOptions) ([]*ContainerData, []InvalidContainer, error) {
 	containers, err := cli.ContainerList(ctx, container.ListOptions{
 		All: false, // Only running containers
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to list containers: %w", err)
+		return nil, nil, fmt.Errorf("failed to list containers: %w", err)
 	}
 
-	var containerData []*ContainerData
-
+	// Containers with nginx ingress labels that aren't excluded
+	var candidates []container.Summary
+	var candidateLabels []map[string]string
 	for _, container := range containers {
+		labels := mergeLabels(opts.FileLabels[getContainerName(container.Names)], container.Labels)
+		
 		// Skip containers without nginx ingress labels
-		if !hasNginxLabels(container.Labels) {
+		if !hasNginxLabels(labels, opts.MatchMode) {
 			continue
 		}
 
+		// Skip containers excluded by the operator
+		if isExcluded(getContainerName(container.Names), opts.ExcludePatterns) {
+			continue
+		}
+		
+		candidates = append(candidates, container)
+		candidateLabels = append(candidateLabels, labels)
+	}
+	
+	inspected := opts.InspectCache.inspect(ctx, cli, candidates, opts.InspectConcurrency)
+
+	var containerData []*ContainerData
+	var invalid []InvalidContainer
+	skipInvalid := func(id, name string, err error) {
+		invalid = append(invalid, InvalidContainer{ContainerID: id, ContainerName: name, Error: err.Error()})
+	}
+
+	for i, container := range candidates {
+		labels := candidateLabels[i]
+		
 		// Get container details
-		containerJSON, err := cli.ContainerInspect(ctx, container.ID)
+		containerJSON, err := inspected[i].response, inspected[i].err
 		if err != nil {
 			fmt.Printf("Warning: failed to inspect container %s: %v\n", container.ID, err)
 			continue
@@ -46,9 +192,10 @@ func ListContainers(ctx context.Context, cli *client.Client) ([]*ContainerData,
 		networkIP, networkName := extractNetworkInfo(containerJSON)
 
 		// Extract nginx configuration from labels
-		config, err := ExtractConfig(container.ID, getContainerName(container.Names), networkIP, container.Labels)
+		config, err := ExtractConfigWithDefaults(container.ID, getContainerName(container.Names), networkIP, labels, opts.Defaults)
 		if err != nil {
 			fmt.Printf("Warning: failed to extract config for container %s: %v\n", container.ID, err)
+			skipInvalid(container.ID, getContainerName(container.Names), err)
 			continue
 		}
 
@@ -57,27 +204,272 @@ func ListContainers(ctx context.Context, cli *client.Client) ([]*ContainerData,
 			continue
 		}
 
+		// Without a port label, use the single exposed TCP port
+		if _, labeled := labels[LabelPort]; !labeled && containerJSON.Config != nil {
+			var exposed []int
+			for port := range containerJSON.Config.ExposedPorts {
+				if port.Proto() == "tcp" {
+					exposed = append(exposed, port.Int())
+				}
+			}
+			config.Port = inferPort(config.ContainerName, config.Port, exposed)
+		}
+
 		// Validate configuration
 		if err := ValidateConfig(config); err != nil {
 			fmt.Printf("Warning: invalid config for container %s: %v\n", container.ID, err)
+			skipInvalid(container.ID, config.ContainerName, err)
 			continue
 		}
+		
+		if opts.Backends != nil {
+			address, hostPort, remote, err := opts.Backends.ResolveBackend(container.ID, containerJSON, config.Port)
+			if err != nil {
+				fmt.Printf("Warning: can't route to container %s: %v\n", config.ContainerName, err)
+				skipInvalid(container.ID, config.ContainerName, err)
+				continue
+			}
+			if remote {
+				networkIP, networkName = address, "published"
+				config.NetworkIP, config.Port = address, hostPort
+			}
+		}
 
 		data := &ContainerData{
 			Config:      config,
 			IPAddress:   networkIP,
 			NetworkName: networkName,
 			Status:      container.Status,
+			Image:       container.Image,
+			Service:     composeService(container.Labels),
+			Restarting:  containerJSON.State != nil && containerJSON.State.Restarting,
 		}
+		data.fingerprint = containerFingerprint(data, labels)
 
 		containerData = append(containerData, data)
 	}
 
-	return containerData, nil
+	return containerData, invalid, nil
+}
+
+// inspectResult is the outcome of inspecting one container
+type inspectResult struct {
+	response container.InspectResponse
+	err      error
+}
+
+// inspectContainers inspects containers with at most concurrency inspects in
+// flight, returning results in the order of containers
+func inspectContainers(ctx context.Context, cli DockerAPI, containers []container.Summary, concurrency int) []inspectResult {
+	results := make([]inspectResult, len(containers))
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	
+	pool := safe.NewBoundedPool(ctx, concurrency)
+	for i, summary := range containers {
+		// Reported if the inspect panics before storing its result
+		results[i].err = fmt.Errorf("inspect of container %s did not complete", summary.ID)
+		pool.GoCtx(func(ctx context.Context) {
+			results[i].response, results[i].err = cli.ContainerInspect(ctx, summary.ID)
+		})
+	}
+	pool.Wait()
+	pool.Stop() // all done, releases the pool context
+	
+	return results
+}
+
+// InspectCache holds the last inspect result of each listed container, so a
+// reconcile only inspects containers that started, restarted or changed
+// networks since the previous one. Containers gone from a listing are
+// dropped. A nil cache inspects every container.
+type InspectCache struct {
+	mu      sync.Mutex
+	entries map[string]inspectCacheEntry // container ID -> last result
+}
+
+// inspectCacheEntry is a cached inspect result and the listing it belongs to
+type inspectCacheEntry struct {
+	key      string
+	response container.InspectResponse
 }
 
-// hasNginxLabels checks if container has any nginx ingress labels
-func hasNginxLabels(labels map[string]string) bool {
+// NewInspectCache creates an empty inspect cache
+func NewInspectCache() *InspectCache {
+	return &InspectCache{entries: make(map[string]inspectCacheEntry)}
+}
+
+// inspectCacheKey identifies what a listing says about a container: a change
+// of state or of any network endpoint means the cached inspect is stale
+func inspectCacheKey(summary container.Summary) string {
+	parts := []string{summary.ID, summary.State}
+	if summary.NetworkSettings != nil {
+		for name, endpoint := range summary.NetworkSettings.Networks {
+			if endpoint != nil {
+				parts = append(parts, name+"="+endpoint.EndpointID+"/"+endpoint.IPAddress)
+			}
+		}
+	}
+	sort.Strings(parts[2:])
+	return strings.Join(parts, "|")
+}
+
+// inspect returns inspect results for containers in their order, inspecting
+// only those without an up-to-date cache entry
+func (c *InspectCache) inspect(ctx context.Context, cli DockerAPI, containers []container.Summary, concurrency int) []inspectResult {
+	if c == nil {
+		return inspectContainers(ctx, cli, containers, concurrency)
+	}
+	
+	results := make([]inspectResult, len(containers))
+	keys := make([]string, len(containers))
+	var missing []container.Summary
+	var missingIndex []int
+	
+	c.mu.Lock()
+	for i, summary := range containers {
+		keys[i] = inspectCacheKey(summary)
+		if entry, ok := c.entries[summary.ID]; ok && entry.key == keys[i] {
+			results[i].response = entry.response
+			continue
+		}
+		missing = append(missing, summary)
+		missingIndex = append(missingIndex, i)
+	}
+	c.mu.Unlock()
+	
+	inspected := inspectContainers(ctx, cli, missing, concurrency)
+	
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for j, i := range missingIndex {
+		results[i] = inspected[j]
+	}
+	// Rebuild from this listing so removed containers and failed inspects
+	// don't linger
+	entries := make(map[string]inspectCacheEntry, len(containers))
+	for i, summary := range containers {
+		if results[i].err == nil {
+			entries[summary.ID] = inspectCacheEntry{key: keys[i], response: results[i].response}
+		}
+	}
+	c.entries = entries
+	
+	return results
+}
+
+// inferPort picks the backend port of a container without a port label: the
+// only exposed TCP port, or fallback when none or several are exposed
+func inferPort(containerName string, fallback int, exposed []int) int {
+	switch len(exposed) {
+	case 0:
+		return fallback
+	case 1:
+		return exposed[0]
+	default:
+		sort.Ints(exposed)
+		fmt.Printf("Warning: container %s exposes several ports %v, set %s to choose one (using %d)\n",
+			containerName, exposed, LabelPort, fallback)
+		return fallback
+	}
+}
+
+// ValidationResult describes whether a labeled container has a usable configuration
+type ValidationResult struct {
+	ContainerID   string
+	ContainerName string
+	Enabled       bool
+	Config        *ContainerConfig
+	Err           error
+}
+
+// Valid reports whether the container's labels produced a valid configuration
+func (r ValidationResult) Valid() bool {
+	return r.Err == nil
+}
+
+// ValidateContainers lists running containers with nginx ingress labels and
+// reports, for each one, whether its labels extract and validate cleanly
+func ValidateContainers(ctx context.Context, cli DockerAPI, opts ListOptions) ([]ValidationResult, error) {
+	containers, err := cli.ContainerList(ctx, container.ListOptions{
+		All: false, // Only running containers
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	
+	var results []ValidationResult
+	for _, container := range containers {
+		labels := mergeLabels(opts.FileLabels[getContainerName(container.Names)], container.Labels)
+		if !hasNginxLabels(labels, opts.MatchMode) {
+			continue
+		}
+		if isExcluded(getContainerName(container.Names), opts.ExcludePatterns) {
+			continue
+		}
+		
+		result := ValidationResult{
+			ContainerID:   container.ID,
+			ContainerName: getContainerName(container.Names),
+		}
+		
+		config, err := ExtractConfigWithDefaults(container.ID, result.ContainerName, "", labels, opts.Defaults)
+		if err != nil {
+			result.Err = err
+		} else {
+			result.Config = config
+			result.Enabled = config.Enabled
+			result.Err = ValidateConfig(config)
+		}
+		
+		results = append(results, result)
+	}
+	
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].ContainerName < results[j].ContainerName
+	})
+	
+	return results, nil
+}
+
+// FormatValidationReport renders validation results as a human-readable report
+func FormatValidationReport(results []ValidationResult) string {
+	var b strings.Builder
+	
+	if len(results) == 0 {
+		b.WriteString("No containers with nginx ingress labels found\n")
+		return b.String()
+	}
+	
+	invalid := 0
+	for _, result := range results {
+		switch {
+		case !result.Valid():
+			invalid++
+			fmt.Fprintf(&b, "INVALID  %s: %v\n", result.ContainerName, result.Err)
+		case !result.Enabled:
+			fmt.Fprintf(&b, "DISABLED %s\n", result.ContainerName)
+		default:
+			fmt.Fprintf(&b, "VALID    %s -> %s%s (port %d)\n",
+				result.ContainerName, result.Config.Host, result.Config.Path, result.Config.Port)
+		}
+	}
+	
+	fmt.Fprintf(&b, "\n%d containers checked, %d valid, %d invalid\n", len(results), len(results)-invalid, invalid)
+	return b.String()
+}
+
+// hasNginxLabels checks if container has nginx ingress labels according to the match mode
+func hasNginxLabels(labels map[string]string, mode LabelMatchMode) bool {
+	switch mode {
+	case MatchEnableLabel:
+		return parseBool(labels[LabelEnable])
+	case MatchHostLabel:
+		_, exists := labels[LabelHost]
+		return exists
+	}
+	
 	for key := range labels {
 		if strings.HasPrefix(key, LabelPrefix) {
 			return true
@@ -129,7 +521,7 @@ func getContainerName(names []string) string {
 }
 
 // GetContainerIP gets the IP address of a specific container
-func GetContainerIP(ctx context.Context, cli *client.Client, containerID string) (string, error) {
+func GetContainerIP(ctx context.Context, cli DockerAPI, containerID string) (string, error) {
 	containerJSON, err := cli.ContainerInspect(ctx, containerID)
 	if err != nil {
 		return "", fmt.Errorf("failed to inspect container %s: %w", containerID, err)
@@ -144,7 +536,7 @@ func GetContainerIP(ctx context.Context, cli *client.Client, containerID string)
 }
 
 // IsContainerHealthy checks if container is healthy and reachable
-func IsContainerHealthy(ctx context.Context, cli *client.Client, containerID string) bool {
+func IsContainerHealthy(ctx context.Context, cli DockerAPI, containerID string) bool {
 	containerJSON, err := cli.ContainerInspect(ctx, containerID)
 	if err != nil {
 		return false
@@ -163,11 +555,13 @@ func IsContainerHealthy(ctx context.Context, cli *client.Client, containerID str
 	return true
 }
 
-// CheckContainerPort verifies if the specified port is accessible on the container
+// CheckContainerPort verifies if the specified port is accessible on the
+// container, giving up after 5 seconds or when ctx is done
 func CheckContainerPort(ctx context.Context, containerIP string, port int) bool {
-	address := fmt.Sprintf("%s:%d", containerIP, port)
+	address := net.JoinHostPort(containerIP, strconv.Itoa(port))
 	
-	conn, err := net.DialTimeout("tcp", address, 5) // 5 second timeout
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
 	if err != nil {
 		return false
 	}
@@ -189,14 +583,77 @@ func FilterEnabledContainers(containers []*ContainerData) []*ContainerData {
 	return enabled
 }
 
-// GroupContainersByHost groups containers by their host configuration
+// GroupContainersByHost groups containers by their host configuration. A
+// container whose host is another container's alias joins that container's
+// host, so the names share one server block.
 func GroupContainersByHost(containers []*ContainerData) map[string][]*ContainerData {
+	aliasOf := aliasOwners(containers)
 	hostGroups := make(map[string][]*ContainerData)
 	
 	for _, container := range containers {
 		host := container.Config.Host
+		if primary, isAlias := aliasOf[strings.ToLower(host)]; isAlias {
+			host = primary
+		}
 		hostGroups[host] = append(hostGroups[host], container)
 	}
 	
 	return hostGroups
+}
+
+// aliasOwners maps every lower-cased host alias to the host declaring it.
+// The first host to declare an alias owns it, and a host that is itself an
+// alias doesn't declare aliases, which keeps two hosts aliasing each other apart.
+func aliasOwners(containers []*ContainerData) map[string]string {
+	aliasOf := make(map[string]string)
+	for _, container := range containers {
+		if _, isAlias := aliasOf[strings.ToLower(container.Config.Host)]; isAlias {
+			continue
+		}
+		for _, alias := range container.Config.HostAliases {
+			if _, taken := aliasOf[strings.ToLower(alias)]; !taken {
+				aliasOf[strings.ToLower(alias)] = container.Config.Host
+			}
+		}
+	}
+	return aliasOf
+}
+
+// hostAliases returns the extra server names of a host's containers: their
+// aliases and hosts other than host, without duplicates. Aliases owned by
+// another host in aliasOf are skipped with a warning.
+func hostAliases(host string, containers []*ContainerData, aliasOf map[string]string) []string {
+	var aliases []string
+	skipped := make(map[string]bool)
+	for _, container := range containers {
+		aliases = appendAliases(aliases, host, container.Config.Host)
+		for _, alias := range container.Config.HostAliases {
+			owner, owned := aliasOf[strings.ToLower(alias)]
+			if owned && !strings.EqualFold(owner, host) {
+				if !skipped[strings.ToLower(alias)] {
+					fmt.Printf("Warning: alias %s of container %s is already an alias of host %s, skipping it for host %s\n",
+						alias, container.Config.ContainerName, owner, host)
+					skipped[strings.ToLower(alias)] = true
+				}
+				continue
+			}
+			aliases = appendAliases(aliases, host, alias)
+		}
+	}
+	return aliases
+}
+
+// appendAliases appends names not already in aliases and other than host,
+// compared case-insensitively like nginx compares server names
+func appendAliases(aliases []string, host string, names ...string) []string {
+	for _, name := range names {
+		duplicate := strings.EqualFold(name, host)
+		for _, alias := range aliases {
+			duplicate = duplicate || strings.EqualFold(name, alias)
+		}
+		if !duplicate {
+			aliases = append(aliases, name)
+		}
+	}
+	return aliases
 }
\ No newline at end of file
@@ -0,0 +1,424 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListContainers(t *testing.T) {
+	web := fakeContainer{Name: "web", IP: "172.18.0.2", Labels: map[string]string{LabelEnable: "true", LabelHost: "web.test"}}
+	hostOnly := fakeContainer{Name: "api", IP: "172.18.0.3", Labels: map[string]string{LabelHost: "api.test"}}
+	enabledOnly := fakeContainer{Name: "worker", IP: "172.18.0.7", Labels: map[string]string{LabelEnable: "true"}}
+	unlabeled := fakeContainer{Name: "db", IP: "172.18.0.4", Labels: map[string]string{"com.example": "x"}}
+	infra := fakeContainer{Name: "infra-proxy", IP: "172.18.0.5", Labels: map[string]string{LabelEnable: "true", LabelHost: "infra.test"}}
+	invalid := fakeContainer{Name: "broken", IP: "172.18.0.6", Labels: map[string]string{LabelEnable: "true", LabelHost: "broken.test", LabelPort: "none"}}
+	custom := fakeContainer{Name: "multi", Labels: map[string]string{LabelEnable: "true", LabelHost: "multi.test"},
+		Networks: map[string]string{"bridge": "172.17.0.2", "app": "172.20.0.2"}}
+
+	tests := []struct {
+		name       string
+		containers []fakeContainer
+		opts       ListOptions
+		want       map[string]string // container name -> IP
+	}{
+		{
+			name:       "enabled containers only",
+			containers: []fakeContainer{web, hostOnly, unlabeled},
+			want:       map[string]string{"web": "172.18.0.2"},
+		},
+		{
+			name:       "host label match mode",
+			containers: []fakeContainer{web, enabledOnly},
+			opts:       ListOptions{MatchMode: MatchHostLabel},
+			want:       map[string]string{"web": "172.18.0.2"},
+		},
+		{
+			name:       "excluded by pattern",
+			containers: []fakeContainer{web, infra},
+			opts:       ListOptions{ExcludePatterns: []string{"infra-*"}},
+			want:       map[string]string{"web": "172.18.0.2"},
+		},
+		{
+			name:       "invalid labels skipped",
+			containers: []fakeContainer{web, invalid},
+			want:       map[string]string{"web": "172.18.0.2"},
+		},
+		{
+			name:       "labels from a label file",
+			containers: []fakeContainer{unlabeled},
+			opts: ListOptions{FileLabels: map[string]map[string]string{
+				"db": {LabelEnable: "true", LabelHost: "db.test"},
+			}},
+			want: map[string]string{"db": "172.18.0.4"},
+		},
+		{
+			name:       "custom network preferred over bridge",
+			containers: []fakeContainer{custom},
+			want:       map[string]string{"multi": "172.20.0.2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			containers, err := ListContainers(context.Background(), newFakeDocker(tt.containers...), tt.opts)
+			if err != nil {
+				t.Fatalf("ListContainers: %v", err)
+			}
+			got := make(map[string]string)
+			for _, container := range containers {
+				got[container.Config.ContainerName] = container.IPAddress
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("containers = %v, want %v", got, tt.want)
+			}
+			for name, ip := range tt.want {
+				if got[name] != ip {
+					t.Errorf("%s IP = %q, want %q", name, got[name], ip)
+				}
+			}
+		})
+	}
+}
+
+func TestListContainersReportsInvalid(t *testing.T) {
+	docker := newFakeDocker(
+		fakeContainer{Name: "web", IP: "172.18.0.2", Labels: map[string]string{LabelEnable: "true", LabelHost: "web.test"}},
+		fakeContainer{Name: "broken", IP: "172.18.0.3", Labels: map[string]string{LabelEnable: "true", LabelHost: "broken.test", LabelPort: "none"}},
+	)
+	_, invalid, err := listContainers(context.Background(), docker, ListOptions{})
+	if err != nil {
+		t.Fatalf("listContainers: %v", err)
+	}
+	var names []string
+	for _, container := range invalid {
+		names = append(names, container.ContainerName)
+	}
+	sort.Strings(names)
+	if len(names) != 1 || names[0] != "broken" {
+		t.Errorf("invalid containers = %v, want [broken]", names)
+	}
+}
+
+func TestHostAliasesInOneServer(t *testing.T) {
+	config := generateTestConfig(t, DefaultGeneratorOptions(),
+		newTestContainer(t, "site", "10.0.0.2", map[string]string{LabelHost: "example.test", LabelHostAliases: "www.example.test, example.local"}),
+		newTestContainer(t, "api", "10.0.0.3", map[string]string{LabelHost: "www.example.test", LabelPath: "/api"}),
+	)
+
+	if len(config.Servers) != 1 {
+		t.Fatalf("servers = %d, want 1", len(config.Servers))
+	}
+	server := config.Servers[0]
+	names := append([]string{server.ServerName}, server.Aliases...)
+	sort.Strings(names)
+	if want := []string{"example.local", "example.test", "www.example.test"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("server names = %v, want %v", names, want)
+	}
+	if len(server.Locations) < 2 {
+		t.Errorf("locations = %+v, want the alias host's /api too", server.Locations)
+	}
+}
+
+func TestHostAliasesSkipClaimedAliases(t *testing.T) {
+	tests := []struct {
+		name       string
+		containers []*ContainerData
+		want       map[string][]string // host -> aliases
+	}{
+		{
+			name: "alias claimed by an earlier host",
+			containers: []*ContainerData{
+				newTestContainer(t, "a", "10.0.0.2", map[string]string{LabelHost: "a.test", LabelHostAliases: "shared.test,www.a.test"}),
+				newTestContainer(t, "b", "10.0.0.3", map[string]string{LabelHost: "b.test", LabelHostAliases: "Shared.test,www.b.test"}),
+			},
+			want: map[string][]string{"a.test": {"shared.test", "www.a.test"}, "b.test": {"www.b.test"}},
+		},
+		{
+			name: "replicas declaring the same alias",
+			containers: []*ContainerData{
+				newTestContainer(t, "a1", "10.0.0.2", map[string]string{LabelHost: "a.test", LabelHostAliases: "www.a.test"}),
+				newTestContainer(t, "a2", "10.0.0.3", map[string]string{LabelHost: "a.test", LabelHostAliases: "www.a.test"}),
+			},
+			want: map[string][]string{"a.test": {"www.a.test"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aliasOf := aliasOwners(tt.containers)
+			got := make(map[string][]string)
+			for host, containers := range GroupContainersByHost(tt.containers) {
+				got[host] = hostAliases(host, containers, aliasOf)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("aliases = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasNginxLabels(t *testing.T) {
+	enabled := map[string]string{LabelEnable: "true", LabelHost: "app.test"}
+	disabled := map[string]string{LabelEnable: "false", LabelHost: "app.test"}
+	hostOnly := map[string]string{LabelHost: "app.test"}
+	otherOnly := map[string]string{LabelPort: "8080"}
+	unrelated := map[string]string{"com.example.host": "app.test"}
+
+	tests := []struct {
+		mode   LabelMatchMode
+		labels map[string]string
+		want   bool
+	}{
+		{MatchAnyLabel, enabled, true},
+		{MatchAnyLabel, disabled, true},
+		{MatchAnyLabel, otherOnly, true},
+		{MatchAnyLabel, unrelated, false},
+		{MatchEnableLabel, enabled, true},
+		{MatchEnableLabel, disabled, false},
+		{MatchEnableLabel, hostOnly, false},
+		{MatchHostLabel, hostOnly, true},
+		{MatchHostLabel, disabled, true},
+		{MatchHostLabel, otherOnly, false},
+	}
+
+	for _, tt := range tests {
+		if got := hasNginxLabels(tt.labels, tt.mode); got != tt.want {
+			t.Errorf("hasNginxLabels(%v, %s) = %v, want %v", tt.labels, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestParseLabelMatchMode(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    LabelMatchMode
+		wantErr bool
+	}{
+		{"", MatchAnyLabel, false},
+		{"any", MatchAnyLabel, false},
+		{"Enable", MatchEnableLabel, false},
+		{"host", MatchHostLabel, false},
+		{"all", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLabelMatchMode(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseLabelMatchMode(%q) = %q, %v, want %q, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateContainers(t *testing.T) {
+	docker := newFakeDocker(
+		fakeContainer{Name: "web", IP: "172.18.0.2", Labels: map[string]string{LabelEnable: "true", LabelHost: "web.test", LabelPort: "3000"}},
+		fakeContainer{Name: "broken", IP: "172.18.0.3", Labels: map[string]string{LabelEnable: "true", LabelHost: "broken.test", LabelPort: "none"}},
+		fakeContainer{Name: "off", IP: "172.18.0.4", Labels: map[string]string{LabelEnable: "false", LabelHost: "off.test"}},
+		fakeContainer{Name: "db", IP: "172.18.0.5", Labels: map[string]string{"com.example": "x"}},
+	)
+
+	results, err := ValidateContainers(context.Background(), docker, ListOptions{})
+	if err != nil {
+		t.Fatalf("ValidateContainers: %v", err)
+	}
+	want := []struct {
+		name    string
+		valid   bool
+		enabled bool
+	}{
+		{"broken", false, false},
+		{"off", true, false},
+		{"web", true, true},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for i, w := range want {
+		result := results[i]
+		if result.ContainerName != w.name || result.Valid() != w.valid || result.Enabled != w.enabled {
+			t.Errorf("result %d = %s valid=%v enabled=%v, want %s valid=%v enabled=%v",
+				i, result.ContainerName, result.Valid(), result.Enabled, w.name, w.valid, w.enabled)
+		}
+	}
+
+	report := FormatValidationReport(results)
+	for _, line := range []string{
+		"INVALID  broken:",
+		"DISABLED off",
+		"VALID    web -> web.test/ (port 3000)",
+		"3 containers checked, 2 valid, 1 invalid",
+	} {
+		if !strings.Contains(report, line) {
+			t.Errorf("report lacks %q:\n%s", line, report)
+		}
+	}
+}
+
+func TestExcludePatterns(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		want     bool
+	}{
+		{"no patterns", nil, false},
+		{"prefix glob", []string{"infra-*"}, true},
+		{"exact name", []string{"infra-proxy"}, true},
+		{"single character", []string{"infra-prox?"}, true},
+		{"other pattern", []string{"db-*"}, false},
+		{"any of several", []string{"db-*", "*-proxy"}, true},
+		{"case sensitive", []string{"INFRA-*"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isExcluded("infra-proxy", tt.patterns); got != tt.want {
+				t.Errorf("isExcluded(infra-proxy, %v) = %v, want %v", tt.patterns, got, tt.want)
+			}
+		})
+	}
+
+	if err := ValidateExcludePatterns([]string{"infra-*", "[abc]-*"}); err != nil {
+		t.Errorf("ValidateExcludePatterns rejected valid patterns: %v", err)
+	}
+	if err := ValidateExcludePatterns([]string{"infra-[*"}); err == nil {
+		t.Error("ValidateExcludePatterns accepted a malformed pattern")
+	}
+}
+
+func TestPortInference(t *testing.T) {
+	tests := []struct {
+		name     string
+		port     string // port label, omitted when empty
+		exposed  []string
+		wantPort int
+	}{
+		{name: "single exposed port", exposed: []string{"3000/tcp"}, wantPort: 3000},
+		{name: "no exposed port", wantPort: 80},
+		{name: "udp ports ignored", exposed: []string{"53/udp", "8080/tcp"}, wantPort: 8080},
+		{name: "several exposed ports", exposed: []string{"3000/tcp", "9090/tcp"}, wantPort: 80},
+		{name: "label wins", port: "9090", exposed: []string{"3000/tcp"}, wantPort: 9090},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := map[string]string{LabelEnable: "true", LabelHost: "app.test"}
+			if tt.port != "" {
+				labels[LabelPort] = tt.port
+			}
+			docker := newFakeDocker(fakeContainer{Name: "app", IP: "172.18.0.2", Labels: labels, Exposed: tt.exposed})
+
+			containers := listTestContainers(t, docker)
+			if len(containers) != 1 {
+				t.Fatalf("listed %d containers, want 1", len(containers))
+			}
+			if got := containers[0].Config.Port; got != tt.wantPort {
+				t.Errorf("port = %d, want %d", got, tt.wantPort)
+			}
+		})
+	}
+}
+
+func TestInspectConcurrency(t *testing.T) {
+	var containers []fakeContainer
+	want := make(map[string]string)
+	for i := 0; i < 8; i++ {
+		name := fmt.Sprintf("app%d", i)
+		ip := fmt.Sprintf("172.18.0.%d", i+2)
+		containers = append(containers, fakeContainer{Name: name, IP: ip,
+			Labels: map[string]string{LabelEnable: "true", LabelHost: name + ".test"}})
+		want[name] = ip
+	}
+
+	tests := []struct {
+		name        string
+		concurrency int
+		wantMax     int
+	}{
+		{"default is sequential", 0, 1},
+		{"sequential", 1, 1},
+		{"bounded", 3, 3},
+		{"bound above the container count", 16, 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docker := newFakeDocker(containers...)
+			docker.inspectDelay = 20 * time.Millisecond
+			listed, _, err := listContainers(context.Background(), docker, ListOptions{InspectConcurrency: tt.concurrency})
+			if err != nil {
+				t.Fatalf("listContainers: %v", err)
+			}
+
+			got := make(map[string]string)
+			for _, container := range listed {
+				got[container.Config.ContainerName] = container.IPAddress
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("listed %v, want %v", got, want)
+			}
+			if docker.maxInspecting != tt.wantMax {
+				t.Errorf("%d inspects in flight at once, want %d", docker.maxInspecting, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestInspectCache(t *testing.T) {
+	labels := func(host string) map[string]string {
+		return map[string]string{LabelEnable: "true", LabelHost: host}
+	}
+	web := fakeContainer{Name: "web", IP: "172.18.0.2", Labels: labels("web.test")}
+	api := fakeContainer{Name: "api", IP: "172.18.0.3", Labels: labels("api.test")}
+	moved := web
+	moved.IP = "172.18.0.9"
+	restarting := api
+	restarting.State = "restarting"
+	relabeled := api
+	relabeled.Labels = labels("api2.test")
+
+	steps := []struct {
+		name         string
+		containers   []fakeContainer
+		wantInspects int
+		wantIPs      map[string]string
+	}{
+		{"initial", []fakeContainer{web, api}, 2, map[string]string{"web": "172.18.0.2", "api": "172.18.0.3"}},
+		{"unchanged", []fakeContainer{web, api}, 0, map[string]string{"web": "172.18.0.2", "api": "172.18.0.3"}},
+		{"network changed", []fakeContainer{moved, api}, 1, map[string]string{"web": "172.18.0.9", "api": "172.18.0.3"}},
+		{"state changed", []fakeContainer{moved, restarting}, 1, map[string]string{"web": "172.18.0.9", "api": "172.18.0.3"}},
+		{"back to running", []fakeContainer{moved, api}, 1, map[string]string{"web": "172.18.0.9", "api": "172.18.0.3"}},
+		// Labels come from the listing, so they need no new inspect
+		{"labels changed", []fakeContainer{moved, relabeled}, 0, map[string]string{"web": "172.18.0.9", "api": "172.18.0.3"}},
+		{"removed", []fakeContainer{moved}, 0, map[string]string{"web": "172.18.0.9"}},
+		{"readded", []fakeContainer{moved, api}, 1, map[string]string{"web": "172.18.0.9", "api": "172.18.0.3"}},
+	}
+
+	docker := newFakeDocker()
+	cache := NewInspectCache()
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			docker.set(step.containers...)
+			_, before := docker.counts()
+			listed, _, err := listContainers(context.Background(), docker, ListOptions{InspectCache: cache})
+			if err != nil {
+				t.Fatalf("listContainers: %v", err)
+			}
+			if _, after := docker.counts(); after-before != step.wantInspects {
+				t.Errorf("%d inspects, want %d", after-before, step.wantInspects)
+			}
+
+			got := make(map[string]string)
+			for _, container := range listed {
+				got[container.Config.ContainerName] = container.IPAddress
+			}
+			if !reflect.DeepEqual(got, step.wantIPs) {
+				t.Errorf("listed %v, want %v", got, step.wantIPs)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package docker
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ConfigDiff describes what changed between two nginx configurations
+type ConfigDiff struct {
+	AddedHosts      []string
+	RemovedHosts    []string
+	ChangedHosts    []string // hosts whose server-level settings changed
+	UpstreamChanges []string
+	LocationChanges []string
+}
+
+// DiffConfigs compares two configurations structurally. A nil previous
+// config is treated as empty, so everything in current shows up as added.
+func DiffConfigs(previous, current *NginxConfig) ConfigDiff {
+	if previous == nil {
+		previous = &NginxConfig{}
+	}
+	if current == nil {
+		current = &NginxConfig{}
+	}
+
+	var diff ConfigDiff
+
+	// Servers and their locations
+	oldServers := make(map[string]ServerConfig)
+	for _, server := range previous.Servers {
+		oldServers[server.ServerName] = server
+	}
+	newServers := make(map[string]ServerConfig)
+	for _, server := range current.Servers {
+		newServers[server.ServerName] = server
+	}
+
+	for _, host := range sortedKeys(newServers) {
+		server := newServers[host]
+		old, exists := oldServers[host]
+		if !exists {
+			diff.AddedHosts = append(diff.AddedHosts, host)
+			continue
+		}
+		if !reflect.DeepEqual(serverSettings(old), serverSettings(server)) {
+			diff.ChangedHosts = append(diff.ChangedHosts, host)
+		}
+		diff.LocationChanges = append(diff.LocationChanges, diffLocations(host, old.Locations, server.Locations)...)
+	}
+	for _, host := range sortedKeys(oldServers) {
+		if _, exists := newServers[host]; !exists {
+			diff.RemovedHosts = append(diff.RemovedHosts, host)
+		}
+	}
+
+	// Upstreams and their membership
+	oldUpstreams := make(map[string]UpstreamConfig)
+	for _, upstream := range previous.Upstreams {
+		oldUpstreams[upstream.Name] = upstream
+	}
+	newUpstreams := make(map[string]UpstreamConfig)
+	for _, upstream := range current.Upstreams {
+		newUpstreams[upstream.Name] = upstream
+	}
+
+	for _, name := range sortedKeys(newUpstreams) {
+		upstream := newUpstreams[name]
+		old, exists := oldUpstreams[name]
+		if !exists {
+			diff.UpstreamChanges = append(diff.UpstreamChanges,
+				fmt.Sprintf("+%s (%s)", name, strings.Join(upstreamAddresses(upstream), ", ")))
+			continue
+		}
+
+		var changes []string
+		oldAddrs := stringSet(upstreamAddresses(old))
+		newAddrs := stringSet(upstreamAddresses(upstream))
+		for _, addr := range upstreamAddresses(upstream) {
+			if !oldAddrs[addr] {
+				changes = append(changes, "+"+addr)
+			}
+		}
+		for _, addr := range upstreamAddresses(old) {
+			if !newAddrs[addr] {
+				changes = append(changes, "-"+addr)
+			}
+		}
+		if len(changes) == 0 && !reflect.DeepEqual(old, upstream) {
+			changes = append(changes, "settings changed")
+		}
+		if len(changes) > 0 {
+			diff.UpstreamChanges = append(diff.UpstreamChanges,
+				fmt.Sprintf("~%s: %s", name, strings.Join(changes, " ")))
+		}
+	}
+	for _, name := range sortedKeys(oldUpstreams) {
+		if _, exists := newUpstreams[name]; !exists {
+			diff.UpstreamChanges = append(diff.UpstreamChanges, "-"+name)
+		}
+	}
+
+	return diff
+}
+
+// Empty reports whether the diff contains no changes
+func (d ConfigDiff) Empty() bool {
+	return len(d.AddedHosts) == 0 && len(d.RemovedHosts) == 0 && len(d.ChangedHosts) == 0 &&
+		len(d.UpstreamChanges) == 0 && len(d.LocationChanges) == 0
+}
+
+// String renders the diff as one change per line
+func (d ConfigDiff) String() string {
+	var lines []string
+	for _, host := range d.AddedHosts {
+		lines = append(lines, "host +"+host)
+	}
+	for _, host := range d.RemovedHosts {
+		lines = append(lines, "host -"+host)
+	}
+	for _, host := range d.ChangedHosts {
+		lines = append(lines, "host ~"+host+": server settings changed")
+	}
+	for _, change := range d.UpstreamChanges {
+		lines = append(lines, "upstream "+change)
+	}
+	for _, change := range d.LocationChanges {
+		lines = append(lines, "location "+change)
+	}
+	if len(lines) == 0 {
+		return "no changes"
+	}
+	return strings.Join(lines, "\n")
+}
+
+// diffLocations compares the locations of one host by path
+func diffLocations(host string, previous, current []LocationConfig) []string {
+	oldLocations := make(map[string]LocationConfig)
+	for _, location := range previous {
+		oldLocations[location.Path] = location
+	}
+	newLocations := make(map[string]LocationConfig)
+	for _, location := range current {
+		newLocations[location.Path] = location
+	}
+
+	var changes []string
+	for _, path := range sortedKeys(newLocations) {
+		old, exists := oldLocations[path]
+		switch {
+		case !exists:
+			changes = append(changes, fmt.Sprintf("+%s%s", host, path))
+		case !reflect.DeepEqual(old, newLocations[path]):
+			changes = append(changes, fmt.Sprintf("~%s%s", host, path))
+		}
+	}
+	for _, path := range sortedKeys(oldLocations) {
+		if _, exists := newLocations[path]; !exists {
+			changes = append(changes, fmt.Sprintf("-%s%s", host, path))
+		}
+	}
+	return changes
+}
+
+// serverSettings returns a server without its locations, for comparing
+// server-level settings only
+func serverSettings(server ServerConfig) ServerConfig {
+	server.Locations = nil
+	return server
+}
+
+// upstreamAddresses returns the server addresses of an upstream
+func upstreamAddresses(upstream UpstreamConfig) []string {
+	addresses := make([]string, 0, len(upstream.Servers))
+	for _, server := range upstream.Servers {
+		addresses = append(addresses, server.Address)
+	}
+	return addresses
+}
+
+func stringSet(items []string) map[string]bool {
+	set := make(map[string]bool, len(items))
+	for _, item := range items {
+		set[item] = true
+	}
+	return set
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,100 @@
+package docker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffConfigs(t *testing.T) {
+	web := newTestContainer(t, "web", "10.0.0.2", hostLabels("web.test", nil))
+	api := newTestContainer(t, "api", "10.0.0.3", hostLabels("api.test", map[string]string{LabelPath: "/v1"}))
+	before := generateTestConfig(t, DefaultGeneratorOptions(), web, api)
+
+	tests := []struct {
+		name       string
+		containers []*ContainerData
+		want       string
+	}{
+		{"unchanged", []*ContainerData{web, api}, "no changes"},
+		{
+			name:       "backend moved",
+			containers: []*ContainerData{newTestContainer(t, "web", "10.0.0.9", hostLabels("web.test", nil)), api},
+			want:       "upstream ~backend_web_test_web_85c1cde8: +10.0.0.9:80 -10.0.0.2:80",
+		},
+		{
+			name:       "host removed",
+			containers: []*ContainerData{web},
+			want:       "host -api.test\nupstream -backend_api_test_api_8337e330",
+		},
+		{
+			name:       "host added",
+			containers: []*ContainerData{web, api, newTestContainer(t, "shop", "10.0.0.4", hostLabels("shop.test", nil))},
+			want:       "host +shop.test\nupstream +backend_shop_test_shop_3b970beb (10.0.0.4:80)",
+		},
+		{
+			name:       "server settings changed",
+			containers: []*ContainerData{newTestContainer(t, "web", "10.0.0.2", hostLabels("web.test", map[string]string{LabelTLS: "true"})), api},
+			want:       "host ~web.test: server settings changed",
+		},
+		{
+			name:       "location changed",
+			containers: []*ContainerData{web, newTestContainer(t, "api", "10.0.0.3", hostLabels("api.test", map[string]string{LabelPath: "/v1", LabelCORS: "true"}))},
+			want:       "location ~api.test/v1",
+		},
+		{
+			name:       "location moved",
+			containers: []*ContainerData{web, newTestContainer(t, "api", "10.0.0.3", hostLabels("api.test", map[string]string{LabelPath: "/v2"}))},
+			want: "upstream +backend_api_test_api_27730fd7 (10.0.0.3:80)\nupstream -backend_api_test_api_8337e330\n" +
+				"location +api.test/v2\nlocation -api.test/v1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			after := generateTestConfig(t, DefaultGeneratorOptions(), tt.containers...)
+			diff := DiffConfigs(before, after)
+			if got := diff.String(); got != tt.want {
+				t.Errorf("diff:\n%s\nwant:\n%s", got, tt.want)
+			}
+			if diff.Empty() != (tt.want == "no changes") {
+				t.Errorf("Empty() = %v for:\n%s", diff.Empty(), diff)
+			}
+		})
+	}
+}
+
+func TestOnConfigChangeReceivesDiff(t *testing.T) {
+	web := fakeContainer{Name: "web", IP: "172.18.0.2", Labels: map[string]string{LabelEnable: "true", LabelHost: "web.test"}}
+	api := fakeContainer{Name: "api", IP: "172.18.0.3", Labels: map[string]string{LabelEnable: "true", LabelHost: "api.test"}}
+
+	steps := []struct {
+		name       string
+		containers []fakeContainer
+		wantHosts  []string // added hosts, nil when no change is applied
+		wantCalls  int
+	}{
+		{"initial", []fakeContainer{web}, []string{"web.test"}, 1},
+		{"unchanged", []fakeContainer{web}, nil, 0},
+		{"host added", []fakeContainer{web, api}, []string{"api.test"}, 1},
+	}
+
+	var diffs []ConfigDiff
+	docker := newFakeDocker()
+	p := newTestProvider(t, docker, Config{
+		OnConfigChange: func(config *NginxConfig, diff ConfigDiff) { diffs = append(diffs, diff) },
+	})
+
+	for _, step := range steps {
+		diffs = nil
+		docker.set(step.containers...)
+		if err := p.loadConfiguration(); err != nil {
+			t.Fatalf("%s: loadConfiguration: %v", step.name, err)
+		}
+		if len(diffs) != step.wantCalls {
+			t.Fatalf("%s: OnConfigChange called %d times, want %d", step.name, len(diffs), step.wantCalls)
+		}
+		if step.wantCalls > 0 && !reflect.DeepEqual(diffs[0].AddedHosts, step.wantHosts) {
+			t.Errorf("%s: added hosts %v, want %v", step.name, diffs[0].AddedHosts, step.wantHosts)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package docker
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+// waitForEvents waits until p has counted n Docker events
+func waitForEvents(t *testing.T, p *Provider, n int) ReloadStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := p.GetReloadStatus()
+		if status.EventsReceived >= n {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("counted %d events, want %d", status.EventsReceived, n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEventDebounce(t *testing.T) {
+	tests := []struct {
+		name          string
+		debounce      time.Duration
+		burst         bool // all events at once, else waiting for each reload
+		wantReloads   int
+		wantCoalesced int
+	}{
+		{name: "burst within the window", debounce: 200 * time.Millisecond, burst: true, wantReloads: 1, wantCoalesced: 9},
+		{name: "events in separate windows", debounce: 20 * time.Millisecond, wantReloads: 10},
+		{name: "no debounce", wantReloads: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docker := newFakeDocker()
+			p := newTestProvider(t, docker, Config{EventDebounce: tt.debounce})
+			if err := p.Start(); err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+
+			var containers []fakeContainer
+			for i := 0; i < 10; i++ {
+				c := fakeContainer{
+					Name:   fmt.Sprintf("app%d", i),
+					IP:     fmt.Sprintf("172.18.0.%d", i+2),
+					Labels: map[string]string{LabelEnable: "true", LabelHost: fmt.Sprintf("app%d.test", i)},
+				}
+				containers = append(containers, c)
+				if tt.burst {
+					continue
+				}
+				docker.set(containers...)
+				docker.emit(events.ActionStart, c)
+				waitForEvents(t, p, i+1)
+			}
+			if tt.burst {
+				docker.set(containers...)
+				for _, c := range containers {
+					docker.emit(events.ActionStart, c)
+				}
+			}
+
+			status := waitForEvents(t, p, 10)
+			if status.EventReloads != tt.wantReloads || status.EventsCoalesced != tt.wantCoalesced {
+				t.Errorf("reloads = %d, coalesced = %d, want %d and %d",
+					status.EventReloads, status.EventsCoalesced, tt.wantReloads, tt.wantCoalesced)
+			}
+			if got := len(p.GetCurrentConfig().Servers); got != 10 {
+				t.Errorf("servers = %d, want 10", got)
+			}
+		})
+	}
+}
+
+func TestIrrelevantEventsCoalesced(t *testing.T) {
+	docker := newFakeDocker(fakeContainer{Name: "db", IP: "172.18.0.2"})
+	p := newTestProvider(t, docker, Config{EventDebounce: 20 * time.Millisecond})
+	if err := p.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	// An unlabeled container starting and an untracked one stopping
+	docker.emit(events.ActionStart, fakeContainer{Name: "db"})
+	docker.emit(events.ActionDie, fakeContainer{Name: "other"})
+
+	status := waitForEvents(t, p, 2)
+	if status.EventReloads != 0 || status.EventsCoalesced != 2 {
+		t.Errorf("reloads = %d, coalesced = %d, want 0 and 2", status.EventReloads, status.EventsCoalesced)
+	}
+}
@@ -5,20 +5,18 @@ import (
 	"context"
 	"fmt"
 	"strings"
-
-	"github.com/docker/docker/client"
 )
 
 // FastCGIParameterManager handles FastCGI parameter file downloading and parsing
 type FastCGIParameterManager struct {
-	client    *client.Client
+	client    DockerAPI
 	cacheDir  string
 	ctx       context.Context
 	snippetManager *SnippetManager // Reuse snippet manager for file operations
 }
 
 // NewFastCGIParameterManager creates a new FastCGI parameter manager
-func NewFastCGIParameterManager(client *client.Client, cacheDir string) *FastCGIParameterManager {
+func NewFastCGIParameterManager(client DockerAPI, cacheDir string) *FastCGIParameterManager {
 	return &FastCGIParameterManager{
 		client:         client,
 		cacheDir:       cacheDir,
@@ -27,32 +25,44 @@ func NewFastCGIParameterManager(client *client.Client, cacheDir string) *FastCGI
 	}
 }
 
-// LoadFastCGIParams loads FastCGI parameters from container file or labels
+// LoadFastCGIParams loads FastCGI parameters from container files and labels.
+// Params files are applied in the order listed, later files overriding earlier
+// ones, and parameters from the direct label override all files.
 func (fpm *FastCGIParameterManager) LoadFastCGIParams(config *ContainerConfig) (map[string]string, error) {
+	return fpm.LoadFastCGIParamsWithPolicy(config, SnippetFailClosed)
+}
+
+// LoadFastCGIParamsWithPolicy is LoadFastCGIParams where, with fail-open, a
+// params file whose path is rejected is skipped with a warning instead of
+// failing. Files that can't be downloaded or parsed always fail.
+func (fpm *FastCGIParameterManager) LoadFastCGIParamsWithPolicy(config *ContainerConfig, policy SnippetFailurePolicy) (map[string]string, error) {
 	params := make(map[string]string)
 	
-	// First, add any parameters from direct labels
-	if config.FastCGI.Params != nil {
-		for key, value := range config.FastCGI.Params {
-			params[key] = value
+	// First, load parameters from files if specified (requires a manager with Docker access)
+	if fpm != nil {
+		for _, paramsFile := range config.FastCGI.ParamsFiles {
+			fileParams, err := fpm.loadParamsFromFile(config.ContainerID, paramsFile)
+			if err != nil && IsSnippetPathRejected(err) && policy != SnippetFailClosed {
+				fmt.Printf("Warning: FastCGI params file rejected for container %s, continuing without it: %v\n", config.ContainerName, err)
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to load FastCGI params from file %s: %w", paramsFile, err)
+			}
+			
+			for key, value := range fileParams {
+				params[key] = value
+			}
 		}
 	}
 	
-	// Then, load parameters from file if specified
-	if config.FastCGI.ParamsFile != "" {
-		fileParams, err := fpm.loadParamsFromFile(config.ContainerID, config.FastCGI.ParamsFile)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load FastCGI params from file %s: %w", config.FastCGI.ParamsFile, err)
-		}
-		
-		// Merge file parameters (file takes precedence over labels)
-		for key, value := range fileParams {
-			params[key] = value
-		}
+	// Then, apply parameters from direct labels (labels take precedence over files)
+	for key, value := range config.FastCGI.Params {
+		params[key] = value
 	}
 	
-	// Add default PHP-FPM parameters if not specified
-	fpm.addDefaultPHPParams(params)
+	// Add the selected default parameter set where not specified
+	addDefaultParams(params, config.FastCGI.Defaults)
 	
 	return params, nil
 }
@@ -132,29 +142,58 @@ func (fpm *FastCGIParameterManager) parseFastCGIParamsFile(content string) (map[
 	return params, nil
 }
 
-// addDefaultPHPParams adds common PHP-FPM parameters if not already specified
-func (fpm *FastCGIParameterManager) addDefaultPHPParams(params map[string]string) {
-	defaults := map[string]string{
-		"SCRIPT_FILENAME":   "$document_root$fastcgi_script_name",
-		"QUERY_STRING":      "$query_string",
-		"REQUEST_METHOD":    "$request_method",
-		"CONTENT_TYPE":      "$content_type",
-		"CONTENT_LENGTH":    "$content_length",
-		"SCRIPT_NAME":       "$fastcgi_script_name",
-		"REQUEST_URI":       "$request_uri",
-		"DOCUMENT_URI":      "$document_uri",
-		"DOCUMENT_ROOT":     "$document_root",
-		"SERVER_PROTOCOL":   "$server_protocol",
-		"REQUEST_SCHEME":    "$scheme",
-		"HTTPS":            "$https if_not_empty",
-		"GATEWAY_INTERFACE": "CGI/1.1",
-		"SERVER_SOFTWARE":   "nginx/$nginx_version",
-		"REMOTE_ADDR":       "$remote_addr",
-		"REMOTE_PORT":       "$remote_port",
-		"SERVER_ADDR":       "$server_addr",
-		"SERVER_PORT":       "$server_port",
-		"SERVER_NAME":       "$server_name",
-		"REDIRECT_STATUS":   "200",
+// Default FastCGI parameter sets selected with the fastcgi-defaults label
+const (
+	FastCGIDefaultsPHP  = "php"  // PHP-FPM parameters (default)
+	FastCGIDefaultsCGI  = "cgi"  // Plain CGI/1.1 meta-variables only
+	FastCGIDefaultsNone = "none" // No defaults, params come from labels and files only
+)
+
+// addDefaultParams adds the parameters of the given default set if not already specified
+func addDefaultParams(params map[string]string, set string) {
+	var defaults map[string]string
+	switch set {
+	case FastCGIDefaultsNone:
+		return
+	case FastCGIDefaultsCGI:
+		defaults = map[string]string{
+			"SCRIPT_FILENAME":   "$document_root$fastcgi_script_name",
+			"SCRIPT_NAME":       "$fastcgi_script_name",
+			"QUERY_STRING":      "$query_string",
+			"REQUEST_METHOD":    "$request_method",
+			"CONTENT_TYPE":      "$content_type",
+			"CONTENT_LENGTH":    "$content_length",
+			"REQUEST_URI":       "$request_uri",
+			"SERVER_PROTOCOL":   "$server_protocol",
+			"GATEWAY_INTERFACE": "CGI/1.1",
+			"SERVER_SOFTWARE":   "nginx/$nginx_version",
+			"REMOTE_ADDR":       "$remote_addr",
+			"SERVER_NAME":       "$server_name",
+			"SERVER_PORT":       "$server_port",
+		}
+	default:
+		defaults = map[string]string{
+			"SCRIPT_FILENAME":   "$document_root$fastcgi_script_name",
+			"QUERY_STRING":      "$query_string",
+			"REQUEST_METHOD":    "$request_method",
+			"CONTENT_TYPE":      "$content_type",
+			"CONTENT_LENGTH":    "$content_length",
+			"SCRIPT_NAME":       "$fastcgi_script_name",
+			"REQUEST_URI":       "$request_uri",
+			"DOCUMENT_URI":      "$document_uri",
+			"DOCUMENT_ROOT":     "$document_root",
+			"SERVER_PROTOCOL":   "$server_protocol",
+			"REQUEST_SCHEME":    "$scheme",
+			"HTTPS":            "$https if_not_empty",
+			"GATEWAY_INTERFACE": "CGI/1.1",
+			"SERVER_SOFTWARE":   "nginx/$nginx_version",
+			"REMOTE_ADDR":       "$remote_addr",
+			"REMOTE_PORT":       "$remote_port",
+			"SERVER_ADDR":       "$server_addr",
+			"SERVER_PORT":       "$server_port",
+			"SERVER_NAME":       "$server_name",
+			"REDIRECT_STATUS":   "200",
+		}
 	}
 	
 	// Only add defaults that aren't already specified
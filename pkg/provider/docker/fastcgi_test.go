@@ -0,0 +1,147 @@
+package docker
+
+import "testing"
+
+func TestLoadFastCGIParamsFiles(t *testing.T) {
+	files := map[string]string{
+		"/app/base.conf":     "fastcgi_param APP_ENV base;\nfastcgi_param APP_NAME \"shop\";\n# comment\n",
+		"/app/override.conf": "APP_ENV=prod\nAPP_DEBUG='0'\n",
+	}
+
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:   "single file",
+			labels: map[string]string{LabelFastCGIParamsFile: "/app/base.conf"},
+			want:   map[string]string{"APP_ENV": "base", "APP_NAME": "shop"},
+		},
+		{
+			name:   "later files override earlier ones",
+			labels: map[string]string{LabelFastCGIParamsFile: "/app/base.conf, /app/override.conf"},
+			want:   map[string]string{"APP_ENV": "prod", "APP_NAME": "shop", "APP_DEBUG": "0"},
+		},
+		{
+			name:   "order matters",
+			labels: map[string]string{LabelFastCGIParamsFile: "/app/override.conf,/app/base.conf"},
+			want:   map[string]string{"APP_ENV": "base", "APP_DEBUG": "0"},
+		},
+		{
+			name: "inline params override files",
+			labels: map[string]string{
+				LabelFastCGIParamsFile: "/app/base.conf,/app/override.conf",
+				LabelFastCGIParams:     "APP_ENV=staging",
+			},
+			want: map[string]string{"APP_ENV": "staging", "APP_NAME": "shop"},
+		},
+		{
+			name:    "missing file",
+			labels:  map[string]string{LabelFastCGIParamsFile: "/app/base.conf,/app/missing.conf"},
+			wantErr: "/app/missing.conf",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := map[string]string{LabelHost: "php.test", LabelBackendProtocol: "FCGI", LabelPort: "9000"}
+			for key, value := range tt.labels {
+				labels[key] = value
+			}
+			container := newTestContainer(t, "php", "10.0.0.2", labels)
+			docker := newFakeDocker()
+			for path, content := range files {
+				docker.files[container.Config.ContainerID+":"+path] = content
+			}
+			fpm := NewFastCGIParameterManager(docker, t.TempDir())
+
+			params, err := fpm.LoadFastCGIParams(container.Config)
+			checkError(t, err, tt.wantErr)
+			for key, value := range tt.want {
+				if params[key] != value {
+					t.Errorf("%s = %q, want %q", key, params[key], value)
+				}
+			}
+		})
+	}
+}
+
+func TestFastCGIDefaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		defaults string // fastcgi-defaults label, omitted when empty
+		want     map[string]string
+		unwanted []string
+		wantErr  string
+	}{
+		{
+			name: "php by default",
+			want: map[string]string{"DOCUMENT_ROOT": "$document_root", "REDIRECT_STATUS": "200", "APP_ENV": "prod"},
+		},
+		{
+			name:     "true selects php",
+			defaults: "true",
+			want:     map[string]string{"REDIRECT_STATUS": "200", "HTTPS": "$https if_not_empty"},
+		},
+		{
+			name:     "cgi set",
+			defaults: "CGI",
+			want:     map[string]string{"GATEWAY_INTERFACE": "CGI/1.1", "SCRIPT_NAME": "$fastcgi_script_name"},
+			unwanted: []string{"DOCUMENT_ROOT", "REDIRECT_STATUS", "HTTPS"},
+		},
+		{
+			name:     "false disables defaults",
+			defaults: "false",
+			want:     map[string]string{"APP_ENV": "prod"},
+			unwanted: []string{"REQUEST_METHOD", "QUERY_STRING", "REDIRECT_STATUS"},
+		},
+		{
+			name:     "none disables defaults",
+			defaults: "none",
+			want:     map[string]string{"APP_ENV": "prod"},
+			unwanted: []string{"REQUEST_METHOD", "GATEWAY_INTERFACE"},
+		},
+		{
+			name:     "labels override defaults",
+			defaults: "php",
+			want:     map[string]string{"SCRIPT_FILENAME": "/srv/index.php"},
+		},
+		{name: "unknown set", defaults: "python", wantErr: `invalid fastcgi-defaults "python"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := map[string]string{
+				LabelHost:            "php.test",
+				LabelBackendProtocol: "FCGI",
+				LabelPort:            "9000",
+				LabelFastCGIParams:   "APP_ENV=prod,SCRIPT_FILENAME=/srv/index.php",
+			}
+			if tt.defaults != "" {
+				labels[LabelFastCGIDefaults] = tt.defaults
+			}
+			config, err := validateTestLabels(labels)
+			checkError(t, err, tt.wantErr)
+			if tt.wantErr != "" {
+				return
+			}
+
+			params, err := NewFastCGIParameterManager(newFakeDocker(), t.TempDir()).LoadFastCGIParams(config)
+			if err != nil {
+				t.Fatalf("LoadFastCGIParams: %v", err)
+			}
+			for key, value := range tt.want {
+				if params[key] != value {
+					t.Errorf("%s = %q, want %q", key, params[key], value)
+				}
+			}
+			for _, key := range tt.unwanted {
+				if value, ok := params[key]; ok {
+					t.Errorf("unexpected default %s = %q", key, value)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultFileMode is the mode of generated config, metadata and snippet cache files
+const DefaultFileMode os.FileMode = 0644
+
+// FilePermissions controls the mode and owner of files written by the controller.
+// A UID or GID of -1 leaves that part of the ownership unchanged.
+type FilePermissions struct {
+	Mode os.FileMode
+	UID  int
+	GID  int
+}
+
+// DefaultFilePermissions returns 0644 without changing ownership
+func DefaultFilePermissions() FilePermissions {
+	return FilePermissions{Mode: DefaultFileMode, UID: -1, GID: -1}
+}
+
+// ParseFileMode parses an octal file mode such as "0640"; empty returns the default
+func ParseFileMode(value string) (os.FileMode, error) {
+	if value == "" {
+		return DefaultFileMode, nil
+	}
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode == 0 || mode > 0777 {
+		return 0, fmt.Errorf("invalid file mode %q, must be an octal mode like 0640", value)
+	}
+	if mode&0400 == 0 {
+		return 0, fmt.Errorf("invalid file mode %q, the owner must be able to read the file", value)
+	}
+	return os.FileMode(mode), nil
+}
+
+// ParseFileOwner parses "uid:gid" (or just "uid"); empty returns -1, -1
+func ParseFileOwner(value string) (uid, gid int, err error) {
+	if value == "" {
+		return -1, -1, nil
+	}
+
+	uidStr, gidStr, hasGID := strings.Cut(value, ":")
+	if uid, err = strconv.Atoi(uidStr); err != nil || uid < 0 {
+		return -1, -1, fmt.Errorf("invalid file owner %q, must be uid[:gid]", value)
+	}
+	gid = -1
+	if hasGID {
+		if gid, err = strconv.Atoi(gidStr); err != nil || gid < 0 {
+			return -1, -1, fmt.Errorf("invalid file owner %q, must be uid[:gid]", value)
+		}
+	}
+	return uid, gid, nil
+}
+
+// apply sets the mode and owner of path. The mode is set explicitly since
+// os.WriteFile only applies it, minus the umask, when creating a file.
+func (fp FilePermissions) apply(path string) error {
+	if err := os.Chmod(path, fp.Mode); err != nil {
+		return fmt.Errorf("failed to set permissions of %s: %w", path, err)
+	}
+	if fp.UID >= 0 || fp.GID >= 0 {
+		if err := os.Chown(path, fp.UID, fp.GID); err != nil {
+			return fmt.Errorf("failed to change owner of %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// writeFile writes data to path with the configured mode and owner
+func (fp FilePermissions) writeFile(path string, data []byte) error {
+	if err := os.WriteFile(path, data, fp.Mode); err != nil {
+		return err
+	}
+	return fp.apply(path)
+}
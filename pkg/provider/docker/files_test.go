@@ -0,0 +1,121 @@
+package docker
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseFileMode(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    os.FileMode
+		wantErr string
+	}{
+		{"", DefaultFileMode, ""},
+		{"0640", 0640, ""},
+		{"600", 0600, ""},
+		{"0", 0, "must be an octal mode"},
+		{"0999", 0, "must be an octal mode"},
+		{"01777", 0, "must be an octal mode"},
+		{"rw-r-----", 0, "must be an octal mode"},
+		{"0044", 0, "the owner must be able to read"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseFileMode(tt.value)
+			checkError(t, err, tt.wantErr)
+			if got != tt.want {
+				t.Errorf("ParseFileMode(%q) = %o, want %o", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFileOwner(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantUID int
+		wantGID int
+		wantErr string
+	}{
+		{"", -1, -1, ""},
+		{"101", 101, -1, ""},
+		{"101:102", 101, 102, ""},
+		{"nginx", -1, -1, "must be uid[:gid]"},
+		{"101:", -1, -1, "must be uid[:gid]"},
+		{"-1:5", -1, -1, "must be uid[:gid]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			uid, gid, err := ParseFileOwner(tt.value)
+			checkError(t, err, tt.wantErr)
+			if uid != tt.wantUID || gid != tt.wantGID {
+				t.Errorf("ParseFileOwner(%q) = %d, %d, want %d, %d", tt.value, uid, gid, tt.wantUID, tt.wantGID)
+			}
+		})
+	}
+}
+
+func TestWrittenFilePermissions(t *testing.T) {
+	web := fakeContainer{Name: "web", IP: "172.18.0.2", Labels: map[string]string{
+		LabelEnable:               "true",
+		LabelHost:                 "web.test",
+		LabelConfigurationSnippet: "/app/location.conf",
+	}}
+	owner := fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+
+	tests := []struct {
+		name string
+		mode string
+		want os.FileMode
+	}{
+		{"default mode", "", DefaultFileMode},
+		{"restricted mode", "0640", 0640},
+		{"owner only", "0600", 0600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docker := newFakeDocker(web)
+			docker.files[web.id()+":/app/location.conf"] = "add_header X-Snippet yes;"
+			p := newTestProvider(t, docker, Config{FileMode: tt.mode, FileOwner: owner})
+			if err := p.loadConfiguration(); err != nil {
+				t.Fatalf("loadConfiguration: %v", err)
+			}
+
+			// The config and the snippet cache share the provider's directory
+			written := 0
+			err := filepath.WalkDir(filepath.Dir(p.nginxConfigPath), func(path string, entry fs.DirEntry, err error) error {
+				if err != nil || entry.IsDir() {
+					return err
+				}
+				info, err := entry.Info()
+				if err != nil {
+					return err
+				}
+				written++
+				if got := info.Mode().Perm(); got != tt.want {
+					t.Errorf("%s has mode %o, want %o", path, got, tt.want)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The config, its metadata and the cached snippet
+			if written < 3 {
+				t.Errorf("found %d written files, want at least 3", written)
+			}
+		})
+	}
+
+	t.Run("invalid mode rejected", func(t *testing.T) {
+		_, err := NewProvider(newFakeDocker(), Config{FileMode: "0044"})
+		checkError(t, err, "invalid file mode")
+	})
+}
@@ -0,0 +1,406 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/system"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/go-connections/nat"
+)
+
+// testTemplatePath is the nginx template of the repository
+const testTemplatePath = "../../../templates/nginx.conf.tmpl"
+
+// testContainerID returns a stable 64 character container ID for name
+func testContainerID(name string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(name)))
+}
+
+// newTestContainer extracts a container's config from labels, adding
+// nginx.ingress.enable, and fails the test when the labels are invalid
+func newTestContainer(t testing.TB, name, ip string, labels map[string]string) *ContainerData {
+	t.Helper()
+	withEnable := map[string]string{LabelEnable: "true"}
+	for key, value := range labels {
+		withEnable[key] = value
+	}
+	config, err := ExtractConfig(testContainerID(name), name, ip, withEnable)
+	if err != nil {
+		t.Fatalf("ExtractConfig(%s): %v", name, err)
+	}
+	if err := ValidateConfig(config); err != nil {
+		t.Fatalf("ValidateConfig(%s): %v", name, err)
+	}
+	return &ContainerData{Config: config, IPAddress: ip, NetworkName: "bridge", Status: "running"}
+}
+
+// validateTestLabels extracts and validates the config of a container with
+// labels plus nginx.ingress.enable
+func validateTestLabels(labels map[string]string) (*ContainerConfig, error) {
+	withEnable := map[string]string{LabelEnable: "true"}
+	for key, value := range labels {
+		withEnable[key] = value
+	}
+	config, err := ExtractConfig(testContainerID("app"), "app", "10.0.0.2", withEnable)
+	if err != nil {
+		return nil, err
+	}
+	return config, ValidateConfig(config)
+}
+
+// checkError fails the test unless err is nil for an empty want, or else
+// contains want
+func checkError(t testing.TB, err error, want string) {
+	t.Helper()
+	if want == "" {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return
+	}
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("error = %v, want %q", err, want)
+	}
+}
+
+// generateTestConfig generates the config of containers with opts
+func generateTestConfig(t testing.TB, opts GeneratorOptions, containers ...*ContainerData) *NginxConfig {
+	t.Helper()
+	config, err := GenerateNginxConfigWithOptions(containers, nil, nil, opts)
+	if err != nil {
+		t.Fatalf("GenerateNginxConfigWithOptions: %v", err)
+	}
+	return config
+}
+
+// renderTestConfig generates and renders the config of containers
+func renderTestConfig(t testing.TB, opts GeneratorOptions, containers ...*ContainerData) string {
+	t.Helper()
+	rendered, err := RenderNginxConfig(generateTestConfig(t, opts, containers...), testTemplatePath)
+	if err != nil {
+		t.Fatalf("RenderNginxConfig: %v", err)
+	}
+	return rendered
+}
+
+// locationBlock returns the body of the first "location <path> {" block of
+// a rendered config, up to its closing brace
+func locationBlock(t testing.TB, rendered, path string) string {
+	t.Helper()
+	return configBlock(t, rendered, "location "+path+" {")
+}
+
+// configBlock returns the first block of a rendered config starting with
+// header, up to its closing brace
+func configBlock(t testing.TB, rendered, header string) string {
+	t.Helper()
+	start := strings.Index(rendered, header)
+	if start < 0 {
+		t.Fatalf("no %s in:\n%s", header, rendered)
+	}
+	depth := 0
+	for i := start; i < len(rendered); i++ {
+		switch rendered[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return rendered[start : i+1]
+			}
+		}
+	}
+	t.Fatalf("unterminated %s", header)
+	return ""
+}
+
+// fakeContainer is a container served by fakeDocker
+type fakeContainer struct {
+	ID       string
+	Name     string
+	IP       string
+	State    string
+	Labels   map[string]string
+	Exposed  []string // e.g. "8080/tcp"
+	Ports    []container.Port
+	Networks map[string]string // network name -> IP, default {"bridge": IP}
+	Unlisted bool              // inspectable but missing from listings
+}
+
+// fakeDocker is an in-memory DockerAPI
+type fakeDocker struct {
+	mu         sync.Mutex
+	containers []fakeContainer
+	files      map[string]string // "<id>:<path>" -> content
+	events     chan events.Message
+	errs       chan error
+	infoErr    error
+	listErr    error
+
+	// When set, a listing signals listStarted and waits for listRelease
+	// to be closed
+	listStarted chan struct{}
+	listRelease chan struct{}
+
+	// inspectDelay keeps each inspect in flight for a while, so concurrent
+	// inspects overlap
+	inspectDelay time.Duration
+
+	lists         int
+	listing       int // listings in flight
+	maxListing    int
+	inspects      int
+	inspecting    int // inspects in flight
+	maxInspecting int
+	infos         int
+}
+
+func newFakeDocker(containers ...fakeContainer) *fakeDocker {
+	return &fakeDocker{
+		containers: containers,
+		files:      make(map[string]string),
+		events:     make(chan events.Message, 100),
+		errs:       make(chan error, 1),
+	}
+}
+
+// set replaces the containers served
+func (f *fakeDocker) set(containers ...fakeContainer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.containers = containers
+}
+
+func (c fakeContainer) id() string {
+	if c.ID != "" {
+		return c.ID
+	}
+	return testContainerID(c.Name)
+}
+
+func (c fakeContainer) networks() map[string]*network.EndpointSettings {
+	networks := make(map[string]*network.EndpointSettings)
+	if c.Networks == nil {
+		networks["bridge"] = &network.EndpointSettings{IPAddress: c.IP, EndpointID: "ep-" + c.Name}
+		return networks
+	}
+	for name, ip := range c.Networks {
+		networks[name] = &network.EndpointSettings{IPAddress: ip, EndpointID: "ep-" + c.Name + "-" + name}
+	}
+	return networks
+}
+
+func (f *fakeDocker) ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+	f.mu.Lock()
+	f.listing++
+	if f.listing > f.maxListing {
+		f.maxListing = f.listing
+	}
+	started, release := f.listStarted, f.listRelease
+	f.mu.Unlock()
+	if started != nil {
+		started <- struct{}{}
+		<-release
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.listing--
+	f.lists++
+	if f.listErr != nil {
+		return nil, f.listErr
+	}
+
+	var summaries []container.Summary
+	for _, c := range f.containers {
+		if c.Unlisted {
+			continue
+		}
+		state := c.State
+		if state == "" {
+			state = "running"
+		}
+		summaries = append(summaries, container.Summary{
+			ID:              c.id(),
+			Names:           []string{"/" + c.Name},
+			Image:           "image-" + c.Name,
+			State:           state,
+			Status:          "Up",
+			Labels:          c.Labels,
+			Ports:           c.Ports,
+			NetworkSettings: &container.NetworkSettingsSummary{Networks: c.networks()},
+		})
+	}
+	return summaries, nil
+}
+
+func (f *fakeDocker) ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error) {
+	f.mu.Lock()
+	f.inspecting++
+	if f.inspecting > f.maxInspecting {
+		f.maxInspecting = f.inspecting
+	}
+	delay := f.inspectDelay
+	f.mu.Unlock()
+	time.Sleep(delay)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inspecting--
+	f.inspects++
+
+	for _, c := range f.containers {
+		if c.id() != containerID {
+			continue
+		}
+		exposed := make(nat.PortSet)
+		for _, port := range c.Exposed {
+			exposed[nat.Port(port)] = struct{}{}
+		}
+		published := make(nat.PortMap)
+		for _, port := range c.Ports {
+			key := nat.Port(fmt.Sprintf("%d/%s", port.PrivatePort, port.Type))
+			published[key] = append(published[key], nat.PortBinding{HostIP: port.IP, HostPort: fmt.Sprint(port.PublicPort)})
+		}
+		return container.InspectResponse{
+			ContainerJSONBase: &container.ContainerJSONBase{
+				ID:    c.id(),
+				Name:  "/" + c.Name,
+				State: &container.State{Running: c.State != "restarting", Restarting: c.State == "restarting"},
+			},
+			Config: &container.Config{Labels: c.Labels, ExposedPorts: exposed},
+			NetworkSettings: &container.NetworkSettings{
+				NetworkSettingsBase: container.NetworkSettingsBase{Ports: published},
+				Networks:            c.networks(),
+			},
+		}, nil
+	}
+	return container.InspectResponse{}, errdefs.NotFound(fmt.Errorf("no such container: %s", containerID))
+}
+
+// CopyFromContainer returns the file content as is; the snippet manager
+// passes through content without tar headers
+func (f *fakeDocker) CopyFromContainer(ctx context.Context, containerID, srcPath string) (io.ReadCloser, container.PathStat, error) {
+	f.mu.Lock()
+	content, ok := f.files[containerID+":"+srcPath]
+	f.mu.Unlock()
+	if !ok {
+		return nil, container.PathStat{}, fmt.Errorf("no such file: %s", srcPath)
+	}
+	return io.NopCloser(strings.NewReader(content)), container.PathStat{Name: srcPath, Size: int64(len(content))}, nil
+}
+
+func (f *fakeDocker) Events(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error) {
+	return f.events, f.errs
+}
+
+func (f *fakeDocker) Info(ctx context.Context) (system.Info, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.infos++
+	return system.Info{}, f.infoErr
+}
+
+// counts returns how often containers were listed and inspected
+func (f *fakeDocker) counts() (lists, inspects int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lists, f.inspects
+}
+
+// newTestProvider creates a provider serving docker that writes its config
+// to a temporary directory, reloads with "true" and skips nginx -t
+func newTestProvider(t testing.TB, docker DockerAPI, config Config) *Provider {
+	t.Helper()
+	dir := t.TempDir()
+	if config.NginxConfigPath == "" {
+		config.NginxConfigPath = filepath.Join(dir, "ingress.conf")
+	}
+	if len(config.ReloadCommand) == 0 {
+		config.ReloadCommand = []string{"true"}
+	}
+	config.SnippetCacheDir = filepath.Join(dir, "snippets")
+	config.TemplatePath = testTemplatePath
+	config.SkipConfigTest = true
+	config.DisableTLS = true
+	p, err := NewProvider(docker, config)
+	if err != nil {
+		t.Fatalf("NewProvider: %v", err)
+	}
+	t.Cleanup(func() { p.Stop() })
+	return p
+}
+
+// readTestConfig returns the config written by p
+func readTestConfig(t testing.TB, p *Provider) string {
+	t.Helper()
+	data, err := os.ReadFile(p.nginxConfigPath)
+	if err != nil {
+		t.Fatalf("reading config: %v", err)
+	}
+	return string(data)
+}
+
+// emit sends a container event for c
+func (f *fakeDocker) emit(action events.Action, c fakeContainer) {
+	f.events <- events.Message{
+		Type:   events.ContainerEventType,
+		Action: action,
+		Actor:  events.Actor{ID: c.id(), Attributes: map[string]string{"name": c.Name}},
+	}
+}
+
+// checkContains fails the test unless text contains every wanted line and
+// none of the unwanted ones
+func checkContains(t testing.TB, text string, want, unwanted []string) {
+	t.Helper()
+	for _, line := range want {
+		if !strings.Contains(text, line) {
+			t.Errorf("lacks %q:\n%s", line, text)
+		}
+	}
+	for _, line := range unwanted {
+		if strings.Contains(text, line) {
+			t.Errorf("unexpected %q:\n%s", line, text)
+		}
+	}
+}
+
+// hostLabels returns labels routing host, plus extra
+func hostLabels(host string, extra map[string]string) map[string]string {
+	labels := map[string]string{LabelHost: host}
+	for key, value := range extra {
+		labels[key] = value
+	}
+	return labels
+}
+
+// serverBlock returns the server block of a rendered config whose
+// server_name starts with host
+func serverBlock(t testing.TB, rendered, host string) string {
+	t.Helper()
+	for rest := rendered; ; {
+		start := strings.Index(rest, "\nserver {")
+		if start < 0 {
+			t.Fatalf("no server block for %s in:\n%s", host, rendered)
+		}
+		rest = rest[start+1:]
+		block := configBlock(t, rest, "server {")
+		if strings.Contains(block, "server_name "+host+" ") || strings.Contains(block, "server_name "+host+";") {
+			return block
+		}
+		rest = rest[len(block):]
+	}
+}
@@ -0,0 +1,83 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultConfigHistoryLimit is how many archived configs are kept per directory
+const DefaultConfigHistoryLimit = 100
+
+// configHistoryTimeFormat sorts lexically in the order the configs were applied
+const configHistoryTimeFormat = "20060102T150405.000000000Z"
+
+// ConfigHistory archives every applied nginx configuration into a directory
+// as <config name>.<UTC timestamp>, keeping the newest limit files
+type ConfigHistory struct {
+	dir       string
+	prefix    string
+	limit     int
+	filePerms FilePermissions
+}
+
+// NewConfigHistory creates an archive for configs written to configPath.
+// A limit <= 0 uses DefaultConfigHistoryLimit.
+func NewConfigHistory(dir, configPath string, limit int, filePerms FilePermissions) *ConfigHistory {
+	if limit <= 0 {
+		limit = DefaultConfigHistoryLimit
+	}
+	return &ConfigHistory{
+		dir:       dir,
+		prefix:    filepath.Base(configPath) + ".",
+		limit:     limit,
+		filePerms: filePerms,
+	}
+}
+
+// Archive writes content as the config applied at the given time and prunes
+// the oldest archives beyond the limit. It returns the archive's path.
+func (h *ConfigHistory) Archive(content string, appliedAt time.Time) (string, error) {
+	if err := os.MkdirAll(h.dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create config history directory: %w", err)
+	}
+
+	path := filepath.Join(h.dir, h.prefix+appliedAt.UTC().Format(configHistoryTimeFormat))
+	if err := h.filePerms.writeFile(path, []byte(content)); err != nil {
+		return "", fmt.Errorf("failed to archive config: %w", err)
+	}
+
+	if err := h.prune(); err != nil {
+		return path, err
+	}
+	return path, nil
+}
+
+// prune removes the oldest archives beyond the limit
+func (h *ConfigHistory) prune() error {
+	entries, err := os.ReadDir(h.dir)
+	if err != nil {
+		return fmt.Errorf("failed to list config history: %w", err)
+	}
+
+	var archives []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && strings.HasPrefix(entry.Name(), h.prefix) {
+			archives = append(archives, entry.Name())
+		}
+	}
+	if len(archives) <= h.limit {
+		return nil
+	}
+
+	sort.Strings(archives)
+	for _, name := range archives[:len(archives)-h.limit] {
+		if err := os.Remove(filepath.Join(h.dir, name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to prune config history: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package docker
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigHistoryArchive(t *testing.T) {
+	applied := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		limit    int
+		archives int
+		wantKept []int // indexes of the archives kept, oldest first
+	}{
+		{"below the limit", 3, 2, []int{0, 1}},
+		{"at the limit", 3, 3, []int{0, 1, 2}},
+		{"oldest pruned", 3, 5, []int{2, 3, 4}},
+		{"default limit", 0, 5, []int{0, 1, 2, 3, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			// Unrelated files in the directory are left alone
+			if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("keep"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			history := NewConfigHistory(dir, "/etc/nginx/conf.d/ingress.conf", tt.limit, DefaultFilePermissions())
+
+			var paths []string
+			for i := 0; i < tt.archives; i++ {
+				path, err := history.Archive(fmt.Sprintf("config %d", i), applied.Add(time.Duration(i)*time.Second))
+				if err != nil {
+					t.Fatalf("Archive: %v", err)
+				}
+				paths = append(paths, path)
+			}
+			if want := filepath.Join(dir, "ingress.conf.20260102T030405.000000000Z"); paths[0] != want {
+				t.Errorf("archived to %s, want %s", paths[0], want)
+			}
+
+			var kept []int
+			for i, path := range paths {
+				content, err := os.ReadFile(path)
+				if os.IsNotExist(err) {
+					continue
+				}
+				if err != nil || string(content) != fmt.Sprintf("config %d", i) {
+					t.Errorf("archive %d = %q, %v", i, content, err)
+				}
+				kept = append(kept, i)
+			}
+			if !reflect.DeepEqual(kept, tt.wantKept) {
+				t.Errorf("kept archives %v, want %v", kept, tt.wantKept)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+				t.Errorf("unrelated file pruned: %v", err)
+			}
+		})
+	}
+}
+
+func TestProviderRecordsAppliedConfigs(t *testing.T) {
+	web := fakeContainer{Name: "web", IP: "172.18.0.2", Labels: map[string]string{LabelEnable: "true", LabelHost: "web.test"}}
+	moved := web
+	moved.IP = "172.18.0.9"
+
+	steps := []struct {
+		name         string
+		containers   []fakeContainer
+		wantArchives int
+		wantLogged   bool
+	}{
+		{"initial config", []fakeContainer{web}, 1, true},
+		{"unchanged config", []fakeContainer{web}, 1, false},
+		{"changed config", []fakeContainer{moved}, 2, true},
+	}
+
+	var logged bytes.Buffer
+	previous := log.Writer()
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(previous) })
+
+	historyDir := filepath.Join(t.TempDir(), "history")
+	docker := newFakeDocker()
+	p := newTestProvider(t, docker, Config{ConfigHistoryDir: historyDir, LogRenderedConfig: true})
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			logged.Reset()
+			docker.set(step.containers...)
+			if err := p.loadConfiguration(); err != nil {
+				t.Fatalf("loadConfiguration: %v", err)
+			}
+
+			archives, err := filepath.Glob(filepath.Join(historyDir, "ingress.conf.*"))
+			if err != nil || len(archives) != step.wantArchives {
+				t.Fatalf("archives = %v (%v), want %d", archives, err, step.wantArchives)
+			}
+			latest, err := os.ReadFile(archives[len(archives)-1])
+			if err != nil || string(latest) != readTestConfig(t, p) {
+				t.Errorf("latest archive differs from the applied config (%v)", err)
+			}
+			if got := strings.Contains(logged.String(), "Applied nginx configuration:\n"); got != step.wantLogged {
+				t.Errorf("rendered config logged = %v, want %v", got, step.wantLogged)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package docker
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ConfigCache holds the generated server block and upstreams of each host,
+// so regenerating the config after a change only regenerates the hosts whose
+// containers changed. Hosts that depend on more than their containers' labels
+// and addresses (snippets, FastCGI params files, backend CA bundles or names
+// resolved once) are always regenerated, as are hosts of containers that
+// weren't listed from Docker. A nil cache regenerates every host.
+type ConfigCache struct {
+	mu      sync.Mutex
+	options string                      // generator options the entries were generated with
+	entries map[string]configCacheEntry // host -> last generated
+
+	// Hosts reused and regenerated by the last generation
+	reused      int
+	regenerated int
+}
+
+// configCacheEntry is a generated host and the key of its inputs
+type configCacheEntry struct {
+	key       string
+	generated hostConfig
+}
+
+// NewConfigCache creates an empty config cache
+func NewConfigCache() *ConfigCache {
+	return &ConfigCache{entries: make(map[string]configCacheEntry)}
+}
+
+// containerFingerprint identifies what a listed container's config was
+// extracted from: its labels (including label file ones) and address
+func containerFingerprint(data *ContainerData, labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s|%s|%s|%d", data.Config.ContainerID, data.Config.ContainerName, data.IPAddress, data.Config.Port)
+	for _, key := range keys {
+		b.WriteString("|")
+		b.WriteString(key)
+		b.WriteString("=")
+		b.WriteString(labels[key])
+	}
+	return b.String()
+}
+
+// start begins a generation with opts, dropping every entry when the options
+// differ from those of the previous generation
+func (c *ConfigCache) start(opts GeneratorOptions) {
+	if c == nil {
+		return
+	}
+	opts.Cache = nil
+	options := fmt.Sprintf("%+v", opts)
+	
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if options != c.options {
+		c.entries = make(map[string]configCacheEntry)
+		c.options = options
+	}
+	c.reused, c.regenerated = 0, 0
+}
+
+// hostKey builds the key of everything the generated host depends on. It
+// returns false when the host can't be cached.
+func (c *ConfigCache) hostKey(host string, aliases []string, containers []*ContainerData, fixedUpstreams map[string]string, opts GeneratorOptions) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	
+	var b strings.Builder
+	b.WriteString(host)
+	for _, alias := range aliases {
+		b.WriteString(" ")
+		b.WriteString(alias)
+	}
+	
+	needsSSL := false
+	for _, container := range containers {
+		config := container.Config
+		if container.fingerprint == "" ||
+			config.ServerSnippet != "" || config.ConfigurationSnippet != "" ||
+			config.FastCGI.Enabled || config.ProxySSLVerify ||
+			(config.UpstreamHost != "" && upstreamResolveMode(config, opts) == ResolveOnce) {
+			return "", false
+		}
+		b.WriteString("\n")
+		b.WriteString(container.fingerprint)
+		b.WriteString("|" + strconv.FormatBool(container.Restarting) + "|" + strconv.FormatBool(container.Unready))
+		b.WriteString("|" + fixedUpstreams[config.UpstreamName])
+		needsSSL = needsSSL || (config.TLS && !opts.DisableTLS)
+	}
+	
+	// A certificate named after the host is picked up once it exists
+	if needsSSL {
+		defaultCert, _ := opts.defaultCertificate()
+		b.WriteString("\ncert=" + resolveHostCertificate(host, filepath.Dir(defaultCert)))
+	}
+	return b.String(), true
+}
+
+// lookup returns a copy of the generated host when its key is unchanged
+func (c *ConfigCache) lookup(host, key string) (hostConfig, bool) {
+	if c == nil {
+		return hostConfig{}, false
+	}
+	
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[host]
+	if !ok || key == "" || entry.key != key {
+		c.regenerated++
+		return hostConfig{}, false
+	}
+	c.reused++
+	return entry.generated.clone(), true
+}
+
+// store remembers a copy of the generated host under key
+func (c *ConfigCache) store(host, key string, generated hostConfig) {
+	if c == nil {
+		return
+	}
+	
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[host] = configCacheEntry{key: key, generated: generated.clone()}
+}
+
+// retain drops the entries of hosts that are gone
+func (c *ConfigCache) retain(hosts map[string][]*ContainerData) {
+	if c == nil {
+		return
+	}
+	
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for host := range c.entries {
+		if _, exists := hosts[host]; !exists {
+			delete(c.entries, host)
+		}
+	}
+}
+
+// stats returns how many hosts the last generation reused and regenerated
+func (c *ConfigCache) stats() (reused, regenerated int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reused, c.regenerated
+}
+
+// clone copies the slices the config's post-processing modifies in place,
+// so a cached host isn't changed by the configs it's used in
+func (h hostConfig) clone() hostConfig {
+	server := h.server
+	server.Listen = append([]string(nil), h.server.Listen...)
+	server.Aliases = append([]string(nil), h.server.Aliases...)
+	server.Locations = append([]LocationConfig(nil), h.server.Locations...)
+	return hostConfig{
+		server:    server,
+		upstreams: append([]UpstreamConfig(nil), h.upstreams...),
+		caches:    append([]CacheZoneConfig(nil), h.caches...),
+	}
+}
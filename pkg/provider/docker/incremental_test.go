@@ -0,0 +1,232 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// listTestContainers lists docker's containers the way the provider does
+func listTestContainers(t testing.TB, docker *fakeDocker) []*ContainerData {
+	t.Helper()
+	containers, _, err := listContainers(context.Background(), docker, ListOptions{})
+	if err != nil {
+		t.Fatalf("listContainers: %v", err)
+	}
+	return containers
+}
+
+// renderAt renders config as if generated at the time of other, so configs
+// generated at different times compare equal
+func renderAt(t testing.TB, config, other *NginxConfig) string {
+	t.Helper()
+	copied := *config
+	copied.Generated = other.Generated
+	rendered, err := RenderNginxConfig(&copied, testTemplatePath)
+	if err != nil {
+		t.Fatalf("RenderNginxConfig: %v", err)
+	}
+	return rendered
+}
+
+func TestIncrementalMatchesFullRegeneration(t *testing.T) {
+	labels := func(host string, extra ...string) map[string]string {
+		labels := map[string]string{LabelEnable: "true", LabelHost: host, LabelPort: "8080"}
+		for i := 0; i+1 < len(extra); i += 2 {
+			labels[extra[i]] = extra[i+1]
+		}
+		return labels
+	}
+	web := fakeContainer{Name: "web", IP: "172.18.0.2", Labels: labels("web.test", LabelHostAliases, "www.test", LabelTLS, "true")}
+	api := fakeContainer{Name: "api", IP: "172.18.0.3", Labels: labels("api.test", LabelPath, "/v1", LabelCORS, "true", LabelCORS+".origins", "https://a.test,https://b.test")}
+	api2 := fakeContainer{Name: "api-2", IP: "172.18.0.4", Labels: labels("api.test", LabelPath, "/v2", LabelPreservePath, "false")}
+	mirror := fakeContainer{Name: "mirror", IP: "172.18.0.3", Labels: labels("mirror.test")}
+	upper := fakeContainer{Name: "upper", IP: "172.18.0.5", Labels: labels("API.test", LabelPath, "/v3")}
+	named := fakeContainer{Name: "named", IP: "172.18.0.6", Labels: labels("named.test", LabelUpstreamName, "backend_named")}
+	claim := fakeContainer{Name: "claim", IP: "172.18.0.7", Labels: labels("claim.test", LabelHostAliases, "www.test")}
+	snippet := fakeContainer{Name: "snippet", IP: "172.18.0.8", Labels: labels("snippet.test", LabelConfigurationSnippet, "/app/location.conf")}
+
+	moved := func(c fakeContainer, ip string) fakeContainer {
+		c.IP = ip
+		return c
+	}
+	relabeled := func(c fakeContainer, key, value string) fakeContainer {
+		copied := map[string]string{key: value}
+		for k, v := range c.Labels {
+			if k != key {
+				copied[k] = v
+			}
+		}
+		c.Labels = copied
+		return c
+	}
+	webHSTS := relabeled(web, LabelHSTS, "true")
+	restarting := func(c fakeContainer) fakeContainer {
+		c.State = "restarting"
+		return c
+	}
+
+	steps := []struct {
+		name            string
+		containers      []fakeContainer
+		wantRegenerated int
+	}{
+		{"initial", []fakeContainer{web, api, api2, mirror, named}, 4},
+		{"unchanged", []fakeContainer{web, api, api2, mirror, named}, 0},
+		{"reordered listing", []fakeContainer{named, mirror, web, api, api2}, 0},
+		// mirror shares api's backend, so its location uses api's upstream
+		// until api moves; the cached mirror must get its own back
+		{"shared backend moves", []fakeContainer{web, moved(api, "172.18.0.9"), api2, mirror, named}, 1},
+		{"host differing in case added", []fakeContainer{web, moved(api, "172.18.0.9"), api2, mirror, named, upper}, 1},
+		{"label changed", []fakeContainer{webHSTS, api, api2, mirror, named}, 2},
+		{"host removed", []fakeContainer{webHSTS, api, api2, named}, 0},
+		{"alias claimed by another host", []fakeContainer{webHSTS, api, api2, named, claim}, 1},
+		{"restarting", []fakeContainer{webHSTS, api, api2, restarting(named), claim}, 1},
+		{"snippets always regenerated", []fakeContainer{webHSTS, api, api2, named, snippet}, 2},
+		{"unchanged with snippet", []fakeContainer{webHSTS, api, api2, named, snippet}, 1},
+	}
+
+	docker := newFakeDocker()
+	docker.files[snippet.id()+":/app/location.conf"] = "add_header X-Snippet yes;"
+	snippets := NewSnippetManager(docker, "")
+	snippets.SetCacheEnabled(false)
+	cache := NewConfigCache()
+	incrementalOpts := DefaultGeneratorOptions()
+	incrementalOpts.Cache = cache
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			docker.set(step.containers...)
+			containers := listTestContainers(t, docker)
+
+			incremental, err := GenerateNginxConfigWithOptions(containers, snippets, nil, incrementalOpts)
+			if err != nil {
+				t.Fatalf("incremental generation: %v", err)
+			}
+			full, err := GenerateNginxConfigWithOptions(containers, snippets, nil, DefaultGeneratorOptions())
+			if err != nil {
+				t.Fatalf("full generation: %v", err)
+			}
+
+			got, want := renderAt(t, incremental, full), renderAt(t, full, full)
+			if got != want {
+				t.Errorf("incremental config differs from full regeneration\nincremental:\n%s\nfull:\n%s", got, want)
+			}
+			if _, regenerated := cache.stats(); regenerated != step.wantRegenerated {
+				t.Errorf("regenerated %d hosts, want %d", regenerated, step.wantRegenerated)
+			}
+		})
+	}
+}
+
+func TestConfigCacheResetsOnOptionChange(t *testing.T) {
+	docker := newFakeDocker(fakeContainer{Name: "web", IP: "172.18.0.2",
+		Labels: map[string]string{LabelEnable: "true", LabelHost: "web.test", LabelTLS: "true"}})
+	containers := listTestContainers(t, docker)
+
+	opts := DefaultGeneratorOptions()
+	opts.Cache = NewConfigCache()
+	generateTestConfig(t, opts, containers...)
+
+	opts.DisableTLS = true
+	config := generateTestConfig(t, opts, containers...)
+	if config.Servers[0].SSL.Enabled {
+		t.Error("cached TLS server reused after TLS was disabled")
+	}
+	if _, regenerated := opts.Cache.stats(); regenerated != 1 {
+		t.Errorf("regenerated %d hosts, want 1", regenerated)
+	}
+}
+
+func TestProviderReusesUnchangedHosts(t *testing.T) {
+	var containers []fakeContainer
+	for i := 0; i < 5; i++ {
+		containers = append(containers, fakeContainer{
+			Name:   fmt.Sprintf("app%d", i),
+			IP:     fmt.Sprintf("172.18.0.%d", i+2),
+			Labels: map[string]string{LabelEnable: "true", LabelHost: fmt.Sprintf("app%d.test", i), LabelPort: "8080"},
+		})
+	}
+	docker := newFakeDocker(containers...)
+	p := newTestProvider(t, docker, Config{})
+	if err := p.loadConfiguration(); err != nil {
+		t.Fatalf("loadConfiguration: %v", err)
+	}
+
+	containers[2].IP = "172.18.0.99"
+	docker.set(containers...)
+	if err := p.loadConfiguration(); err != nil {
+		t.Fatalf("loadConfiguration: %v", err)
+	}
+	if reused, regenerated := p.configCache.stats(); reused != 4 || regenerated != 1 {
+		t.Errorf("reused %d and regenerated %d hosts, want 4 and 1", reused, regenerated)
+	}
+	if config := readTestConfig(t, p); !containsAll(config, "172.18.0.99:8080", "172.18.0.2:8080", "172.18.0.6:8080") {
+		t.Errorf("config misses backends:\n%s", config)
+	}
+}
+
+// containsAll reports whether s contains every substring
+func containsAll(s string, substrings ...string) bool {
+	for _, substring := range substrings {
+		if !strings.Contains(s, substring) {
+			return false
+		}
+	}
+	return true
+}
+
+// benchmarkContainers returns n containers, two per host, and the same
+// containers with the first one moved to another IP
+func benchmarkContainers(b *testing.B, n int) (before, after []*ContainerData) {
+	var containers []fakeContainer
+	for i := 0; i < n; i++ {
+		containers = append(containers, fakeContainer{
+			Name: fmt.Sprintf("app%d", i),
+			IP:   fmt.Sprintf("172.18.%d.%d", i/250, i%250+2),
+			Labels: map[string]string{
+				LabelEnable: "true",
+				LabelHost:   fmt.Sprintf("app%d.test", i/2),
+				LabelPath:   fmt.Sprintf("/p%d", i%2),
+				LabelPort:   "8080",
+				LabelTLS:    "true",
+			},
+		})
+	}
+	docker := newFakeDocker(containers...)
+	before = listTestContainers(b, docker)
+	containers[0].IP = "172.19.0.2"
+	docker.set(containers...)
+	after = listTestContainers(b, docker)
+	return before, after
+}
+
+func BenchmarkGenerateNginxConfig(b *testing.B) {
+	before, after := benchmarkContainers(b, 500)
+
+	for _, bm := range []struct {
+		name  string
+		cache *ConfigCache
+	}{
+		{"full", nil},
+		{"incremental", NewConfigCache()},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			opts := DefaultGeneratorOptions()
+			opts.Cache = bm.cache
+			generateTestConfig(b, opts, before...)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Every generation sees one container changed
+				containers := after
+				if i%2 == 1 {
+					containers = before
+				}
+				if _, err := GenerateNginxConfigWithOptions(containers, nil, nil, opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
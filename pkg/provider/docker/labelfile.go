@@ -0,0 +1,129 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LabelFile holds ingress labels for containers that can't carry Docker
+// labels themselves, read from a JSON file mapping container name to labels:
+//
+//	{"grafana": {"nginx.ingress.enable": "true", "nginx.ingress.host": "grafana.local"}}
+//
+// or, when the file name ends in .yaml or .yml, the same mapping in YAML:
+//
+//	grafana:
+//	  nginx.ingress.enable: "true"
+//	  nginx.ingress.host: grafana.local
+//
+// The file is re-read whenever its modification time changes.
+type LabelFile struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	labels  map[string]map[string]string
+}
+
+// NewLabelFile creates a label file reader and loads the file once
+func NewLabelFile(path string) (*LabelFile, error) {
+	lf := &LabelFile{path: path}
+	if _, err := lf.Refresh(); err != nil {
+		return nil, err
+	}
+	return lf, nil
+}
+
+// Refresh re-reads the file if it changed and reports whether it did. A
+// missing file is treated as empty so it can be created later.
+func (lf *LabelFile) Refresh() (bool, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	info, err := os.Stat(lf.path)
+	if os.IsNotExist(err) {
+		changed := lf.labels != nil
+		lf.labels = nil
+		lf.modTime = time.Time{}
+		return changed, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to stat label file %s: %w", lf.path, err)
+	}
+	if info.ModTime().Equal(lf.modTime) && lf.labels != nil {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(lf.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read label file %s: %w", lf.path, err)
+	}
+
+	labels, err := parseLabelFile(lf.path, data)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse label file %s: %w", lf.path, err)
+	}
+	if labels == nil {
+		labels = make(map[string]map[string]string)
+	}
+
+	lf.labels = labels
+	lf.modTime = info.ModTime()
+	return true, nil
+}
+
+// parseLabelFile decodes label file content as YAML or JSON, by file extension
+func parseLabelFile(path string, data []byte) (map[string]map[string]string, error) {
+	var labels map[string]map[string]string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &labels); err != nil {
+			return nil, err
+		}
+	default:
+		if err := json.Unmarshal(data, &labels); err != nil {
+			return nil, err
+		}
+	}
+	return labels, nil
+}
+
+// Labels returns a copy of the labels for every container in the file
+func (lf *LabelFile) Labels() map[string]map[string]string {
+	if lf == nil {
+		return nil
+	}
+
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	labels := make(map[string]map[string]string, len(lf.labels))
+	for name, containerLabels := range lf.labels {
+		labels[name] = containerLabels
+	}
+	return labels
+}
+
+// mergeLabels combines file labels with a container's Docker labels. Docker
+// labels win when both set the same key.
+func mergeLabels(fileLabels, dockerLabels map[string]string) map[string]string {
+	if len(fileLabels) == 0 {
+		return dockerLabels
+	}
+
+	merged := make(map[string]string, len(fileLabels)+len(dockerLabels))
+	for key, value := range fileLabels {
+		merged[key] = value
+	}
+	for key, value := range dockerLabels {
+		merged[key] = value
+	}
+	return merged
+}
@@ -0,0 +1,131 @@
+package docker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLabelFileFormats(t *testing.T) {
+	want := map[string]string{LabelEnable: "true", LabelHost: "grafana.test", LabelPort: "3000"}
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr bool
+	}{
+		{
+			name:    "json",
+			file:    "labels.json",
+			content: `{"grafana": {"nginx.ingress.enable": "true", "nginx.ingress.host": "grafana.test", "nginx.ingress.port": "3000"}}`,
+		},
+		{
+			name:    "yaml",
+			file:    "labels.yaml",
+			content: "grafana:\n  nginx.ingress.enable: \"true\"\n  nginx.ingress.host: grafana.test\n  nginx.ingress.port: \"3000\"\n",
+		},
+		{
+			name:    "yml with unquoted scalars",
+			file:    "labels.YML",
+			content: "grafana:\n  nginx.ingress.enable: true\n  nginx.ingress.host: grafana.test\n  nginx.ingress.port: 3000\n",
+		},
+		{name: "yaml read as json", file: "labels.conf", content: "grafana:\n  nginx.ingress.enable: \"true\"\n", wantErr: true},
+		{name: "invalid yaml", file: "labels.yaml", content: "grafana: [\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			lf, err := NewLabelFile(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("NewLabelFile succeeded, labels %v", lf.Labels())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewLabelFile: %v", err)
+			}
+			got := lf.Labels()["grafana"]
+			for key, value := range want {
+				if got[key] != value {
+					t.Errorf("%s = %q, want %q", key, got[key], value)
+				}
+			}
+		})
+	}
+}
+
+func TestLabelFileRefresh(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "labels.yaml")
+	lf, err := NewLabelFile(path)
+	if err != nil {
+		t.Fatalf("NewLabelFile of a missing file: %v", err)
+	}
+	if len(lf.Labels()) != 0 {
+		t.Fatalf("labels of a missing file = %v", lf.Labels())
+	}
+
+	if err := os.WriteFile(path, []byte("app:\n  nginx.ingress.host: app.test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := lf.Refresh(); err != nil || !changed {
+		t.Fatalf("Refresh after create = %v, %v", changed, err)
+	}
+	if changed, err := lf.Refresh(); err != nil || changed {
+		t.Fatalf("Refresh without change = %v, %v", changed, err)
+	}
+
+	if err := os.WriteFile(path, []byte("app:\n  nginx.ingress.host: other.test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := lf.Refresh(); err != nil || !changed {
+		t.Fatalf("Refresh after change = %v, %v", changed, err)
+	}
+	if got := lf.Labels()["app"][LabelHost]; got != "other.test" {
+		t.Errorf("host = %q after change, want other.test", got)
+	}
+}
+
+func TestLabelFileAppliedToUnlabeledContainer(t *testing.T) {
+	tests := []struct {
+		name         string
+		dockerLabels map[string]string
+		wantHost     string
+	}{
+		{name: "no docker labels", wantHost: "grafana.test"},
+		{name: "docker labels win", dockerLabels: map[string]string{LabelHost: "docker.test"}, wantHost: "docker.test"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "labels.yml")
+			content := "grafana:\n  nginx.ingress.enable: \"true\"\n  nginx.ingress.host: grafana.test\n"
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			lf, err := NewLabelFile(path)
+			if err != nil {
+				t.Fatalf("NewLabelFile: %v", err)
+			}
+
+			docker := newFakeDocker(fakeContainer{Name: "grafana", IP: "172.18.0.2", Labels: tt.dockerLabels})
+			containers, err := ListContainers(context.Background(), docker, ListOptions{FileLabels: lf.Labels()})
+			if err != nil {
+				t.Fatalf("ListContainers: %v", err)
+			}
+			if len(containers) != 1 || containers[0].Config.Host != tt.wantHost {
+				t.Fatalf("containers = %+v, want one with host %s", containers, tt.wantHost)
+			}
+		})
+	}
+}
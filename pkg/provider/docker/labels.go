@@ -2,8 +2,12 @@ package docker
 
 import (
 	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
 const (
@@ -13,21 +17,80 @@ const (
 	// Core labels
 	LabelEnable    = LabelPrefix + ".enable"
 	LabelHost      = LabelPrefix + ".host"
+	LabelHostAliases = LabelPrefix + ".host-aliases"
 	LabelPort      = LabelPrefix + ".port"
 	LabelPath      = LabelPrefix + ".path"
 	LabelProtocol  = LabelPrefix + ".protocol"
+	LabelUpstreamHost = LabelPrefix + ".upstream-host"
+	LabelUpstreamResolve = LabelPrefix + ".upstream-resolve"
+	LabelUpstreamName = LabelPrefix + ".upstream-name"
+	LabelUpstreamHostHeader = LabelPrefix + ".upstream-host-header"
+	LabelForwardedProto = LabelPrefix + ".forwarded-proto"
+	LabelForwardedPort  = LabelPrefix + ".forwarded-port"
 	
 	// SSL/TLS labels
 	LabelTLS       = LabelPrefix + ".tls"
 	LabelCertName  = LabelPrefix + ".tls.certname"
+	LabelSSLProtocols = LabelPrefix + ".ssl-protocols"
+	LabelMinTLSVersion = LabelPrefix + ".min-tls-version"
+	LabelSSLCiphers   = LabelPrefix + ".ssl-ciphers"
+	LabelSSLStapling           = LabelPrefix + ".ssl-stapling"
+	LabelSSLTrustedCertificate = LabelPrefix + ".ssl-trusted-certificate"
+	
+	// Client timeout labels (server level)
+	LabelClientBodyTimeout   = LabelPrefix + ".client-body-timeout"
+	LabelClientHeaderTimeout = LabelPrefix + ".client-header-timeout"
+	LabelSendTimeout         = LabelPrefix + ".send-timeout"
+	
+	// HSTS labels
+	LabelHSTS                  = LabelPrefix + ".hsts"
+	LabelHSTSMaxAge            = LabelPrefix + ".hsts-max-age"
+	LabelHSTSIncludeSubdomains = LabelPrefix + ".hsts-include-subdomains"
 	
 	// Advanced routing labels
 	LabelPriority  = LabelPrefix + ".priority"
 	LabelRule      = LabelPrefix + ".rule"
+	LabelTryFiles  = LabelPrefix + ".try-files"
+	LabelPreservePath = LabelPrefix + ".preserve-path"
+	LabelDefaultBackend = LabelPrefix + ".default-backend"
+	
+	// Header manipulation labels
+	LabelHideHeaders         = LabelPrefix + ".hide-headers"
+	LabelClearRequestHeaders = LabelPrefix + ".clear-request-headers"
+	LabelDiagnosticHeaders   = LabelPrefix + ".enable-diagnostic-headers"
+	LabelProxyRequestBuffering = LabelPrefix + ".proxy-request-buffering"
+	LabelProxyRedirect       = LabelPrefix + ".proxy-redirect"
+	LabelProxySSLVerify      = LabelPrefix + ".proxy-ssl-verify"
+	LabelProxySSLCA          = LabelPrefix + ".proxy-ssl-ca"
+	LabelInterceptErrors     = LabelPrefix + ".intercept-errors"
+	LabelBackendHTTP2        = LabelPrefix + ".backend-http2"
+	LabelRequestID           = LabelPrefix + ".request-id"
+	LabelAllowedMethods      = LabelPrefix + ".allowed-methods"
+	
+	// Proxy cache labels
+	LabelProxyCache         = LabelPrefix + ".proxy-cache"
+	LabelProxyCacheKey      = LabelPrefix + ".proxy-cache-key"
+	LabelProxyCacheValid    = LabelPrefix + ".proxy-cache-valid"
+	LabelProxyCacheZoneSize = LabelPrefix + ".proxy-cache-zone-size"
+	LabelProxyCacheMaxSize  = LabelPrefix + ".proxy-cache-max-size"
+	LabelProxyCacheInactive = LabelPrefix + ".proxy-cache-inactive"
+	
+	// Map block labels: nginx.ingress.map.<variable>.source, .default and .<input>=<output>
+	LabelMapPrefix = LabelPrefix + ".map."
+	
+	// Redirect labels
+	LabelRedirectTo   = LabelPrefix + ".redirect-to"
+	LabelRedirectCode = LabelPrefix + ".redirect-code"
 	
 	// Load balancing labels
 	LabelLoadBalancer = LabelPrefix + ".loadbalancer"
 	LabelMethod       = LabelPrefix + ".loadbalancer.method"
+	LabelHashKey      = LabelPrefix + ".loadbalancer.hash-key"
+	
+	// Upstream server labels (passive health checking)
+	LabelUpstreamMaxFails    = LabelPrefix + ".upstream-max-fails"
+	LabelUpstreamFailTimeout = LabelPrefix + ".upstream-fail-timeout"
+	LabelUpstreamZoneSize    = LabelPrefix + ".upstream-zone-size"
 	
 	// Health check labels
 	LabelHealthCheck     = LabelPrefix + ".healthcheck"
@@ -40,19 +103,27 @@ const (
 	
 	// Snippet labels (file-based configuration)
 	LabelConfigurationSnippet = LabelPrefix + ".configuration-snippet"
+	LabelConfigurationSnippetSHA256 = LabelPrefix + ".configuration-snippet-sha256"
 	LabelServerSnippet        = LabelPrefix + ".server-snippet"
+	LabelServerSnippetSHA256  = LabelPrefix + ".server-snippet-sha256"
 	
 	// FastCGI labels
 	LabelBackendProtocol    = LabelPrefix + ".backend-protocol"
 	LabelFastCGIIndex       = LabelPrefix + ".fastcgi-index"
 	LabelFastCGIParams      = LabelPrefix + ".fastcgi-params"
 	LabelFastCGIParamsFile  = LabelPrefix + ".fastcgi-params-file"
+	LabelFastCGIDefaults    = LabelPrefix + ".fastcgi-defaults"
 	
 	// Default values
 	DefaultProtocol = "http"
 	DefaultPort     = "80"
 	DefaultPath     = "/"
 	DefaultPriority = 100
+	DefaultHSTSMaxAge = 31536000 // one year
+	
+	DefaultProxyCacheKey      = "$scheme$proxy_host$request_uri"
+	DefaultProxyCacheZoneSize = "10m"
+	DefaultProxyCacheValid    = "200 302 10m"
 )
 
 // ContainerConfig represents the nginx configuration extracted from container labels
@@ -64,15 +135,92 @@ type ContainerConfig struct {
 	// Basic routing
 	Enabled   bool
 	Host      string
+	HostAliases []string // extra server names of the host's server block
 	Port      int
 	Path      string
 	Protocol  string
 	Priority  int
 	Rule      string
 	
+	// Pass the full request path to the backend (false strips the location prefix)
+	PreservePath bool
+	
+	// Also serve the host's unmatched paths (location /)
+	DefaultBackend bool
+	
+	// Backend DNS name resolved by nginx at request time instead of the container IP
+	UpstreamHost string
+	UpstreamResolve UpstreamResolveMode // continuous or once; empty uses the controller default
+	
+	// Upstream name replacing the generated backend_<host>_<name>_<hash>
+	UpstreamName string
+	
+	// Host header sent to the backend instead of the client's $host
+	UpstreamHostHeader string
+	
+	// X-Forwarded-Proto and X-Forwarded-Port sent to the backend instead of
+	// $scheme and $server_port, e.g. behind an external TLS terminator
+	ForwardedProto string
+	ForwardedPort  string
+	
+	// Redirect instead of proxying
+	Redirect RedirectConfig
+	
+	// http-level map blocks declared by this container
+	Maps []MapConfig
+	
+	// Response headers hidden from clients and request headers cleared before proxying
+	HideHeaders         []string
+	ClearRequestHeaders []string
+	
+	// Send X-Container-Name / X-Container-ID to the backend
+	DiagnosticHeaders bool
+	
+	// proxy_request_buffering: "on", "off" or empty for the nginx default
+	ProxyRequestBuffering string
+	
+	// proxy_redirect: "default", "off" or "<redirect> <replacement>"
+	ProxyRedirect string
+	
+	// Verify the certificate of an https backend, against a CA bundle copied
+	// from the container (path inside it) or the system bundle
+	ProxySSLVerify bool
+	ProxySSLCA     string
+	
+	// Replace backend error responses (status >= 300) with nginx error pages
+	InterceptErrors bool
+	
+	// Talk HTTP/2 to the backend (h2c, or TLS with protocol https) via grpc_pass
+	BackendHTTP2 bool
+	
+	// Pass an X-Request-ID upstream, generated when the client sent none
+	RequestID bool
+	
+	// Methods the location accepts, others get a 405 (empty allows all)
+	AllowedMethods []string
+	
+	// try_files fallback list (e.g. $uri $uri/ /index.html)
+	TryFiles []string
+	
 	// SSL/TLS
 	TLS      bool
 	CertName string
+	SSLProtocols []string // overrides the controller-wide ssl_protocols
+	MinTLSVersion string  // lowest TLS version accepted, e.g. "1.2"
+	SSLCiphers   string   // overrides the controller-wide ssl_ciphers
+	
+	// OCSP stapling; needs the issuer chain in SSLTrustedCertificate
+	SSLStapling           bool
+	SSLTrustedCertificate string
+	
+	// HSTS (only applied to TLS-enabled hosts)
+	HSTS HSTSConfig
+	
+	// Timeouts for slow clients of the host
+	ClientTimeouts ClientTimeoutConfig
+	
+	// Response caching in nginx
+	ProxyCache ProxyCacheConfig
 	
 	// Load balancing
 	LoadBalancer LoadBalancerConfig
@@ -85,14 +233,80 @@ type ContainerConfig struct {
 	
 	// Nginx snippets (file-based)
 	ConfigurationSnippet string // Path to location-level nginx config file
+	ConfigurationSnippetSHA256 string // Expected sha256 of the location-level snippet (optional)
 	ServerSnippet        string // Path to server-level nginx config file
+	ServerSnippetSHA256  string // Expected sha256 of the server-level snippet (optional)
 	
 	// FastCGI configuration
 	FastCGI FastCGIConfig
 }
 
+// MapConfig represents an nginx map block: map <Source> $<Variable> { ... }
+type MapConfig struct {
+	Variable string
+	Source   string
+	Default  string
+	Entries  map[string]string // input -> output
+}
+
+type RedirectConfig struct {
+	URL  string
+	Code int // 301, 302, 303, 307 or 308
+}
+
+type ProxyCacheConfig struct {
+	Enabled  bool
+	Key      string
+	Valid    []string // proxy_cache_valid arguments, e.g. "200 302 10m"
+	ZoneSize string   // keys_zone size
+	MaxSize  string   // max_size of the cache on disk (optional)
+	Inactive string   // inactive time before entries are removed (optional)
+}
+
+// UpstreamResolveMode controls when the DNS name of an upstream-host backend
+// is resolved
+type UpstreamResolveMode string
+
+const (
+	// ResolveContinuous lets nginx re-resolve the name at request time
+	ResolveContinuous UpstreamResolveMode = "continuous"
+	// ResolveOnce resolves the name when the config is generated and bakes
+	// the addresses into the upstream
+	ResolveOnce UpstreamResolveMode = "once"
+)
+
+// ParseUpstreamResolveMode parses a resolve mode, defaulting to continuous
+func ParseUpstreamResolveMode(value string) (UpstreamResolveMode, error) {
+	switch mode := UpstreamResolveMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return ResolveContinuous, nil
+	case ResolveContinuous, ResolveOnce:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid upstream resolve mode %q, must be continuous or once", value)
+	}
+}
+
+// ClientTimeoutConfig represents client_body_timeout, client_header_timeout
+// and send_timeout; empty values leave the nginx default
+type ClientTimeoutConfig struct {
+	Body   string
+	Header string
+	Send   string
+}
+
+type HSTSConfig struct {
+	Enabled           bool
+	MaxAge            int // seconds
+	IncludeSubdomains bool
+}
+
 type LoadBalancerConfig struct {
-	Method string // round_robin, least_conn, ip_hash
+	Method      string // round_robin, least_conn, ip_hash, random, hash
+	HashKey     string // key for the hash method, e.g. $request_uri
+	MaxFails    int    // max_fails for each upstream server (0 = nginx default)
+	FailTimeout string // fail_timeout for each upstream server (e.g. "30s")
+	ZoneSize    string // shared memory zone size for the upstream (e.g. "64k")
 }
 
 type HealthCheckConfig struct {
@@ -125,19 +339,69 @@ type FastCGIConfig struct {
 	BackendProtocol string // "FCGI" to enable FastCGI mode
 	Index         string   // FastCGI index file (e.g., "index.php")
 	Params        map[string]string // FastCGI parameters
-	ParamsFile    string   // Path to file containing FastCGI parameters
+	ParamsFiles   []string // Paths to files containing FastCGI parameters, applied in order
+	Defaults      string   // Default parameter set: php (default), cgi or none
 }
 
 // ExtractConfig extracts nginx configuration from container labels
 func ExtractConfig(containerID, containerName, networkIP string, labels map[string]string) (*ContainerConfig, error) {
+	return ExtractConfigWithDefaults(containerID, containerName, networkIP, labels, LabelDefaults{})
+}
+
+// LabelDefaults are the values used when a container omits the protocol,
+// port, path or priority label. Zero fields fall back to the package defaults.
+type LabelDefaults struct {
+	Protocol string
+	Port     int
+	Path     string
+	Priority int
+}
+
+// withFallbacks fills zero fields with the package defaults
+func (d LabelDefaults) withFallbacks() LabelDefaults {
+	if d.Protocol == "" {
+		d.Protocol = DefaultProtocol
+	}
+	if d.Port == 0 {
+		d.Port, _ = strconv.Atoi(DefaultPort)
+	}
+	if d.Path == "" {
+		d.Path = DefaultPath
+	}
+	if d.Priority == 0 {
+		d.Priority = DefaultPriority
+	}
+	return d
+}
+
+// Validate checks the defaults the same way the corresponding labels are checked
+func (d LabelDefaults) Validate() error {
+	if d.Protocol != "" && d.Protocol != "http" && d.Protocol != "https" {
+		return fmt.Errorf("invalid default protocol %q, must be http or https", d.Protocol)
+	}
+	if d.Port < 0 || d.Port > 65535 {
+		return fmt.Errorf("invalid default port %d", d.Port)
+	}
+	if d.Path != "" && !strings.HasPrefix(d.Path, "/") {
+		return fmt.Errorf("invalid default path %q, must start with /", d.Path)
+	}
+	return nil
+}
+
+// ExtractConfigWithDefaults extracts nginx configuration from container labels,
+// using defaults for omitted protocol, port, path and priority labels
+func ExtractConfigWithDefaults(containerID, containerName, networkIP string, labels map[string]string, defaults LabelDefaults) (*ContainerConfig, error) {
+	defaults = defaults.withFallbacks()
 	config := &ContainerConfig{
 		ContainerID:   containerID,
 		ContainerName: containerName,
 		NetworkIP:     networkIP,
-		Protocol:      DefaultProtocol,
-		Port:          80,
-		Path:          DefaultPath,
-		Priority:      DefaultPriority,
+		Protocol:      defaults.Protocol,
+		Port:          defaults.Port,
+		Path:          defaults.Path,
+		Priority:      defaults.Priority,
+		PreservePath:  true,
+		DiagnosticHeaders: true,
 	}
 	
 	// Check if nginx ingress is enabled
@@ -154,6 +418,17 @@ func ExtractConfig(containerID, containerName, networkIP string, labels map[stri
 		return nil, fmt.Errorf("container %s: %s label is required when nginx ingress is enabled", containerName, LabelHost)
 	}
 	
+	if aliases, exists := labels[LabelHostAliases]; exists {
+		for _, alias := range splitList(aliases) {
+			if err := ValidateHostname(alias); err != nil {
+				return nil, fmt.Errorf("container %s: invalid host alias %s: %w", containerName, alias, err)
+			}
+			if !strings.EqualFold(alias, config.Host) {
+				config.HostAliases = append(config.HostAliases, alias)
+			}
+		}
+	}
+	
 	// Extract port
 	if portStr, exists := labels[LabelPort]; exists {
 		if port, err := strconv.Atoi(portStr); err == nil && port > 0 && port <= 65535 {
@@ -172,6 +447,78 @@ func ExtractConfig(containerID, containerName, networkIP string, labels map[stri
 		}
 	}
 	
+	if preservePath, exists := labels[LabelPreservePath]; exists {
+		config.PreservePath = parseBool(preservePath)
+	}
+	
+	config.DefaultBackend = parseBool(labels[LabelDefaultBackend])
+	
+	if diagnostic, exists := labels[LabelDiagnosticHeaders]; exists {
+		config.DiagnosticHeaders = parseBool(diagnostic)
+	}
+	
+	if buffering, exists := labels[LabelProxyRequestBuffering]; exists {
+		switch strings.ToLower(strings.TrimSpace(buffering)) {
+		case "on", "true":
+			config.ProxyRequestBuffering = "on"
+		case "off", "false":
+			config.ProxyRequestBuffering = "off"
+		default:
+			return nil, fmt.Errorf("container %s: invalid %s %q, must be on or off", containerName, LabelProxyRequestBuffering, buffering)
+		}
+	}
+	
+	if redirect, exists := labels[LabelProxyRedirect]; exists {
+		value, err := parseProxyRedirect(redirect)
+		if err != nil {
+			return nil, fmt.Errorf("container %s: %s: %w", containerName, LabelProxyRedirect, err)
+		}
+		config.ProxyRedirect = value
+	}
+	
+	if verify, exists := labels[LabelProxySSLVerify]; exists {
+		config.ProxySSLVerify = parseBool(verify)
+	}
+	
+	if ca, exists := labels[LabelProxySSLCA]; exists {
+		if err := validateCertificatePath(ca); err != nil {
+			return nil, fmt.Errorf("container %s: invalid %s %q: %w", containerName, LabelProxySSLCA, ca, err)
+		}
+		config.ProxySSLCA = ca
+	}
+	
+	if intercept, exists := labels[LabelInterceptErrors]; exists {
+		config.InterceptErrors = parseBool(intercept)
+	}
+	
+	if http2, exists := labels[LabelBackendHTTP2]; exists {
+		config.BackendHTTP2 = parseBool(http2)
+	}
+	
+	if requestID, exists := labels[LabelRequestID]; exists {
+		config.RequestID = parseBool(requestID)
+	}
+	
+	if methods, exists := labels[LabelAllowedMethods]; exists {
+		for _, method := range splitList(methods) {
+			method = strings.ToUpper(method)
+			if !isValidHTTPMethod(method) {
+				return nil, fmt.Errorf("container %s: invalid allowed method %q", containerName, method)
+			}
+			config.AllowedMethods = append(config.AllowedMethods, method)
+		}
+		if len(config.AllowedMethods) == 0 {
+			return nil, fmt.Errorf("container %s: %s needs at least one method", containerName, LabelAllowedMethods)
+		}
+	}
+	
+	if upstreamHost, exists := labels[LabelUpstreamHost]; exists {
+		if err := ValidateHostname(upstreamHost); err != nil {
+			return nil, fmt.Errorf("container %s: invalid upstream host %s: %w", containerName, upstreamHost, err)
+		}
+		config.UpstreamHost = upstreamHost
+	}
+	
 	if path, exists := labels[LabelPath]; exists {
 		config.Path = path
 	}
@@ -186,29 +533,170 @@ func ExtractConfig(containerID, containerName, networkIP string, labels map[stri
 		config.Rule = rule
 	}
 	
+	if resolve, exists := labels[LabelUpstreamResolve]; exists {
+		mode, err := ParseUpstreamResolveMode(resolve)
+		if err != nil {
+			return nil, fmt.Errorf("container %s: %w", containerName, err)
+		}
+		config.UpstreamResolve = mode
+	}
+	
+	if name, exists := labels[LabelUpstreamName]; exists {
+		sanitized := SanitizeContainerName(strings.TrimSpace(name))
+		if strings.TrimSpace(name) == "" || !isValidVariableName(sanitized) {
+			return nil, fmt.Errorf("container %s: invalid upstream name %q, use letters, digits and underscores", containerName, name)
+		}
+		config.UpstreamName = sanitized
+	}
+	
+	if hostHeader, exists := labels[LabelUpstreamHostHeader]; exists {
+		if hostHeader == "" || strings.ContainsAny(hostHeader, " \t;{}\"'") {
+			return nil, fmt.Errorf("container %s: invalid upstream host header %q", containerName, hostHeader)
+		}
+		config.UpstreamHostHeader = hostHeader
+	}
+	
+	if proto, exists := labels[LabelForwardedProto]; exists {
+		if !isForwardedValue(proto) && proto != "http" && proto != "https" {
+			return nil, fmt.Errorf("container %s: invalid forwarded proto %q, must be http, https or an nginx variable", containerName, proto)
+		}
+		config.ForwardedProto = proto
+	}
+	
+	if port, exists := labels[LabelForwardedPort]; exists {
+		if number, err := strconv.Atoi(port); !isForwardedValue(port) && (err != nil || number <= 0 || number > 65535) {
+			return nil, fmt.Errorf("container %s: invalid forwarded port %q, must be a port number or an nginx variable", containerName, port)
+		}
+		config.ForwardedPort = port
+	}
+	
+	if hideHeaders, exists := labels[LabelHideHeaders]; exists {
+		headers, err := parseHeaderList(hideHeaders)
+		if err != nil {
+			return nil, fmt.Errorf("container %s: %s: %w", containerName, LabelHideHeaders, err)
+		}
+		config.HideHeaders = headers
+	}
+	
+	if clearHeaders, exists := labels[LabelClearRequestHeaders]; exists {
+		headers, err := parseHeaderList(clearHeaders)
+		if err != nil {
+			return nil, fmt.Errorf("container %s: %s: %w", containerName, LabelClearRequestHeaders, err)
+		}
+		config.ClearRequestHeaders = headers
+	}
+	
+	maps, err := extractMapConfigs(labels)
+	if err != nil {
+		return nil, fmt.Errorf("container %s: %w", containerName, err)
+	}
+	config.Maps = maps
+	
+	redirect, err := extractRedirectConfig(labels)
+	if err != nil {
+		return nil, fmt.Errorf("container %s: %w", containerName, err)
+	}
+	config.Redirect = redirect
+	
+	proxyCache, err := extractProxyCacheConfig(labels)
+	if err != nil {
+		return nil, fmt.Errorf("container %s: %w", containerName, err)
+	}
+	config.ProxyCache = proxyCache
+	
+	if tryFiles, exists := labels[LabelTryFiles]; exists {
+		config.TryFiles = strings.Fields(strings.ReplaceAll(tryFiles, ",", " "))
+		if len(config.TryFiles) == 0 {
+			return nil, fmt.Errorf("container %s: %s must list at least one file", containerName, LabelTryFiles)
+		}
+		for _, file := range config.TryFiles {
+			if strings.ContainsAny(file, ";{}\"'") {
+				return nil, fmt.Errorf("container %s: invalid %s entry %q", containerName, LabelTryFiles, file)
+			}
+		}
+	}
+	
 	// Extract TLS config
 	config.TLS = parseBool(labels[LabelTLS])
 	if certName, exists := labels[LabelCertName]; exists {
 		config.CertName = certName
 	}
+	if protocols, exists := labels[LabelSSLProtocols]; exists {
+		config.SSLProtocols = strings.Fields(strings.ReplaceAll(protocols, ",", " "))
+		if err := ValidateSSLProtocols(config.SSLProtocols); err != nil {
+			return nil, fmt.Errorf("container %s: %w", containerName, err)
+		}
+	}
+	if version, exists := labels[LabelMinTLSVersion]; exists {
+		config.MinTLSVersion, err = ParseMinTLSVersion(version)
+		if err != nil {
+			return nil, fmt.Errorf("container %s: %w", containerName, err)
+		}
+	}
+	config.SSLStapling = parseBool(labels[LabelSSLStapling])
+	if trusted, exists := labels[LabelSSLTrustedCertificate]; exists {
+		trusted = strings.TrimSpace(trusted)
+		if !filepath.IsAbs(trusted) || strings.ContainsAny(trusted, " \t;{}\"'") {
+			return nil, fmt.Errorf("container %s: invalid %s %q, must be an absolute path", containerName, LabelSSLTrustedCertificate, trusted)
+		}
+		config.SSLTrustedCertificate = trusted
+	}
+	if config.SSLStapling && config.SSLTrustedCertificate == "" {
+		return nil, fmt.Errorf("container %s: %s requires %s", containerName, LabelSSLStapling, LabelSSLTrustedCertificate)
+	}
+	if ciphers, exists := labels[LabelSSLCiphers]; exists {
+		config.SSLCiphers = strings.TrimSpace(ciphers)
+		if err := ValidateSSLCiphers(config.SSLCiphers); err != nil {
+			return nil, fmt.Errorf("container %s: %w", containerName, err)
+		}
+	}
+	
+	// Extract HSTS config
+	hsts, err := extractHSTSConfig(labels)
+	if err != nil {
+		return nil, fmt.Errorf("container %s: %w", containerName, err)
+	}
+	config.HSTS = hsts
+	
+	// Extract client timeouts
+	clientTimeouts, err := extractClientTimeoutConfig(labels)
+	if err != nil {
+		return nil, fmt.Errorf("container %s: %w", containerName, err)
+	}
+	config.ClientTimeouts = clientTimeouts
 	
 	// Extract load balancer config
-	config.LoadBalancer = extractLoadBalancerConfig(labels)
+	loadBalancer, err := extractLoadBalancerConfig(labels)
+	if err != nil {
+		return nil, fmt.Errorf("container %s: %w", containerName, err)
+	}
+	config.LoadBalancer = loadBalancer
 	
 	// Extract health check config
 	config.HealthCheck = extractHealthCheckConfig(labels)
 	
 	// Extract middleware config
-	config.Middleware = extractMiddlewareConfig(labels)
+	middleware, err := extractMiddlewareConfig(labels)
+	if err != nil {
+		return nil, fmt.Errorf("container %s: %w", containerName, err)
+	}
+	config.Middleware = middleware
 	
 	// Extract snippet file paths
 	if configSnippet, exists := labels[LabelConfigurationSnippet]; exists {
 		config.ConfigurationSnippet = configSnippet
 	}
 	
+	if config.ConfigurationSnippetSHA256, err = snippetHashLabel(labels, LabelConfigurationSnippetSHA256); err != nil {
+		return nil, fmt.Errorf("container %s: %w", containerName, err)
+	}
+	
 	if serverSnippet, exists := labels[LabelServerSnippet]; exists {
 		config.ServerSnippet = serverSnippet
 	}
+	if config.ServerSnippetSHA256, err = snippetHashLabel(labels, LabelServerSnippetSHA256); err != nil {
+		return nil, fmt.Errorf("container %s: %w", containerName, err)
+	}
 	
 	// Extract FastCGI config
 	config.FastCGI = extractFastCGIConfig(labels)
@@ -216,19 +704,338 @@ func ExtractConfig(containerID, containerName, networkIP string, labels map[stri
 	return config, nil
 }
 
-func extractLoadBalancerConfig(labels map[string]string) LoadBalancerConfig {
+func extractMapConfigs(labels map[string]string) ([]MapConfig, error) {
+	maps := make(map[string]*MapConfig)
+	
+	for key, value := range labels {
+		rest, found := strings.CutPrefix(key, LabelMapPrefix)
+		if !found {
+			continue
+		}
+		variable, field, found := strings.Cut(rest, ".")
+		if !found || field == "" {
+			return nil, fmt.Errorf("invalid map label %s, expected %s<variable>.<source|default|input>", key, LabelMapPrefix)
+		}
+		if !isValidVariableName(variable) {
+			return nil, fmt.Errorf("invalid map variable name %q", variable)
+		}
+		// Values are rendered unquoted, so a space or quote breaks the map
+		if strings.ContainsAny(value, ";{}\"'") || strings.IndexFunc(value, unicode.IsSpace) >= 0 {
+			return nil, fmt.Errorf("invalid value for %s", key)
+		}
+		
+		m, exists := maps[variable]
+		if !exists {
+			m = &MapConfig{Variable: variable, Entries: make(map[string]string)}
+			maps[variable] = m
+		}
+		
+		switch field {
+		case "source":
+			m.Source = value
+		case "default":
+			m.Default = value
+		default:
+			if strings.ContainsAny(field, ";{}\"'") || strings.IndexFunc(field, unicode.IsSpace) >= 0 {
+				return nil, fmt.Errorf("invalid map input %q for %s", field, variable)
+			}
+			if value == "" {
+				return nil, fmt.Errorf("empty map output for input %q of %s", field, variable)
+			}
+			m.Entries[field] = value
+		}
+	}
+	
+	var configs []MapConfig
+	for _, m := range maps {
+		if !strings.HasPrefix(m.Source, "$") || !isValidVariableName(m.Source[1:]) {
+			return nil, fmt.Errorf("map %s requires a source variable (%s%s.source=$...)", m.Variable, LabelMapPrefix, m.Variable)
+		}
+		configs = append(configs, *m)
+	}
+	sort.Slice(configs, func(i, j int) bool {
+		return configs[i].Variable < configs[j].Variable
+	})
+	
+	return configs, nil
+}
+
+// isForwardedValue reports whether value is an nginx variable reference such
+// as $http_x_forwarded_proto, accepted by the forwarded-* labels
+func isForwardedValue(value string) bool {
+	return strings.HasPrefix(value, "$") && isValidVariableName(value[1:])
+}
+
+// isValidVariableName reports whether name is a legal nginx variable name (without $)
+func isValidVariableName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func extractRedirectConfig(labels map[string]string) (RedirectConfig, error) {
+	config := RedirectConfig{}
+	
+	target, exists := labels[LabelRedirectTo]
+	if !exists {
+		return config, nil
+	}
+	
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return config, fmt.Errorf("invalid redirect URL %q, must be an absolute http(s) URL", target)
+	}
+	if strings.ContainsAny(target, " \t;{}\"'") {
+		return config, fmt.Errorf("invalid redirect URL %q", target)
+	}
+	config.URL = target
+	config.Code = 302
+	
+	if codeStr, exists := labels[LabelRedirectCode]; exists {
+		code, err := strconv.Atoi(codeStr)
+		if err != nil {
+			return config, fmt.Errorf("invalid redirect code %s", codeStr)
+		}
+		switch code {
+		case 301, 302, 303, 307, 308:
+			config.Code = code
+		default:
+			return config, fmt.Errorf("invalid redirect code %d, must be 301, 302, 303, 307 or 308", code)
+		}
+	}
+	
+	return config, nil
+}
+
+// ValidateSSLProtocols checks that every entry is a protocol nginx accepts in ssl_protocols
+func ValidateSSLProtocols(protocols []string) error {
+	if len(protocols) == 0 {
+		return fmt.Errorf("ssl protocols must list at least one protocol")
+	}
+	for _, protocol := range protocols {
+		switch protocol {
+		case "TLSv1", "TLSv1.1", "TLSv1.2", "TLSv1.3":
+		default:
+			return fmt.Errorf("invalid ssl protocol %q, must be one of: TLSv1, TLSv1.1, TLSv1.2, TLSv1.3", protocol)
+		}
+	}
+	return nil
+}
+
+// tlsVersions are the TLS versions nginx supports, oldest first, with their
+// ssl_protocols names
+var tlsVersions = []struct {
+	version  string
+	protocol string
+}{
+	{"1.0", "TLSv1"},
+	{"1.1", "TLSv1.1"},
+	{"1.2", "TLSv1.2"},
+	{"1.3", "TLSv1.3"},
+}
+
+// ParseMinTLSVersion parses a minimum TLS version such as "1.2" or "TLSv1.2"
+// and returns it as "1.2"
+func ParseMinTLSVersion(value string) (string, error) {
+	version := strings.TrimPrefix(strings.TrimSpace(value), "TLSv")
+	if version == "1" {
+		version = "1.0"
+	}
+	if tlsVersionIndex(version) < 0 {
+		return "", fmt.Errorf("invalid minimum TLS version %q, must be one of: 1.0, 1.1, 1.2, 1.3", value)
+	}
+	return version, nil
+}
+
+// tlsVersionIndex returns the position of a version ("1.2") or protocol
+// ("TLSv1.2") in tlsVersions, or -1 when unknown
+func tlsVersionIndex(value string) int {
+	for i, v := range tlsVersions {
+		if value == v.version || value == v.protocol {
+			return i
+		}
+	}
+	return -1
+}
+
+// MinTLSProtocols returns the ssl_protocols for a minimum TLS version: that
+// version and every newer one
+func MinTLSProtocols(version string) []string {
+	var protocols []string
+	if i := tlsVersionIndex(version); i >= 0 {
+		for _, v := range tlsVersions[i:] {
+			protocols = append(protocols, v.protocol)
+		}
+	}
+	return protocols
+}
+
+// ValidateSSLCiphers checks that an OpenSSL cipher string is a single token
+// that can't break out of the ssl_ciphers directive
+func ValidateSSLCiphers(ciphers string) error {
+	if ciphers == "" {
+		return fmt.Errorf("ssl ciphers must not be empty")
+	}
+	if strings.ContainsAny(ciphers, " \t\n;{}\"'") {
+		return fmt.Errorf("invalid ssl ciphers %q", ciphers)
+	}
+	return nil
+}
+
+func extractProxyCacheConfig(labels map[string]string) (ProxyCacheConfig, error) {
+	config := ProxyCacheConfig{
+		Enabled:  parseBool(labels[LabelProxyCache]),
+		Key:      DefaultProxyCacheKey,
+		Valid:    []string{DefaultProxyCacheValid},
+		ZoneSize: DefaultProxyCacheZoneSize,
+	}
+	
+	if key, exists := labels[LabelProxyCacheKey]; exists {
+		key = strings.TrimSpace(key)
+		if key == "" || strings.ContainsAny(key, " \t;{}\"'") {
+			return config, fmt.Errorf("invalid proxy cache key %q", key)
+		}
+		config.Key = key
+	}
+	
+	if valid, exists := labels[LabelProxyCacheValid]; exists {
+		config.Valid = nil
+		for _, entry := range splitList(valid) {
+			fields := strings.Fields(entry)
+			if !isValidNginxDuration(fields[len(fields)-1]) {
+				return config, fmt.Errorf("invalid proxy cache validity %q, must end with a duration", entry)
+			}
+			for _, code := range fields[:len(fields)-1] {
+				if status, err := strconv.Atoi(code); code != "any" && (err != nil || status < 100 || status > 599) {
+					return config, fmt.Errorf("invalid status code %q in proxy cache validity %q", code, entry)
+				}
+			}
+			config.Valid = append(config.Valid, strings.Join(fields, " "))
+		}
+		if len(config.Valid) == 0 {
+			return config, fmt.Errorf("%s must list at least one entry", LabelProxyCacheValid)
+		}
+	}
+	
+	if size, exists := labels[LabelProxyCacheZoneSize]; exists {
+		if !isValidNginxSize(size) {
+			return config, fmt.Errorf("invalid proxy cache zone size %q", size)
+		}
+		config.ZoneSize = size
+	}
+	
+	if size, exists := labels[LabelProxyCacheMaxSize]; exists {
+		if !isValidNginxSize(size) {
+			return config, fmt.Errorf("invalid proxy cache max size %q", size)
+		}
+		config.MaxSize = size
+	}
+	
+	if inactive, exists := labels[LabelProxyCacheInactive]; exists {
+		if !isValidNginxDuration(inactive) {
+			return config, fmt.Errorf("invalid proxy cache inactive time %q", inactive)
+		}
+		config.Inactive = inactive
+	}
+	
+	return config, nil
+}
+
+func extractClientTimeoutConfig(labels map[string]string) (ClientTimeoutConfig, error) {
+	config := ClientTimeoutConfig{}
+	
+	for label, target := range map[string]*string{
+		LabelClientBodyTimeout:   &config.Body,
+		LabelClientHeaderTimeout: &config.Header,
+		LabelSendTimeout:         &config.Send,
+	} {
+		value, exists := labels[label]
+		if !exists {
+			continue
+		}
+		if !isValidNginxDuration(value) {
+			return config, fmt.Errorf("invalid %s %q, must be an nginx time such as 30s or 1m", label, value)
+		}
+		*target = value
+	}
+	
+	return config, nil
+}
+
+func extractHSTSConfig(labels map[string]string) (HSTSConfig, error) {
+	config := HSTSConfig{
+		Enabled: parseBool(labels[LabelHSTS]),
+		MaxAge:  DefaultHSTSMaxAge,
+	}
+	
+	if maxAgeStr, exists := labels[LabelHSTSMaxAge]; exists {
+		maxAge, err := strconv.Atoi(maxAgeStr)
+		if err != nil || maxAge < 0 {
+			return config, fmt.Errorf("invalid HSTS max-age %s", maxAgeStr)
+		}
+		config.MaxAge = maxAge
+	}
+	
+	config.IncludeSubdomains = parseBool(labels[LabelHSTSIncludeSubdomains])
+	
+	return config, nil
+}
+
+func extractLoadBalancerConfig(labels map[string]string) (LoadBalancerConfig, error) {
 	config := LoadBalancerConfig{
 		Method: "round_robin", // default
 	}
 	
 	if method, exists := labels[LabelMethod]; exists {
 		switch method {
-		case "round_robin", "least_conn", "ip_hash":
+		case "round_robin", "least_conn", "ip_hash", "random", "hash":
 			config.Method = method
 		}
 	}
 	
-	return config
+	if config.Method == "hash" {
+		hashKey := strings.TrimSpace(labels[LabelHashKey])
+		if hashKey == "" {
+			return config, fmt.Errorf("%s is required when load balancing method is hash", LabelHashKey)
+		}
+		if strings.ContainsAny(hashKey, ";{}\"'") {
+			return config, fmt.Errorf("invalid hash key %q", hashKey)
+		}
+		config.HashKey = hashKey
+	}
+	
+	if maxFailsStr, exists := labels[LabelUpstreamMaxFails]; exists {
+		maxFails, err := strconv.Atoi(maxFailsStr)
+		if err != nil || maxFails <= 0 {
+			return config, fmt.Errorf("invalid upstream max-fails %s, must be a positive integer", maxFailsStr)
+		}
+		config.MaxFails = maxFails
+	}
+	
+	if failTimeout, exists := labels[LabelUpstreamFailTimeout]; exists {
+		if !isValidNginxDuration(failTimeout) {
+			return config, fmt.Errorf("invalid upstream fail-timeout %s", failTimeout)
+		}
+		config.FailTimeout = failTimeout
+	}
+	
+	if zoneSize, exists := labels[LabelUpstreamZoneSize]; exists {
+		if !isValidNginxSize(zoneSize) {
+			return config, fmt.Errorf("invalid upstream zone size %s, e.g. 64k", zoneSize)
+		}
+		config.ZoneSize = zoneSize
+	}
+	
+	return config, nil
 }
 
 func extractHealthCheckConfig(labels map[string]string) HealthCheckConfig {
@@ -244,7 +1051,7 @@ func extractHealthCheckConfig(labels map[string]string) HealthCheckConfig {
 	return config
 }
 
-func extractMiddlewareConfig(labels map[string]string) MiddlewareConfig {
+func extractMiddlewareConfig(labels map[string]string) (MiddlewareConfig, error) {
 	config := MiddlewareConfig{}
 	
 	// Extract auth config
@@ -259,14 +1066,76 @@ func extractMiddlewareConfig(labels map[string]string) MiddlewareConfig {
 		config.CORS.Enabled = true
 		// Parse CORS specific labels
 		if origins, exists := labels[LabelCORS+".origins"]; exists {
-			config.CORS.AllowOrigins = strings.Split(origins, ",")
+			config.CORS.AllowOrigins = splitList(origins)
+			for _, origin := range config.CORS.AllowOrigins {
+				if err := validateCORSOrigin(origin); err != nil {
+					return config, err
+				}
+			}
 		}
 		if methods, exists := labels[LabelCORS+".methods"]; exists {
-			config.CORS.AllowMethods = strings.Split(methods, ",")
+			config.CORS.AllowMethods = splitList(methods)
+			for i, method := range config.CORS.AllowMethods {
+				method = strings.ToUpper(method)
+				if !isValidHTTPMethod(method) {
+					return config, fmt.Errorf("invalid CORS method %q", method)
+				}
+				config.CORS.AllowMethods[i] = method
+			}
 		}
 	}
 	
-	return config
+	return config, nil
+}
+
+// validateCORSOrigin checks that an origin is "*" or exactly an http(s)
+// scheme://host[:port], optionally with a trailing slash. Origins are written
+// quoted into a map, so quotes, semicolons, braces and whitespace are refused.
+func validateCORSOrigin(origin string) error {
+	if origin == "*" {
+		return nil
+	}
+	if strings.ContainsAny(origin, "\"';{}") || strings.IndexFunc(origin, unicode.IsSpace) >= 0 {
+		return fmt.Errorf("invalid CORS origin %q: contains forbidden characters", origin)
+	}
+	
+	u, err := url.Parse(origin)
+	if err != nil {
+		return fmt.Errorf("invalid CORS origin %q: %w", origin, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid CORS origin %q: must be \"*\" or an http(s) URL", origin)
+	}
+	if u.Path != "" && u.Path != "/" {
+		return fmt.Errorf("invalid CORS origin %q: origins must not contain a path", origin)
+	}
+	// Browsers send only scheme, host and port: no user info, query or fragment
+	if strings.TrimSuffix(origin, "/") != u.Scheme+"://"+u.Host {
+		return fmt.Errorf("invalid CORS origin %q: must be scheme://host[:port]", origin)
+	}
+	
+	return nil
+}
+
+// isValidHTTPMethod reports whether method is a recognized HTTP method
+func isValidHTTPMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "CONNECT", "TRACE":
+		return true
+	default:
+		return false
+	}
+}
+
+// splitList splits a comma-separated label value, trimming whitespace and dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 func extractFastCGIConfig(labels map[string]string) FastCGIConfig {
@@ -291,8 +1160,21 @@ func extractFastCGIConfig(labels map[string]string) FastCGIConfig {
 	}
 	
 	// Extract FastCGI parameters file path
-	if paramsFile, exists := labels[LabelFastCGIParamsFile]; exists {
-		config.ParamsFile = paramsFile
+	if paramsFiles, exists := labels[LabelFastCGIParamsFile]; exists {
+		config.ParamsFiles = splitList(paramsFiles)
+	}
+	
+	// Extract default parameter set; true/false toggle the PHP defaults
+	config.Defaults = FastCGIDefaultsPHP
+	if defaults, exists := labels[LabelFastCGIDefaults]; exists {
+		switch value := strings.ToLower(strings.TrimSpace(defaults)); value {
+		case "true", "":
+			config.Defaults = FastCGIDefaultsPHP
+		case "false":
+			config.Defaults = FastCGIDefaultsNone
+		default:
+			config.Defaults = value
+		}
 	}
 	
 	return config
@@ -318,6 +1200,110 @@ func parseFastCGIParams(paramStr string) map[string]string {
 	return params
 }
 
+// parseHeaderList splits a comma-separated list of header names and validates each one
+func parseHeaderList(value string) ([]string, error) {
+	headers := splitList(value)
+	for _, header := range headers {
+		if !isValidHeaderName(header) {
+			return nil, fmt.Errorf("invalid header name %q", header)
+		}
+	}
+	return headers, nil
+}
+
+// parseProxyRedirect validates a proxy_redirect value: "default", "off" or a
+// redirect and replacement separated by whitespace
+func parseProxyRedirect(value string) (string, error) {
+	fields := strings.Fields(value)
+	switch {
+	case len(fields) == 1 && (fields[0] == "default" || fields[0] == "off"):
+		return fields[0], nil
+	case len(fields) != 2:
+		return "", fmt.Errorf("invalid proxy redirect %q, must be default, off or \"<redirect> <replacement>\"", value)
+	}
+	
+	for _, field := range fields {
+		if strings.ContainsAny(field, ";{}\"'") {
+			return "", fmt.Errorf("invalid proxy redirect %q", value)
+		}
+	}
+	return fields[0] + " " + fields[1], nil
+}
+
+// isValidHeaderName reports whether name is a valid HTTP header field name
+func isValidHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// isValidNginxSize reports whether value is an nginx size such as 512k, 10m or 1g
+func isValidNginxSize(value string) bool {
+	digits := strings.TrimRight(value, "kKmMgG")
+	if digits == "" || len(value)-len(digits) > 1 {
+		return false
+	}
+	size, err := strconv.Atoi(digits)
+	return err == nil && size > 0
+}
+
+// isValidNginxDuration reports whether value is an nginx time value such as
+// "30", "30s", "500ms" or "1m"
+func isValidNginxDuration(value string) bool {
+	digits := strings.TrimRightFunc(value, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	if digits == "" {
+		return false
+	}
+	if _, err := strconv.Atoi(digits); err != nil {
+		return false
+	}
+	
+	switch value[len(digits):] {
+	case "", "ms", "s", "m", "h", "d", "w", "M", "y":
+		return true
+	default:
+		return false
+	}
+}
+
+// snippetHashLabel returns the lower-cased sha256 digest of a snippet hash
+// label, or an empty string when the label isn't set
+func snippetHashLabel(labels map[string]string, label string) (string, error) {
+	expectedHash, exists := labels[label]
+	if !exists {
+		return "", nil
+	}
+	expectedHash = strings.ToLower(strings.TrimSpace(expectedHash))
+	if !isSHA256Hex(expectedHash) {
+		return "", fmt.Errorf("invalid %s value, expected 64 hex characters", label)
+	}
+	return expectedHash, nil
+}
+
+// isSHA256Hex reports whether value is a hex-encoded sha256 digest
+func isSHA256Hex(value string) bool {
+	if len(value) != 64 {
+		return false
+	}
+	for _, c := range value {
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
 func parseBool(value string) bool {
 	switch strings.ToLower(value) {
 	case "true", "1", "yes", "on":
@@ -350,6 +1336,38 @@ func ValidateConfig(config *ContainerConfig) error {
 		if config.FastCGI.BackendProtocol != "FCGI" {
 			return fmt.Errorf("backend-protocol must be 'FCGI' when FastCGI is enabled")
 		}
+		switch config.FastCGI.Defaults {
+		case "", FastCGIDefaultsPHP, FastCGIDefaultsCGI, FastCGIDefaultsNone:
+		default:
+			return fmt.Errorf("invalid fastcgi-defaults %q, must be php, cgi, none, true or false", config.FastCGI.Defaults)
+		}
+	}
+	
+	// Backend certificates are only checked on https connections
+	if config.ProxySSLVerify && config.Protocol != "https" {
+		return fmt.Errorf("proxy-ssl-verify requires protocol https")
+	}
+	if config.ProxySSLCA != "" && !config.ProxySSLVerify {
+		return fmt.Errorf("proxy-ssl-ca requires proxy-ssl-verify")
+	}
+	
+	// grpc_pass takes no URI and can't use a resolver variable here, and
+	// the grpc module has no request buffering, redirect rewriting or cache
+	if config.BackendHTTP2 {
+		switch {
+		case config.FastCGI.Enabled:
+			return fmt.Errorf("backend-http2 can't be combined with FastCGI")
+		case config.UpstreamHost != "":
+			return fmt.Errorf("backend-http2 can't be combined with upstream-host")
+		case !config.PreservePath:
+			return fmt.Errorf("backend-http2 requires preserve-path, the full path is always passed")
+		case config.ProxyRequestBuffering != "":
+			return fmt.Errorf("backend-http2 can't be combined with proxy-request-buffering")
+		case config.ProxyRedirect != "":
+			return fmt.Errorf("backend-http2 can't be combined with proxy-redirect")
+		case config.ProxyCache.Enabled:
+			return fmt.Errorf("backend-http2 can't be combined with proxy-cache")
+		}
 	}
 	
 	if !strings.HasPrefix(config.Path, "/") {
@@ -0,0 +1,192 @@
+package docker
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBackendHTTP2Validation(t *testing.T) {
+	base := map[string]string{LabelEnable: "true", LabelHost: "grpc.test", LabelBackendHTTP2: "true", LabelPreservePath: "true"}
+	tests := []struct {
+		name    string
+		extra   map[string]string
+		wantErr string
+	}{
+		{name: "h2c"},
+		{name: "intercept errors", extra: map[string]string{LabelInterceptErrors: "true"}},
+		{name: "without preserve-path", extra: map[string]string{LabelPreservePath: "false"}, wantErr: "requires preserve-path"},
+		{name: "upstream host", extra: map[string]string{LabelUpstreamHost: "grpc.internal"}, wantErr: "upstream-host"},
+		{name: "request buffering", extra: map[string]string{LabelProxyRequestBuffering: "off"}, wantErr: "proxy-request-buffering"},
+		{name: "proxy redirect", extra: map[string]string{LabelProxyRedirect: "off"}, wantErr: "proxy-redirect"},
+		{name: "proxy cache", extra: map[string]string{LabelProxyCache: "true"}, wantErr: "proxy-cache"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := make(map[string]string)
+			for key, value := range base {
+				labels[key] = value
+			}
+			for key, value := range tt.extra {
+				labels[key] = value
+			}
+			config, err := ExtractConfig(testContainerID("grpc"), "grpc", "10.0.0.2", labels)
+			if err == nil {
+				err = ValidateConfig(config)
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBackendHTTP2Directives(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol string
+		want     []string
+	}{
+		{name: "h2c", want: []string{"grpc_pass grpc://", "grpc_set_header Host $host;"}},
+		{name: "tls", protocol: "https", want: []string{"grpc_pass grpcs://", "grpc_ssl_server_name on;"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := map[string]string{LabelHost: "grpc.test", LabelBackendHTTP2: "true", LabelPreservePath: "true", LabelInterceptErrors: "true"}
+			if tt.protocol != "" {
+				labels[LabelProtocol] = tt.protocol
+			}
+			location := locationBlock(t, renderTestConfig(t, DefaultGeneratorOptions(), newTestContainer(t, "grpc", "10.0.0.2", labels)), "/")
+			for _, want := range append(tt.want, "grpc_intercept_errors on;") {
+				if !strings.Contains(location, want) {
+					t.Errorf("location lacks %q:\n%s", want, location)
+				}
+			}
+			if strings.Contains(location, "proxy_pass") {
+				t.Errorf("HTTP/2 backend proxied with proxy_pass:\n%s", location)
+			}
+		})
+	}
+}
+
+func TestCORSLabelValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     string
+		methods     string
+		wantErr     string
+		wantOrigins []string
+		wantMethods []string
+	}{
+		{name: "wildcard", origins: "*", wantOrigins: []string{"*"}},
+		{name: "origins trimmed", origins: " https://a.test , http://b.test:8080 ", wantOrigins: []string{"https://a.test", "http://b.test:8080"}},
+		{name: "trailing slash", origins: "https://a.test/", wantOrigins: []string{"https://a.test/"}},
+		{name: "methods upper-cased", methods: "get, post", wantMethods: []string{"GET", "POST"}},
+		{name: "origin without scheme", origins: "a.test", wantErr: "must be \"*\" or an http(s) URL"},
+		{name: "origin with other scheme", origins: "ftp://a.test", wantErr: "must be \"*\" or an http(s) URL"},
+		{name: "origin with path", origins: "https://a.test/app", wantErr: "must not contain a path"},
+		{name: "unknown method", methods: "GET,FETCH", wantErr: `invalid CORS method "FETCH"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := map[string]string{LabelHost: "app.test", LabelCORS: "true"}
+			if tt.origins != "" {
+				labels[LabelCORS+".origins"] = tt.origins
+			}
+			if tt.methods != "" {
+				labels[LabelCORS+".methods"] = tt.methods
+			}
+			config, err := validateTestLabels(labels)
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+			cors := config.Middleware.CORS
+			if tt.wantOrigins != nil && !reflect.DeepEqual(cors.AllowOrigins, tt.wantOrigins) {
+				t.Errorf("origins = %q, want %q", cors.AllowOrigins, tt.wantOrigins)
+			}
+			if tt.wantMethods != nil && !reflect.DeepEqual(cors.AllowMethods, tt.wantMethods) {
+				t.Errorf("methods = %q, want %q", cors.AllowMethods, tt.wantMethods)
+			}
+		})
+	}
+}
+
+func TestLabelDefaults(t *testing.T) {
+	custom := LabelDefaults{Protocol: "https", Port: 8080, Path: "/app", Priority: 50}
+
+	tests := []struct {
+		name     string
+		defaults LabelDefaults
+		labels   map[string]string
+		want     LabelDefaults
+	}{
+		{"package defaults", LabelDefaults{}, nil, LabelDefaults{Protocol: DefaultProtocol, Port: 80, Path: DefaultPath, Priority: DefaultPriority}},
+		{"custom defaults", custom, nil, custom},
+		{"partial defaults fall back", LabelDefaults{Port: 3000}, nil, LabelDefaults{Protocol: DefaultProtocol, Port: 3000, Path: DefaultPath, Priority: DefaultPriority}},
+		{
+			name:     "labels override defaults",
+			defaults: custom,
+			labels:   map[string]string{LabelProtocol: "http", LabelPort: "9000", LabelPath: "/api", LabelPriority: "200"},
+			want:     LabelDefaults{Protocol: "http", Port: 9000, Path: "/api", Priority: 200},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := map[string]string{LabelEnable: "true", LabelHost: "app.test"}
+			for key, value := range tt.labels {
+				labels[key] = value
+			}
+			config, err := ExtractConfigWithDefaults(testContainerID("app"), "app", "10.0.0.2", labels, tt.defaults)
+			if err != nil {
+				t.Fatalf("ExtractConfigWithDefaults: %v", err)
+			}
+			got := LabelDefaults{Protocol: config.Protocol, Port: config.Port, Path: config.Path, Priority: config.Priority}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLabelDefaultsValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		defaults LabelDefaults
+		wantErr  string
+	}{
+		{"zero", LabelDefaults{}, ""},
+		{"valid", LabelDefaults{Protocol: "https", Port: 8443, Path: "/app", Priority: 10}, ""},
+		{"protocol", LabelDefaults{Protocol: "ftp"}, "invalid default protocol"},
+		{"port", LabelDefaults{Port: 70000}, "invalid default port"},
+		{"path", LabelDefaults{Path: "app"}, "invalid default path"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkError(t, tt.defaults.Validate(), tt.wantErr)
+		})
+	}
+}
+
+func TestListContainersAppliesLabelDefaults(t *testing.T) {
+	docker := newFakeDocker(fakeContainer{Name: "web", IP: "172.18.0.2", Labels: map[string]string{LabelEnable: "true", LabelHost: "web.test"}})
+	containers, _, err := listContainers(context.Background(), docker, ListOptions{Defaults: LabelDefaults{Port: 8080, Path: "/app"}})
+	if err != nil {
+		t.Fatalf("listContainers: %v", err)
+	}
+	if config := containers[0].Config; config.Port != 8080 || config.Path != "/app" {
+		t.Errorf("listed port %d and path %s, want the defaults 8080 and /app", config.Port, config.Path)
+	}
+}
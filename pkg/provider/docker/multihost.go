@@ -0,0 +1,356 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/system"
+	"github.com/docker/go-connections/nat"
+)
+
+// DockerEndpoint is one Docker daemon of a multi-host setup
+type DockerEndpoint struct {
+	Host string // Daemon address, used in log messages
+	API  DockerAPI
+	
+	// Address nginx reaches the host's published ports at. Containers of an
+	// endpoint with an address are routed to their published host port there;
+	// without one they are routed to their container IP, which requires nginx
+	// to reach the host's container networks (local daemon or overlay network).
+	Address string
+}
+
+// EndpointAddress returns the address of a Docker daemon URL that published
+// ports are reachable at: the host of a tcp:// or http(s):// URL, or empty
+// for a local unix socket or named pipe.
+func EndpointAddress(host string) string {
+	u, err := url.Parse(host)
+	if err != nil {
+		return ""
+	}
+	switch u.Scheme {
+	case "tcp", "http", "https", "ssh":
+		return u.Hostname()
+	}
+	return ""
+}
+
+// BackendResolver is implemented by Docker APIs whose containers aren't all
+// reachable at their container IP, e.g. on remote hosts of a multi-host
+// setup. ResolveBackend returns the address and port nginx reaches port of a
+// container at, or remote=false when the container IP and port work.
+type BackendResolver interface {
+	ResolveBackend(containerID string, response container.InspectResponse, port int) (address string, hostPort int, remote bool, err error)
+}
+
+// resyncNotifier is implemented by Docker APIs whose containers can change
+// without an event being delivered, e.g. when one of several hosts drops
+// out or comes back. The provider reloads on every signal.
+type resyncNotifier interface {
+	Resync() <-chan struct{}
+}
+
+// Reconnect backoff of a host whose event stream failed
+const (
+	hostReconnectDelay    = 5 * time.Second
+	hostReconnectMaxDelay = time.Minute
+)
+
+// multiDockerAPI aggregates several Docker daemons into one DockerAPI.
+// Containers of all hosts are listed together and per-container calls go to
+// the host that reported the container. A host that fails is skipped with a
+// warning so the others keep serving; only when every host fails is an
+// error returned.
+type multiDockerAPI struct {
+	endpoints []DockerEndpoint
+	resync    chan struct{}
+
+	mu     sync.RWMutex
+	owners map[string]int // container ID -> index into endpoints
+}
+
+// NewMultiDockerAPI combines the endpoints into a single DockerAPI. A single
+// endpoint is returned as is.
+func NewMultiDockerAPI(endpoints []DockerEndpoint) (DockerAPI, error) {
+	switch len(endpoints) {
+	case 0:
+		return nil, fmt.Errorf("no Docker endpoints configured")
+	case 1:
+		return endpoints[0].API, nil
+	}
+	return &multiDockerAPI{
+		endpoints: endpoints,
+		resync:    make(chan struct{}, 1),
+		owners:    make(map[string]int),
+	}, nil
+}
+
+// Resync signals when a host's event stream was lost or restored
+func (m *multiDockerAPI) Resync() <-chan struct{} {
+	return m.resync
+}
+
+// requestResync signals a resync unless one is already pending
+func (m *multiDockerAPI) requestResync() {
+	select {
+	case m.resync <- struct{}{}:
+	default:
+	}
+}
+
+// setOwner records which host runs a container
+func (m *multiDockerAPI) setOwner(containerID string, index int) {
+	if containerID == "" {
+		return
+	}
+	m.mu.Lock()
+	m.owners[containerID] = index
+	m.mu.Unlock()
+}
+
+// candidates returns the endpoint indexes to try for a container: its known
+// host, or every host when it hasn't been seen yet
+func (m *multiDockerAPI) candidates(containerID string) []int {
+	m.mu.RLock()
+	index, known := m.owners[containerID]
+	m.mu.RUnlock()
+	if known {
+		return []int{index}
+	}
+
+	all := make([]int, len(m.endpoints))
+	for i := range all {
+		all[i] = i
+	}
+	return all
+}
+
+// hostErrors combines the errors of every host into one
+func hostErrors(hosts []string, errs []error) error {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = fmt.Sprintf("%s: %v", hosts[i], err)
+	}
+	return fmt.Errorf("all Docker hosts failed: %s", strings.Join(messages, "; "))
+}
+
+// ContainerList lists the containers of all hosts concurrently
+func (m *multiDockerAPI) ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+	lists := make([][]container.Summary, len(m.endpoints))
+	errs := make([]error, len(m.endpoints))
+
+	var wg sync.WaitGroup
+	for i, endpoint := range m.endpoints {
+		wg.Add(1)
+		go func(i int, endpoint DockerEndpoint) {
+			defer wg.Done()
+			lists[i], errs[i] = endpoint.API.ContainerList(ctx, options)
+		}(i, endpoint)
+	}
+	wg.Wait()
+
+	var all []container.Summary
+	var failedHosts []string
+	var failures []error
+	failed := make(map[int]bool)
+	for i, endpoint := range m.endpoints {
+		if errs[i] != nil {
+			log.Printf("Warning: failed to list containers on Docker host %s, skipping it: %v", endpoint.Host, errs[i])
+			failedHosts = append(failedHosts, endpoint.Host)
+			failures = append(failures, errs[i])
+			failed[i] = true
+			continue
+		}
+		all = append(all, lists[i]...)
+	}
+	if len(failures) == len(m.endpoints) {
+		return nil, hostErrors(failedHosts, failures)
+	}
+
+	// Rebuild ownership from the hosts that answered, keeping what is known
+	// about the ones that didn't
+	owners := make(map[string]int, len(all))
+	m.mu.Lock()
+	for id, index := range m.owners {
+		if failed[index] {
+			owners[id] = index
+		}
+	}
+	for i := range m.endpoints {
+		for _, summary := range lists[i] {
+			owners[summary.ID] = i
+		}
+	}
+	m.owners = owners
+	m.mu.Unlock()
+
+	return all, nil
+}
+
+// ResolveBackend routes a container on an endpoint with an address to the
+// host port its port is published on. Ports published only on a loopback
+// address aren't reachable from nginx and are an error like unpublished ones.
+func (m *multiDockerAPI) ResolveBackend(containerID string, response container.InspectResponse, port int) (string, int, bool, error) {
+	m.mu.RLock()
+	index, known := m.owners[containerID]
+	m.mu.RUnlock()
+	if !known || m.endpoints[index].Address == "" {
+		return "", 0, false, nil
+	}
+	endpoint := m.endpoints[index]
+	
+	if response.NetworkSettings != nil {
+		for _, binding := range response.NetworkSettings.Ports[nat.Port(fmt.Sprintf("%d/tcp", port))] {
+			if ip := net.ParseIP(binding.HostIP); ip != nil && ip.IsLoopback() {
+				continue
+			}
+			hostPort, err := nat.ParsePort(binding.HostPort)
+			if err != nil || hostPort == 0 {
+				continue
+			}
+			return endpoint.Address, hostPort, true, nil
+		}
+	}
+	return "", 0, true, fmt.Errorf("port %d is not published on Docker host %s, containers of remote hosts are routed through published ports", port, endpoint.Host)
+}
+
+// ContainerInspect inspects a container on the host that runs it
+func (m *multiDockerAPI) ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error) {
+	var lastErr error
+	for _, i := range m.candidates(containerID) {
+		response, err := m.endpoints[i].API.ContainerInspect(ctx, containerID)
+		if err == nil {
+			m.setOwner(containerID, i)
+			return response, nil
+		}
+		lastErr = err
+	}
+	return container.InspectResponse{}, lastErr
+}
+
+// CopyFromContainer copies from a container on the host that runs it
+func (m *multiDockerAPI) CopyFromContainer(ctx context.Context, containerID, srcPath string) (io.ReadCloser, container.PathStat, error) {
+	var lastErr error
+	for _, i := range m.candidates(containerID) {
+		reader, stat, err := m.endpoints[i].API.CopyFromContainer(ctx, containerID, srcPath)
+		if err == nil {
+			return reader, stat, nil
+		}
+		lastErr = err
+	}
+	return nil, container.PathStat{}, lastErr
+}
+
+// Info returns the info of the first host that answers
+func (m *multiDockerAPI) Info(ctx context.Context) (system.Info, error) {
+	var hosts []string
+	var errs []error
+	for _, endpoint := range m.endpoints {
+		info, err := endpoint.API.Info(ctx)
+		if err == nil {
+			return info, nil
+		}
+		hosts = append(hosts, endpoint.Host)
+		errs = append(errs, err)
+	}
+	return system.Info{}, hostErrors(hosts, errs)
+}
+
+// Events merges the event streams of all hosts. A host whose stream fails
+// is reconnected in the background with backoff, so the returned error
+// channel never reports errors of a single host.
+func (m *multiDockerAPI) Events(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error) {
+	messages := make(chan events.Message)
+	errs := make(chan error)
+
+	for i := range m.endpoints {
+		go m.watchHost(ctx, i, options, messages)
+	}
+	return messages, errs
+}
+
+// watchHost forwards the events of one host until ctx is done
+func (m *multiDockerAPI) watchHost(ctx context.Context, index int, options events.ListOptions, out chan<- events.Message) {
+	endpoint := m.endpoints[index]
+	for {
+		err := m.forwardEvents(ctx, index, options, out)
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Printf("Warning: lost the event stream of Docker host %s: %v", endpoint.Host, err)
+		m.requestResync()
+		if !m.awaitHost(ctx, endpoint) {
+			return
+		}
+		log.Printf("Reconnected to Docker host %s", endpoint.Host)
+		m.requestResync()
+	}
+}
+
+// forwardEvents subscribes to one host's events and forwards them until the
+// stream fails or ctx is done
+func (m *multiDockerAPI) forwardEvents(ctx context.Context, index int, options events.ListOptions, out chan<- events.Message) error {
+	messages, errs := m.endpoints[index].API.Events(ctx, options)
+	for {
+		select {
+		case event, ok := <-messages:
+			if !ok {
+				return fmt.Errorf("event stream closed")
+			}
+			if event.Type == events.NetworkEventType {
+				m.setOwner(event.Actor.Attributes["container"], index)
+			} else {
+				m.setOwner(event.Actor.ID, index)
+			}
+			select {
+			case out <- event:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+		case err := <-errs:
+			if err == nil {
+				err = fmt.Errorf("event stream closed")
+			}
+			return err
+
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// awaitHost polls a host with backoff until it answers again. It returns
+// false when ctx is done first.
+func (m *multiDockerAPI) awaitHost(ctx context.Context, endpoint DockerEndpoint) bool {
+	delay := hostReconnectDelay
+	for {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return false
+		}
+
+		probeCtx, cancel := context.WithTimeout(ctx, DefaultDockerTimeout)
+		_, err := endpoint.API.Info(probeCtx)
+		cancel()
+		if err == nil {
+			return true
+		}
+
+		delay *= 2
+		if delay > hostReconnectMaxDelay {
+			delay = hostReconnectMaxDelay
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+)
+
+func TestEndpointAddress(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"unix:///var/run/docker.sock", ""},
+		{"npipe:////./pipe/docker_engine", ""},
+		{"tcp://node1:2375", "node1"},
+		{"tcp://10.1.0.5:2376", "10.1.0.5"},
+		{"ssh://user@node2", "node2"},
+		{"https://[fd00::5]:2376", "fd00::5"},
+	}
+	for _, tt := range tests {
+		if got := EndpointAddress(tt.host); got != tt.want {
+			t.Errorf("EndpointAddress(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+// published returns a container port published on hostPort
+func published(port, hostPort uint16, hostIP string) container.Port {
+	return container.Port{PrivatePort: port, PublicPort: hostPort, IP: hostIP, Type: "tcp"}
+}
+
+func TestMultiHostRouting(t *testing.T) {
+	labels := func(host string) map[string]string {
+		return map[string]string{LabelEnable: "true", LabelHost: host, LabelPort: "80"}
+	}
+	tests := []struct {
+		name        string
+		remote      fakeContainer
+		address     string            // of the remote endpoint
+		want        map[string]string // host -> upstream server address
+		wantInvalid []string
+	}{
+		{
+			name:    "remote container on its published port",
+			remote:  fakeContainer{Name: "b", IP: "172.17.0.9", Labels: labels("b.test"), Ports: []container.Port{published(80, 8081, "0.0.0.0")}},
+			address: "10.1.0.5",
+			want:    map[string]string{"a.test": "172.18.0.2:80", "b.test": "10.1.0.5:8081"},
+		},
+		{
+			name:        "remote container without a published port",
+			remote:      fakeContainer{Name: "b", IP: "172.17.0.9", Labels: labels("b.test")},
+			address:     "10.1.0.5",
+			want:        map[string]string{"a.test": "172.18.0.2:80"},
+			wantInvalid: []string{"b"},
+		},
+		{
+			name:        "remote port published on loopback only",
+			remote:      fakeContainer{Name: "b", IP: "172.17.0.9", Labels: labels("b.test"), Ports: []container.Port{published(80, 8081, "127.0.0.1")}},
+			address:     "10.1.0.5",
+			want:        map[string]string{"a.test": "172.18.0.2:80"},
+			wantInvalid: []string{"b"},
+		},
+		{
+			name:   "container ip routing",
+			remote: fakeContainer{Name: "b", IP: "172.17.0.9", Labels: labels("b.test")},
+			want:   map[string]string{"a.test": "172.18.0.2:80", "b.test": "172.17.0.9:80"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local := newFakeDocker(fakeContainer{Name: "a", IP: "172.18.0.2", Labels: labels("a.test")})
+			remote := newFakeDocker(tt.remote)
+			api, err := NewMultiDockerAPI([]DockerEndpoint{
+				{Host: "unix:///var/run/docker.sock", API: local},
+				{Host: "tcp://node2:2375", API: remote, Address: tt.address},
+			})
+			if err != nil {
+				t.Fatalf("NewMultiDockerAPI: %v", err)
+			}
+
+			containers, invalid, err := listContainers(context.Background(), api, ListOptions{Backends: api.(BackendResolver)})
+			if err != nil {
+				t.Fatalf("listContainers: %v", err)
+			}
+			config := generateTestConfig(t, DefaultGeneratorOptions(), containers...)
+
+			got := make(map[string]string)
+			for _, server := range config.Servers {
+				for _, upstream := range config.Upstreams {
+					if upstream.Name == server.Locations[0].Upstream {
+						got[server.ServerName] = upstream.Servers[0].Address
+					}
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("upstreams = %v, want %v", got, tt.want)
+			}
+			for host, address := range tt.want {
+				if got[host] != address {
+					t.Errorf("%s routed to %q, want %q", host, got[host], address)
+				}
+			}
+
+			var names []string
+			for _, container := range invalid {
+				names = append(names, container.ContainerName)
+			}
+			if len(names) != len(tt.wantInvalid) || len(names) > 0 && names[0] != tt.wantInvalid[0] {
+				t.Errorf("invalid = %v, want %v", names, tt.wantInvalid)
+			}
+		})
+	}
+}
+
+func TestMultiHostListing(t *testing.T) {
+	tests := []struct {
+		name      string
+		failing   []bool
+		wantNames []string
+		wantErr   bool
+	}{
+		{name: "all hosts answer", failing: []bool{false, false}, wantNames: []string{"a", "b"}},
+		{name: "one host down", failing: []bool{true, false}, wantNames: []string{"b"}},
+		{name: "every host down", failing: []bool{true, true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hosts := []*fakeDocker{
+				newFakeDocker(fakeContainer{Name: "a", IP: "172.18.0.2"}),
+				newFakeDocker(fakeContainer{Name: "b", IP: "172.19.0.2"}),
+			}
+			var endpoints []DockerEndpoint
+			for i, host := range hosts {
+				if tt.failing[i] {
+					host.listErr = errors.New("connection refused")
+				}
+				endpoints = append(endpoints, DockerEndpoint{Host: string(rune('a' + i)), API: host})
+			}
+			api, err := NewMultiDockerAPI(endpoints)
+			if err != nil {
+				t.Fatalf("NewMultiDockerAPI: %v", err)
+			}
+
+			summaries, err := api.ContainerList(context.Background(), container.ListOptions{})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("listing succeeded with every host down")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ContainerList: %v", err)
+			}
+			var names []string
+			for _, summary := range summaries {
+				names = append(names, getContainerName(summary.Names))
+			}
+			sort.Strings(names)
+			if len(names) != len(tt.wantNames) || names[0] != tt.wantNames[0] {
+				t.Errorf("containers = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestMultiHostInspectGoesToOwner(t *testing.T) {
+	a := newFakeDocker(fakeContainer{Name: "a", IP: "172.18.0.2"})
+	b := newFakeDocker(fakeContainer{Name: "b", IP: "172.19.0.2"})
+	api, err := NewMultiDockerAPI([]DockerEndpoint{{Host: "a", API: a}, {Host: "b", API: b}})
+	if err != nil {
+		t.Fatalf("NewMultiDockerAPI: %v", err)
+	}
+	if _, err := api.ContainerList(context.Background(), container.ListOptions{}); err != nil {
+		t.Fatalf("ContainerList: %v", err)
+	}
+
+	if _, err := api.ContainerInspect(context.Background(), testContainerID("b")); err != nil {
+		t.Fatalf("ContainerInspect: %v", err)
+	}
+	if _, inspects := a.counts(); inspects != 0 {
+		t.Errorf("host a inspected %d times for a container of host b", inspects)
+	}
+	if _, inspects := b.counts(); inspects != 1 {
+		t.Errorf("host b inspected %d times, want 1", inspects)
+	}
+}
+
+func TestMultiHostProviderMergesHosts(t *testing.T) {
+	labels := func(host string) map[string]string {
+		return map[string]string{LabelEnable: "true", LabelHost: host, LabelPort: "80"}
+	}
+	local := newFakeDocker(fakeContainer{Name: "a", IP: "172.18.0.2", Labels: labels("a.test")})
+	remote := newFakeDocker()
+	api, err := NewMultiDockerAPI([]DockerEndpoint{
+		{Host: "unix:///var/run/docker.sock", API: local},
+		{Host: "tcp://node2:2375", API: remote, Address: "10.1.0.5"},
+	})
+	if err != nil {
+		t.Fatalf("NewMultiDockerAPI: %v", err)
+	}
+
+	applied := make(chan *NginxConfig, 10)
+	p := newTestProvider(t, api, Config{
+		OnConfigChange: func(config *NginxConfig, _ ConfigDiff) { applied <- config },
+	})
+	if err := p.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	<-applied
+
+	// A container started on the remote host shows up through its event
+	b := fakeContainer{Name: "b", IP: "172.17.0.9", Labels: labels("b.test"), Ports: []container.Port{published(80, 8081, "")}}
+	remote.set(b)
+	remote.emit(events.ActionStart, b)
+
+	select {
+	case config := <-applied:
+		if len(config.Servers) != 2 {
+			t.Fatalf("servers = %d, want both hosts' containers", len(config.Servers))
+		}
+		rendered := readTestConfig(t, p)
+		for _, backend := range []string{"server 172.18.0.2:80", "server 10.1.0.5:8081"} {
+			if !strings.Contains(rendered, backend) {
+				t.Errorf("config lacks %q:\n%s", backend, rendered)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("remote container start not applied")
+	}
+}
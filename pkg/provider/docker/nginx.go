@@ -2,47 +2,208 @@ package docker
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"fmt"
+	"log"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
 )
 
+const (
+	// Default self-signed certificate generated at startup, unless
+	// GeneratorOptions names another one
+	DefaultSSLCertificate = "/etc/nginx/ssl/default.crt"
+	DefaultSSLPrivateKey  = "/etc/nginx/ssl/default.key"
+	
+	// Default OpenSSL cipher string for TLS servers
+	DefaultSSLCiphers = "HIGH:!aNULL:!MD5"
+	
+	// Directory holding one proxy cache directory per caching container
+	DefaultProxyCacheDir = "/var/cache/nginx/ingress"
+)
+
+// DefaultSSLProtocols are the TLS versions enabled when none are configured
+var DefaultSSLProtocols = []string{"TLSv1.2", "TLSv1.3"}
+
+// GeneratorOptions holds controller-wide settings that affect config generation
+type GeneratorOptions struct {
+	// Resolver is the DNS server nginx uses for DNS-based upstreams
+	Resolver string
+	// ResolverValid overrides the TTL of resolved addresses (e.g. "30s")
+	ResolverValid string
+	
+	// BindAddress restricts listen directives to one address (empty = all interfaces)
+	BindAddress string
+	
+	// ProxyProtocol accepts the PROXY protocol on every listen directive
+	ProxyProtocol bool
+	// TrustedProxies lists addresses/CIDRs allowed to set the client IP
+	TrustedProxies []string
+	
+	// DisableTLS serves every host over plain HTTP, ignoring tls labels
+	DisableTLS bool
+	
+	// DefaultCertPath and DefaultKeyPath are the fallback certificate of TLS
+	// servers. Certificates named by tls.certname or after a host are looked
+	// up in the same directory (empty = DefaultSSLCertificate/PrivateKey).
+	DefaultCertPath string
+	DefaultKeyPath  string
+	
+	// SSLProtocols and SSLCiphers apply to TLS servers unless a container overrides them
+	SSLProtocols []string
+	SSLCiphers   string
+	
+	// ProxyCacheDir is the parent directory of proxy_cache_path zones
+	ProxyCacheDir string	
+	// DefaultBackendStatus is returned by the fallback location generated for
+	// hosts without a "/" location (0 = no fallback location)
+	DefaultBackendStatus int
+	
+	// UpstreamZoneSize adds a shared memory zone of this size to every
+	// upstream (empty = only upstreams whose containers request one)
+	UpstreamZoneSize string
+	
+	// RetryAfter is the Retry-After (seconds) sent with the 503 page of hosts
+	// whose backends are all down (0 = no 503 page)
+	RetryAfter int
+	
+	// UpstreamResolve is how upstream-host names are resolved unless a
+	// container overrides it (empty = continuous)
+	UpstreamResolve UpstreamResolveMode
+	// LookupHost resolves names for resolve-once backends (nil = net.LookupHost)
+	LookupHost func(host string) ([]string, error)
+	
+	// What to do when a server or configuration snippet can't be downloaded
+	// (empty = fail-open)
+	ServerSnippetPolicy        SnippetFailurePolicy
+	ConfigurationSnippetPolicy SnippetFailurePolicy
+	
+	// Cache reuses the generated servers of hosts whose containers haven't
+	// changed since the last generation (nil = regenerate every host)
+	Cache *ConfigCache
+}
+
+// DefaultGeneratorOptions returns the generator settings used when none are given
+func DefaultGeneratorOptions() GeneratorOptions {
+	return GeneratorOptions{
+		Resolver:      "127.0.0.11", // Docker embedded DNS
+		ResolverValid: "30s",
+		SSLProtocols:  DefaultSSLProtocols,
+		SSLCiphers:    DefaultSSLCiphers,
+		DefaultCertPath: DefaultSSLCertificate,
+		DefaultKeyPath:  DefaultSSLPrivateKey,
+		ProxyCacheDir: DefaultProxyCacheDir,
+		DefaultBackendStatus: 404,
+		RetryAfter:    DefaultRetryAfter,
+	}
+}
+
+// snippetFailure describes a snippet error for warnings, telling a rejected
+// path apart from a failed download
+func snippetFailure(err error) string {
+	if IsSnippetPathRejected(err) {
+		return "rejected path of"
+	}
+	return "failed to download"
+}
+
+// defaultCertificate returns the fallback certificate and key of TLS servers
+func (opts GeneratorOptions) defaultCertificate() (string, string) {
+	cert, key := opts.DefaultCertPath, opts.DefaultKeyPath
+	if cert == "" {
+		cert = DefaultSSLCertificate
+	}
+	if key == "" {
+		key = DefaultSSLPrivateKey
+	}
+	return cert, key
+}
+
+// DefaultRetryAfter is the Retry-After sent while a host's backends are all down
+const DefaultRetryAfter = 30
+
 // NginxConfig represents the complete nginx configuration
 type NginxConfig struct {
+	// RequestID declares $ingress_request_id and the ingress_request_id
+	// log format, set when a location uses request IDs
+	RequestID bool
+	
+	Maps      []MapConfig
+	Caches    []CacheZoneConfig
 	Upstreams []UpstreamConfig
 	Servers   []ServerConfig
 	Generated time.Time
 }
 
+// CacheZoneConfig represents an http-level proxy_cache_path
+type CacheZoneConfig struct {
+	Name         string // keys_zone name
+	Path         string
+	KeysZoneSize string
+	MaxSize      string
+	Inactive     string
+}
+
 // UpstreamConfig represents an nginx upstream block
 type UpstreamConfig struct {
 	Name          string
 	Method        string // load balancing method
+	HashKey       string // key for the hash method
+	ZoneSize      string // shared memory zone size, empty for no zone
 	Servers       []UpstreamServer
 	HealthCheck   bool
 	HealthPath    string
+	Fixed         bool // named by the upstream-name label, never merged away by deduplication
 }
 
 // UpstreamServer represents a server in an upstream
 type UpstreamServer struct {
-	Address string
-	Weight  int
-	Backup  bool
+	Address     string
+	Weight      int
+	Backup      bool
+	Down        bool // temporarily unavailable, e.g. a restarting container
+	MaxFails    int
+	FailTimeout string
 }
 
 // ServerConfig represents an nginx server block
 type ServerConfig struct {
 	ServerName string
+	Aliases    []string // further server_name entries
 	Listen     []string
 	SSL        SSLConfig
 	Locations  []LocationConfig
 	
 	// Custom server snippet (server-level)
 	ServerSnippet string
+	
+	// Unavailable serves a 503 with Retry-After while every backend is down
+	Unavailable UnavailableConfig
+	
+	// Real client IP handling when behind another proxy
+	RealIP RealIPConfig
+	
+	// Timeouts protecting the host against slow clients
+	ClientTimeouts ClientTimeoutConfig
+}
+
+// UnavailableConfig represents the 503 page of a host whose backends are all down
+type UnavailableConfig struct {
+	Enabled    bool
+	RetryAfter int // seconds
+}
+
+// RealIPConfig represents set_real_ip_from / real_ip_header settings
+type RealIPConfig struct {
+	TrustedProxies []string
+	Header         string // header carrying the client address
 }
 
 // SSLConfig represents SSL/TLS configuration
@@ -51,6 +212,19 @@ type SSLConfig struct {
 	Certificate string
 	PrivateKey  string
 	Protocols   []string
+	Ciphers     string
+	MinTLSVersion string // from min-tls-version, already applied to Protocols
+	
+	// OCSP stapling, only emitted for real certificates with a trust chain
+	Stapling           bool
+	TrustedCertificate string
+	Resolver           string
+	ResolverValid      string
+	
+	// HSTS header settings
+	HSTS                  bool
+	HSTSMaxAge            int
+	HSTSIncludeSubdomains bool
 }
 
 // LocationConfig represents an nginx location block
@@ -65,6 +239,10 @@ type LocationConfig struct {
 	AuthType string
 	CORS     CORSConfig
 	
+	// Access-Control-Allow-Origin value: "*" or a variable holding the
+	// request's Origin when it is one of CORS.AllowOrigins
+	CORSOrigin string
+	
 	// Headers and proxy settings
 	ProxyHeaders map[string]string
 	
@@ -73,6 +251,84 @@ type LocationConfig struct {
 	
 	// FastCGI configuration
 	FastCGI FastCGILocationConfig
+	
+	// DNS-based backend resolved by nginx at request time
+	Dynamic DynamicUpstreamConfig
+	
+	// TLS settings for https backends
+	ProxySSL ProxySSLConfig
+	
+	// try_files fallback list
+	TryFiles []string
+	
+	// Host header sent to the backend (defaults to $host)
+	HostHeader string
+	
+	// X-Forwarded-Proto and X-Forwarded-Port values (default $scheme and $server_port)
+	ForwardedProto string
+	ForwardedPort  string
+	
+	// Redirect replaces proxying with a return directive
+	Redirect RedirectConfig
+	
+	// ReturnStatus answers with a bare status code instead of proxying
+	ReturnStatus int
+	
+	// Response headers hidden from clients and request headers cleared before proxying
+	HideHeaders         []string
+	ClearRequestHeaders []string
+	
+	// Response caching through a proxy_cache zone
+	Cache LocationCacheConfig
+	
+	// proxy_request_buffering ("on"/"off"), empty leaves the nginx default
+	ProxyRequestBuffering string
+	
+	// proxy_redirect rewriting backend Location headers, empty leaves the nginx default
+	ProxyRedirect string
+	
+	// proxy_intercept_errors on, so error_page handles backend errors
+	InterceptErrors bool
+	
+	// Proxy over HTTP/2 with grpc_pass; ProxyPass is then a grpc:// URL
+	BackendHTTP2 bool
+	
+	// Pass X-Request-ID upstream and log it
+	RequestID bool
+	
+	// Methods answered normally, others get a 405 (empty allows all)
+	AllowedMethods []string
+}
+
+// LocationCacheConfig represents proxy_cache settings of a location
+type LocationCacheConfig struct {
+	Enabled bool
+	Zone    string
+	Key     string
+	Valid   []string
+}
+
+// ProxySSLConfig represents proxy_ssl_* settings for https backends
+type ProxySSLConfig struct {
+	Enabled bool
+	
+	// Verify the backend certificate against TrustedCertificate
+	Verify             bool
+	TrustedCertificate string
+}
+
+// DefaultProxySSLTrustedCertificate is the CA bundle verifying https
+// backends without a proxy-ssl-ca label
+const DefaultProxySSLTrustedCertificate = "/etc/ssl/certs/ca-certificates.crt"
+
+// DynamicUpstreamConfig represents a backend addressed by DNS name through a
+// variable proxy_pass, so nginx re-resolves it without a reload
+type DynamicUpstreamConfig struct {
+	Enabled       bool
+	Variable      string // nginx variable holding the backend address (without $)
+	Address       string // host:port
+	Resolver      string
+	ResolverValid string
 }
 
 // FastCGILocationConfig represents FastCGI-specific location configuration
@@ -125,135 +381,1097 @@ func loadTemplate(templatePath string) (string, error) {
 	return "", fmt.Errorf("template file not found: %s", templatePath)
 }
 
-// GenerateNginxConfig generates nginx configuration from container data
+// GenerateNginxConfig generates nginx configuration from container data.
+// A nil snippetManager skips snippet downloads and a nil fastcgiManager skips
+// FastCGI params files, which allows generating config without Docker access.
 func GenerateNginxConfig(containers []*ContainerData, snippetManager *SnippetManager, fastcgiManager *FastCGIParameterManager) (*NginxConfig, error) {
+	return GenerateNginxConfigWithOptions(containers, snippetManager, fastcgiManager, DefaultGeneratorOptions())
+}
+
+// GenerateNginxConfigWithOptions generates nginx configuration from container data using the given options
+func GenerateNginxConfigWithOptions(containers []*ContainerData, snippetManager *SnippetManager, fastcgiManager *FastCGIParameterManager, opts GeneratorOptions) (*NginxConfig, error) {
 	config := &NginxConfig{
 		Generated: time.Now(),
 	}
 	
 	// Group containers by host for server blocks
-	hostGroups := GroupContainersByHost(containers)
+	routed := withHost(containers)
+	hostGroups := GroupContainersByHost(routed)
+	aliasOf := aliasOwners(routed)
+	fixedUpstreams := claimUpstreamNames(hostGroups)
+	
+	// Hosts in name order, the order servers are merged and rendered in
+	hosts := make([]string, 0, len(hostGroups))
+	for host := range hostGroups {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	
+	opts.Cache.start(opts)
+	for _, host := range hosts {
+		hostContainers := hostGroups[host]
+		aliases := hostAliases(host, hostContainers, aliasOf)
+		key, cacheable := opts.Cache.hostKey(host, aliases, hostContainers, fixedUpstreams, opts)
+		generated, cached := opts.Cache.lookup(host, key)
+		if !cached {
+			var err error
+			generated, err = generateHost(host, aliases, hostContainers, fixedUpstreams, snippetManager, fastcgiManager, opts)
+			if err != nil {
+				return nil, err
+			}
+			if cacheable {
+				opts.Cache.store(host, key, generated)
+			}
+		}
+		
+		config.Upstreams = append(config.Upstreams, generated.upstreams...)
+		config.Caches = append(config.Caches, generated.caches...)
+		config.Servers = append(config.Servers, generated.server)
+	}
+	opts.Cache.retain(hostGroups)
+	
+	config.RequestID = usesRequestID(config)
+	
+	maps, err := collectMaps(containers)
+	if err != nil {
+		return nil, err
+	}
+	config.Maps = append(maps, corsOriginMaps(config)...)
+	sort.Slice(config.Maps, func(i, j int) bool {
+		return config.Maps[i].Variable < config.Maps[j].Variable
+	})
+	
+	sort.Slice(config.Caches, func(i, j int) bool {
+		return config.Caches[i].Name < config.Caches[j].Name
+	})
+	
+	// Hosts are visited in map order, sort so an unchanged config renders the same
+	sort.Slice(config.Upstreams, func(i, j int) bool {
+		return config.Upstreams[i].Name < config.Upstreams[j].Name
+	})
+	
+	if err := mergeDuplicateServers(config); err != nil {
+		return nil, err
+	}
+	
+	dedupeUpstreams(config)
+	markUnavailableServers(config, opts)
+	
+	return config, nil
+}
+
+
+// hostConfig is the generated server block of a host and the upstreams and
+// cache zones its locations use
+type hostConfig struct {
+	server    ServerConfig
+	upstreams []UpstreamConfig
+	caches    []CacheZoneConfig
+}
+
+// generateHost generates the server block, upstreams and cache zones of host
+func generateHost(host string, aliases []string, hostContainers []*ContainerData, fixedUpstreams map[string]string, snippetManager *SnippetManager, fastcgiManager *FastCGIParameterManager, opts GeneratorOptions) (hostConfig, error) {
+	var generated hostConfig
+	serverConfig := ServerConfig{
+		ServerName: host,
+		Aliases:    aliases,
+		Listen:     []string{listenAddress(opts.BindAddress, "80")},
+	}
+	
+	// Check if any container requires SSL, unless TLS is off everywhere
+	needsSSL := false
+	for _, container := range hostContainers {
+		if container.Config.TLS && !opts.DisableTLS {
+			needsSSL = true
+			break
+		}
+	}
 	
-	for host, hostContainers := range hostGroups {
-		serverConfig := ServerConfig{
-			ServerName: host,
-			Listen:     []string{"80"},
+	if needsSSL {
+		defaultCert, defaultKey := opts.defaultCertificate()
+		serverConfig.Listen = append(serverConfig.Listen, listenAddress(opts.BindAddress, "443")+" ssl")
+		serverConfig.SSL = SSLConfig{
+			Enabled:     true,
+			Certificate: defaultCert,
+			PrivateKey:  defaultKey,
+			Protocols:   opts.SSLProtocols,
+			Ciphers:     opts.SSLCiphers,
+		}
+		if len(serverConfig.SSL.Protocols) == 0 {
+			serverConfig.SSL.Protocols = DefaultSSLProtocols
+		}
+		if serverConfig.SSL.Ciphers == "" {
+			serverConfig.SSL.Ciphers = DefaultSSLCiphers
 		}
 		
-		// Check if any container requires SSL
-		needsSSL := false
+		// Per-host overrides from the first container setting them
 		for _, container := range hostContainers {
-			if container.Config.TLS {
-				needsSSL = true
+			if len(container.Config.SSLProtocols) > 0 {
+				serverConfig.SSL.Protocols = container.Config.SSLProtocols
 				break
 			}
 		}
+		for _, container := range hostContainers {
+			if container.Config.SSLCiphers != "" {
+				serverConfig.SSL.Ciphers = container.Config.SSLCiphers
+				break
+			}
+		}
+		if minVersion := hostMinTLSVersion(host, hostContainers); minVersion != "" {
+			serverConfig.SSL.MinTLSVersion = minVersion
+			serverConfig.SSL.Protocols = applyMinTLSVersion(serverConfig.SSL.Protocols, minVersion, hostContainers)
+		}
 		
-		if needsSSL {
-			serverConfig.Listen = append(serverConfig.Listen, "443 ssl")
-			serverConfig.SSL = SSLConfig{
-				Enabled:     true,
-				Certificate: "/etc/nginx/ssl/default.crt", // Use default cert for now
-				PrivateKey:  "/etc/nginx/ssl/default.key", // Use default key for now
-				Protocols:   []string{"TLSv1.2", "TLSv1.3"},
+		// Certificate named by the first container, or else one named after
+		// the host, looked up next to the default one. Each server carries
+		// its own paths so nginx picks the right certificate by SNI.
+		certName := ""
+		for _, container := range hostContainers {
+			if container.Config.CertName != "" {
+				certName = container.Config.CertName
+				break
 			}
 		}
+		if certName == "" {
+			certName = resolveHostCertificate(host, filepath.Dir(defaultCert))
+		}
+		if certName != "" {
+			certDir := filepath.Dir(defaultCert)
+			serverConfig.SSL.Certificate = filepath.Join(certDir, certName+".crt")
+			serverConfig.SSL.PrivateKey = filepath.Join(certDir, certName+".key")
+		}
 		
-		// Download server snippet if needed
-		var serverSnippetContent string
+		// OCSP stapling from the first container requesting it
 		for _, container := range hostContainers {
-			if container.Config.ServerSnippet != "" {
-				snippets, err := snippetManager.DownloadAllSnippets(container.Config)
-				if err != nil {
-					fmt.Printf("Warning: failed to download snippets for container %s: %v\n", container.Config.ContainerName, err)
-				} else if serverSnippet, exists := snippets["server"]; exists {
-					serverSnippetContent = serverSnippet.Content
+			if container.Config.SSLStapling {
+				serverConfig.SSL.Stapling = true
+				serverConfig.SSL.TrustedCertificate = container.Config.SSLTrustedCertificate
+				serverConfig.SSL.Resolver = opts.Resolver
+				serverConfig.SSL.ResolverValid = opts.ResolverValid
+				break
+			}
+		}
+		disableStapling(&serverConfig, defaultCert)
+	}
+	
+	// Apply HSTS from the first container requesting it
+	for _, container := range hostContainers {
+		if !container.Config.HSTS.Enabled {
+			continue
+		}
+		if !needsSSL {
+			fmt.Printf("Warning: HSTS requested by container %s but host %s is not TLS-enabled, ignoring\n", container.Config.ContainerName, host)
+			break
+		}
+		serverConfig.SSL.HSTS = true
+		serverConfig.SSL.HSTSMaxAge = container.Config.HSTS.MaxAge
+		serverConfig.SSL.HSTSIncludeSubdomains = container.Config.HSTS.IncludeSubdomains
+		break
+	}
+	
+	// Client timeouts, each from the first container setting it
+	for _, container := range hostContainers {
+		mergeClientTimeouts(&serverConfig.ClientTimeouts, container.Config.ClientTimeouts)
+	}
+	
+	// Download server snippet if needed
+	var serverSnippetContent string
+	for _, container := range hostContainers {
+		if container.Config.ServerSnippet != "" && snippetManager != nil {
+			snippet, err := snippetManager.DownloadSnippetWithHash(container.Config.ContainerID,
+				container.Config.ServerSnippet, container.Config.ServerSnippetSHA256)
+			if err != nil {
+				if opts.ServerSnippetPolicy == SnippetFailClosed {
+					return hostConfig{}, fmt.Errorf("failed to download server snippet for container %s: %w", container.Config.ContainerName, err)
 				}
-				break // Use first server snippet found for this host
+				fmt.Printf("Warning: %s server snippet for container %s, continuing without it: %v\n", snippetFailure(err), container.Config.ContainerName, err)
+			} else if snippet != nil {
+				serverSnippetContent = snippet.Content
+			}
+			break // Use first server snippet found for this host
+		}
+	}
+	
+	// Create upstream and locations for each route; replicas of one
+	// service share it, conflicting services lose to the first claim
+	for _, group := range resolveRouteConflicts(host, hostContainers) {
+		container := group.primary
+		upstreamName := UpstreamName(host, container.Config.Path, container.Config.ContainerName)
+		fixedName := false
+		if name := container.Config.UpstreamName; name != "" {
+			if owner := fixedUpstreams[name]; owner != host+container.Config.Path {
+				fmt.Printf("Warning: upstream name %s of container %s is already used by %s, using the generated name %s\n",
+					name, container.Config.ContainerName, owner, upstreamName)
+			} else {
+				upstreamName = name
+				fixedName = true
 			}
 		}
 		
-		// Create upstream and locations for each container
-		for _, container := range hostContainers {
-			upstreamName := fmt.Sprintf("backend_%s_%s", 
-				strings.ReplaceAll(host, ".", "_"), 
-				container.Config.ContainerName)
-			
-			// Create upstream
+		// DNS-based backends skip the upstream block and use a variable
+		// proxy_pass, unless resolved once here into a regular upstream
+		dnsBackend := container.Config.UpstreamHost != "" && !container.Config.FastCGI.Enabled
+		var resolved []string
+		if dnsBackend && upstreamResolveMode(container.Config, opts) == ResolveOnce {
+			resolved = resolveUpstreamHost(container, opts)
+		}
+		dynamic := dnsBackend && resolved == nil
+		
+		// Redirecting locations never reach the backend
+		redirect := container.Config.Redirect.URL != ""
+		
+		// Create upstream
+		if !dynamic && !redirect {
 			upstream := UpstreamConfig{
 				Name:   upstreamName,
 				Method: container.Config.LoadBalancer.Method,
+				HashKey: container.Config.LoadBalancer.HashKey,
+				ZoneSize: container.Config.LoadBalancer.ZoneSize,
 				Servers: []UpstreamServer{
 					{
-						Address: fmt.Sprintf("%s:%d", container.IPAddress, container.Config.Port),
-						Weight:  1,
+						Address:     fmt.Sprintf("%s:%d", container.IPAddress, container.Config.Port),
+						Weight:      1,
+						Down:        container.Restarting || container.Unready,
+						MaxFails:    container.Config.LoadBalancer.MaxFails,
+						FailTimeout: container.Config.LoadBalancer.FailTimeout,
 					},
 				},
 				HealthCheck: container.Config.HealthCheck.Enabled,
 				HealthPath:  container.Config.HealthCheck.Path,
+				Fixed:       fixedName,
 			}
-			config.Upstreams = append(config.Upstreams, upstream)
-			
-			// Download configuration snippet if needed
-			var configSnippetContent string
-			if container.Config.ConfigurationSnippet != "" {
-				snippets, err := snippetManager.DownloadAllSnippets(container.Config)
-				if err != nil {
-					fmt.Printf("Warning: failed to download snippets for container %s: %v\n", container.Config.ContainerName, err)
-				} else if configSnippet, exists := snippets["configuration"]; exists {
-					configSnippetContent = configSnippet.Content
+			if resolved != nil {
+				upstream.Servers = resolvedServers(container, resolved)
+			}
+			for _, replica := range group.replicas {
+				if resolved != nil {
+					break // replicas share the DNS name
 				}
+				upstream.Servers = append(upstream.Servers, UpstreamServer{
+					Address:     fmt.Sprintf("%s:%d", replica.IPAddress, replica.Config.Port),
+					Weight:      1,
+					Down:        replica.Restarting || replica.Unready,
+					MaxFails:    container.Config.LoadBalancer.MaxFails,
+					FailTimeout: container.Config.LoadBalancer.FailTimeout,
+				})
 			}
-			
-			// Create location
-			location := LocationConfig{
-				Path:      container.Config.Path,
-				Upstream:  upstreamName,
-				Priority:  container.Config.Priority,
-				ProxyPass: fmt.Sprintf("http://%s", upstreamName),
-				Auth:      container.Config.Middleware.Auth.Enabled,
-				AuthType:  container.Config.Middleware.Auth.Type,
-				CORS:      container.Config.Middleware.CORS,
-				ProxyHeaders: map[string]string{
-					"X-Container-Name": container.Config.ContainerName,
-					"X-Container-ID":   container.Config.ContainerID[:12],
-				},
-				ConfigurationSnippet: configSnippetContent,
+			if upstream.ZoneSize == "" {
+				upstream.ZoneSize = opts.UpstreamZoneSize
 			}
-			
-			// Configure FastCGI if enabled
-			if container.Config.FastCGI.Enabled {
-				// Load FastCGI parameters (from file or labels)
-				fastcgiParams, err := fastcgiManager.LoadFastCGIParams(container.Config)
-				if err != nil {
-					return nil, fmt.Errorf("failed to load FastCGI params for container %s: %w", container.Config.ContainerName, err)
+			generated.upstreams = append(generated.upstreams, upstream)
+		}
+		
+		// Download configuration snippet if needed
+		var configSnippetContent string
+		if container.Config.ConfigurationSnippet != "" && snippetManager != nil {
+			snippet, err := snippetManager.DownloadSnippetWithHash(container.Config.ContainerID,
+				container.Config.ConfigurationSnippet, container.Config.ConfigurationSnippetSHA256)
+			if err != nil {
+				if opts.ConfigurationSnippetPolicy == SnippetFailClosed {
+					return hostConfig{}, fmt.Errorf("failed to download configuration snippet for container %s: %w", container.Config.ContainerName, err)
+				}
+				fmt.Printf("Warning: %s configuration snippet for container %s, continuing without it: %v\n", snippetFailure(err), container.Config.ContainerName, err)
+			} else if snippet != nil {
+				configSnippetContent = snippet.Content
+			}
+		}
+		
+		// Create location
+		location := LocationConfig{
+			Path:      container.Config.Path,
+			Upstream:  upstreamName,
+			Priority:  container.Config.Priority,
+			ProxyPass: proxyPassURL(container.Config.Protocol, upstreamName, container.Config.PreservePath),
+			Auth:      container.Config.Middleware.Auth.Enabled,
+			AuthType:  container.Config.Middleware.Auth.Type,
+			CORS:      container.Config.Middleware.CORS,
+			ProxyHeaders: make(map[string]string),
+			ConfigurationSnippet: configSnippetContent,
+			TryFiles: container.Config.TryFiles,
+			HostHeader: container.Config.UpstreamHostHeader,
+			ForwardedProto: container.Config.ForwardedProto,
+			ForwardedPort:  container.Config.ForwardedPort,
+			HideHeaders:         container.Config.HideHeaders,
+			ClearRequestHeaders: container.Config.ClearRequestHeaders,
+			ProxyRequestBuffering: container.Config.ProxyRequestBuffering,
+			ProxyRedirect:         container.Config.ProxyRedirect,
+			InterceptErrors:       container.Config.InterceptErrors,
+			RequestID:             container.Config.RequestID,
+			AllowedMethods:        allowedMethods(container.Config),
+			ProxySSL: ProxySSLConfig{
+				Enabled: container.Config.Protocol == "https",
+				Verify:  container.Config.ProxySSLVerify,
+			},
+		}
+		
+		// Without its CA the backend can't be verified; answer 502 rather
+		// than proxying unverified
+		if location.ProxySSL.Verify {
+			trusted, err := backendTrustedCertificate(container, snippetManager)
+			if err != nil {
+				if opts.ConfigurationSnippetPolicy == SnippetFailClosed {
+					return hostConfig{}, fmt.Errorf("failed to download backend CA for container %s: %w", container.Config.ContainerName, err)
 				}
-				
-				// Validate FastCGI parameters
+				fmt.Printf("Warning: failed to download backend CA for container %s, answering 502 on %s%s: %v\n",
+					container.Config.ContainerName, host, container.Config.Path, err)
+				location.ReturnStatus = http.StatusBadGateway
+			}
+			location.ProxySSL.TrustedCertificate = trusted
+		}
+		
+		if redirect {
+			location.Upstream = ""
+			location.ProxyPass = ""
+			location.Redirect = container.Config.Redirect
+		} else if container.Config.BackendHTTP2 && !dynamic {
+			// nginx only speaks HTTP/2 to backends through the gRPC module
+			scheme := "grpc"
+			if container.Config.Protocol == "https" {
+				scheme = "grpcs"
+			}
+			location.BackendHTTP2 = true
+			location.ProxyPass = fmt.Sprintf("%s://%s", scheme, upstreamName)
+		} else if dnsBackend {
+			if !container.Config.PreservePath {
+				fmt.Printf("Warning: preserve-path=false is not supported with upstream-host for container %s, passing the full path\n", container.Config.ContainerName)
+			}
+			if dynamic {
+				location.Upstream = ""
+				location.Dynamic = dynamicUpstream(container, upstreamName, opts)
+				location.ProxyPass = fmt.Sprintf("%s://$%s", container.Config.Protocol, location.Dynamic.Variable)
+			} else {
+				location.ProxyPass = proxyPassURL(container.Config.Protocol, upstreamName, true)
+			}
+		}
+		
+		// Stripping the prefix requires a location ending in "/" so that the
+		// matched part is replaced by the proxy_pass URI as a whole segment
+		if !container.Config.PreservePath && !dnsBackend && !strings.HasSuffix(location.Path, "/") {
+			location.Path += "/"
+		}
+		
+		if container.Config.DiagnosticHeaders {
+			location.ProxyHeaders["X-Container-Name"] = container.Config.ContainerName
+			location.ProxyHeaders["X-Container-ID"] = container.Config.ContainerID[:12]
+		}
+		
+		// Configure FastCGI if enabled
+		if container.Config.FastCGI.Enabled && !redirect {
+			// Load FastCGI parameters (from file or labels)
+			fastcgiParams, err := fastcgiManager.LoadFastCGIParamsWithPolicy(container.Config, opts.ConfigurationSnippetPolicy)
+			if err != nil {
+				return hostConfig{}, fmt.Errorf("failed to load FastCGI params for container %s: %w", container.Config.ContainerName, err)
+			}
+			
+			// Validate FastCGI parameters, unless the user took full control of them
+			if container.Config.FastCGI.Defaults != FastCGIDefaultsNone {
 				if err := fastcgiManager.ValidateFastCGIParams(fastcgiParams); err != nil {
-					return nil, fmt.Errorf("invalid FastCGI params for container %s: %w", container.Config.ContainerName, err)
+					return hostConfig{}, fmt.Errorf("invalid FastCGI params for container %s: %w", container.Config.ContainerName, err)
+				}
+			}
+			
+			location.FastCGI = FastCGILocationConfig{
+				Enabled:    true,
+				Pass:       fmt.Sprintf("%s:%d", container.IPAddress, container.Config.Port),
+				Index:      container.Config.FastCGI.Index,
+				Params:     fastcgiParams,
+			}
+			// For FastCGI, we don't use proxy_pass
+			location.ProxyPass = ""
+		}
+		
+		// Proxy cache zone per container, only for proxied backends
+		if container.Config.ProxyCache.Enabled && !redirect && !container.Config.FastCGI.Enabled {
+			zone := cacheZone(upstreamName, container.Config.ProxyCache, opts)
+			generated.caches = append(generated.caches, zone)
+			location.Cache = LocationCacheConfig{
+				Enabled: true,
+				Zone:    zone.Name,
+				Key:     container.Config.ProxyCache.Key,
+				Valid:   container.Config.ProxyCache.Valid,
+			}
+		}
+		
+		serverConfig.Locations = append(serverConfig.Locations, location)
+		
+		// A default backend also serves every path no other location matches
+		if container.Config.DefaultBackend && location.Path != "/" {
+			fallback := location
+			fallback.Path = "/"
+			fallback.Priority = 0
+			serverConfig.Locations = append(serverConfig.Locations, fallback)
+		}
+	}
+	
+	ensureDefaultLocation(&serverConfig, opts)
+	
+	// Add server snippet content
+	serverConfig.ServerSnippet = serverSnippetContent
+	
+	applyProxySettings(&serverConfig, opts)
+	
+	generated.server = serverConfig
+	return generated, nil
+}
+
+// markUnavailableServers enables the 503 page on hosts that proxy only to
+// upstreams whose servers are all down, e.g. restarting containers
+func markUnavailableServers(config *NginxConfig, opts GeneratorOptions) {
+	if opts.RetryAfter <= 0 {
+		return
+	}
+	
+	upstreams := make(map[string]UpstreamConfig, len(config.Upstreams))
+	for _, upstream := range config.Upstreams {
+		upstreams[upstream.Name] = upstream
+	}
+	
+	for i := range config.Servers {
+		server := &config.Servers[i]
+		proxied := false
+		allDown := true
+		for _, location := range server.Locations {
+			upstream, exists := upstreams[location.Upstream]
+			if !exists {
+				continue
+			}
+			proxied = true
+			if !upstreamDown(upstream) {
+				allDown = false
+				break
+			}
+		}
+		if proxied && allDown {
+			server.Unavailable = UnavailableConfig{Enabled: true, RetryAfter: opts.RetryAfter}
+		}
+	}
+}
+
+// upstreamDown reports whether an upstream has no server that can take requests
+func upstreamDown(upstream UpstreamConfig) bool {
+	for _, server := range upstream.Servers {
+		if !server.Down {
+			return false
+		}
+	}
+	return true
+}
+
+// ensureDefaultLocation makes sure a host handles unmatched paths: duplicate
+// "/" locations from several default backends are dropped (first wins), and
+// hosts without a "/" location get one returning DefaultBackendStatus
+func ensureDefaultLocation(server *ServerConfig, opts GeneratorOptions) {
+	hasRoot := false
+	locations := server.Locations[:0]
+	for _, location := range server.Locations {
+		if location.Path == "/" {
+			if hasRoot {
+				fmt.Printf("Warning: host %s has several default backends or / locations, keeping the first\n", server.ServerName)
+				continue
+			}
+			hasRoot = true
+		}
+		locations = append(locations, location)
+	}
+	server.Locations = locations
+	
+	if hasRoot || opts.DefaultBackendStatus == 0 {
+		return
+	}
+	server.Locations = append(server.Locations, LocationConfig{
+		Path:         "/",
+		ReturnStatus: opts.DefaultBackendStatus,
+	})
+}
+
+// cacheZone builds the proxy_cache_path zone of a container, named after its
+// upstream so the name is unique and safe for nginx
+func cacheZone(upstreamName string, cache ProxyCacheConfig, opts GeneratorOptions) CacheZoneConfig {
+	name := "cache_" + strings.TrimPrefix(upstreamName, "backend_")
+	dir := opts.ProxyCacheDir
+	if dir == "" {
+		dir = DefaultProxyCacheDir
+	}
+	return CacheZoneConfig{
+		Name:         name,
+		Path:         filepath.Join(dir, name),
+		KeysZoneSize: cache.ZoneSize,
+		MaxSize:      cache.MaxSize,
+		Inactive:     cache.Inactive,
+	}
+}
+
+// ValidateProxyCacheDir checks that dir is empty or an absolute path safe to
+// use in proxy_cache_path
+func ValidateProxyCacheDir(dir string) error {
+	if dir != "" && (!filepath.IsAbs(dir) || strings.ContainsAny(dir, " \t;{}\"'")) {
+		return fmt.Errorf("invalid proxy cache directory %q, must be an absolute path", dir)
+	}
+	return nil
+}
+
+// backendTrustedCertificate returns the CA bundle verifying a container's
+// https backend: its proxy-ssl-ca copied from the container, or the system
+// bundle
+func backendTrustedCertificate(container *ContainerData, snippetManager *SnippetManager) (string, error) {
+	if container.Config.ProxySSLCA == "" {
+		return DefaultProxySSLTrustedCertificate, nil
+	}
+	if snippetManager == nil {
+		return "", fmt.Errorf("no Docker access to copy %s", container.Config.ProxySSLCA)
+	}
+	return snippetManager.DownloadCertificate(container.Config.ContainerID, container.Config.ProxySSLCA)
+}
+
+// allowedMethods returns the methods a location accepts: those of the
+// allowed-methods label, plus HEAD with GET as nginx's limit_except does and
+// OPTIONS while CORS answers preflight requests. Nil allows every method.
+func allowedMethods(config *ContainerConfig) []string {
+	if len(config.AllowedMethods) == 0 {
+		return nil
+	}
+	
+	allowed := stringSet(config.AllowedMethods)
+	if allowed["GET"] {
+		allowed["HEAD"] = true
+	}
+	if config.Middleware.CORS.Enabled {
+		allowed["OPTIONS"] = true
+	}
+	
+	methods := make([]string, 0, len(allowed))
+	for method := range allowed {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// usesRequestID reports whether any location passes request IDs
+func usesRequestID(config *NginxConfig) bool {
+	for _, server := range config.Servers {
+		for _, location := range server.Locations {
+			if location.RequestID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// collectMaps gathers the map blocks declared by all containers. The same
+// variable may be declared by several containers only if the maps are identical.
+func collectMaps(containers []*ContainerData) ([]MapConfig, error) {
+	byVariable := make(map[string]MapConfig)
+	owners := make(map[string]string)
+	
+	for _, container := range containers {
+		for _, m := range container.Config.Maps {
+			if existing, exists := byVariable[m.Variable]; exists {
+				if !mapsEqual(existing, m) {
+					return nil, fmt.Errorf("map $%s declared differently by containers %s and %s",
+						m.Variable, owners[m.Variable], container.Config.ContainerName)
 				}
-				
-				location.FastCGI = FastCGILocationConfig{
-					Enabled:    true,
-					Pass:       fmt.Sprintf("%s:%d", container.IPAddress, container.Config.Port),
-					Index:      container.Config.FastCGI.Index,
-					Params:     fastcgiParams,
+				continue
+			}
+			byVariable[m.Variable] = m
+			owners[m.Variable] = container.Config.ContainerName
+		}
+	}
+	
+	maps := make([]MapConfig, 0, len(byVariable))
+	for _, m := range byVariable {
+		maps = append(maps, m)
+	}
+	sort.Slice(maps, func(i, j int) bool {
+		return maps[i].Variable < maps[j].Variable
+	})
+	
+	return maps, nil
+}
+
+// corsOriginMaps sets the Access-Control-Allow-Origin value of every CORS
+// location. A header may carry a single origin only, so a list of origins
+// becomes a map from $http_origin that echoes the request's origin when it
+// is allowed and is empty (no header) otherwise. Locations allowing the same
+// origins share a map.
+func corsOriginMaps(config *NginxConfig) []MapConfig {
+	byVariable := make(map[string]MapConfig)
+	
+	for i := range config.Servers {
+		for j := range config.Servers[i].Locations {
+			location := &config.Servers[i].Locations[j]
+			if !location.CORS.Enabled || len(location.CORS.AllowOrigins) == 0 {
+				continue
+			}
+			
+			origins := make([]string, 0, len(location.CORS.AllowOrigins))
+			wildcard := false
+			for _, origin := range location.CORS.AllowOrigins {
+				if origin == "*" {
+					wildcard = true
+					break
 				}
-				// For FastCGI, we don't use proxy_pass
-				location.ProxyPass = ""
+				// Browsers send the origin without a trailing slash
+				origins = append(origins, strings.TrimSuffix(origin, "/"))
+			}
+			if wildcard {
+				location.CORSOrigin = "*"
+				continue
 			}
 			
-			serverConfig.Locations = append(serverConfig.Locations, location)
+			sort.Strings(origins)
+			h := sha256.Sum256([]byte(strings.Join(origins, "\n")))
+			variable := fmt.Sprintf("cors_origin_%x", h[:4])
+			location.CORSOrigin = "$" + variable
+			
+			if _, exists := byVariable[variable]; exists {
+				continue
+			}
+			m := MapConfig{Variable: variable, Source: "$http_origin", Default: `""`, Entries: make(map[string]string)}
+			for _, origin := range origins {
+				m.Entries[`"`+origin+`"`] = "$http_origin"
+			}
+			byVariable[variable] = m
+		}
+	}
+	
+	maps := make([]MapConfig, 0, len(byVariable))
+	for _, m := range byVariable {
+		maps = append(maps, m)
+	}
+	return maps
+}
+
+// mapsEqual reports whether two map blocks render identically
+func mapsEqual(a, b MapConfig) bool {
+	if a.Source != b.Source || a.Default != b.Default || len(a.Entries) != len(b.Entries) {
+		return false
+	}
+	for input, output := range a.Entries {
+		if b.Entries[input] != output {
+			return false
+		}
+	}
+	return true
+}
+
+// listenAddress builds a listen directive value for port, bound to address if set
+func listenAddress(address, port string) string {
+	if address == "" {
+		return port
+	}
+	return net.JoinHostPort(address, port)
+}
+
+// EmptyConfigMode controls what is applied when no enabled containers exist
+type EmptyConfigMode string
+
+const (
+	// EmptyConfigEmpty writes a config without any servers (default)
+	EmptyConfigEmpty EmptyConfigMode = "empty"
+	// EmptyConfigPlaceholder writes a default server answering 503
+	EmptyConfigPlaceholder EmptyConfigMode = "placeholder"
+	// EmptyConfigKeep leaves the previous config in place
+	EmptyConfigKeep EmptyConfigMode = "keep"
+)
+
+// ParseEmptyConfigMode parses an empty config mode, defaulting to "empty"
+func ParseEmptyConfigMode(value string) (EmptyConfigMode, error) {
+	switch mode := EmptyConfigMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return EmptyConfigEmpty, nil
+	case EmptyConfigEmpty, EmptyConfigPlaceholder, EmptyConfigKeep:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid empty config mode %q, must be one of: empty, placeholder, keep", value)
+	}
+}
+
+// PlaceholderServer returns a catch-all server answering 503, used while no
+// containers are routed
+func PlaceholderServer(opts GeneratorOptions) ServerConfig {
+	server := ServerConfig{
+		ServerName:    "_",
+		Listen:        []string{listenAddress(opts.BindAddress, "80") + " default_server"},
+		ServerSnippet: "return 503;",
+	}
+	applyProxySettings(&server, opts)
+	return server
+}
+
+// ValidateBindAddress checks that address is empty or a literal IP address
+func ValidateBindAddress(address string) error {
+	if address != "" && net.ParseIP(address) == nil {
+		return fmt.Errorf("invalid bind address %q, must be an IP address", address)
+	}
+	return nil
+}
+
+// applyProxySettings adds PROXY protocol listen flags and real IP settings
+// for controllers running behind another proxy or L4 load balancer
+func applyProxySettings(server *ServerConfig, opts GeneratorOptions) {
+	if opts.ProxyProtocol {
+		for i := range server.Listen {
+			server.Listen[i] += " proxy_protocol"
+		}
+	}
+	
+	if len(opts.TrustedProxies) > 0 {
+		header := "X-Forwarded-For"
+		if opts.ProxyProtocol {
+			header = "proxy_protocol"
+		}
+		server.RealIP = RealIPConfig{
+			TrustedProxies: opts.TrustedProxies,
+			Header:         header,
+		}
+	}
+}
+
+// ValidateTrustedProxies checks that each entry is an IP address or CIDR
+func ValidateTrustedProxies(proxies []string) error {
+	for _, proxy := range proxies {
+		if _, _, err := net.ParseCIDR(proxy); err == nil {
+			continue
+		}
+		if net.ParseIP(proxy) == nil {
+			return fmt.Errorf("invalid trusted proxy %q, must be an IP address or CIDR", proxy)
+		}
+	}
+	return nil
+}
+
+// proxyPassURL builds the proxy_pass target for an upstream. nginx passes the
+// full request URI when proxy_pass has no URI part (http://upstream), but
+// replaces the part matching the location with the URI when one is given
+// (http://upstream/), which strips the location prefix.
+func proxyPassURL(protocol, upstreamName string, preservePath bool) string {
+	if preservePath {
+		return fmt.Sprintf("%s://%s", protocol, upstreamName)
+	}
+	return fmt.Sprintf("%s://%s/", protocol, upstreamName)
+}
+
+// upstreamResolveMode returns how a container's upstream-host is resolved:
+// its own label, else the controller-wide default
+func upstreamResolveMode(config *ContainerConfig, opts GeneratorOptions) UpstreamResolveMode {
+	if config.UpstreamResolve != "" {
+		return config.UpstreamResolve
+	}
+	if opts.UpstreamResolve != "" {
+		return opts.UpstreamResolve
+	}
+	return ResolveContinuous
+}
+
+// resolveUpstreamHost looks up the upstream-host of a resolve-once backend,
+// sorted so the config stays stable. When the lookup fails it warns and
+// returns nil, and the backend is resolved by nginx at request time instead.
+func resolveUpstreamHost(container *ContainerData, opts GeneratorOptions) []string {
+	lookup := opts.LookupHost
+	if lookup == nil {
+		lookup = net.LookupHost
+	}
+	
+	addrs, err := lookup(container.Config.UpstreamHost)
+	if err == nil && len(addrs) == 0 {
+		err = fmt.Errorf("no addresses found")
+	}
+	if err != nil {
+		fmt.Printf("Warning: failed to resolve %s for container %s, resolving it at request time instead: %v\n",
+			container.Config.UpstreamHost, container.Config.ContainerName, err)
+		return nil
+	}
+	
+	sort.Strings(addrs)
+	return addrs
+}
+
+// resolvedServers builds the upstream servers of a resolve-once backend
+func resolvedServers(container *ContainerData, addrs []string) []UpstreamServer {
+	servers := make([]UpstreamServer, 0, len(addrs))
+	for _, addr := range addrs {
+		servers = append(servers, UpstreamServer{
+			Address:     net.JoinHostPort(addr, strconv.Itoa(container.Config.Port)),
+			Weight:      1,
+			MaxFails:    container.Config.LoadBalancer.MaxFails,
+			FailTimeout: container.Config.LoadBalancer.FailTimeout,
+		})
+	}
+	return servers
+}
+
+// dynamicUpstream describes the DNS-based backend of a container resolved by
+// nginx at request time
+func dynamicUpstream(container *ContainerData, upstreamName string, opts GeneratorOptions) DynamicUpstreamConfig {
+	return DynamicUpstreamConfig{
+		Enabled:       true,
+		Variable:      "upstream_" + strings.TrimPrefix(upstreamName, "backend_"),
+		Address:       fmt.Sprintf("%s:%d", container.Config.UpstreamHost, container.Config.Port),
+		Resolver:      opts.Resolver,
+		ResolverValid: opts.ResolverValid,
+	}
+}
+
+// UpstreamName builds the upstream name for a container routed at host+path.
+// The sanitized parts keep the name readable, while the short hash of the
+// unsanitized values keeps hosts like a-b.local and a.b.local distinct.
+func UpstreamName(host, path, containerName string) string {
+	h := sha256.Sum256([]byte(host + "\x00" + path + "\x00" + containerName))
+	return fmt.Sprintf("backend_%s_%s_%x",
+		SanitizeContainerName(host),
+		SanitizeContainerName(containerName),
+		h[:4])
+}
+
+// withHost drops containers without a host, which would otherwise produce a
+// server block with an empty server_name that nginx rejects
+func withHost(containers []*ContainerData) []*ContainerData {
+	kept := make([]*ContainerData, 0, len(containers))
+	for _, container := range containers {
+		if strings.TrimSpace(container.Config.Host) == "" {
+			fmt.Printf("Warning: container %s has no host, skipping it\n", container.Config.ContainerName)
+			continue
+		}
+		kept = append(kept, container)
+	}
+	return kept
+}
+
+// claimUpstreamNames assigns every name requested with the upstream-name
+// label to the first route (host and path, in sorted order) requesting it,
+// so a name requested twice goes to the same route on every generation. It
+// maps names to host+path of the owning route.
+func claimUpstreamNames(hostGroups map[string][]*ContainerData) map[string]string {
+	hosts := make([]string, 0, len(hostGroups))
+	for host := range hostGroups {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	
+	claims := make(map[string]string)
+	for _, host := range hosts {
+		containers := append([]*ContainerData(nil), hostGroups[host]...)
+		sort.Slice(containers, func(i, j int) bool {
+			if containers[i].Config.Path != containers[j].Config.Path {
+				return containers[i].Config.Path < containers[j].Config.Path
+			}
+			return containers[i].Config.ContainerName < containers[j].Config.ContainerName
+		})
+		for _, container := range containers {
+			name := container.Config.UpstreamName
+			if _, taken := claims[name]; name != "" && !taken {
+				claims[name] = host + container.Config.Path
+			}
+		}
+	}
+	return claims
+}
+
+// dedupeUpstreams collapses upstreams with identical server membership into a
+// single shared upstream and repoints the affected locations at it
+func dedupeUpstreams(config *NginxConfig) {
+	canonical := make(map[string]string) // signature -> upstream name
+	renamed := make(map[string]string)   // dropped name -> shared name
+	
+	// Visit upstreams in name order so the shared name is deterministic
+	sorted := make([]UpstreamConfig, len(config.Upstreams))
+	copy(sorted, config.Upstreams)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	
+	var unique []UpstreamConfig
+	for _, upstream := range sorted {
+		if upstream.Fixed {
+			unique = append(unique, upstream)
+			continue
+		}
+		signature := upstreamSignature(upstream)
+		if name, exists := canonical[signature]; exists {
+			renamed[upstream.Name] = name
+			continue
+		}
+		canonical[signature] = upstream.Name
+		unique = append(unique, upstream)
+	}
+	
+	if len(renamed) == 0 {
+		return
+	}
+	config.Upstreams = unique
+	
+	for i := range config.Servers {
+		for j := range config.Servers[i].Locations {
+			location := &config.Servers[i].Locations[j]
+			shared, exists := renamed[location.Upstream]
+			if !exists {
+				continue
+			}
+			location.ProxyPass = strings.Replace(location.ProxyPass, location.Upstream, shared, 1)
+			location.Upstream = shared
+		}
+	}
+}
+
+// upstreamSignature builds a key describing everything that affects how an
+// upstream block is rendered, excluding its name
+func upstreamSignature(upstream UpstreamConfig) string {
+	servers := make([]string, 0, len(upstream.Servers))
+	for _, server := range upstream.Servers {
+		servers = append(servers, fmt.Sprintf("%s|%d|%t|%t|%d|%s", server.Address, server.Weight, server.Backup, server.Down, server.MaxFails, server.FailTimeout))
+	}
+	sort.Strings(servers)
+	
+	return fmt.Sprintf("%s|%s|%s|%t|%s|%s", upstream.Method, upstream.HashKey, upstream.ZoneSize, upstream.HealthCheck, upstream.HealthPath, strings.Join(servers, ","))
+}
+
+// EnsureSSLCertificates verifies that every TLS server references a readable
+// certificate and key. Servers with missing files fall back to the default
+// certificate, or have TLS disabled when the default is unavailable too, so a
+// single missing certificate can't break the whole configuration.
+func EnsureSSLCertificates(config *NginxConfig, opts GeneratorOptions) {
+	defaultCert, defaultKey := opts.defaultCertificate()
+	defaultAvailable := fileReadable(defaultCert) && fileReadable(defaultKey)
+	
+	for i := range config.Servers {
+		server := &config.Servers[i]
+		if !server.SSL.Enabled {
+			continue
+		}
+		if fileReadable(server.SSL.Certificate) && fileReadable(server.SSL.PrivateKey) {
+			continue
 		}
 		
-		// Add server snippet content
-		serverConfig.ServerSnippet = serverSnippetContent
+		if defaultAvailable {
+			fmt.Printf("Warning: certificate %s or key %s for host %s is not readable, falling back to default certificate\n",
+				server.SSL.Certificate, server.SSL.PrivateKey, server.ServerName)
+			server.SSL.Certificate = defaultCert
+			server.SSL.PrivateKey = defaultKey
+			disableStapling(server, defaultCert)
+			continue
+		}
 		
-		config.Servers = append(config.Servers, serverConfig)
+		fmt.Printf("Warning: no usable certificate for host %s, disabling TLS for this host\n", server.ServerName)
+		server.SSL = SSLConfig{}
+		var listen []string
+		for _, l := range server.Listen {
+			if !strings.Contains(l, "ssl") {
+				listen = append(listen, l)
+			}
+		}
+		server.Listen = listen
+	}
+}
+
+// hostMinTLSVersion returns the strictest min-tls-version of a host's
+// containers, warning when they disagree
+func hostMinTLSVersion(host string, containers []*ContainerData) string {
+	minVersion, owner := "", ""
+	for _, container := range containers {
+		version := container.Config.MinTLSVersion
+		if version == "" || version == minVersion {
+			continue
+		}
+		if minVersion != "" {
+			fmt.Printf("Warning: containers %s and %s set different %s on host %s, using the stricter one\n",
+				owner, container.Config.ContainerName, LabelMinTLSVersion, host)
+		}
+		if tlsVersionIndex(version) > tlsVersionIndex(minVersion) {
+			minVersion, owner = version, container.Config.ContainerName
+		}
+	}
+	return minVersion
+}
+
+// applyMinTLSVersion returns the ssl_protocols of a host with a minimum TLS
+// version: every version from the minimum up, or, when a container of the
+// host lists ssl-protocols explicitly, those of them at or above the minimum
+func applyMinTLSVersion(protocols []string, minVersion string, containers []*ContainerData) []string {
+	explicit := false
+	for _, container := range containers {
+		if len(container.Config.SSLProtocols) > 0 {
+			explicit = true
+			break
+		}
+	}
+	if !explicit {
+		return MinTLSProtocols(minVersion)
 	}
 	
-	return config, nil
+	var allowed []string
+	for _, protocol := range protocols {
+		if tlsVersionIndex(protocol) >= tlsVersionIndex(minVersion) {
+			allowed = append(allowed, protocol)
+		}
+	}
+	if len(allowed) == 0 {
+		fmt.Printf("Warning: no ssl-protocols remain at or above %s %s, using %s\n",
+			LabelMinTLSVersion, minVersion, strings.Join(MinTLSProtocols(minVersion), " "))
+		return MinTLSProtocols(minVersion)
+	}
+	return allowed
+}
+
+// mergeClientTimeouts fills the timeouts not set yet from other
+func mergeClientTimeouts(timeouts *ClientTimeoutConfig, other ClientTimeoutConfig) {
+	if timeouts.Body == "" {
+		timeouts.Body = other.Body
+	}
+	if timeouts.Header == "" {
+		timeouts.Header = other.Header
+	}
+	if timeouts.Send == "" {
+		timeouts.Send = other.Send
+	}
+}
+
+// resolveHostCertificate returns the name of the certificate in certDir that
+// covers host: <host>.crt, or else the wildcard *.<parent>.crt for the host's
+// parent domain. Empty means none was found.
+func resolveHostCertificate(host, certDir string) string {
+	if host == "" || strings.ContainsAny(host, "/*") {
+		return ""
+	}
+	if certificateExists(certDir, host) {
+		return host
+	}
+	// A wildcard only covers one label, so only the direct parent is checked
+	if _, parent, found := strings.Cut(host, "."); found && strings.Contains(parent, ".") {
+		if wildcard := "*." + parent; certificateExists(certDir, wildcard) {
+			return wildcard
+		}
+	}
+	return ""
+}
+
+// certificateExists reports whether <name>.crt and <name>.key exist in certDir
+func certificateExists(certDir, name string) bool {
+	return fileReadable(filepath.Join(certDir, name+".crt")) && fileReadable(filepath.Join(certDir, name+".key"))
+}
+
+// disableStapling turns off OCSP stapling for servers using the self-signed
+// default certificate, which has no issuer to staple a response for
+func disableStapling(server *ServerConfig, defaultCert string) {
+	if !server.SSL.Stapling || server.SSL.Certificate != defaultCert {
+		return
+	}
+	fmt.Printf("Warning: OCSP stapling requested for host %s but it uses the self-signed default certificate, ignoring\n", server.ServerName)
+	server.SSL.Stapling = false
+}
+
+// fileReadable reports whether path exists and can be opened for reading
+func fileReadable(path string) bool {
+	if path == "" {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
 }
 
 // RenderNginxConfig renders the nginx configuration to string using a template file
@@ -319,7 +1537,7 @@ func WriteNginxConfig(config *NginxConfig, filename string, templatePath string)
 		return fmt.Errorf("failed to write nginx config to %s: %w", filename, err)
 	}
 	
-	fmt.Printf("✅ Nginx configuration written to %s\n", filename)
+	log.Printf("✅ Nginx configuration written to %s", filename)
 	return nil
 }
 
@@ -341,10 +1559,12 @@ func ValidateNginxConfig(config *NginxConfig) error {
 	// Check for duplicate server names
 	serverNames := make(map[string]bool)
 	for _, server := range config.Servers {
-		if serverNames[server.ServerName] {
-			return fmt.Errorf("duplicate server name: %s", server.ServerName)
+		for _, name := range append([]string{server.ServerName}, server.Aliases...) {
+			if serverNames[name] {
+				return fmt.Errorf("duplicate server name: %s", name)
+			}
+			serverNames[name] = true
 		}
-		serverNames[server.ServerName] = true
 		
 		if len(server.Listen) == 0 {
 			return fmt.Errorf("server %s has no listen directives", server.ServerName)
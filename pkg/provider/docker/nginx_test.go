@@ -0,0 +1,1337 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// upstreamNames returns the names of the upstreams of config
+func upstreamNames(config *NginxConfig) []string {
+	names := make([]string, 0, len(config.Upstreams))
+	for _, upstream := range config.Upstreams {
+		names = append(names, upstream.Name)
+	}
+	return names
+}
+
+// findLocation returns the location at path of the server for host
+func findLocation(t testing.TB, config *NginxConfig, host, path string) LocationConfig {
+	t.Helper()
+	for _, server := range config.Servers {
+		if server.ServerName != host {
+			continue
+		}
+		for _, location := range server.Locations {
+			if location.Path == path {
+				return location
+			}
+		}
+	}
+	t.Fatalf("no location %s%s", host, path)
+	return LocationConfig{}
+}
+
+func TestDedupeUpstreams(t *testing.T) {
+	tests := []struct {
+		name          string
+		a, b          map[string]string
+		ipA, ipB      string
+		wantUpstreams int
+	}{
+		{
+			name:          "same backend on two hosts",
+			a:             map[string]string{LabelHost: "a.test", LabelPort: "8080"},
+			b:             map[string]string{LabelHost: "b.test", LabelPort: "8080"},
+			ipA:           "10.0.0.2",
+			ipB:           "10.0.0.2",
+			wantUpstreams: 1,
+		},
+		{
+			name:          "different ports",
+			a:             map[string]string{LabelHost: "a.test", LabelPort: "8080"},
+			b:             map[string]string{LabelHost: "b.test", LabelPort: "9090"},
+			ipA:           "10.0.0.2",
+			ipB:           "10.0.0.2",
+			wantUpstreams: 2,
+		},
+		{
+			name:          "different backends",
+			a:             map[string]string{LabelHost: "a.test", LabelPort: "8080"},
+			b:             map[string]string{LabelHost: "b.test", LabelPort: "8080"},
+			ipA:           "10.0.0.2",
+			ipB:           "10.0.0.3",
+			wantUpstreams: 2,
+		},
+		{
+			name:          "different load balancing",
+			a:             map[string]string{LabelHost: "a.test", LabelPort: "8080"},
+			b:             map[string]string{LabelHost: "b.test", LabelPort: "8080", LabelMethod: "least_conn"},
+			ipA:           "10.0.0.2",
+			ipB:           "10.0.0.2",
+			wantUpstreams: 2,
+		},
+		{
+			name:          "fixed name kept",
+			a:             map[string]string{LabelHost: "a.test", LabelPort: "8080"},
+			b:             map[string]string{LabelHost: "b.test", LabelPort: "8080", LabelUpstreamName: "backend_b"},
+			ipA:           "10.0.0.2",
+			ipB:           "10.0.0.2",
+			wantUpstreams: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := generateTestConfig(t, DefaultGeneratorOptions(),
+				newTestContainer(t, "a", tt.ipA, tt.a),
+				newTestContainer(t, "b", tt.ipB, tt.b))
+			if len(config.Upstreams) != tt.wantUpstreams {
+				t.Fatalf("upstreams = %v, want %d", upstreamNames(config), tt.wantUpstreams)
+			}
+
+			// Every location must point at an upstream that is rendered
+			names := strings.Join(upstreamNames(config), " ")
+			for _, host := range []string{"a.test", "b.test"} {
+				location := findLocation(t, config, host, "/")
+				if !strings.Contains(" "+names+" ", " "+location.Upstream+" ") {
+					t.Errorf("%s uses upstream %s, not in %s", host, location.Upstream, names)
+				}
+				if !strings.Contains(location.ProxyPass, location.Upstream) {
+					t.Errorf("%s proxy_pass %s doesn't use upstream %s", host, location.ProxyPass, location.Upstream)
+				}
+			}
+		})
+	}
+}
+
+func TestUpstreamFailureParameters(t *testing.T) {
+	tests := []struct {
+		name       string
+		labels     map[string]string
+		wantServer string
+		wantErr    string
+	}{
+		{name: "nginx defaults", wantServer: "server 10.0.0.2:80 weight=1;"},
+		{
+			name:       "max fails and fail timeout",
+			labels:     map[string]string{LabelUpstreamMaxFails: "3", LabelUpstreamFailTimeout: "30s"},
+			wantServer: "server 10.0.0.2:80 weight=1 max_fails=3 fail_timeout=30s;",
+		},
+		{
+			name:       "fail timeout only",
+			labels:     map[string]string{LabelUpstreamFailTimeout: "1m"},
+			wantServer: "server 10.0.0.2:80 weight=1 fail_timeout=1m;",
+		},
+		{name: "zero max fails", labels: map[string]string{LabelUpstreamMaxFails: "0"}, wantErr: "max-fails"},
+		{name: "non-numeric max fails", labels: map[string]string{LabelUpstreamMaxFails: "many"}, wantErr: "max-fails"},
+		{name: "invalid fail timeout", labels: map[string]string{LabelUpstreamFailTimeout: "30 seconds"}, wantErr: "fail-timeout"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := map[string]string{LabelHost: "app.test"}
+			for key, value := range tt.labels {
+				labels[key] = value
+			}
+			_, err := validateTestLabels(labels)
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+			rendered := renderTestConfig(t, DefaultGeneratorOptions(), newTestContainer(t, "app", "10.0.0.2", labels))
+			if !strings.Contains(rendered, tt.wantServer) {
+				t.Errorf("config lacks %q:\n%s", tt.wantServer, rendered)
+			}
+		})
+	}
+}
+
+func TestUpstreamName(t *testing.T) {
+	tests := []struct {
+		name       string
+		a, b       [3]string // host, path, container name
+		wantShared bool
+	}{
+		{"same route", [3]string{"app.test", "/", "app"}, [3]string{"app.test", "/", "app"}, true},
+		{"hosts sanitized alike", [3]string{"a-b.test", "/", "app"}, [3]string{"a.b.test", "/", "app"}, false},
+		{"same container on two hosts", [3]string{"a.test", "/", "app"}, [3]string{"b.test", "/", "app"}, false},
+		{"same host on two paths", [3]string{"app.test", "/v1", "app"}, [3]string{"app.test", "/v2", "app"}, false},
+		{"container names sanitized alike", [3]string{"app.test", "/", "my-app"}, [3]string{"app.test", "/", "my_app"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := UpstreamName(tt.a[0], tt.a[1], tt.a[2])
+			b := UpstreamName(tt.b[0], tt.b[1], tt.b[2])
+			if (a == b) != tt.wantShared {
+				t.Errorf("UpstreamName = %s and %s, want shared %v", a, b, tt.wantShared)
+			}
+			if !strings.HasPrefix(a, "backend_") || strings.ContainsAny(a, ".-/") {
+				t.Errorf("UpstreamName = %s, want a backend_ prefixed nginx identifier", a)
+			}
+		})
+	}
+}
+
+func TestDynamicUpstreamResolver(t *testing.T) {
+	tests := []struct {
+		name         string
+		configure    func(opts *GeneratorOptions)
+		wantResolver string
+	}{
+		{"docker dns", func(opts *GeneratorOptions) {}, "resolver 127.0.0.11 valid=30s;"},
+		{"custom resolver", func(opts *GeneratorOptions) {
+			opts.Resolver, opts.ResolverValid = "10.0.0.53", "10s"
+		}, "resolver 10.0.0.53 valid=10s;"},
+		{"without valid", func(opts *GeneratorOptions) {
+			opts.Resolver, opts.ResolverValid = "10.0.0.53 10.0.0.54", ""
+		}, "resolver 10.0.0.53 10.0.0.54;"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultGeneratorOptions()
+			tt.configure(&opts)
+			container := newTestContainer(t, "app", "10.0.0.2", map[string]string{
+				LabelHost: "app.test", LabelPort: "8080", LabelUpstreamHost: "app.internal",
+			})
+			config := generateTestConfig(t, opts, container)
+			if len(config.Upstreams) != 0 {
+				t.Errorf("upstreams = %v, want none for a DNS-based backend", upstreamNames(config))
+			}
+
+			rendered, err := RenderNginxConfig(config, testTemplatePath)
+			if err != nil {
+				t.Fatalf("RenderNginxConfig: %v", err)
+			}
+			location := locationBlock(t, rendered, "/")
+			variable := findLocation(t, config, "app.test", "/").Dynamic.Variable
+			for _, want := range []string{
+				tt.wantResolver,
+				"set $" + variable + " app.internal:8080;",
+				"proxy_pass http://$" + variable,
+			} {
+				if !strings.Contains(location, want) {
+					t.Errorf("location lacks %q:\n%s", want, location)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadBalancingMethods(t *testing.T) {
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		want     []string
+		unwanted []string
+		wantErr  string
+	}{
+		{name: "round robin", unwanted: []string{"least_conn", "ip_hash", "random", "hash "}},
+		{name: "least connections", labels: map[string]string{LabelMethod: "least_conn"}, want: []string{"least_conn;"}},
+		{name: "ip hash", labels: map[string]string{LabelMethod: "ip_hash"}, want: []string{"ip_hash;"}},
+		{name: "random", labels: map[string]string{LabelMethod: "random"}, want: []string{"random;"}},
+		{
+			name:   "consistent hash",
+			labels: map[string]string{LabelMethod: "hash", LabelHashKey: "$request_uri"},
+			want:   []string{"hash $request_uri consistent;"},
+		},
+		{name: "unknown method falls back to round robin", labels: map[string]string{LabelMethod: "fastest"}, unwanted: []string{"fastest"}},
+		{name: "hash without key", labels: map[string]string{LabelMethod: "hash"}, wantErr: LabelHashKey + " is required"},
+		{name: "hash key with nginx syntax", labels: map[string]string{LabelMethod: "hash", LabelHashKey: "$uri; x"}, wantErr: "invalid hash key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := map[string]string{LabelHost: "app.test"}
+			for key, value := range tt.labels {
+				labels[key] = value
+			}
+			_, err := validateTestLabels(labels)
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+			rendered := renderTestConfig(t, DefaultGeneratorOptions(), newTestContainer(t, "app", "10.0.0.2", labels))
+			checkContains(t, configBlock(t, rendered, "upstream backend_"), tt.want, tt.unwanted)
+		})
+	}
+}
+
+func TestProxyProtocolListeners(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     func(opts *GeneratorOptions)
+		want     []string
+		unwanted []string
+	}{
+		{
+			name:     "direct",
+			opts:     func(opts *GeneratorOptions) {},
+			want:     []string{"listen 80;", "listen 443 ssl;"},
+			unwanted: []string{"proxy_protocol", "set_real_ip_from"},
+		},
+		{
+			name:     "proxy protocol",
+			opts:     func(opts *GeneratorOptions) { opts.ProxyProtocol = true },
+			want:     []string{"listen 80 proxy_protocol;", "listen 443 ssl proxy_protocol;"},
+			unwanted: []string{"set_real_ip_from"},
+		},
+		{
+			name: "proxy protocol from trusted proxies",
+			opts: func(opts *GeneratorOptions) {
+				opts.ProxyProtocol = true
+				opts.TrustedProxies = []string{"10.0.0.0/8", "192.168.1.1"}
+			},
+			want: []string{"listen 80 proxy_protocol;", "set_real_ip_from 10.0.0.0/8;", "set_real_ip_from 192.168.1.1;", "real_ip_header proxy_protocol;"},
+		},
+		{
+			name: "forwarded for from trusted proxies",
+			opts: func(opts *GeneratorOptions) { opts.TrustedProxies = []string{"10.0.0.0/8"} },
+			want: []string{"listen 80;", "set_real_ip_from 10.0.0.0/8;", "real_ip_header X-Forwarded-For;"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultGeneratorOptions()
+			tt.opts(&opts)
+			rendered := renderTestConfig(t, opts, newTestContainer(t, "app", "10.0.0.2", map[string]string{LabelHost: "app.test", LabelTLS: "true"}))
+			checkContains(t, rendered, tt.want, tt.unwanted)
+		})
+	}
+}
+
+func TestValidateTrustedProxies(t *testing.T) {
+	tests := []struct {
+		proxies []string
+		wantErr bool
+	}{
+		{nil, false},
+		{[]string{"10.0.0.1", "10.0.0.0/8", "fd00::/8", "::1"}, false},
+		{[]string{"10.0.0.0/33"}, true},
+		{[]string{"proxy.local"}, true},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateTrustedProxies(tt.proxies); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateTrustedProxies(%v) = %v, want error %v", tt.proxies, err, tt.wantErr)
+		}
+	}
+}
+
+func TestMapBlocks(t *testing.T) {
+	mobile := map[string]string{
+		LabelMapPrefix + "is_mobile.source":   "$http_user_agent",
+		LabelMapPrefix + "is_mobile.default":  "0",
+		LabelMapPrefix + "is_mobile.~*iphone": "1",
+	}
+	conflicting := map[string]string{
+		LabelMapPrefix + "is_mobile.source":  "$http_user_agent",
+		LabelMapPrefix + "is_mobile.default": "1",
+	}
+
+	tests := []struct {
+		name    string
+		a, b    map[string]string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "declared once",
+			a:    mobile,
+			want: []string{"map $http_user_agent $is_mobile {", "default 0;", "~*iphone 1;"},
+		},
+		{
+			name: "declared identically twice",
+			a:    mobile,
+			b:    mobile,
+			want: []string{"map $http_user_agent $is_mobile {"},
+		},
+		{name: "declared differently", a: mobile, b: conflicting, wantErr: "map $is_mobile declared differently"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			containers := []*ContainerData{newTestContainer(t, "a", "10.0.0.2", hostLabels("a.test", tt.a))}
+			if tt.b != nil {
+				containers = append(containers, newTestContainer(t, "b", "10.0.0.3", hostLabels("b.test", tt.b)))
+			}
+			config, err := GenerateNginxConfigWithOptions(containers, nil, nil, DefaultGeneratorOptions())
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+			rendered, err := RenderNginxConfig(config, testTemplatePath)
+			if err != nil {
+				t.Fatalf("RenderNginxConfig: %v", err)
+			}
+			if got := strings.Count(rendered, "$is_mobile {"); got != 1 {
+				t.Errorf("map rendered %d times, want once", got)
+			}
+			checkContains(t, configBlock(t, rendered, "map $http_user_agent"), tt.want, nil)
+		})
+	}
+}
+
+func TestMapLabelValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		wantErr string
+	}{
+		{"missing source", map[string]string{LabelMapPrefix + "flag.default": "0"}, "requires a source variable"},
+		{"source without $", map[string]string{LabelMapPrefix + "flag.source": "http_host"}, "requires a source variable"},
+		{"invalid variable", map[string]string{LabelMapPrefix + "my-flag.source": "$host"}, "invalid map variable name"},
+		{"missing field", map[string]string{LabelMapPrefix + "flag": "$host"}, "invalid map label"},
+		{"nginx syntax in value", map[string]string{LabelMapPrefix + "flag.source": "$host", LabelMapPrefix + "flag.default": "0; }"}, "invalid value"},
+		{"valid map", map[string]string{LabelMapPrefix + "flag.source": "$http_x_tenant", LabelMapPrefix + "flag.default": "0", LabelMapPrefix + "flag.~^a": "1"}, ""},
+		{"space in source", map[string]string{LabelMapPrefix + "flag.source": "$http_a b"}, "invalid value"},
+		{"invalid source variable", map[string]string{LabelMapPrefix + "flag.source": "$http-a"}, "requires a source variable"},
+		{"bare $ source", map[string]string{LabelMapPrefix + "flag.source": "$"}, "requires a source variable"},
+		{"space in default", map[string]string{LabelMapPrefix + "flag.source": "$host", LabelMapPrefix + "flag.default": "a b"}, "invalid value"},
+		{"tab in output", map[string]string{LabelMapPrefix + "flag.source": "$host", LabelMapPrefix + "flag.a": "1\t2"}, "invalid value"},
+		{"quote in output", map[string]string{LabelMapPrefix + "flag.source": "$host", LabelMapPrefix + "flag.a": `"1`}, "invalid value"},
+		{"single quote in default", map[string]string{LabelMapPrefix + "flag.source": "$host", LabelMapPrefix + "flag.default": "'0"}, "invalid value"},
+		{"quote in input", map[string]string{LabelMapPrefix + "flag.source": "$host", LabelMapPrefix + `flag."a`: "1"}, "invalid map input"},
+		{"empty output", map[string]string{LabelMapPrefix + "flag.source": "$host", LabelMapPrefix + "flag.a": ""}, "empty map output"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := validateTestLabels(hostLabels("app.test", tt.labels))
+			checkError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestProxyPassPathHandling(t *testing.T) {
+	tests := []struct {
+		name          string
+		labels        map[string]string
+		wantPath      string
+		wantProxyPass string // with %s for the upstream name
+	}{
+		{"preserved by default", map[string]string{LabelPath: "/api"}, "/api", "http://%s"},
+		{"stripped prefix", map[string]string{LabelPath: "/api", LabelPreservePath: "false"}, "/api/", "http://%s/"},
+		{"stripped prefix with slash", map[string]string{LabelPath: "/api/", LabelPreservePath: "false"}, "/api/", "http://%s/"},
+		{"stripped https", map[string]string{LabelPath: "/api", LabelPreservePath: "false", LabelProtocol: "https"}, "/api/", "https://%s/"},
+		{"upstream host always preserves", map[string]string{LabelPath: "/api", LabelPreservePath: "false", LabelUpstreamHost: "api.internal", LabelUpstreamResolve: "once"}, "/api", "http://%s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultGeneratorOptions()
+			opts.LookupHost = func(host string) ([]string, error) { return []string{"10.0.0.9"}, nil }
+			config := generateTestConfig(t, opts, newTestContainer(t, "app", "10.0.0.2", hostLabels("app.test", tt.labels)))
+
+			location := findLocation(t, config, "app.test", tt.wantPath)
+			if want := fmt.Sprintf(tt.wantProxyPass, location.Upstream); location.ProxyPass != want {
+				t.Errorf("proxy_pass = %s, want %s", location.ProxyPass, want)
+			}
+		})
+	}
+}
+
+func TestBindAddress(t *testing.T) {
+	tests := []struct {
+		name            string
+		address         string
+		want            []string
+		wantPlaceholder string
+		wantErr         bool
+	}{
+		{name: "all interfaces", want: []string{"listen 80;", "listen 443 ssl;"}, wantPlaceholder: "80 default_server"},
+		{
+			name:            "ipv4",
+			address:         "192.168.1.10",
+			want:            []string{"listen 192.168.1.10:80;", "listen 192.168.1.10:443 ssl;"},
+			wantPlaceholder: "192.168.1.10:80 default_server",
+		},
+		{
+			name:            "ipv6",
+			address:         "::1",
+			want:            []string{"listen [::1]:80;", "listen [::1]:443 ssl;"},
+			wantPlaceholder: "[::1]:80 default_server",
+		},
+		{name: "hostname", address: "localhost", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateBindAddress(tt.address); (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateBindAddress(%q) = %v, want error %v", tt.address, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			opts := DefaultGeneratorOptions()
+			opts.BindAddress = tt.address
+			rendered := renderTestConfig(t, opts, newTestContainer(t, "app", "10.0.0.2", hostLabels("app.test", map[string]string{LabelTLS: "true"})))
+			checkContains(t, rendered, tt.want, nil)
+
+			if listen := PlaceholderServer(opts).Listen; listen[0] != tt.wantPlaceholder {
+				t.Errorf("placeholder listens on %q, want %q", listen[0], tt.wantPlaceholder)
+			}
+		})
+	}
+}
+
+func TestDiagnosticHeaders(t *testing.T) {
+	tests := []struct {
+		name       string
+		diagnostic string // enable-diagnostic-headers label of the api container, omitted when empty
+		wantAPI    bool
+	}{
+		{"enabled by default", "", true},
+		{"explicitly enabled", "true", true},
+		{"opted out", "false", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiLabels := map[string]string{LabelPath: "/api"}
+			if tt.diagnostic != "" {
+				apiLabels[LabelDiagnosticHeaders] = tt.diagnostic
+			}
+			web := newTestContainer(t, "web", "10.0.0.2", hostLabels("app.test", nil))
+			api := newTestContainer(t, "api", "10.0.0.3", hostLabels("app.test", apiLabels))
+			rendered := renderTestConfig(t, DefaultGeneratorOptions(), web, api)
+
+			checkContains(t, locationBlock(t, rendered, "/"), []string{
+				"proxy_set_header X-Container-Name web;",
+				"proxy_set_header X-Container-ID " + web.Config.ContainerID[:12] + ";",
+			}, nil)
+
+			headers := []string{"X-Container-Name", "X-Container-ID"}
+			if tt.wantAPI {
+				checkContains(t, locationBlock(t, rendered, "/api"), []string{"proxy_set_header X-Container-Name api;"}, nil)
+			} else {
+				checkContains(t, locationBlock(t, rendered, "/api"), nil, headers)
+			}
+		})
+	}
+}
+
+func TestProxyCache(t *testing.T) {
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		cacheDir string
+		want     []string
+		unwanted []string
+		wantErr  string
+	}{
+		{
+			name:     "disabled by default",
+			unwanted: []string{"proxy_cache"},
+		},
+		{
+			name:   "defaults",
+			labels: map[string]string{LabelProxyCache: "true"},
+			want: []string{
+				"proxy_cache_path /var/cache/nginx/ingress/cache_app_test_app_",
+				"levels=1:2 keys_zone=cache_app_test_app_",
+				":10m;",
+				"proxy_cache cache_app_test_app_",
+				"proxy_cache_key $scheme$proxy_host$request_uri;",
+				"proxy_cache_valid 200 302 10m;",
+			},
+			unwanted: []string{"max_size=", "inactive="},
+		},
+		{
+			name: "custom settings",
+			labels: map[string]string{
+				LabelProxyCache:         "true",
+				LabelProxyCacheKey:      "$host$request_uri",
+				LabelProxyCacheValid:    "200 1h, 404 1m, any 5s",
+				LabelProxyCacheZoneSize: "32m",
+				LabelProxyCacheMaxSize:  "1g",
+				LabelProxyCacheInactive: "2h",
+			},
+			cacheDir: "/data/cache",
+			want: []string{
+				"proxy_cache_path /data/cache/cache_app_test_app_",
+				":32m max_size=1g inactive=2h;",
+				"proxy_cache_key $host$request_uri;",
+				"proxy_cache_valid 200 1h;",
+				"proxy_cache_valid 404 1m;",
+				"proxy_cache_valid any 5s;",
+			},
+		},
+		{name: "invalid key", labels: map[string]string{LabelProxyCache: "true", LabelProxyCacheKey: "$host; return 200"}, wantErr: "invalid proxy cache key"},
+		{name: "validity without duration", labels: map[string]string{LabelProxyCacheValid: "200 forever"}, wantErr: "must end with a duration"},
+		{name: "invalid status code", labels: map[string]string{LabelProxyCacheValid: "700 10m"}, wantErr: `invalid status code "700"`},
+		{name: "invalid zone size", labels: map[string]string{LabelProxyCacheZoneSize: "10 mb"}, wantErr: "invalid proxy cache zone size"},
+		{name: "invalid inactive time", labels: map[string]string{LabelProxyCacheInactive: "soon"}, wantErr: "invalid proxy cache inactive time"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := hostLabels("app.test", tt.labels)
+			if _, err := validateTestLabels(labels); tt.wantErr != "" || err != nil {
+				checkError(t, err, tt.wantErr)
+				return
+			}
+
+			opts := DefaultGeneratorOptions()
+			if tt.cacheDir != "" {
+				opts.ProxyCacheDir = tt.cacheDir
+			}
+			rendered := renderTestConfig(t, opts, newTestContainer(t, "app", "10.0.0.2", labels))
+			checkContains(t, rendered, tt.want, tt.unwanted)
+		})
+	}
+}
+
+func TestValidateProxyCacheDir(t *testing.T) {
+	tests := []struct {
+		dir     string
+		wantErr string
+	}{
+		{"", ""},
+		{"/var/cache/nginx", ""},
+		{"cache", "must be an absolute path"},
+		{"/var/cache; root /", "must be an absolute path"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			checkError(t, ValidateProxyCacheDir(tt.dir), tt.wantErr)
+		})
+	}
+}
+
+func TestProxyRequestBuffering(t *testing.T) {
+	tests := []struct {
+		name      string
+		buffering string // proxy-request-buffering label, omitted when empty
+		want      []string
+		unwanted  []string
+		wantErr   string
+	}{
+		{name: "nginx default", unwanted: []string{"proxy_request_buffering"}},
+		{name: "off", buffering: "off", want: []string{"proxy_request_buffering off;"}},
+		{name: "false means off", buffering: "false", want: []string{"proxy_request_buffering off;"}},
+		{name: "on", buffering: "On", want: []string{"proxy_request_buffering on;"}},
+		{name: "invalid", buffering: "stream", wantErr: `invalid nginx.ingress.proxy-request-buffering "stream"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := hostLabels("upload.test", nil)
+			if tt.buffering != "" {
+				labels[LabelProxyRequestBuffering] = tt.buffering
+			}
+			if _, err := validateTestLabels(labels); tt.wantErr != "" || err != nil {
+				checkError(t, err, tt.wantErr)
+				return
+			}
+
+			rendered := renderTestConfig(t, DefaultGeneratorOptions(), newTestContainer(t, "upload", "10.0.0.2", labels))
+			checkContains(t, locationBlock(t, rendered, "/"), tt.want, tt.unwanted)
+		})
+	}
+}
+
+func TestUpstreamZone(t *testing.T) {
+	tests := []struct {
+		name       string
+		zoneSize   string // upstream-zone-size label, omitted when empty
+		controller string // GeneratorOptions.UpstreamZoneSize
+		wantZone   string
+		wantErr    string
+	}{
+		{name: "no zone by default"},
+		{name: "label", zoneSize: "64k", wantZone: "64k"},
+		{name: "controller default", controller: "128k", wantZone: "128k"},
+		{name: "label overrides controller", zoneSize: "1m", controller: "128k", wantZone: "1m"},
+		{name: "invalid size", zoneSize: "64 kb", wantErr: "invalid upstream zone size"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := hostLabels("app.test", nil)
+			if tt.zoneSize != "" {
+				labels[LabelUpstreamZoneSize] = tt.zoneSize
+			}
+			if _, err := validateTestLabels(labels); tt.wantErr != "" || err != nil {
+				checkError(t, err, tt.wantErr)
+				return
+			}
+
+			// Replicas of one image share an upstream
+			app, replica := newTestContainer(t, "app", "10.0.0.2", labels), newTestContainer(t, "app-2", "10.0.0.3", labels)
+			app.Image, replica.Image = "shop:1", "shop:1"
+			opts := DefaultGeneratorOptions()
+			opts.UpstreamZoneSize = tt.controller
+			config := generateTestConfig(t, opts, app, replica)
+			if len(config.Upstreams) != 1 {
+				t.Fatalf("upstreams = %v, want the replicas merged into one", upstreamNames(config))
+			}
+			rendered, err := RenderNginxConfig(config, testTemplatePath)
+			if err != nil {
+				t.Fatalf("RenderNginxConfig: %v", err)
+			}
+
+			name := config.Upstreams[0].Name
+			block := configBlock(t, rendered, "upstream "+name+" {")
+			if tt.wantZone == "" {
+				checkContains(t, block, nil, []string{"zone "})
+				return
+			}
+			checkContains(t, block, []string{fmt.Sprintf("zone %s %s;", name, tt.wantZone), "server 10.0.0.2:80", "server 10.0.0.3:80"}, nil)
+		})
+	}
+}
+
+func TestDefaultBackend(t *testing.T) {
+	api := newTestContainer(t, "api", "10.0.0.2", hostLabels("app.test", map[string]string{LabelPath: "/api"}))
+	admin := newTestContainer(t, "admin", "10.0.0.3", hostLabels("app.test", map[string]string{LabelPath: "/admin"}))
+	catchAll := newTestContainer(t, "api", "10.0.0.2", hostLabels("app.test", map[string]string{LabelPath: "/api", LabelDefaultBackend: "true"}))
+	root := newTestContainer(t, "web", "10.0.0.4", hostLabels("app.test", nil))
+
+	tests := []struct {
+		name         string
+		status       int // GeneratorOptions.DefaultBackendStatus
+		containers   []*ContainerData
+		wantRoot     bool
+		wantStatus   int
+		wantUpstream string // container name whose upstream serves /
+	}{
+		{name: "prefixed paths get a 404 fallback", status: 404, containers: []*ContainerData{api, admin}, wantRoot: true, wantStatus: 404},
+		{name: "configured status", status: 503, containers: []*ContainerData{api, admin}, wantRoot: true, wantStatus: 503},
+		{name: "fallback disabled", status: 0, containers: []*ContainerData{api, admin}},
+		{name: "default backend container", status: 404, containers: []*ContainerData{catchAll, admin}, wantRoot: true, wantUpstream: "api"},
+		{name: "root location kept", status: 404, containers: []*ContainerData{api, root}, wantRoot: true, wantUpstream: "web"},
+		{name: "first default backend wins", status: 404, containers: []*ContainerData{catchAll, root}, wantRoot: true, wantUpstream: "api"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultGeneratorOptions()
+			opts.DefaultBackendStatus = tt.status
+			config := generateTestConfig(t, opts, tt.containers...)
+
+			var roots []LocationConfig
+			for _, location := range config.Servers[0].Locations {
+				if location.Path == "/" {
+					roots = append(roots, location)
+				}
+			}
+			if !tt.wantRoot {
+				if len(roots) != 0 {
+					t.Fatalf("unexpected / locations %+v", roots)
+				}
+				return
+			}
+			if len(roots) != 1 {
+				t.Fatalf("%d / locations, want 1", len(roots))
+			}
+			if roots[0].ReturnStatus != tt.wantStatus {
+				t.Errorf("/ returns %d, want %d", roots[0].ReturnStatus, tt.wantStatus)
+			}
+			if tt.wantUpstream != "" && !strings.Contains(roots[0].Upstream, "_"+tt.wantUpstream+"_") {
+				t.Errorf("/ proxies to %q, want the upstream of %s", roots[0].Upstream, tt.wantUpstream)
+			}
+		})
+	}
+}
+
+func TestInterceptErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		want     []string
+		unwanted []string
+	}{
+		{name: "off by default", unwanted: []string{"intercept_errors"}},
+		{name: "disabled", labels: map[string]string{LabelInterceptErrors: "false"}, unwanted: []string{"intercept_errors"}},
+		{name: "enabled", labels: map[string]string{LabelInterceptErrors: "true"}, want: []string{"proxy_intercept_errors on;"}},
+		{
+			name:   "grpc backend",
+			labels: map[string]string{LabelInterceptErrors: "true", LabelBackendHTTP2: "true", LabelPreservePath: "true"},
+			want:   []string{"grpc_intercept_errors on;"}, unwanted: []string{"proxy_intercept_errors"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered := renderTestConfig(t, DefaultGeneratorOptions(), newTestContainer(t, "app", "10.0.0.2", hostLabels("app.test", tt.labels)))
+			checkContains(t, locationBlock(t, rendered, "/"), tt.want, tt.unwanted)
+		})
+	}
+
+	// Backend errors are routed to the server's error_page while all
+	// backends are down
+	container := newTestContainer(t, "app", "10.0.0.2", hostLabels("app.test", map[string]string{LabelInterceptErrors: "true"}))
+	container.Restarting = true
+	rendered := renderTestConfig(t, DefaultGeneratorOptions(), container)
+	checkContains(t, rendered, []string{"error_page 502 503 504 =503 @unavailable;", "location @unavailable {"}, nil)
+	checkContains(t, locationBlock(t, rendered, "/"), []string{"proxy_intercept_errors on;"}, nil)
+}
+
+func TestUnavailablePage(t *testing.T) {
+	tests := []struct {
+		name           string
+		retryAfter     int
+		downPaths      []string
+		wantRetryAfter int // 0 for no 503 page
+	}{
+		{"healthy host", DefaultRetryAfter, nil, 0},
+		{"all backends down", DefaultRetryAfter, []string{"/", "/api"}, DefaultRetryAfter},
+		{"custom Retry-After", 120, []string{"/", "/api"}, 120},
+		{"disabled", -1, []string{"/", "/api"}, 0},
+		{"some backends up", DefaultRetryAfter, []string{"/api"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var containers []*ContainerData
+			for i, path := range []string{"/", "/api"} {
+				c := newTestContainer(t, fmt.Sprintf("app%d", i), fmt.Sprintf("10.0.0.%d", i+2), hostLabels("app.test", map[string]string{LabelPath: path}))
+				for _, down := range tt.downPaths {
+					c.Restarting = c.Restarting || down == path
+				}
+				containers = append(containers, c)
+			}
+
+			opts := DefaultGeneratorOptions()
+			opts.RetryAfter = tt.retryAfter
+			config := generateTestConfig(t, opts, containers...)
+			want := UnavailableConfig{Enabled: tt.wantRetryAfter > 0, RetryAfter: tt.wantRetryAfter}
+			if got := config.Servers[0].Unavailable; got != want {
+				t.Errorf("Unavailable = %+v, want %+v", got, want)
+			}
+
+			rendered := renderTestConfig(t, opts, containers...)
+			if tt.wantRetryAfter == 0 {
+				checkContains(t, rendered, nil, []string{"@unavailable"})
+				return
+			}
+			checkContains(t, rendered, []string{"error_page 502 503 504 =503 @unavailable;"}, nil)
+			checkContains(t, locationBlock(t, rendered, "@unavailable"),
+				[]string{fmt.Sprintf("add_header Retry-After %d always;", tt.wantRetryAfter), "return 503"}, nil)
+		})
+	}
+}
+
+func TestProxyRedirect(t *testing.T) {
+	tests := []struct {
+		name     string
+		redirect string // proxy-redirect label, omitted when empty
+		want     []string
+		unwanted []string
+		wantErr  string
+	}{
+		{name: "nginx default", unwanted: []string{"proxy_redirect"}},
+		{name: "default", redirect: "default", want: []string{"proxy_redirect default;"}},
+		{name: "off", redirect: "off", want: []string{"proxy_redirect off;"}},
+		{name: "rewrite", redirect: "http://backend/  https://app.test/", want: []string{"proxy_redirect http://backend/ https://app.test/;"}},
+		{name: "missing replacement", redirect: "http://backend/", wantErr: "invalid proxy redirect"},
+		{name: "too many arguments", redirect: "http://a/ http://b/ http://c/", wantErr: "invalid proxy redirect"},
+		{name: "injection", redirect: "http://backend/ https://app.test/;return", wantErr: "invalid proxy redirect"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := hostLabels("app.test", nil)
+			if tt.redirect != "" {
+				labels[LabelProxyRedirect] = tt.redirect
+			}
+			if _, err := validateTestLabels(labels); tt.wantErr != "" || err != nil {
+				checkError(t, err, tt.wantErr)
+				return
+			}
+
+			rendered := renderTestConfig(t, DefaultGeneratorOptions(), newTestContainer(t, "app", "10.0.0.2", labels))
+			checkContains(t, locationBlock(t, rendered, "/"), tt.want, tt.unwanted)
+		})
+	}
+}
+
+func TestClientTimeouts(t *testing.T) {
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		other    map[string]string // labels of a second container of the host at /api
+		want     []string
+		unwanted []string
+		wantErr  string
+	}{
+		{name: "nginx defaults", unwanted: []string{"client_body_timeout", "client_header_timeout", " send_timeout"}},
+		{
+			name:     "body only",
+			labels:   map[string]string{LabelClientBodyTimeout: "10s"},
+			want:     []string{"client_body_timeout 10s;"},
+			unwanted: []string{"client_header_timeout", " send_timeout"},
+		},
+		{
+			name:   "all timeouts",
+			labels: map[string]string{LabelClientBodyTimeout: "10s", LabelClientHeaderTimeout: "5s", LabelSendTimeout: "1m"},
+			want:   []string{"client_body_timeout 10s;", "client_header_timeout 5s;", "send_timeout 1m;"},
+		},
+		{
+			name:     "first container setting a timeout wins",
+			labels:   map[string]string{LabelClientBodyTimeout: "10s"},
+			other:    map[string]string{LabelClientBodyTimeout: "20s", LabelSendTimeout: "30s"},
+			want:     []string{"client_body_timeout 10s;", "send_timeout 30s;"},
+			unwanted: []string{"client_body_timeout 20s;"},
+		},
+		{name: "invalid duration", labels: map[string]string{LabelClientHeaderTimeout: "5 seconds"}, wantErr: "invalid " + LabelClientHeaderTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := hostLabels("app.test", tt.labels)
+			if _, err := validateTestLabels(labels); tt.wantErr != "" || err != nil {
+				checkError(t, err, tt.wantErr)
+				return
+			}
+
+			containers := []*ContainerData{newTestContainer(t, "app", "10.0.0.2", labels)}
+			if tt.other != nil {
+				other := hostLabels("app.test", tt.other)
+				other[LabelPath] = "/api"
+				containers = append(containers, newTestContainer(t, "api", "10.0.0.3", other))
+			}
+			rendered := renderTestConfig(t, DefaultGeneratorOptions(), containers...)
+			checkContains(t, serverBlock(t, rendered, "app.test"), tt.want, tt.unwanted)
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	declared := []string{"map $http_x_request_id $ingress_request_id {", `"" $request_id;`, "log_format ingress_request_id "}
+	logged := "access_log /dev/stdout ingress_request_id;"
+
+	tests := []struct {
+		name         string
+		labels       map[string]string
+		wantLocation []string
+	}{
+		{"disabled", map[string]string{LabelRequestID: "false"}, nil},
+		{"http", map[string]string{LabelRequestID: "true"}, []string{"proxy_set_header X-Request-ID $ingress_request_id;", logged}},
+		{
+			name:         "fastcgi",
+			labels:       map[string]string{LabelRequestID: "true", LabelBackendProtocol: "FCGI", LabelPort: "9000"},
+			wantLocation: []string{"fastcgi_param HTTP_X_REQUEST_ID $ingress_request_id;", logged},
+		},
+		{
+			name:         "grpc",
+			labels:       map[string]string{LabelRequestID: "true", LabelBackendHTTP2: "true", LabelPreservePath: "true"},
+			wantLocation: []string{"grpc_set_header X-Request-ID $ingress_request_id;", logged},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := hostLabels("app.test", tt.labels)
+			if _, err := validateTestLabels(labels); err != nil {
+				t.Fatalf("labels rejected: %v", err)
+			}
+			// A second host never asking for request IDs
+			other := newTestContainer(t, "other", "10.0.0.3", hostLabels("other.test", nil))
+			rendered := renderTestConfig(t, DefaultGeneratorOptions(), newTestContainer(t, "app", "10.0.0.2", labels), other)
+
+			if tt.wantLocation == nil {
+				checkContains(t, rendered, nil, append(declared, "X-Request-ID", "X_REQUEST_ID"))
+				return
+			}
+			checkContains(t, rendered, declared, nil)
+			if got := strings.Count(rendered, "map $http_x_request_id"); got != 1 {
+				t.Errorf("request ID map declared %d times, want once", got)
+			}
+			checkContains(t, serverBlock(t, rendered, "app.test"), tt.wantLocation, nil)
+			checkContains(t, serverBlock(t, rendered, "other.test"), nil, []string{"ingress_request_id"})
+		})
+	}
+}
+
+func TestUpstreamResolveMode(t *testing.T) {
+	lookupResult := func(addrs []string, err error) func(string) ([]string, error) {
+		return func(host string) ([]string, error) {
+			if host != "app.internal" {
+				t.Errorf("looked up %s, want app.internal", host)
+			}
+			return addrs, err
+		}
+	}
+
+	tests := []struct {
+		name        string
+		label       string // upstream-resolve label, omitted when empty
+		controller  UpstreamResolveMode
+		lookup      func(string) ([]string, error)
+		wantServers []string // nil for a backend resolved by nginx
+		wantErr     string
+	}{
+		{name: "continuous by default", lookup: lookupResult([]string{"10.1.0.2"}, nil)},
+		{
+			name:        "controller resolves once",
+			controller:  ResolveOnce,
+			lookup:      lookupResult([]string{"10.1.0.3", "10.1.0.2"}, nil),
+			wantServers: []string{"10.1.0.2:8080", "10.1.0.3:8080"},
+		},
+		{name: "label resolves once", label: "once", lookup: lookupResult([]string{"10.1.0.2"}, nil), wantServers: []string{"10.1.0.2:8080"}},
+		{name: "label overrides controller", label: "continuous", controller: ResolveOnce, lookup: lookupResult([]string{"10.1.0.2"}, nil)},
+		{name: "lookup failure falls back to nginx", label: "once", lookup: lookupResult(nil, fmt.Errorf("no such host"))},
+		{name: "no addresses falls back to nginx", label: "once", lookup: lookupResult(nil, nil)},
+		{name: "invalid mode", label: "sometimes", wantErr: "invalid upstream resolve mode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := hostLabels("app.test", map[string]string{LabelPort: "8080", LabelUpstreamHost: "app.internal"})
+			if tt.label != "" {
+				labels[LabelUpstreamResolve] = tt.label
+			}
+			if _, err := validateTestLabels(labels); tt.wantErr != "" || err != nil {
+				checkError(t, err, tt.wantErr)
+				return
+			}
+
+			opts := DefaultGeneratorOptions()
+			opts.UpstreamResolve = tt.controller
+			opts.LookupHost = tt.lookup
+			container := newTestContainer(t, "app", "10.0.0.2", labels)
+			config := generateTestConfig(t, opts, container)
+			location := findLocation(t, config, "app.test", "/")
+
+			if tt.wantServers == nil {
+				if len(config.Upstreams) != 0 || location.Dynamic.Variable == "" {
+					t.Errorf("upstreams %v, dynamic %+v, want a backend resolved by nginx", upstreamNames(config), location.Dynamic)
+				}
+				return
+			}
+			if len(config.Upstreams) != 1 || location.Dynamic.Variable != "" {
+				t.Fatalf("upstreams %v, dynamic %+v, want one resolved upstream", upstreamNames(config), location.Dynamic)
+			}
+			var servers []string
+			for _, server := range config.Upstreams[0].Servers {
+				servers = append(servers, server.Address)
+			}
+			if !reflect.DeepEqual(servers, tt.wantServers) {
+				t.Errorf("upstream servers = %v, want %v", servers, tt.wantServers)
+			}
+			checkContains(t, renderTestConfig(t, opts, container), nil, []string{"resolver "})
+		})
+	}
+}
+
+func TestResolveOnceReresolvesOnRegeneration(t *testing.T) {
+	addrs := []string{"10.1.0.2"}
+	opts := DefaultGeneratorOptions()
+	opts.Cache = NewConfigCache()
+	opts.LookupHost = func(string) ([]string, error) { return addrs, nil }
+	container := newTestContainer(t, "app", "10.0.0.2", hostLabels("app.test", map[string]string{
+		LabelPort: "8080", LabelUpstreamHost: "app.internal", LabelUpstreamResolve: "once",
+	}))
+
+	generateTestConfig(t, opts, container)
+	addrs = []string{"10.1.0.9"}
+	config := generateTestConfig(t, opts, container)
+	if got := config.Upstreams[0].Servers[0].Address; got != "10.1.0.9:8080" {
+		t.Errorf("upstream server = %s after the name moved, want 10.1.0.9:8080", got)
+	}
+}
+
+func TestUpstreamNameOverride(t *testing.T) {
+	tests := []struct {
+		name    string
+		label   string
+		want    string
+		wantErr string
+	}{
+		{name: "fixed name", label: "shop_backend", want: "shop_backend"},
+		{name: "sanitized", label: " shop-backend.v2 ", want: "shop_backend_v2"},
+		{name: "empty", label: " ", wantErr: "invalid upstream name"},
+		{name: "invalid characters", label: "shop backend;", wantErr: "invalid upstream name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := hostLabels("shop.test", map[string]string{LabelUpstreamName: tt.label})
+			if _, err := validateTestLabels(labels); tt.wantErr != "" || err != nil {
+				checkError(t, err, tt.wantErr)
+				return
+			}
+
+			container := newTestContainer(t, "shop", "10.0.0.2", labels)
+			config := generateTestConfig(t, DefaultGeneratorOptions(), container)
+			if location := findLocation(t, config, "shop.test", "/"); location.Upstream != tt.want {
+				t.Errorf("location uses upstream %s, want %s", location.Upstream, tt.want)
+			}
+			checkContains(t, renderTestConfig(t, DefaultGeneratorOptions(), container),
+				[]string{"upstream " + tt.want + " {", "proxy_pass http://" + tt.want}, nil)
+		})
+	}
+}
+
+func TestUpstreamNameClaimedOnce(t *testing.T) {
+	labels := map[string]string{LabelUpstreamName: "shared", LabelPort: "8080"}
+	a := newTestContainer(t, "a", "10.0.0.2", hostLabels("a.test", labels))
+	b := newTestContainer(t, "b", "10.0.0.3", hostLabels("b.test", labels))
+
+	// The first route by host and path keeps the name whatever the order
+	for _, containers := range [][]*ContainerData{{a, b}, {b, a}} {
+		config := generateTestConfig(t, DefaultGeneratorOptions(), containers...)
+		if got := findLocation(t, config, "a.test", "/").Upstream; got != "shared" {
+			t.Errorf("a.test uses upstream %s, want shared", got)
+		}
+		if got := findLocation(t, config, "b.test", "/").Upstream; got == "shared" || !strings.HasPrefix(got, "backend_b_test") {
+			t.Errorf("b.test uses upstream %s, want its generated name", got)
+		}
+	}
+}
+
+func TestForwardedProtoAndPort(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "client scheme and port by default",
+			want: []string{"proxy_set_header X-Forwarded-Proto $scheme;", "proxy_set_header X-Forwarded-Port $server_port;"},
+		},
+		{
+			name:   "behind a TLS terminator",
+			labels: map[string]string{LabelForwardedProto: "https", LabelForwardedPort: "443"},
+			want:   []string{"proxy_set_header X-Forwarded-Proto https;", "proxy_set_header X-Forwarded-Port 443;"},
+		},
+		{
+			name:   "nginx variables",
+			labels: map[string]string{LabelForwardedProto: "$http_x_forwarded_proto", LabelForwardedPort: "$http_x_forwarded_port"},
+			want: []string{
+				"proxy_set_header X-Forwarded-Proto $http_x_forwarded_proto;",
+				"proxy_set_header X-Forwarded-Port $http_x_forwarded_port;",
+			},
+		},
+		{
+			name:   "grpc",
+			labels: map[string]string{LabelForwardedProto: "https", LabelBackendHTTP2: "true", LabelPreservePath: "true"},
+			want:   []string{"grpc_set_header X-Forwarded-Proto https;", "grpc_set_header X-Forwarded-Port $server_port;"},
+		},
+		{name: "invalid proto", labels: map[string]string{LabelForwardedProto: "ftp"}, wantErr: "invalid forwarded proto"},
+		{name: "invalid variable", labels: map[string]string{LabelForwardedProto: "$scheme;"}, wantErr: "invalid forwarded proto"},
+		{name: "invalid port", labels: map[string]string{LabelForwardedPort: "70000"}, wantErr: "invalid forwarded port"},
+		{name: "port not a number", labels: map[string]string{LabelForwardedPort: "https"}, wantErr: "invalid forwarded port"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := hostLabels("app.test", tt.labels)
+			if _, err := validateTestLabels(labels); tt.wantErr != "" || err != nil {
+				checkError(t, err, tt.wantErr)
+				return
+			}
+
+			rendered := renderTestConfig(t, DefaultGeneratorOptions(), newTestContainer(t, "app", "10.0.0.2", labels))
+			checkContains(t, locationBlock(t, rendered, "/"), tt.want, nil)
+		})
+	}
+}
+
+func TestAllowedMethods(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		want    []string // allowed methods of the location, nil for all
+		wantErr string
+	}{
+		{name: "every method by default"},
+		{name: "GET allows HEAD", labels: map[string]string{LabelAllowedMethods: "get"}, want: []string{"GET", "HEAD"}},
+		{name: "several methods", labels: map[string]string{LabelAllowedMethods: "POST, PUT"}, want: []string{"POST", "PUT"}},
+		{
+			name:   "CORS allows preflight",
+			labels: map[string]string{LabelAllowedMethods: "POST", LabelCORS: "true"},
+			want:   []string{"OPTIONS", "POST"},
+		},
+		{name: "unknown method", labels: map[string]string{LabelAllowedMethods: "GET,FETCH"}, wantErr: `invalid allowed method "FETCH"`},
+		{name: "no methods", labels: map[string]string{LabelAllowedMethods: " , "}, wantErr: "needs at least one method"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := hostLabels("app.test", tt.labels)
+			if _, err := validateTestLabels(labels); tt.wantErr != "" || err != nil {
+				checkError(t, err, tt.wantErr)
+				return
+			}
+
+			container := newTestContainer(t, "app", "10.0.0.2", labels)
+			config := generateTestConfig(t, DefaultGeneratorOptions(), container)
+			if got := findLocation(t, config, "app.test", "/").AllowedMethods; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("allowed methods = %v, want %v", got, tt.want)
+			}
+
+			location := locationBlock(t, renderTestConfig(t, DefaultGeneratorOptions(), container), "/")
+			if tt.want == nil {
+				checkContains(t, location, nil, []string{"$request_method", "return 405;"})
+				return
+			}
+			checkContains(t, location, []string{
+				"if ($request_method !~ ^(" + strings.Join(tt.want, "|") + ")$) {",
+				"add_header Allow '" + strings.Join(tt.want, ", ") + "' always;",
+				"return 405;",
+			}, nil)
+		})
+	}
+}
+
+func TestEmptyHostSkipped(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+	}{
+		{"empty", ""},
+		{"blank", "  "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			web := newTestContainer(t, "web", "172.18.0.2", hostLabels("web.test", nil))
+			broken := newTestContainer(t, "broken", "172.18.0.3", hostLabels("broken.test", nil))
+			broken.Config.Host = tt.host
+
+			config := generateTestConfig(t, DefaultGeneratorOptions(), web, broken)
+			var hosts []string
+			for _, server := range config.Servers {
+				hosts = append(hosts, server.ServerName)
+			}
+			if !reflect.DeepEqual(hosts, []string{"web.test"}) {
+				t.Errorf("servers = %v, want only web.test", hosts)
+			}
+			if names := upstreamNames(config); len(names) != 1 {
+				t.Errorf("upstreams = %v, want only web.test's", names)
+			}
+
+			rendered := renderTestConfig(t, DefaultGeneratorOptions(), web, broken)
+			checkContains(t, rendered, []string{"server_name web.test;", "172.18.0.2:80"}, []string{"server_name ;", "172.18.0.3"})
+		})
+	}
+}
+
+func TestProxySSLLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		wantErr string
+	}{
+		{"verify https", map[string]string{LabelProtocol: "https", LabelProxySSLVerify: "true"}, ""},
+		{"verify with CA", map[string]string{LabelProtocol: "https", LabelProxySSLVerify: "true", LabelProxySSLCA: "/etc/ssl/internal-ca.crt"}, ""},
+		{"verify http", map[string]string{LabelProxySSLVerify: "true"}, "proxy-ssl-verify requires protocol https"},
+		{"CA without verify", map[string]string{LabelProtocol: "https", LabelProxySSLCA: "/app/ca.pem"}, "proxy-ssl-ca requires proxy-ssl-verify"},
+		{"relative CA", map[string]string{LabelProtocol: "https", LabelProxySSLVerify: "true", LabelProxySSLCA: "ca.pem"}, "path must be absolute"},
+		{"CA traversal", map[string]string{LabelProtocol: "https", LabelProxySSLVerify: "true", LabelProxySSLCA: "/app/../etc/ca.pem"}, "path traversal not allowed"},
+		{"CA not a certificate", map[string]string{LabelProtocol: "https", LabelProxySSLVerify: "true", LabelProxySSLCA: "/app/ca.key"}, "only .pem and .crt files allowed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := validateTestLabels(hostLabels("app.test", tt.labels))
+			checkError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestProxySSLVerify(t *testing.T) {
+	ca, key := testCertificatePEM(t)
+	const caPath = "/app/ca.pem"
+
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		file     string // content of caPath in the container, if any
+		policy   SnippetFailurePolicy
+		wantErr  string
+		want     []string
+		unwanted []string
+	}{
+		{
+			name:     "verification off by default",
+			labels:   map[string]string{LabelProtocol: "https"},
+			want:     []string{"proxy_ssl_server_name on;"},
+			unwanted: []string{"proxy_ssl_verify", "proxy_ssl_trusted_certificate"},
+		},
+		{
+			name:   "system bundle",
+			labels: map[string]string{LabelProtocol: "https", LabelProxySSLVerify: "true"},
+			want:   []string{"proxy_ssl_verify on;", "proxy_ssl_trusted_certificate " + DefaultProxySSLTrustedCertificate + ";"},
+		},
+		{
+			name:     "CA from the container",
+			labels:   map[string]string{LabelProtocol: "https", LabelProxySSLVerify: "true", LabelProxySSLCA: caPath},
+			file:     string(ca),
+			want:     []string{"proxy_ssl_verify on;", "proxy_ssl_trusted_certificate CACHE/"},
+			unwanted: []string{DefaultProxySSLTrustedCertificate, "return 502"},
+		},
+		{
+			name:   "gRPC backend",
+			labels: map[string]string{LabelProtocol: "https", LabelBackendHTTP2: "true", LabelProxySSLVerify: "true"},
+			want:   []string{"grpc_ssl_verify on;", "grpc_ssl_trusted_certificate " + DefaultProxySSLTrustedCertificate + ";"},
+		},
+		{
+			name:   "missing CA fails open",
+			labels: map[string]string{LabelProtocol: "https", LabelProxySSLVerify: "true", LabelProxySSLCA: caPath},
+			want:   []string{"return 502"},
+		},
+		{
+			name:    "missing CA fails closed",
+			labels:  map[string]string{LabelProtocol: "https", LabelProxySSLVerify: "true", LabelProxySSLCA: caPath},
+			policy:  SnippetFailClosed,
+			wantErr: "failed to download backend CA for container app",
+		},
+		{
+			name:    "private key rejected",
+			labels:  map[string]string{LabelProtocol: "https", LabelProxySSLVerify: "true", LabelProxySSLCA: caPath},
+			file:    string(ca) + string(key),
+			policy:  SnippetFailClosed,
+			wantErr: "bundle contains a private key",
+		},
+		{
+			name:    "not PEM rejected",
+			labels:  map[string]string{LabelProtocol: "https", LabelProxySSLVerify: "true", LabelProxySSLCA: caPath},
+			file:    "not a certificate",
+			policy:  SnippetFailClosed,
+			wantErr: "not a PEM certificate bundle",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			container := newTestContainer(t, "app", "10.0.0.2", hostLabels("app.test", tt.labels))
+			docker := newFakeDocker()
+			if tt.file != "" {
+				docker.files[container.Config.ContainerID+":"+caPath] = tt.file
+			}
+			cacheDir := t.TempDir()
+			snippets := NewSnippetManager(docker, cacheDir)
+
+			opts := DefaultGeneratorOptions()
+			opts.ConfigurationSnippetPolicy = tt.policy
+			config, err := GenerateNginxConfigWithOptions([]*ContainerData{container}, snippets, nil, opts)
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+			rendered, err := RenderNginxConfig(config, testTemplatePath)
+			if err != nil {
+				t.Fatalf("RenderNginxConfig: %v", err)
+			}
+			location := strings.ReplaceAll(locationBlock(t, rendered, "/"), cacheDir, "CACHE")
+			checkContains(t, location, tt.want, tt.unwanted)
+
+			if trusted := config.Servers[0].Locations[0].ProxySSL.TrustedCertificate; strings.HasPrefix(trusted, cacheDir) {
+				if got, err := os.ReadFile(trusted); err != nil || strings.TrimSpace(string(got)) != strings.TrimSpace(tt.file) {
+					t.Errorf("cached CA = %q, %v; want the container's bundle", got, err)
+				}
+			}
+		})
+	}
+}
@@ -2,24 +2,26 @@ package docker
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/containerd/containerd/errdefs"
 	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/api/types/filters"
-	"github.com/docker/docker/client"
 	"github.com/menta2k/local-nginx-ingress/pkg/errors"
 )
 
 // Provider represents the Docker provider for nginx ingress
 type Provider struct {
-	client        *client.Client
+	client        DockerAPI
 	ctx           context.Context
 	cancel        context.CancelFunc
 	
@@ -28,11 +30,48 @@ type Provider struct {
 	nginxBinary     string
 	reloadCommand   []string
 	templatePath    string
+	commandTimeout  time.Duration
+	restartingGrace time.Duration
+	inspectConcurrency int
+	inspectCache    *InspectCache
+	configCache     *ConfigCache
+	labelDefaults   LabelDefaults
+	restartingSince map[string]time.Time // container ID -> first seen restarting
+	readinessMode   ReadinessMode
+	readinessTimeout time.Duration
+	readinessUntil  time.Time       // end of the startup window probing backends
+	readyBackends   map[string]bool // container IDs whose backend answered a probe
+	skipConfigTest  bool
+	labelMatchMode  LabelMatchMode
+	excludePatterns []string
+	emptyConfigMode EmptyConfigMode
+	invalidPolicy   InvalidContainerPolicy
+	watchNetworks   bool
+	filePerms       FilePermissions
+	labelFile       *LabelFile
+	logRendered     bool
+	configHistory   *ConfigHistory // nil unless a history directory is configured
+	generatorOpts   GeneratorOptions
 	
 	// State management
 	mu              sync.RWMutex
+	
+	// Reconciliation (list, generate, write, reload) runs one at a time under
+	// reconcileMu. Requests are numbered so callers that queued behind a
+	// reconcile started after their request share its result.
+	reconcileMu        sync.Mutex
+	reconcileRequests  atomic.Uint64
+	reconciledThrough  uint64 // requests covered by the last reconcile
+	lastReconcileErr   error
+	
 	containers      []*ContainerData
 	lastConfig      *NginxConfig
+	paused          bool // reconciliation frozen for maintenance
+	missedEvents    int  // events dropped while paused
+	invalidContainers []InvalidContainer // skipped by the last listing for invalid labels
+	reloadStatus    ReloadStatus
+	coalescedSinceReload int // events since the last event-triggered reload
+	eventDebounce   time.Duration
 	
 	// Snippet management
 	snippetManager  *SnippetManager
@@ -43,30 +82,91 @@ type Provider struct {
 	// Event handling
 	eventChan       <-chan events.Message
 	errorChan       <-chan error
+	resyncChan      <-chan struct{} // nil unless the Docker API can change without events
+	backends        BackendResolver // nil unless containers may need published ports
 	
 	// Callbacks
-	onConfigChange  func(*NginxConfig)
-	onError         func(error)
+	onConfigChange     func(*NginxConfig, ConfigDiff)
+	onError            func(error)
+	onContainerAdded   func(*ContainerData)
+	onContainerRemoved func(*ContainerData)
 	
 	// Error handling
 	errorHandler    *errors.ErrorHandler
 }
 
+// ReloadStatus records the outcome of applying configuration changes
+type ReloadStatus struct {
+	LastAttemptTime time.Time `json:"last_attempt_time"`
+	LastReloadTime  time.Time `json:"last_reload_time"` // last successful reload
+	LastReloadError string    `json:"last_reload_error,omitempty"`
+	SuccessCount    int       `json:"success_count"`
+	FailureCount    int       `json:"failure_count"`
+	
+	// Docker event counters: every received event either triggered a reload
+	// attempt or was coalesced (filtered, dropped, shared a debounced reload
+	// or left the config unchanged)
+	EventsReceived  int `json:"events_received"`
+	EventReloads    int `json:"event_reloads"`
+	EventsCoalesced int `json:"events_coalesced"`
+}
+
 // Config represents provider configuration
 type Config struct {
 	NginxConfigPath string
 	NginxBinary     string
 	ReloadCommand   []string
 	SnippetCacheDir string
+	DisableSnippetCache bool // Always fetch snippets fresh from containers
+	ServerSnippetPolicy        string // fail-open (default) or fail-closed when a server snippet can't be downloaded
+	ConfigurationSnippetPolicy string // fail-open (default) or fail-closed when a configuration snippet can't be downloaded
 	TemplatePath    string // Path to nginx configuration template
+	LabelMatchMode  string // Container matching: any (default), enable or host
+	ExcludeContainerPatterns []string // Glob patterns of container names to ignore
+	EmptyConfigMode string // With no enabled containers: empty (default), placeholder or keep
+	Resolver        string // DNS resolver for DNS-based upstreams (default: Docker DNS)
+	UpstreamResolveMode string // How upstream-host names are resolved: continuous (default) or once
+	CommandTimeout  time.Duration // Timeout for nginx -t and reload commands (default: 15s)
+	DockerTimeout   time.Duration // Timeout of each Docker list, inspect and info call (default: 10s)
+	InspectConcurrency int          // Containers inspected concurrently during reconciliation (default: 4)
+	RestartingGracePeriod time.Duration // How long a restarting container stays in its upstream marked down (default: 2m)
+	InvalidContainerPolicy string // Containers with invalid labels: warn (default) skips them, strict refuses the update
+	ReadinessMode   string        // Unreachable backends at startup: off (default), wait or mark-down
+	ReadinessTimeout time.Duration // How long startup waits for or probes backends (default: 1m)
+	SkipConfigTest  bool          // Skip nginx -t before reloading (faster, relies on generator validation)
+	WatchNetworkEvents bool       // Reconcile when networks are connected to or disconnected from containers
+	EventDebounce   time.Duration // How long an event needing a reload waits for more to share it (default: none)
+	FileMode        string        // Octal mode of the config, metadata and snippet cache files (default: 0644)
+	FileOwner       string        // uid[:gid] to chown written files to (default: unchanged)
+	LabelFile       string        // JSON or YAML file mapping container names to ingress labels (optional)
+	LogRenderedConfig bool        // Log the full rendered config every time a changed config is applied
+	ConfigHistoryDir  string      // Archive every applied config here with a timestamp (optional)
+	ConfigHistoryLimit int        // Archived configs kept in ConfigHistoryDir (default: 100)
+	BindAddress     string        // Address for listen directives (default: all interfaces)
+	ProxyProtocol   bool          // Accept the PROXY protocol on all listeners
+	TrustedProxies  []string      // Addresses/CIDRs allowed to set the real client IP
+	DisableTLS      bool          // Serve every host over HTTP only, e.g. when no default certificate exists
+	SSLProtocols    []string      // ssl_protocols for TLS hosts (default: TLSv1.2 TLSv1.3)
+	SSLCiphers      string        // ssl_ciphers for TLS hosts (default: HIGH:!aNULL:!MD5)
+	DefaultCertPath string        // Fallback certificate of TLS hosts (default: /etc/nginx/ssl/default.crt)
+	DefaultKeyPath  string        // Key of DefaultCertPath (default: /etc/nginx/ssl/default.key)
+	ProxyCacheDir   string        // Parent directory of proxy cache zones (default: /var/cache/nginx/ingress)
+	UpstreamZoneSize string       // Shared memory zone size added to every upstream (default: none)
+	DefaultBackendStatus int      // Status for unmatched paths on hosts without a / location (default: 404)
+	DisableDefaultBackend bool    // Don't generate a / location for hosts without one
+	RetryAfter      int           // Retry-After seconds of the 503 page for hosts with all backends down (default: 30, -1 disables)
+	LabelDefaults   LabelDefaults // Protocol, port, path and priority for containers omitting those labels
+	Resilience      errors.ResilienceConfig // Retry and circuit breaker overrides (default: 3 attempts 5s apart)
 	
 	// Callbacks
-	OnConfigChange func(*NginxConfig)
-	OnError        func(error)
+	OnConfigChange     func(*NginxConfig, ConfigDiff) // Called with the applied config and what changed
+	OnError            func(error)
+	OnContainerAdded   func(*ContainerData) // Container newly managed by the controller
+	OnContainerRemoved func(*ContainerData) // Container no longer managed
 }
 
 // NewProvider creates a new Docker provider
-func NewProvider(dockerClient *client.Client, config Config) (*Provider, error) {
+func NewProvider(dockerClient DockerAPI, config Config) (*Provider, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	
 	// Set defaults
@@ -85,11 +185,172 @@ func NewProvider(dockerClient *client.Client, config Config) (*Provider, error)
 	if config.TemplatePath == "" {
 		config.TemplatePath = "templates/nginx.conf.tmpl"
 	}
+	if config.CommandTimeout <= 0 {
+		config.CommandTimeout = 15 * time.Second
+	}
+	if config.DockerTimeout <= 0 {
+		config.DockerTimeout = DefaultDockerTimeout
+	}
+	var resyncChan <-chan struct{}
+	if notifier, ok := dockerClient.(resyncNotifier); ok {
+		resyncChan = notifier.Resync()
+	}
+	backends, _ := dockerClient.(BackendResolver)
+	dockerClient = WithTimeout(dockerClient, config.DockerTimeout)
+	if config.InspectConcurrency <= 0 {
+		config.InspectConcurrency = 4
+	}
+	if config.RestartingGracePeriod <= 0 {
+		config.RestartingGracePeriod = 2 * time.Minute
+	}
+	if config.ReadinessTimeout <= 0 {
+		config.ReadinessTimeout = DefaultReadinessTimeout
+	}
+	
+	labelMatchMode, err := ParseLabelMatchMode(config.LabelMatchMode)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	
+	filePerms := DefaultFilePermissions()
+	if filePerms.Mode, err = ParseFileMode(config.FileMode); err != nil {
+		cancel()
+		return nil, err
+	}
+	if filePerms.UID, filePerms.GID, err = ParseFileOwner(config.FileOwner); err != nil {
+		cancel()
+		return nil, err
+	}
+	
+	var labelFile *LabelFile
+	if config.LabelFile != "" {
+		if labelFile, err = NewLabelFile(config.LabelFile); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+	
+	var configHistory *ConfigHistory
+	if config.ConfigHistoryDir != "" {
+		configHistory = NewConfigHistory(config.ConfigHistoryDir, config.NginxConfigPath, config.ConfigHistoryLimit, filePerms)
+	}
+	
+	if err := config.LabelDefaults.Validate(); err != nil {
+		cancel()
+		return nil, err
+	}
+	
+	if err := ValidateExcludePatterns(config.ExcludeContainerPatterns); err != nil {
+		cancel()
+		return nil, err
+	}
+	
+	emptyConfigMode, err := ParseEmptyConfigMode(config.EmptyConfigMode)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	
+	readinessMode, err := ParseReadinessMode(config.ReadinessMode)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	
+	invalidPolicy, err := ParseInvalidContainerPolicy(config.InvalidContainerPolicy)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	
+	generatorOpts := DefaultGeneratorOptions()
+	if config.Resolver != "" {
+		generatorOpts.Resolver = config.Resolver
+	}
+	if err := ValidateTrustedProxies(config.TrustedProxies); err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := ValidateBindAddress(config.BindAddress); err != nil {
+		cancel()
+		return nil, err
+	}
+	generatorOpts.BindAddress = config.BindAddress
+	generatorOpts.ProxyProtocol = config.ProxyProtocol
+	generatorOpts.DisableTLS = config.DisableTLS
+	if generatorOpts.UpstreamResolve, err = ParseUpstreamResolveMode(config.UpstreamResolveMode); err != nil {
+		cancel()
+		return nil, err
+	}
+	generatorOpts.TrustedProxies = config.TrustedProxies
+	if len(config.SSLProtocols) > 0 {
+		if err := ValidateSSLProtocols(config.SSLProtocols); err != nil {
+			cancel()
+			return nil, err
+		}
+		generatorOpts.SSLProtocols = config.SSLProtocols
+	}
+	for _, path := range []string{config.DefaultCertPath, config.DefaultKeyPath} {
+		if path != "" && !filepath.IsAbs(path) {
+			cancel()
+			return nil, fmt.Errorf("default certificate path %q must be absolute", path)
+		}
+	}
+	if config.DefaultCertPath != "" {
+		generatorOpts.DefaultCertPath = config.DefaultCertPath
+	}
+	if config.DefaultKeyPath != "" {
+		generatorOpts.DefaultKeyPath = config.DefaultKeyPath
+	}
+	if err := ValidateProxyCacheDir(config.ProxyCacheDir); err != nil {
+		cancel()
+		return nil, err
+	}
+	if config.ProxyCacheDir != "" {
+		generatorOpts.ProxyCacheDir = config.ProxyCacheDir
+	}
+	if config.DefaultBackendStatus != 0 {
+		if config.DefaultBackendStatus < 200 || config.DefaultBackendStatus > 599 {
+			cancel()
+			return nil, fmt.Errorf("invalid default backend status %d", config.DefaultBackendStatus)
+		}
+		generatorOpts.DefaultBackendStatus = config.DefaultBackendStatus
+	}
+	if config.DisableDefaultBackend {
+		generatorOpts.DefaultBackendStatus = 0
+	}
+	if config.RetryAfter != 0 {
+		generatorOpts.RetryAfter = config.RetryAfter
+	}
+	if generatorOpts.ServerSnippetPolicy, err = ParseSnippetFailurePolicy(config.ServerSnippetPolicy); err != nil {
+		cancel()
+		return nil, err
+	}
+	if generatorOpts.ConfigurationSnippetPolicy, err = ParseSnippetFailurePolicy(config.ConfigurationSnippetPolicy); err != nil {
+		cancel()
+		return nil, err
+	}
+	if config.UpstreamZoneSize != "" {
+		if !isValidNginxSize(config.UpstreamZoneSize) {
+			cancel()
+			return nil, fmt.Errorf("invalid upstream zone size %q, e.g. 64k", config.UpstreamZoneSize)
+		}
+		generatorOpts.UpstreamZoneSize = config.UpstreamZoneSize
+	}
+	if config.SSLCiphers != "" {
+		if err := ValidateSSLCiphers(config.SSLCiphers); err != nil {
+			cancel()
+			return nil, err
+		}
+		generatorOpts.SSLCiphers = config.SSLCiphers
+	}
 	
 	// Create error handler for provider operations
 	errorHandler := errors.NewErrorHandler()
 	errorHandler.SetExitOnCritical(false) // Allow graceful recovery
 	errorHandler.SetRetryConfig(3, 5*time.Second)
+	errorHandler.ApplyResilienceConfig(config.Resilience)
 	
 	provider := &Provider{
 		client:          dockerClient,
@@ -99,13 +360,47 @@ func NewProvider(dockerClient *client.Client, config Config) (*Provider, error)
 		nginxBinary:     config.NginxBinary,
 		reloadCommand:   config.ReloadCommand,
 		templatePath:    config.TemplatePath,
+		commandTimeout:  config.CommandTimeout,
+		restartingGrace: config.RestartingGracePeriod,
+		inspectConcurrency: config.InspectConcurrency,
+		inspectCache:    NewInspectCache(),
+		configCache:     NewConfigCache(),
+		labelDefaults:   config.LabelDefaults,
+		restartingSince: make(map[string]time.Time),
+		skipConfigTest:  config.SkipConfigTest,
+		labelMatchMode:  labelMatchMode,
+		excludePatterns: config.ExcludeContainerPatterns,
+		emptyConfigMode: emptyConfigMode,
+		invalidPolicy:   invalidPolicy,
+		readinessMode:   readinessMode,
+		readinessTimeout: config.ReadinessTimeout,
+		readyBackends:   make(map[string]bool),
+		watchNetworks:   config.WatchNetworkEvents,
+		eventDebounce:   config.EventDebounce,
+		filePerms:       filePerms,
+		labelFile:       labelFile,
+		logRendered:     config.LogRenderedConfig,
+		configHistory:   configHistory,
+		resyncChan:      resyncChan,
+		backends:        backends,
+		generatorOpts:   generatorOpts,
 		onConfigChange:  config.OnConfigChange,
 		onError:         config.OnError,
+		onContainerAdded:   config.OnContainerAdded,
+		onContainerRemoved: config.OnContainerRemoved,
 		snippetManager:  NewSnippetManager(dockerClient, config.SnippetCacheDir),
 		fastcgiManager:  NewFastCGIParameterManager(dockerClient, config.SnippetCacheDir),
 		errorHandler:    errorHandler,
 	}
 	
+	provider.snippetManager.SetFilePermissions(filePerms)
+	provider.fastcgiManager.snippetManager.SetFilePermissions(filePerms)
+	
+	if config.DisableSnippetCache {
+		provider.snippetManager.SetCacheEnabled(false)
+		provider.fastcgiManager.snippetManager.SetCacheEnabled(false)
+	}
+	
 	return provider, nil
 }
 
@@ -115,12 +410,25 @@ func (p *Provider) Start() error {
 	
 	log.Println("Starting Docker nginx-ingress provider...")
 	
+	// An existing config on disk is the baseline nginx is already serving
+	hasBaseline := p.hasExistingConfig()
+	if hasBaseline {
+		log.Printf("Found existing nginx configuration at %s, keeping it until a new one is applied", p.nginxConfigPath)
+	}
+	
+	// Backends are probed during this window in mark-down mode
+	p.readinessUntil = time.Now().Add(p.readinessTimeout)
+	
 	// Initial configuration load with retry
 	if err := p.errorHandler.HandleWithRetry(func() error {
 		return p.loadConfiguration()
 	}, "provider", "loading initial configuration"); err != nil {
-		p.errorHandler.Critical("Failed to load initial configuration after retries", err, "provider")
-		return fmt.Errorf("failed to load initial configuration: %w", err)
+		if !hasBaseline {
+			p.errorHandler.Critical("Failed to load initial configuration after retries", err, "provider")
+			return fmt.Errorf("failed to load initial configuration: %w", err)
+		}
+		// Keep serving the last-good config; the next Docker event retries
+		p.errorHandler.Warning("Failed to load initial configuration, keeping existing config", err, "provider")
 	}
 	
 	// Start event monitoring with retry
@@ -134,6 +442,13 @@ func (p *Provider) Start() error {
 	// Start event processing loop
 	go p.processEvents()
 	
+	if p.labelFile != nil {
+		go p.watchLabelFile()
+	}
+	if p.readinessMode == ReadinessMarkDown {
+		go p.watchReadiness()
+	}
+	
 	log.Println("Docker nginx-ingress provider started successfully")
 	p.errorHandler.Info("Docker provider started successfully", "provider")
 	return nil
@@ -149,23 +464,227 @@ func (p *Provider) Stop() error {
 	return nil
 }
 
-// loadConfiguration loads the current container configuration
+// listOptions returns how containers are listed and matched
+func (p *Provider) listOptions() ListOptions {
+	return ListOptions{
+		MatchMode:       p.labelMatchMode,
+		FileLabels:      p.labelFile.Labels(),
+		ExcludePatterns: p.excludePatterns,
+		Defaults:        p.labelDefaults,
+		InspectConcurrency: p.inspectConcurrency,
+		InspectCache:    p.inspectCache,
+		Backends:        p.backends,
+	}
+}
+
+// loadConfiguration reconciles nginx with the current containers. Calls are
+// serialized, and a call that waited while another reconcile started after it
+// was requested returns that reconcile's result instead of running again.
 func (p *Provider) loadConfiguration() error {
+	requested := p.reconcileRequests.Add(1)
+	
+	p.reconcileMu.Lock()
+	defer p.reconcileMu.Unlock()
+	
+	if requested <= p.reconciledThrough {
+		return p.lastReconcileErr
+	}
+	
+	through := p.reconcileRequests.Load()
+	err := p.reconcile()
+	p.reconciledThrough, p.lastReconcileErr = through, err
+	return err
+}
+
+// reconcile lists containers and applies the resulting configuration. It
+// must be called with reconcileMu held.
+func (p *Provider) reconcile() error {
 	defer errors.Recover("docker-provider")
 	
-	containers, err := ListContainers(p.ctx, p.client)
+	containers, invalid, err := listContainers(p.ctx, p.client, p.listOptions())
 	if err != nil {
-		p.errorHandler.Error("Failed to list containers", err, "provider")
+		p.mu.RLock()
+		known := len(p.containers)
+		p.mu.RUnlock()
+		p.errorHandler.ErrorWithContext("Failed to list containers", err, "provider", map[string]interface{}{
+			"action":           "list",
+			"known_containers": known,
+		})
 		return fmt.Errorf("failed to list containers: %w", err)
 	}
 	
 	p.mu.Lock()
+	p.invalidContainers = invalid
+	p.mu.Unlock()
+	if len(invalid) > 0 && p.invalidPolicy == InvalidContainerStrict {
+		names := make([]string, len(invalid))
+		for i, container := range invalid {
+			names[i] = container.ContainerName
+		}
+		return fmt.Errorf("refusing to update, %d container(s) with invalid configuration: %s", len(invalid), strings.Join(names, ", "))
+	}
+	
+	containers = p.keepRestarting(containers)
+	p.markUnready(containers)
+	
+	p.mu.Lock()
+	ipChanges := detectIPChanges(p.containers, containers)
+	added, removed := diffContainers(p.containers, containers)
 	p.containers = containers
 	p.mu.Unlock()
 	
+	// A moved backend renders a different upstream server, so the config
+	// comparison in updateNginxConfig applies it without further help
+	
+	for _, change := range ipChanges {
+		log.Printf("Backend IP changed: %s", change)
+	}
+	
+	for _, container := range added {
+		log.Printf("Container %s is now managed (%s%s)", container.Config.ContainerName, container.Config.Host, container.Config.Path)
+		if p.onContainerAdded != nil {
+			p.onContainerAdded(container)
+		}
+	}
+	for _, container := range removed {
+		log.Printf("Container %s is no longer managed", container.Config.ContainerName)
+		if p.onContainerRemoved != nil {
+			p.onContainerRemoved(container)
+		}
+	}
+	
+	p.pruneSnippetCache(containers)
+	
 	return p.updateNginxConfig()
 }
 
+// keepRestarting adds tracked containers missing from a fresh listing back
+// as restarting, with their backend marked down, while Docker reports them
+// restarting and the grace period hasn't passed. This avoids removing and
+// re-adding crash-looping backends on every restart.
+func (p *Provider) keepRestarting(current []*ContainerData) []*ContainerData {
+	p.mu.RLock()
+	previous := make([]*ContainerData, len(p.containers))
+	copy(previous, p.containers)
+	p.mu.RUnlock()
+	
+	listed := make(map[string]bool, len(current))
+	for _, container := range current {
+		listed[container.Config.ContainerID] = true
+	}
+	
+	now := time.Now()
+	seen := make(map[string]bool)
+	for _, container := range previous {
+		id := container.Config.ContainerID
+		if listed[id] {
+			continue
+		}
+		
+		containerJSON, err := p.client.ContainerInspect(p.ctx, id)
+		if err != nil || containerJSON.State == nil || !containerJSON.State.Restarting {
+			continue
+		}
+		
+		p.mu.Lock()
+		since, exists := p.restartingSince[id]
+		if !exists {
+			since = now
+			p.restartingSince[id] = now
+		}
+		p.mu.Unlock()
+		
+		if now.Sub(since) > p.restartingGrace {
+			log.Printf("Container %s still restarting after %s, removing it", container.Config.ContainerName, p.restartingGrace)
+			continue
+		}
+		
+		seen[id] = true
+		kept := *container
+		kept.Restarting = true
+		current = append(current, &kept)
+		log.Printf("Container %s is restarting, keeping its backend marked down", container.Config.ContainerName)
+	}
+	
+	// Forget containers that stabilized or are gone for good
+	p.mu.Lock()
+	for id := range p.restartingSince {
+		if !seen[id] {
+			delete(p.restartingSince, id)
+		}
+	}
+	p.mu.Unlock()
+	
+	return current
+}
+
+// detectIPChanges compares tracked containers against a fresh listing and
+// describes every container whose IP address changed. Containers are matched
+// by ID first and by name otherwise, so a recreated container is detected too.
+func detectIPChanges(previous, current []*ContainerData) []string {
+	byID := make(map[string]*ContainerData, len(previous))
+	byName := make(map[string]*ContainerData, len(previous))
+	for _, container := range previous {
+		byID[container.Config.ContainerID] = container
+		byName[container.Config.ContainerName] = container
+	}
+	
+	var changes []string
+	for _, container := range current {
+		old, exists := byID[container.Config.ContainerID]
+		if !exists {
+			old, exists = byName[container.Config.ContainerName]
+		}
+		if !exists || old.IPAddress == container.IPAddress {
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("%s %s -> %s",
+			container.Config.ContainerName, old.IPAddress, container.IPAddress))
+	}
+	
+	return changes
+}
+
+// diffContainers returns the containers present only in current (added) and
+// only in previous (removed), matched by container ID
+func diffContainers(previous, current []*ContainerData) (added, removed []*ContainerData) {
+	previousIDs := make(map[string]bool, len(previous))
+	for _, container := range previous {
+		previousIDs[container.Config.ContainerID] = true
+	}
+	currentIDs := make(map[string]bool, len(current))
+	for _, container := range current {
+		currentIDs[container.Config.ContainerID] = true
+		if !previousIDs[container.Config.ContainerID] {
+			added = append(added, container)
+		}
+	}
+	for _, container := range previous {
+		if !currentIDs[container.Config.ContainerID] {
+			removed = append(removed, container)
+		}
+	}
+	
+	return added, removed
+}
+
+// pruneSnippetCache drops cached snippets for containers that are no longer running
+func (p *Provider) pruneSnippetCache(containers []*ContainerData) {
+	activeIDs := make([]string, 0, len(containers))
+	for _, container := range containers {
+		activeIDs = append(activeIDs, container.Config.ContainerID)
+	}
+	
+	removed, err := p.snippetManager.PruneCache(activeIDs)
+	if err != nil {
+		p.errorHandler.Warning("Failed to prune snippet cache", err, "provider")
+		return
+	}
+	if removed > 0 {
+		log.Printf("Pruned %d stale snippet cache entries", removed)
+	}
+}
+
 // startEventMonitoring starts monitoring Docker events
 func (p *Provider) startEventMonitoring() error {
 	// Create event filters for container events
@@ -175,6 +694,12 @@ func (p *Provider) startEventMonitoring() error {
 	eventFilters.Add("event", "stop")
 	eventFilters.Add("event", "die")
 	eventFilters.Add("event", "destroy")
+	if p.watchNetworks {
+		// Attaching or detaching a network changes a container's routable IP
+		eventFilters.Add("type", "network")
+		eventFilters.Add("event", "connect")
+		eventFilters.Add("event", "disconnect")
+	}
 	
 	// Start listening for events
 	eventChan, errorChan := p.client.Events(p.ctx, events.ListOptions{
@@ -187,21 +712,50 @@ func (p *Provider) startEventMonitoring() error {
 	return nil
 }
 
+// DefaultEventDebounce is the event debounce window used by the controller
+const DefaultEventDebounce = 500 * time.Millisecond
+
 // processEvents processes Docker events
 func (p *Provider) processEvents() {
 	defer errors.Recover("docker-provider")
 	
 	log.Println("Starting Docker event processing...")
 	
+	// Events needing a reload wait up to eventDebounce for more, so a burst
+	// such as a compose up triggers a single reload
+	pending := 0
+	var flush <-chan time.Time
+	
 	for {
 		select {
 		case event := <-p.eventChan:
-			if err := p.handleDockerEvent(event); err != nil {
-				p.errorHandler.Warning("Error handling Docker event", err, "provider")
-				if p.onError != nil {
-					p.onError(err)
+			needsReload := false
+			if !p.dropIfPaused(event) {
+				var err error
+				if needsReload, err = p.eventNeedsReload(event); err != nil {
+					p.errorHandler.WarningWithContext("Error handling Docker event", err, "provider", p.eventContext(event))
+					if p.onError != nil {
+						p.onError(err)
+					}
 				}
 			}
+			if !needsReload {
+				p.countEvents(1, false)
+				continue
+			}
+			
+			pending++
+			if p.eventDebounce <= 0 {
+				p.reloadForEvents(pending)
+				pending = 0
+			} else if flush == nil {
+				flush = time.After(p.eventDebounce)
+			}
+			
+		case <-flush:
+			flush = nil
+			p.reloadForEvents(pending)
+			pending = 0
 			
 		case err := <-p.errorChan:
 			if err != nil {
@@ -220,6 +774,12 @@ func (p *Provider) processEvents() {
 				}
 			}
 			
+		case <-p.resyncChan:
+			log.Println("Docker hosts changed, reloading configuration")
+			if err := p.loadConfiguration(); err != nil {
+				p.errorHandler.Warning("Failed to reload configuration after Docker host change", err, "provider")
+			}
+			
 		case <-p.ctx.Done():
 			log.Println("Stopping Docker event processing...")
 			p.errorHandler.Info("Docker event processing stopped", "provider")
@@ -228,10 +788,160 @@ func (p *Provider) processEvents() {
 	}
 }
 
-// handleDockerEvent handles a single Docker event
-func (p *Provider) handleDockerEvent(event events.Message) error {
+// reloadAttempts returns the number of reload attempts so far
+func (p *Provider) reloadAttempts() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.reloadStatus.SuccessCount + p.reloadStatus.FailureCount
+}
+
+// reloadForEvents reconciles once for a number of Docker events needing a reload
+func (p *Provider) reloadForEvents(events int) {
+	attempts := p.reloadAttempts()
+	if err := p.loadConfiguration(); err != nil {
+		p.errorHandler.Warning("Failed to reload configuration after Docker events", err, "provider")
+		if p.onError != nil {
+			p.onError(err)
+		}
+	}
+	p.countEvents(events, p.reloadAttempts() != attempts)
+}
+
+// countEvents records handled Docker events and whether they triggered a
+// reload. Of events sharing one reload, all but one count as coalesced.
+func (p *Provider) countEvents(events int, reloaded bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	p.reloadStatus.EventsReceived += events
+	if !reloaded {
+		p.reloadStatus.EventsCoalesced += events
+		p.coalescedSinceReload += events
+		return
+	}
+	p.reloadStatus.EventReloads++
+	p.reloadStatus.EventsCoalesced += events - 1
+	p.coalescedSinceReload += events - 1
+	log.Printf("Docker events triggered a reload (%d events coalesced since the last one; totals: %d received, %d reloads, %d coalesced)",
+		p.coalescedSinceReload, p.reloadStatus.EventsReceived, p.reloadStatus.EventReloads, p.reloadStatus.EventsCoalesced)
+	p.coalescedSinceReload = 0
+}
+
+// labelFilePollInterval is how often the label file is checked for changes
+const labelFilePollInterval = 5 * time.Second
+
+// watchLabelFile reloads the configuration whenever the label file changes
+func (p *Provider) watchLabelFile() {
+	defer errors.Recover("docker-provider")
+	
+	ticker := time.NewTicker(labelFilePollInterval)
+	defer ticker.Stop()
+	
+	for {
+		select {
+		case <-ticker.C:
+			changed, err := p.labelFile.Refresh()
+			if err != nil {
+				p.errorHandler.Warning("Failed to reload label file", err, "provider")
+				continue
+			}
+			if !changed || p.IsPaused() {
+				continue
+			}
+			log.Println("Label file changed, reloading configuration")
+			if err := p.loadConfiguration(); err != nil && p.onError != nil {
+				p.onError(err)
+			}
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+// dropIfPaused reports whether the provider is paused, counting the event as
+// missed so Resume knows a reconcile is due
+func (p *Provider) dropIfPaused(event events.Message) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	if !p.paused {
+		return false
+	}
+	p.missedEvents++
+	log.Printf("Provider paused, ignoring %s event for container %s", event.Action, event.Actor.Attributes["name"])
+	return true
+}
+
+// Pause stops reacting to Docker events and applying configuration until
+// Resume is called. nginx keeps serving the current configuration.
+func (p *Provider) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	if p.paused {
+		return
+	}
+	p.paused = true
+	p.missedEvents = 0
+	log.Println("Provider paused, reconciliation is frozen")
+	p.errorHandler.Info("Provider paused", "provider")
+}
+
+// Resume unfreezes reconciliation and reconciles once to pick up anything
+// that changed while paused
+func (p *Provider) Resume() error {
+	p.mu.Lock()
+	if !p.paused {
+		p.mu.Unlock()
+		return nil
+	}
+	p.paused = false
+	missed := p.missedEvents
+	p.missedEvents = 0
+	p.mu.Unlock()
+	
+	log.Printf("Provider resumed after ignoring %d events, reconciling", missed)
+	p.errorHandler.Info("Provider resumed", "provider")
+	return p.loadConfiguration()
+}
+
+// Quiesce pauses reconciliation and waits up to timeout for a configuration
+// update already in flight (write, test, reload) to finish, so nginx can be
+// stopped without a reload racing it. It reports whether the provider is idle.
+func (p *Provider) Quiesce(timeout time.Duration) bool {
+	p.Pause()
+	
+	idle := make(chan struct{})
+	go func() {
+		p.reconcileMu.Lock()
+		p.reconcileMu.Unlock()
+		close(idle)
+	}()
+	
+	select {
+	case <-idle:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// IsPaused reports whether reconciliation is paused
+func (p *Provider) IsPaused() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.paused
+}
+
+// eventNeedsReload handles a single Docker event and reports whether it
+// affects the configuration
+func (p *Provider) eventNeedsReload(event events.Message) (bool, error) {
 	defer errors.Recover("docker-provider")
 	
+	if event.Type == events.NetworkEventType {
+		return p.networkEventNeedsReload(event)
+	}
+	
 	containerID := event.Actor.ID
 	containerName := event.Actor.Attributes["name"]
 	action := string(event.Action)
@@ -245,17 +955,19 @@ func (p *Provider) handleDockerEvent(event events.Message) error {
 		containerJSON, err := p.client.ContainerInspect(p.ctx, containerID)
 		if err != nil {
 			if errdefs.IsNotFound(err) {
-				p.errorHandler.Warning("Container not found during start event", err, "provider")
-				return nil
+				p.errorHandler.WarningWithContext("Container not found during start event", err, "provider", p.eventContext(event))
+				return false, nil
 			}
 			inspectErr := fmt.Errorf("failed to inspect container %s: %w", containerID, err)
-			p.errorHandler.Error("Failed to inspect container", inspectErr, "provider")
-			return inspectErr
+			p.errorHandler.ErrorWithContext("Failed to inspect container", inspectErr, "provider", p.eventContext(event))
+			return false, inspectErr
 		}
 		
-		if hasNginxLabels(containerJSON.Config.Labels) {
+		labels := mergeLabels(p.labelFile.Labels()[containerName], containerJSON.Config.Labels)
+		if hasNginxLabels(labels, p.labelMatchMode) &&
+			!isExcluded(containerName, p.excludePatterns) {
 			log.Printf("Container %s has nginx ingress labels, reloading configuration", containerName)
-			return p.loadConfiguration()
+			return true, nil
 		}
 		
 	case "stop", "die", "destroy":
@@ -272,63 +984,136 @@ func (p *Provider) handleDockerEvent(event events.Message) error {
 		
 		if needsUpdate {
 			log.Printf("Container %s with nginx ingress labels stopped, reloading configuration", containerName)
-			return p.loadConfiguration()
+			return true, nil
 		}
 	}
 	
-	return nil
+	return false, nil
 }
 
-// updateNginxConfig generates and applies new nginx configuration
-func (p *Provider) updateNginxConfig() error {
-	defer errors.Recover("docker-provider")
+// networkEventNeedsReload reports a reload when a network is connected to a
+// labeled container or disconnected from a tracked one. For network events
+// the actor is the network and the container ID is an attribute.
+func (p *Provider) networkEventNeedsReload(event events.Message) (bool, error) {
+	containerID := event.Actor.Attributes["container"]
+	networkName := event.Actor.Attributes["name"]
+	if containerID == "" {
+		return false, nil
+	}
 	
 	p.mu.RLock()
-	containers := make([]*ContainerData, len(p.containers))
-	copy(containers, p.containers)
+	tracked := false
+	for _, container := range p.containers {
+		if container.Config.ContainerID == containerID {
+			tracked = true
+			break
+		}
+	}
 	p.mu.RUnlock()
 	
-	// Filter only enabled containers
-	enabledContainers := FilterEnabledContainers(containers)
+	if !tracked && event.Action == events.ActionConnect {
+		containerJSON, err := p.client.ContainerInspect(p.ctx, containerID)
+		if err != nil {
+			if errdefs.IsNotFound(err) {
+				return false, nil
+			}
+			return false, fmt.Errorf("failed to inspect container %s: %w", containerID, err)
+		}
+		tracked = containerJSON.Config != nil && hasNginxLabels(containerJSON.Config.Labels, p.labelMatchMode)
+	}
+	
+	if !tracked {
+		return false, nil
+	}
+	
+	log.Printf("Network %s %sed for container %s, reloading configuration", networkName, event.Action, containerID)
+	return true, nil
+}
+
+// eventContext builds structured error context for a Docker event, including
+// the routed host when the container is already known
+func (p *Provider) eventContext(event events.Message) map[string]interface{} {
+	context := map[string]interface{}{
+		"container_id":   event.Actor.ID,
+		"container_name": event.Actor.Attributes["name"],
+		"action":         string(event.Action),
+	}
+	
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, container := range p.containers {
+		if container.Config.ContainerID == event.Actor.ID {
+			context["host"] = container.Config.Host
+			break
+		}
+	}
 	
-	log.Printf("Generating nginx configuration for %d containers", len(enabledContainers))
+	return context
+}
+
+// updateNginxConfig generates and applies new nginx configuration. It must
+// be called with reconcileMu held.
+func (p *Provider) updateNginxConfig() error {
+	defer errors.Recover("docker-provider")
+	
+	if p.IsPaused() {
+		log.Println("Provider paused, skipping configuration update")
+		return nil
+	}
 	
-	// Generate nginx configuration with snippet support
-	config, err := GenerateNginxConfig(enabledContainers, p.snippetManager, p.fastcgiManager)
+	config, err := p.generateConfig()
 	if err != nil {
-		generateErr := fmt.Errorf("failed to generate nginx config: %w", err)
-		p.errorHandler.Error("Failed to generate nginx configuration", generateErr, "provider")
-		return generateErr
+		return err
 	}
 	
-	// Validate configuration
-	if err := ValidateNginxConfig(config); err != nil {
-		validateErr := fmt.Errorf("invalid nginx config: %w", err)
-		p.errorHandler.Error("Invalid nginx configuration generated", validateErr, "provider")
-		return validateErr
+	if len(config.Servers) == 0 && p.emptyConfigMode == EmptyConfigKeep && p.hasExistingConfig() {
+		log.Println("No enabled containers, keeping previous configuration")
+		p.errorHandler.Info("No enabled containers, keeping previous configuration", "provider")
+		return nil
 	}
 	
 	// Check if configuration changed
-	if p.configEquals(config, p.lastConfig) {
+	p.mu.RLock()
+	previousConfig := p.lastConfig
+	p.mu.RUnlock()
+	
+	if p.configEquals(config, previousConfig) {
 		log.Println("Configuration unchanged, skipping update")
 		p.errorHandler.Info("Configuration unchanged, skipping update", "provider")
 		return nil
 	}
 	
+	// Remember the current config so a failed test doesn't leave nginx
+	// pointing at a broken file
+	previous, readErr := os.ReadFile(p.nginxConfigPath)
+	if readErr != nil {
+		previous = nil
+	}
+	
 	// Write configuration to file with retry
+	var rendered string
 	if err := p.errorHandler.HandleWithRetry(func() error {
-		return p.writeConfigFile(config)
+		var writeErr error
+		rendered, writeErr = p.writeConfigFile(config)
+		return writeErr
 	}, "provider", "writing nginx configuration file"); err != nil {
 		p.errorHandler.Error("Failed to write config file after retries", err, "provider")
-		return fmt.Errorf("failed to write config file: %w", err)
+		writeErr := fmt.Errorf("failed to write config file: %w", err)
+		p.recordReload(writeErr)
+		return writeErr
 	}
 	
-	// Test nginx configuration with retry
-	if err := p.errorHandler.HandleWithRetry(func() error {
+	// Test nginx configuration with retry, unless disabled for speed
+	if p.skipConfigTest {
+		log.Println("Skipping nginx configuration test")
+	} else if err := p.errorHandler.HandleWithRetry(func() error {
 		return p.testNginxConfig()
 	}, "provider", "testing nginx configuration"); err != nil {
 		p.errorHandler.Error("Nginx configuration test failed after retries", err, "provider")
-		return fmt.Errorf("nginx config test failed: %w", err)
+		p.restoreConfigFile(previous)
+		testErr := fmt.Errorf("nginx config test failed: %w", err)
+		p.recordReload(testErr)
+		return testErr
 	}
 	
 	// Reload nginx with retry
@@ -336,57 +1121,244 @@ func (p *Provider) updateNginxConfig() error {
 		return p.reloadNginx()
 	}, "provider", "reloading nginx"); err != nil {
 		p.errorHandler.Error("Failed to reload nginx after retries", err, "provider")
-		return fmt.Errorf("failed to reload nginx: %w", err)
+		if p.skipConfigTest {
+			// The config was never tested, so it may be what broke the reload
+			p.restoreConfigFile(previous)
+		}
+		reloadErr := fmt.Errorf("failed to reload nginx: %w", err)
+		p.recordReload(reloadErr)
+		return reloadErr
 	}
 	
 	p.mu.Lock()
 	p.lastConfig = config
 	p.mu.Unlock()
+	p.recordReload(nil)
+	
+	diff := DiffConfigs(previousConfig, config)
+	log.Printf("Configuration changes:\n%s", diff)
+	
+	if err := p.writeConfigMetadata(config); err != nil {
+		p.errorHandler.Warning("Failed to write config metadata", err, "provider")
+	}
+	p.recordRenderedConfig(rendered)
 	
 	log.Println("Nginx configuration updated successfully")
 	p.errorHandler.Info("Nginx configuration updated successfully", "provider")
 	
 	// Notify callback
 	if p.onConfigChange != nil {
-		p.onConfigChange(config)
+		p.onConfigChange(config, diff)
 	}
 	
 	return nil
 }
 
-// writeConfigFile writes the nginx configuration to file
-func (p *Provider) writeConfigFile(config *NginxConfig) error {
+// generateConfig generates and validates nginx configuration for the
+// currently tracked containers without applying it
+func (p *Provider) generateConfig() (*NginxConfig, error) {
+	containers := FilterEnabledContainers(p.GetContainers())
+	
+	log.Printf("Generating nginx configuration for %d containers", len(containers))
+	
+	config, err := p.buildConfig(containers, p.snippetManager, p.fastcgiManager, p.configCache)
+	if err != nil {
+		p.errorHandler.Error("Failed to generate nginx configuration", err, "provider")
+		return nil, err
+	}
+	reused, regenerated := p.configCache.stats()
+	log.Printf("Regenerated %d hosts, reused %d unchanged", regenerated, reused)
+	return config, nil
+}
+
+// buildConfig generates and validates the nginx configuration of containers,
+// fetching snippets and FastCGI params through the given managers and
+// reusing unchanged hosts from cache unless it's nil
+func (p *Provider) buildConfig(containers []*ContainerData, snippets *SnippetManager, fastcgi *FastCGIParameterManager, cache *ConfigCache) (*NginxConfig, error) {
+	opts := p.generatorOpts
+	opts.Cache = cache
+	config, err := GenerateNginxConfigWithOptions(containers, snippets, fastcgi, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate nginx config: %w", err)
+	}
+	
+	if len(config.Servers) == 0 && p.emptyConfigMode == EmptyConfigPlaceholder {
+		config.Servers = append(config.Servers, PlaceholderServer(p.generatorOpts))
+	}
+	
+	// Make sure TLS servers only reference certificates that exist
+	EnsureSSLCertificates(config, p.generatorOpts)
+	
+	if err := ValidateNginxConfig(config); err != nil {
+		return nil, fmt.Errorf("invalid nginx config: %w", err)
+	}
+	
+	return config, nil
+}
+
+// recordReload updates the reload status with the outcome of an apply attempt
+func (p *Provider) recordReload(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	now := time.Now()
+	p.reloadStatus.LastAttemptTime = now
+	if err != nil {
+		p.reloadStatus.LastReloadError = err.Error()
+		p.reloadStatus.FailureCount++
+		return
+	}
+	p.reloadStatus.LastReloadTime = now
+	p.reloadStatus.LastReloadError = ""
+	p.reloadStatus.SuccessCount++
+}
+
+// writeConfigFile writes the nginx configuration to file and returns the
+// rendered content
+func (p *Provider) writeConfigFile(config *NginxConfig) (string, error) {
 	content, err := RenderNginxConfig(config, p.templatePath)
 	if err != nil {
-		return err
+		return "", err
 	}
 	
 	// Ensure directory exists
 	dir := filepath.Dir(p.nginxConfigPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create config directory: %w", err)
+		return "", fmt.Errorf("failed to create config directory: %w", err)
 	}
 	
 	// Write to temporary file first
 	tempFile := p.nginxConfigPath + ".tmp"
-	if err := os.WriteFile(tempFile, []byte(content), 0644); err != nil {
-		return fmt.Errorf("failed to write temp config file: %w", err)
+	if err := p.filePerms.writeFile(tempFile, []byte(content)); err != nil {
+		os.Remove(tempFile)
+		return "", fmt.Errorf("failed to write temp config file: %w", err)
 	}
 	
 	// Atomic move
 	if err := os.Rename(tempFile, p.nginxConfigPath); err != nil {
 		os.Remove(tempFile) // cleanup
-		return fmt.Errorf("failed to move config file: %w", err)
+		return "", fmt.Errorf("failed to move config file: %w", err)
 	}
 	
 	log.Printf("Nginx configuration written to %s", p.nginxConfigPath)
+	return content, nil
+}
+
+// recordRenderedConfig logs and archives an applied config for audit trails,
+// as enabled by LogRenderedConfig and ConfigHistoryDir
+func (p *Provider) recordRenderedConfig(content string) {
+	if p.logRendered {
+		log.Printf("Applied nginx configuration:\n%s", content)
+	}
+	
+	if p.configHistory == nil {
+		return
+	}
+	path, err := p.configHistory.Archive(content, time.Now())
+	if err != nil {
+		p.errorHandler.Warning("Failed to archive applied config", err, "provider")
+		return
+	}
+	log.Printf("Archived applied nginx configuration to %s", path)
+}
+
+// hasExistingConfig reports whether a non-empty config file is already on disk
+func (p *Provider) hasExistingConfig() bool {
+	info, err := os.Stat(p.nginxConfigPath)
+	return err == nil && info.Mode().IsRegular() && info.Size() > 0
+}
+
+// restoreConfigFile puts the previous config back after a failed test. A nil
+// previous means there was no config before, so the broken one is removed.
+func (p *Provider) restoreConfigFile(previous []byte) {
+	if previous == nil {
+		if err := os.Remove(p.nginxConfigPath); err != nil && !os.IsNotExist(err) {
+			p.errorHandler.Warning("Failed to remove rejected config file", err, "provider")
+		}
+		return
+	}
+	
+	tempFile := p.nginxConfigPath + ".tmp"
+	if err := p.filePerms.writeFile(tempFile, previous); err != nil {
+		p.errorHandler.Warning("Failed to restore previous config file", err, "provider")
+		return
+	}
+	if err := os.Rename(tempFile, p.nginxConfigPath); err != nil {
+		os.Remove(tempFile)
+		p.errorHandler.Warning("Failed to restore previous config file", err, "provider")
+		return
+	}
+	log.Printf("Restored previous nginx configuration at %s", p.nginxConfigPath)
+}
+
+// ConfigMetadata is written next to the config file after every successful apply
+type ConfigMetadata struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	AppliedAt   time.Time `json:"applied_at"`
+	Upstreams   int       `json:"upstreams"`
+	Servers     int       `json:"servers"`
+}
+
+// metadataPath returns the path of the sidecar metadata file
+func (p *Provider) metadataPath() string {
+	return p.nginxConfigPath + ".meta.json"
+}
+
+// writeConfigMetadata records when the applied config was generated
+func (p *Provider) writeConfigMetadata(config *NginxConfig) error {
+	data, err := json.MarshalIndent(ConfigMetadata{
+		GeneratedAt: config.Generated,
+		AppliedAt:   time.Now(),
+		Upstreams:   len(config.Upstreams),
+		Servers:     len(config.Servers),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode config metadata: %w", err)
+	}
+	
+	if err := p.filePerms.writeFile(p.metadataPath(), data); err != nil {
+		return fmt.Errorf("failed to write config metadata: %w", err)
+	}
+	return nil
+}
+
+// GetConfigMetadata reads the metadata sidecar of the config on disk
+func (p *Provider) GetConfigMetadata() (*ConfigMetadata, error) {
+	data, err := os.ReadFile(p.metadataPath())
+	if err != nil {
+		return nil, err
+	}
+	
+	var metadata ConfigMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode config metadata: %w", err)
+	}
+	return &metadata, nil
+}
+
+// checkBinary verifies that binary exists and is executable. A missing
+// binary is a configuration error and returned as non-retryable.
+func checkBinary(binary string) error {
+	if _, err := exec.LookPath(binary); err != nil {
+		return errors.NonRetryable(fmt.Errorf("nginx binary not found: %w", err))
+	}
 	return nil
 }
 
 // testNginxConfig tests the nginx configuration
 func (p *Provider) testNginxConfig() error {
-	cmd := exec.Command(p.nginxBinary, "-t")
+	if err := checkBinary(p.nginxBinary); err != nil {
+		return err
+	}
+	
+	ctx, cancel := context.WithTimeout(p.ctx, p.commandTimeout)
+	defer cancel()
+	
+	cmd := exec.CommandContext(ctx, p.nginxBinary, "-t")
 	if output, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			output = []byte(fmt.Sprintf("timed out after %v", p.commandTimeout))
+		}
 		testErr := fmt.Errorf("nginx config test failed: %s", string(output))
 		p.errorHandler.Warning("Nginx configuration test failed", testErr, "provider")
 		return testErr
@@ -394,10 +1366,21 @@ func (p *Provider) testNginxConfig() error {
 	return nil
 }
 
-// reloadNginx reloads the nginx configuration
+// reloadNginx reloads the nginx configuration. The reload command is checked
+// here too since the config test may be skipped.
 func (p *Provider) reloadNginx() error {
-	cmd := exec.Command(p.reloadCommand[0], p.reloadCommand[1:]...)
+	if err := checkBinary(p.reloadCommand[0]); err != nil {
+		return err
+	}
+	
+	ctx, cancel := context.WithTimeout(p.ctx, p.commandTimeout)
+	defer cancel()
+	
+	cmd := exec.CommandContext(ctx, p.reloadCommand[0], p.reloadCommand[1:]...)
 	if output, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			output = []byte(fmt.Sprintf("timed out after %v", p.commandTimeout))
+		}
 		reloadErr := fmt.Errorf("nginx reload failed: %s", string(output))
 		p.errorHandler.Warning("Nginx reload failed", reloadErr, "provider")
 		return reloadErr
@@ -416,9 +1399,12 @@ func (p *Provider) configEquals(a, b *NginxConfig) bool {
 		return false
 	}
 	
-	// Simple comparison - in production you might want more sophisticated comparison
+	// Simple comparison - in production you might want more sophisticated comparison.
+	// The generation time is rendered into the header, so it's left out.
+	bCopy := *b
+	bCopy.Generated = a.Generated
 	aStr, _ := RenderNginxConfig(a, p.templatePath)
-	bStr, _ := RenderNginxConfig(b, p.templatePath)
+	bStr, _ := RenderNginxConfig(&bCopy, p.templatePath)
 	
 	return aStr == bStr
 }
@@ -438,4 +1424,61 @@ func (p *Provider) GetCurrentConfig() *NginxConfig {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 	return p.lastConfig
-}
\ No newline at end of file
+}
+
+// ReadAppliedConfig returns the nginx configuration file as last written
+func (p *Provider) ReadAppliedConfig() ([]byte, error) {
+	return os.ReadFile(p.nginxConfigPath)
+}
+
+// RenderCurrentConfig regenerates the nginx configuration from the current
+// containers and returns it rendered. It has no side effects: nothing is
+// written or reloaded, snippets are fetched without the on-disk cache and
+// failures are returned rather than reported to the error handler.
+func (p *Provider) RenderCurrentConfig() (string, error) {
+	// Backend CAs resolve to the cached copies the applied config uses
+	snippets := NewSnippetManager(p.client, p.snippetManager.cacheDir)
+	snippets.SetCacheEnabled(false)
+	snippets.SetReadOnly(true)
+	fastcgi := NewFastCGIParameterManager(p.client, "")
+	fastcgi.snippetManager.SetCacheEnabled(false)
+	
+	config, err := p.buildConfig(FilterEnabledContainers(p.GetContainers()), snippets, fastcgi, nil)
+	if err != nil {
+		return "", err
+	}
+	return RenderNginxConfig(config, p.templatePath)
+}
+
+// ListCachedSnippets returns metadata for every cached snippet
+func (p *Provider) ListCachedSnippets() ([]CachedSnippet, error) {
+	return p.snippetManager.ListCached()
+}
+
+// SnippetCacheStats returns the snippet cache hit and download counters
+func (p *Provider) SnippetCacheStats() SnippetCacheStats {
+	return p.snippetManager.Stats()
+}
+
+// ValidateCachedSnippets checks the syntax of every cached snippet
+func (p *Provider) ValidateCachedSnippets() ([]CachedSnippetValidation, error) {
+	return p.snippetManager.ValidateCached()
+}
+
+// InvalidContainers returns the containers the last reconciliation skipped
+// because of invalid ingress labels, with their errors
+func (p *Provider) InvalidContainers() []InvalidContainer {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	
+	invalid := make([]InvalidContainer, len(p.invalidContainers))
+	copy(invalid, p.invalidContainers)
+	return invalid
+}
+
+// GetReloadStatus returns when the configuration was last applied and the outcome
+func (p *Provider) GetReloadStatus() ReloadStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.reloadStatus
+}
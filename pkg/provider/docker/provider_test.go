@@ -0,0 +1,1094 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/menta2k/local-nginx-ingress/pkg/errors"
+)
+
+func TestLoadConfigurationAppliesIPChanges(t *testing.T) {
+	labels := map[string]string{LabelEnable: "true", LabelHost: "app.test", LabelPort: "8080"}
+	tests := []struct {
+		name    string
+		before  fakeContainer
+		after   fakeContainer
+		wantOld bool
+	}{
+		{
+			name:   "same container reconnected",
+			before: fakeContainer{Name: "app", IP: "172.18.0.2", Labels: labels},
+			after:  fakeContainer{Name: "app", IP: "172.18.0.7", Labels: labels},
+		},
+		{
+			name:   "container recreated with the same name",
+			before: fakeContainer{Name: "app", IP: "172.18.0.2", Labels: labels},
+			after:  fakeContainer{ID: testContainerID("app-recreated"), Name: "app", IP: "172.18.0.7", Labels: labels},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docker := newFakeDocker(tt.before)
+			var applied int
+			p := newTestProvider(t, docker, Config{
+				OnConfigChange: func(*NginxConfig, ConfigDiff) { applied++ },
+			})
+
+			if err := p.loadConfiguration(); err != nil {
+				t.Fatalf("first loadConfiguration: %v", err)
+			}
+			if config := readTestConfig(t, p); !strings.Contains(config, "172.18.0.2:8080") {
+				t.Fatalf("initial config lacks the first IP:\n%s", config)
+			}
+
+			docker.set(tt.after)
+			if err := p.loadConfiguration(); err != nil {
+				t.Fatalf("second loadConfiguration: %v", err)
+			}
+			config := readTestConfig(t, p)
+			if !strings.Contains(config, "172.18.0.7:8080") || strings.Contains(config, "172.18.0.2:8080") {
+				t.Errorf("config not regenerated for the new IP:\n%s", config)
+			}
+			if applied != 2 {
+				t.Errorf("configs applied = %d, want 2", applied)
+			}
+		})
+	}
+}
+
+func TestLoadConfigurationSkipsUnchangedConfig(t *testing.T) {
+	docker := newFakeDocker(fakeContainer{Name: "app", IP: "172.18.0.2",
+		Labels: map[string]string{LabelEnable: "true", LabelHost: "app.test"}})
+	var applied int
+	p := newTestProvider(t, docker, Config{
+		OnConfigChange: func(*NginxConfig, ConfigDiff) { applied++ },
+	})
+
+	for i := 0; i < 3; i++ {
+		if err := p.loadConfiguration(); err != nil {
+			t.Fatalf("loadConfiguration: %v", err)
+		}
+	}
+	if applied != 1 {
+		t.Errorf("configs applied = %d, want 1", applied)
+	}
+}
+
+func TestRenderCurrentConfigHasNoSideEffects(t *testing.T) {
+	app := fakeContainer{Name: "app", IP: "172.18.0.2", Labels: map[string]string{
+		LabelEnable: "true", LabelHost: "app.test", LabelConfigurationSnippet: "/app/location.conf",
+	}}
+	docker := newFakeDocker(app)
+	docker.files[app.id()+":/app/location.conf"] = "add_header X-Rendered yes;"
+	p := newTestProvider(t, docker, Config{})
+
+	if err := p.loadConfiguration(); err != nil {
+		t.Fatalf("loadConfiguration: %v", err)
+	}
+	if err := p.snippetManager.ClearCache(); err != nil {
+		t.Fatalf("ClearCache: %v", err)
+	}
+	if err := os.Remove(p.nginxConfigPath); err != nil {
+		t.Fatalf("removing config: %v", err)
+	}
+	status := p.GetReloadStatus()
+
+	rendered, err := p.RenderCurrentConfig()
+	if err != nil {
+		t.Fatalf("RenderCurrentConfig: %v", err)
+	}
+	for _, want := range []string{"server_name app.test", "172.18.0.2:80", "add_header X-Rendered yes;"} {
+		if !strings.Contains(rendered, want) {
+			t.Errorf("rendered config lacks %q:\n%s", want, rendered)
+		}
+	}
+
+	if _, err := os.Stat(p.nginxConfigPath); !os.IsNotExist(err) {
+		t.Errorf("config file written, stat error = %v", err)
+	}
+	if cached, err := p.ListCachedSnippets(); err != nil || len(cached) != 0 {
+		t.Errorf("snippet cache = %v (%v), want empty", cached, err)
+	}
+	if got := p.GetReloadStatus(); got != status {
+		t.Errorf("reload status changed from %+v to %+v", status, got)
+	}
+}
+
+func TestRenderCurrentConfigReturnsErrors(t *testing.T) {
+	app := fakeContainer{Name: "app", IP: "172.18.0.2", Labels: map[string]string{
+		LabelEnable: "true", LabelHost: "app.test", LabelConfigurationSnippet: "/app/location.conf",
+	}}
+	docker := newFakeDocker(app)
+	docker.files[app.id()+":/app/location.conf"] = "add_header X-Rendered yes;"
+	p := newTestProvider(t, docker, Config{ConfigurationSnippetPolicy: "fail-closed"})
+	if err := p.loadConfiguration(); err != nil {
+		t.Fatalf("loadConfiguration: %v", err)
+	}
+
+	// The applied config had the snippet cached, RenderCurrentConfig must
+	// fetch it again and fail now that it's gone
+	delete(docker.files, app.id()+":/app/location.conf")
+	if _, err := p.RenderCurrentConfig(); err == nil {
+		t.Error("RenderCurrentConfig succeeded without the snippet")
+	}
+}
+
+func TestRenderCurrentConfigBackendCA(t *testing.T) {
+	ca, _ := testCertificatePEM(t)
+	app := fakeContainer{Name: "app", IP: "172.18.0.2", Labels: map[string]string{
+		LabelEnable: "true", LabelHost: "app.test", LabelProtocol: "https",
+		LabelProxySSLVerify: "true", LabelProxySSLCA: "/app/ca.pem",
+	}}
+	tests := []struct {
+		name   string
+		policy string
+		before func(t *testing.T, cached string) // runs between apply and preview
+	}{
+		{"cached CA", "", func(t *testing.T, cached string) {}},
+		{"cached CA fail-closed", "fail-closed", func(t *testing.T, cached string) {}},
+		// The preview downloads the CA again but leaves the cache alone
+		{"CA not cached", "fail-closed", func(t *testing.T, cached string) {
+			if err := os.Remove(cached); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docker := newFakeDocker(app)
+			docker.files[app.id()+":/app/ca.pem"] = string(ca)
+			p := newTestProvider(t, docker, Config{ConfigurationSnippetPolicy: tt.policy})
+			if err := p.loadConfiguration(); err != nil {
+				t.Fatalf("loadConfiguration: %v", err)
+			}
+			cached := p.GetCurrentConfig().Servers[0].Locations[0].ProxySSL.TrustedCertificate
+			if !strings.HasPrefix(cached, p.snippetManager.cacheDir) {
+				t.Fatalf("applied CA = %q, want a copy in %s", cached, p.snippetManager.cacheDir)
+			}
+			_, statErr := os.Stat(cached)
+			tt.before(t, cached)
+			_, wantStatErr := os.Stat(cached)
+
+			rendered, err := p.RenderCurrentConfig()
+			if err != nil {
+				t.Fatalf("RenderCurrentConfig: %v", err)
+			}
+			checkContains(t, locationBlock(t, rendered, "/"),
+				[]string{"proxy_ssl_verify on;", "proxy_ssl_trusted_certificate " + cached + ";"},
+				[]string{"return 502"})
+			if _, err := os.Stat(cached); (err == nil) != (wantStatErr == nil) || statErr != nil {
+				t.Errorf("preview changed the cached CA: stat error %v, want %v", err, wantStatErr)
+			}
+		})
+	}
+}
+
+func TestEventFlow(t *testing.T) {
+	web := fakeContainer{Name: "web", IP: "172.18.0.2", Labels: map[string]string{LabelEnable: "true", LabelHost: "web.test"}}
+	api := fakeContainer{Name: "api", IP: "172.18.0.3", Labels: map[string]string{LabelEnable: "true", LabelHost: "api.test"}}
+	unlabeled := fakeContainer{Name: "db", IP: "172.18.0.4"}
+
+	docker := newFakeDocker(web)
+	applied := make(chan *NginxConfig, 10)
+	p := newTestProvider(t, docker, Config{
+		OnConfigChange: func(config *NginxConfig, _ ConfigDiff) { applied <- config },
+	})
+	if err := p.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	hosts := func(config *NginxConfig) []string {
+		var names []string
+		for _, server := range config.Servers {
+			names = append(names, server.ServerName)
+		}
+		sort.Strings(names)
+		return names
+	}
+	next := func() []string {
+		t.Helper()
+		select {
+		case config := <-applied:
+			return hosts(config)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no config applied")
+			return nil
+		}
+	}
+
+	if got := next(); !reflect.DeepEqual(got, []string{"web.test"}) {
+		t.Fatalf("initial hosts = %v", got)
+	}
+
+	// An unlabeled container starting doesn't touch the config
+	docker.set(web, unlabeled)
+	docker.emit(events.ActionStart, unlabeled)
+
+	docker.set(web, unlabeled, api)
+	docker.emit(events.ActionStart, api)
+	if got := next(); !reflect.DeepEqual(got, []string{"api.test", "web.test"}) {
+		t.Fatalf("hosts after start = %v", got)
+	}
+
+	docker.set(api, unlabeled)
+	docker.emit(events.ActionDie, web)
+	if got := next(); !reflect.DeepEqual(got, []string{"api.test"}) {
+		t.Fatalf("hosts after die = %v", got)
+	}
+
+	select {
+	case config := <-applied:
+		t.Errorf("unexpected config applied with hosts %v", hosts(config))
+	default:
+	}
+}
+
+func TestMissingBinaryIsNonRetryable(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "nginx")
+	tests := []struct {
+		name   string
+		config Config
+		run    func(*Provider) error
+	}{
+		{
+			name:   "config test",
+			config: Config{NginxBinary: missing},
+			run:    (*Provider).testNginxConfig,
+		},
+		{
+			name:   "reload with config test skipped",
+			config: Config{ReloadCommand: []string{missing, "-s", "reload"}},
+			run:    (*Provider).reloadNginx,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProvider(t, newFakeDocker(), tt.config)
+			err := tt.run(p)
+			if err == nil {
+				t.Fatal("expected an error for a missing binary")
+			}
+			if !errors.IsNonRetryable(err) {
+				t.Errorf("error %v is not marked non-retryable", err)
+			}
+		})
+	}
+}
+
+func TestReloadAttemptsOnceWithMissingBinary(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "nginx")
+	docker := newFakeDocker(fakeContainer{
+		Name:   "app",
+		IP:     "172.17.0.2",
+		Labels: map[string]string{LabelEnable: "true", LabelHost: "app.test", LabelPort: "8080"},
+	})
+	p := newTestProvider(t, docker, Config{ReloadCommand: []string{missing, "-s", "reload"}})
+
+	start := time.Now()
+	if err := p.loadConfiguration(); err == nil {
+		t.Fatal("expected loadConfiguration to fail")
+	}
+	// A retry would sleep for the handler's retry delay of several seconds
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("loadConfiguration took %v, the missing binary was retried", elapsed)
+	}
+	if status := p.GetReloadStatus(); status.FailureCount != 1 || status.LastReloadError == "" {
+		t.Errorf("reload status %+v doesn't record the failure", status)
+	}
+}
+
+func TestConfigEqualsIgnoresGenerationTime(t *testing.T) {
+	p := newTestProvider(t, newFakeDocker(), Config{})
+	app := newTestContainer(t, "app", "172.18.0.2", map[string]string{LabelHost: "app.test"})
+	moved := newTestContainer(t, "app", "172.18.0.7", map[string]string{LabelHost: "app.test"})
+
+	tests := []struct {
+		name string
+		b    *ContainerData
+		skew time.Duration
+		want bool
+	}{
+		{"same config", app, 0, true},
+		{"generated a second later", app, time.Second, true},
+		{"different IP", moved, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := generateTestConfig(t, p.generatorOpts, app)
+			b := generateTestConfig(t, p.generatorOpts, tt.b)
+			b.Generated = a.Generated.Add(tt.skew)
+			if got := p.configEquals(a, b); got != tt.want {
+				t.Errorf("configEquals() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeneratedConfigIsStable(t *testing.T) {
+	var containers []*ContainerData
+	for i := 0; i < 10; i++ {
+		containers = append(containers, newTestContainer(t, fmt.Sprintf("app%d", i), fmt.Sprintf("172.18.0.%d", i+2),
+			map[string]string{LabelHost: fmt.Sprintf("app%d.test", i)}))
+	}
+	first := generateTestConfig(t, DefaultGeneratorOptions(), containers...)
+	p := newTestProvider(t, newFakeDocker(), Config{})
+
+	for i := 0; i < 20; i++ {
+		if config := generateTestConfig(t, DefaultGeneratorOptions(), containers...); !p.configEquals(first, config) {
+			t.Fatalf("generation %d rendered differently from the first", i)
+		}
+	}
+}
+
+func TestLoadConfigurationCoalescesQueuedReconciles(t *testing.T) {
+	docker := newFakeDocker(fakeContainer{Name: "app", IP: "172.18.0.2",
+		Labels: map[string]string{LabelEnable: "true", LabelHost: "app.test", LabelPort: "8080"}})
+	docker.listStarted = make(chan struct{}, 20)
+	docker.listRelease = make(chan struct{})
+	p := newTestProvider(t, docker, Config{})
+
+	const queued = 10
+	errs := make(chan error, queued+1)
+	go func() { errs <- p.loadConfiguration() }()
+	<-docker.listStarted
+
+	// Queue reconciles while the first one is listing
+	for i := 0; i < queued; i++ {
+		go func() { errs <- p.loadConfiguration() }()
+	}
+	for p.reconcileRequests.Load() < queued+1 {
+		time.Sleep(time.Millisecond)
+	}
+	close(docker.listRelease)
+
+	for i := 0; i < queued+1; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("loadConfiguration: %v", err)
+		}
+	}
+	// The queued requests share one reconcile after the first
+	if lists, _ := docker.counts(); lists != 2 {
+		t.Errorf("listed containers %d times, want 2", lists)
+	}
+	if docker.maxListing != 1 {
+		t.Errorf("%d reconciles listed concurrently, want 1", docker.maxListing)
+	}
+}
+
+func TestConcurrentReconcilesConverge(t *testing.T) {
+	app := func(ip string) fakeContainer {
+		return fakeContainer{Name: "app", IP: ip,
+			Labels: map[string]string{LabelEnable: "true", LabelHost: "app.test", LabelPort: "8080"}}
+	}
+	docker := newFakeDocker(app("172.18.0.2"))
+	p := newTestProvider(t, docker, Config{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				docker.set(app(fmt.Sprintf("172.18.0.%d", 2+(i+j)%4)))
+				if err := p.loadConfiguration(); err != nil {
+					t.Errorf("loadConfiguration: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	docker.set(app("172.18.0.50"))
+	if err := p.loadConfiguration(); err != nil {
+		t.Fatalf("loadConfiguration: %v", err)
+	}
+	if docker.maxListing != 1 {
+		t.Errorf("%d reconciles listed concurrently, want 1", docker.maxListing)
+	}
+	config := readTestConfig(t, p)
+	if strings.Count(config, "server 172.18.0.") != 1 || !strings.Contains(config, "172.18.0.50:8080") {
+		t.Errorf("config doesn't match the final container:\n%s", config)
+	}
+	if current := p.GetContainers(); len(current) != 1 || current[0].IPAddress != "172.18.0.50" {
+		t.Errorf("tracked containers don't match the final container: %+v", current)
+	}
+}
+
+func TestReloadStatus(t *testing.T) {
+	failFlag := filepath.Join(t.TempDir(), "fail")
+	docker := newFakeDocker()
+	p := newTestProvider(t, docker, Config{
+		ReloadCommand: []string{"sh", "-c", "test ! -e " + failFlag},
+		Resilience:    errors.ResilienceConfig{RetryAttempts: 1},
+	})
+
+	steps := []struct {
+		name        string
+		fail        bool
+		wantSuccess int
+		wantFailure int
+	}{
+		{"first reload", false, 1, 0},
+		{"failed reload", true, 1, 1},
+		{"recovered", false, 2, 1},
+	}
+
+	var lastReload time.Time
+	for i, step := range steps {
+		if step.fail {
+			if err := os.WriteFile(failFlag, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			os.Remove(failFlag)
+		}
+		// Move the backend so every step has a config change to apply
+		docker.set(fakeContainer{Name: "app", IP: fmt.Sprintf("172.18.0.%d", i+2),
+			Labels: map[string]string{LabelEnable: "true", LabelHost: "app.test"}})
+
+		before := time.Now()
+		err := p.loadConfiguration()
+		if (err != nil) != step.fail {
+			t.Fatalf("%s: loadConfiguration() = %v, want failure %v", step.name, err, step.fail)
+		}
+
+		status := p.GetReloadStatus()
+		if status.SuccessCount != step.wantSuccess || status.FailureCount != step.wantFailure {
+			t.Errorf("%s: %d successes and %d failures, want %d and %d",
+				step.name, status.SuccessCount, status.FailureCount, step.wantSuccess, step.wantFailure)
+		}
+		if status.LastAttemptTime.Before(before) {
+			t.Errorf("%s: last attempt %v not updated", step.name, status.LastAttemptTime)
+		}
+		if step.fail {
+			if status.LastReloadError == "" || !status.LastReloadTime.Equal(lastReload) {
+				t.Errorf("%s: status %+v, want an error and the previous reload time", step.name, status)
+			}
+		} else if status.LastReloadError != "" || status.LastReloadTime.Before(before) {
+			t.Errorf("%s: status %+v, want a fresh reload without error", step.name, status)
+		}
+		lastReload = status.LastReloadTime
+	}
+}
+
+func TestReloadCommandTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		command []string
+		wantErr string
+	}{
+		{name: "reload succeeds", command: []string{"true"}},
+		{name: "reload fails", command: []string{"sh", "-c", "echo 'no pid'; exit 1"}, wantErr: "no pid"},
+		{name: "reload hangs", command: []string{"sleep", "10"}, wantErr: "timed out after 100ms"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProvider(t, newFakeDocker(), Config{ReloadCommand: tt.command, CommandTimeout: 100 * time.Millisecond})
+
+			started := time.Now()
+			err := p.reloadNginx()
+			if elapsed := time.Since(started); elapsed > 5*time.Second {
+				t.Errorf("reloadNginx took %v", elapsed)
+			}
+			checkError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestContainerCallbacks(t *testing.T) {
+	web := fakeContainer{Name: "web", IP: "172.18.0.2", Labels: map[string]string{LabelEnable: "true", LabelHost: "web.test"}}
+	api := fakeContainer{Name: "api", IP: "172.18.0.3", Labels: map[string]string{LabelEnable: "true", LabelHost: "api.test"}}
+	movedAPI := api
+	movedAPI.IP = "172.18.0.9"
+
+	steps := []struct {
+		name        string
+		containers  []fakeContainer
+		wantAdded   []string
+		wantRemoved []string
+	}{
+		{"initial", []fakeContainer{web}, []string{"web"}, nil},
+		{"unchanged", []fakeContainer{web}, nil, nil},
+		{"container started", []fakeContainer{web, api}, []string{"api"}, nil},
+		{"ip changed", []fakeContainer{web, movedAPI}, nil, nil},
+		{"container stopped", []fakeContainer{movedAPI}, nil, []string{"web"}},
+	}
+
+	var added, removed []string
+	docker := newFakeDocker()
+	p := newTestProvider(t, docker, Config{
+		OnContainerAdded:   func(c *ContainerData) { added = append(added, c.Config.ContainerName) },
+		OnContainerRemoved: func(c *ContainerData) { removed = append(removed, c.Config.ContainerName) },
+	})
+
+	for _, step := range steps {
+		added, removed = nil, nil
+		docker.set(step.containers...)
+		if err := p.loadConfiguration(); err != nil {
+			t.Fatalf("%s: loadConfiguration: %v", step.name, err)
+		}
+		if !reflect.DeepEqual(added, step.wantAdded) || !reflect.DeepEqual(removed, step.wantRemoved) {
+			t.Errorf("%s: added %v and removed %v, want %v and %v", step.name, added, removed, step.wantAdded, step.wantRemoved)
+		}
+	}
+}
+
+// newTestingProvider is newTestProvider with nginx -t run by a fake nginx
+// that rejects configs mentioning rejected.test
+func newTestingProvider(t *testing.T, docker DockerAPI) *Provider {
+	t.Helper()
+	configPath := filepath.Join(t.TempDir(), "ingress.conf")
+	nginx := filepath.Join(t.TempDir(), "nginx")
+	script := "#!/bin/sh\nif grep -q rejected.test " + configPath + "; then echo 'invalid host'; exit 1; fi\n"
+	if err := os.WriteFile(nginx, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	p := newTestProvider(t, docker, Config{
+		NginxConfigPath: configPath,
+		NginxBinary:     nginx,
+		Resilience:      errors.ResilienceConfig{RetryAttempts: 1},
+	})
+	p.skipConfigTest = false
+	return p
+}
+
+func TestRejectedConfigRolledBack(t *testing.T) {
+	good := fakeContainer{Name: "app", IP: "172.18.0.2", Labels: map[string]string{LabelEnable: "true", LabelHost: "app.test"}}
+	rejected := fakeContainer{Name: "bad", IP: "172.18.0.3", Labels: map[string]string{LabelEnable: "true", LabelHost: "rejected.test"}}
+
+	t.Run("previous config restored", func(t *testing.T) {
+		docker := newFakeDocker(good)
+		p := newTestingProvider(t, docker)
+		if err := p.loadConfiguration(); err != nil {
+			t.Fatalf("loadConfiguration: %v", err)
+		}
+		applied := readTestConfig(t, p)
+		metadata, err := p.GetConfigMetadata()
+		if err != nil || metadata.Servers != 1 {
+			t.Fatalf("GetConfigMetadata() = %+v, %v, want one server", metadata, err)
+		}
+
+		docker.set(good, rejected)
+		if err := p.loadConfiguration(); err == nil || !strings.Contains(err.Error(), "invalid host") {
+			t.Fatalf("loadConfiguration() = %v, want the config test failure", err)
+		}
+		if got := readTestConfig(t, p); got != applied {
+			t.Errorf("rejected config left in place:\n%s", got)
+		}
+		if after, err := p.GetConfigMetadata(); err != nil || !after.AppliedAt.Equal(metadata.AppliedAt) {
+			t.Errorf("metadata changed by the rejected config: %+v, %v", after, err)
+		}
+	})
+
+	t.Run("rejected first config removed", func(t *testing.T) {
+		p := newTestingProvider(t, newFakeDocker(rejected))
+		if err := p.loadConfiguration(); err == nil {
+			t.Fatal("loadConfiguration succeeded with a rejected config")
+		}
+		if _, err := os.Stat(p.nginxConfigPath); !os.IsNotExist(err) {
+			t.Errorf("rejected config file kept: %v", err)
+		}
+	})
+}
+
+func TestEmptyConfigModes(t *testing.T) {
+	web := fakeContainer{Name: "web", IP: "172.18.0.2", Labels: map[string]string{LabelEnable: "true", LabelHost: "web.test"}}
+
+	tests := []struct {
+		mode     string
+		want     []string
+		unwanted []string
+	}{
+		{mode: "", unwanted: []string{"server_name", "web.test"}},
+		{mode: "empty", unwanted: []string{"server_name", "web.test"}},
+		{mode: "placeholder", want: []string{"server_name _;", "default_server", "return 503;"}, unwanted: []string{"web.test"}},
+		{mode: "keep", want: []string{"server_name web.test;"}},
+	}
+
+	for _, tt := range tests {
+		t.Run("mode "+tt.mode, func(t *testing.T) {
+			docker := newFakeDocker(web)
+			p := newTestProvider(t, docker, Config{EmptyConfigMode: tt.mode})
+			if err := p.loadConfiguration(); err != nil {
+				t.Fatalf("loadConfiguration: %v", err)
+			}
+
+			docker.set()
+			if err := p.loadConfiguration(); err != nil {
+				t.Fatalf("loadConfiguration without containers: %v", err)
+			}
+			checkContains(t, readTestConfig(t, p), tt.want, tt.unwanted)
+		})
+	}
+
+	t.Run("keep without previous config", func(t *testing.T) {
+		p := newTestProvider(t, newFakeDocker(), Config{EmptyConfigMode: "keep"})
+		if err := p.loadConfiguration(); err != nil {
+			t.Fatalf("loadConfiguration: %v", err)
+		}
+		checkContains(t, readTestConfig(t, p), nil, []string{"server_name"})
+	})
+}
+
+func TestParseEmptyConfigMode(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    EmptyConfigMode
+		wantErr string
+	}{
+		{"", EmptyConfigEmpty, ""},
+		{"Placeholder", EmptyConfigPlaceholder, ""},
+		{" keep ", EmptyConfigKeep, ""},
+		{"delete", "", `invalid empty config mode "delete"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseEmptyConfigMode(tt.value)
+			checkError(t, err, tt.wantErr)
+			if got != tt.want {
+				t.Errorf("ParseEmptyConfigMode(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSkipConfigTest(t *testing.T) {
+	good := fakeContainer{Name: "app", IP: "172.18.0.2", Labels: map[string]string{LabelEnable: "true", LabelHost: "app.test"}}
+	rejected := fakeContainer{Name: "bad", IP: "172.18.0.3", Labels: map[string]string{LabelEnable: "true", LabelHost: "rejected.test"}}
+
+	tests := []struct {
+		name      string
+		skip      bool
+		wantTests int
+	}{
+		{"config tested by default", false, 1},
+		{"config test skipped", true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			configPath := filepath.Join(dir, "ingress.conf")
+			invocations := filepath.Join(dir, "nginx.log")
+			nginx := filepath.Join(dir, "nginx")
+			if err := os.WriteFile(nginx, []byte("#!/bin/sh\necho \"$@\" >> "+invocations+"\n"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			p := newTestProvider(t, newFakeDocker(good), Config{
+				NginxConfigPath: configPath,
+				NginxBinary:     nginx,
+				ReloadCommand:   []string{"sh", "-c", "! grep -q rejected.test " + configPath},
+				Resilience:      errors.ResilienceConfig{RetryAttempts: 1},
+			})
+			p.skipConfigTest = tt.skip
+
+			if err := p.loadConfiguration(); err != nil {
+				t.Fatalf("loadConfiguration: %v", err)
+			}
+			data, _ := os.ReadFile(invocations)
+			if got := strings.Count(string(data), "-t"); got != tt.wantTests {
+				t.Errorf("nginx -t ran %d times, want %d:\n%s", got, tt.wantTests, data)
+			}
+		})
+	}
+
+	t.Run("failed reload of untested config rolled back", func(t *testing.T) {
+		docker := newFakeDocker(good)
+		configPath := filepath.Join(t.TempDir(), "ingress.conf")
+		p := newTestProvider(t, docker, Config{
+			NginxConfigPath: configPath,
+			ReloadCommand:   []string{"sh", "-c", "! grep -q rejected.test " + configPath},
+			Resilience:      errors.ResilienceConfig{RetryAttempts: 1},
+		})
+		if err := p.loadConfiguration(); err != nil {
+			t.Fatalf("loadConfiguration: %v", err)
+		}
+		applied := readTestConfig(t, p)
+
+		docker.set(good, rejected)
+		if err := p.loadConfiguration(); err == nil {
+			t.Fatal("loadConfiguration succeeded with a failing reload")
+		}
+		if got := readTestConfig(t, p); got != applied {
+			t.Errorf("config not rolled back after the failed reload:\n%s", got)
+		}
+		if status := p.GetReloadStatus(); status.LastReloadError == "" {
+			t.Errorf("reload status %+v lacks the failure", status)
+		}
+	})
+}
+
+func TestPauseResume(t *testing.T) {
+	web := fakeContainer{Name: "web", IP: "172.18.0.2", Labels: map[string]string{LabelEnable: "true", LabelHost: "web.test"}}
+	api := fakeContainer{Name: "api", IP: "172.18.0.3", Labels: map[string]string{LabelEnable: "true", LabelHost: "api.test"}}
+
+	docker := newFakeDocker(web)
+	applied := make(chan *NginxConfig, 10)
+	p := newTestProvider(t, docker, Config{
+		OnConfigChange: func(config *NginxConfig, _ ConfigDiff) { applied <- config },
+	})
+	if err := p.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	<-applied
+
+	p.Pause()
+	if !p.IsPaused() {
+		t.Fatal("IsPaused() = false after Pause")
+	}
+	reloads := p.GetReloadStatus().SuccessCount
+
+	// Events while paused are dropped
+	docker.set(web, api)
+	docker.emit(events.ActionStart, api)
+	deadline := time.Now().Add(5 * time.Second)
+	for p.GetReloadStatus().EventsReceived < 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("event not received")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := p.loadConfiguration(); err != nil {
+		t.Fatalf("loadConfiguration while paused: %v", err)
+	}
+	select {
+	case config := <-applied:
+		t.Fatalf("config with %d servers applied while paused", len(config.Servers))
+	case <-time.After(100 * time.Millisecond):
+	}
+	if strings.Contains(readTestConfig(t, p), "api.test") {
+		t.Error("config written while paused")
+	}
+
+	// Resume reconciles once
+	if err := p.Resume(); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if p.IsPaused() {
+		t.Error("IsPaused() = true after Resume")
+	}
+	if !strings.Contains(readTestConfig(t, p), "server_name api.test;") {
+		t.Errorf("Resume did not reconcile:\n%s", readTestConfig(t, p))
+	}
+	if got := p.GetReloadStatus().SuccessCount - reloads; got != 1 {
+		t.Errorf("%d reloads after Resume, want 1", got)
+	}
+	if err := p.Resume(); err != nil {
+		t.Fatalf("second Resume: %v", err)
+	}
+	if got := p.GetReloadStatus().SuccessCount - reloads; got != 1 {
+		t.Errorf("%d reloads after a second Resume, want 1", got)
+	}
+}
+
+// networkEvent returns a network event for c joining or leaving network
+func networkEvent(action events.Action, network string, c fakeContainer) events.Message {
+	return events.Message{
+		Type:   events.NetworkEventType,
+		Action: action,
+		Actor:  events.Actor{ID: "net-" + network, Attributes: map[string]string{"name": network, "container": c.id()}},
+	}
+}
+
+func TestNetworkEventNeedsReload(t *testing.T) {
+	web := fakeContainer{Name: "web", IP: "172.18.0.2", Labels: map[string]string{LabelEnable: "true", LabelHost: "web.test"}}
+	api := fakeContainer{Name: "api", IP: "172.18.0.3", Labels: map[string]string{LabelEnable: "true", LabelHost: "api.test"}}
+	db := fakeContainer{Name: "db", IP: "172.18.0.4"}
+
+	docker := newFakeDocker(web)
+	p := newTestProvider(t, docker, Config{WatchNetworkEvents: true})
+	if err := p.loadConfiguration(); err != nil {
+		t.Fatalf("loadConfiguration: %v", err)
+	}
+	docker.set(web, api, db)
+
+	tests := []struct {
+		name  string
+		event events.Message
+		want  bool
+	}{
+		{"tracked container connected", networkEvent(events.ActionConnect, "app", web), true},
+		{"tracked container disconnected", networkEvent(events.ActionDisconnect, "app", web), true},
+		{"labeled container connected", networkEvent(events.ActionConnect, "app", api), true},
+		{"untracked container disconnected", networkEvent(events.ActionDisconnect, "app", api), false},
+		{"unlabeled container connected", networkEvent(events.ActionConnect, "app", db), false},
+		{"removed container connected", networkEvent(events.ActionConnect, "app", fakeContainer{Name: "gone"}), false},
+		{"no container", events.Message{Type: events.NetworkEventType, Action: events.ActionConnect}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.eventNeedsReload(tt.event)
+			if err != nil {
+				t.Fatalf("eventNeedsReload: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("eventNeedsReload() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNetworkConnectReconciles(t *testing.T) {
+	web := fakeContainer{Name: "web", IP: "172.18.0.2", Labels: map[string]string{LabelEnable: "true", LabelHost: "web.test"}}
+
+	docker := newFakeDocker(web)
+	applied := make(chan *NginxConfig, 10)
+	p := newTestProvider(t, docker, Config{
+		WatchNetworkEvents: true,
+		OnConfigChange:     func(config *NginxConfig, _ ConfigDiff) { applied <- config },
+	})
+	if err := p.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	<-applied
+
+	// Moving web to a custom network changes its routable IP
+	moved := web
+	moved.Networks = map[string]string{"bridge": "172.17.0.2", "app": "172.20.0.2"}
+	docker.set(moved)
+	docker.events <- networkEvent(events.ActionConnect, "app", moved)
+
+	select {
+	case config := <-applied:
+		if got := upstreamAddresses(config.Upstreams[0]); !reflect.DeepEqual(got, []string{"172.20.0.2:80"}) {
+			t.Errorf("upstream servers = %v, want the app network address", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("network connect did not reconcile")
+	}
+}
+
+func TestRestartingContainerKeptDown(t *testing.T) {
+	web := fakeContainer{Name: "web", IP: "172.18.0.2", Labels: map[string]string{LabelEnable: "true", LabelHost: "web.test"}}
+	restarting := web
+	restarting.State = "restarting"
+	betweenRestarts := restarting
+	betweenRestarts.Unlisted = true
+	exited := web
+	exited.State = "exited"
+	exited.Unlisted = true
+
+	tests := []struct {
+		name  string
+		later fakeContainer
+		wait  time.Duration // before the second reconcile
+		want  string        // upstream server line, empty when removed
+	}{
+		{"listed while restarting", restarting, 0, "server 172.18.0.2:80 weight=1 down;"},
+		{"missing from the listing while restarting", betweenRestarts, 0, "server 172.18.0.2:80 weight=1 down;"},
+		{"restarting past the grace period", betweenRestarts, 100 * time.Millisecond, ""},
+		{"stopped", exited, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docker := newFakeDocker(web)
+			p := newTestProvider(t, docker, Config{RestartingGracePeriod: 50 * time.Millisecond})
+			if err := p.loadConfiguration(); err != nil {
+				t.Fatalf("loadConfiguration: %v", err)
+			}
+			checkContains(t, readTestConfig(t, p), []string{"server 172.18.0.2:80 weight=1;"}, nil)
+
+			docker.set(tt.later)
+			if err := p.loadConfiguration(); err != nil {
+				t.Fatalf("loadConfiguration: %v", err)
+			}
+			if tt.wait > 0 {
+				time.Sleep(tt.wait)
+				if err := p.loadConfiguration(); err != nil {
+					t.Fatalf("loadConfiguration: %v", err)
+				}
+			}
+
+			config := readTestConfig(t, p)
+			if tt.want == "" {
+				checkContains(t, config, nil, []string{"172.18.0.2", "web.test"})
+				return
+			}
+			checkContains(t, config, []string{tt.want, "server_name web.test;"}, nil)
+		})
+	}
+}
+
+func TestQuiesceWaitsForInFlightReload(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeout  time.Duration
+		wantIdle bool
+	}{
+		{"reload finishes in time", 5 * time.Second, true},
+		{"reload outlasts the timeout", 20 * time.Millisecond, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			started, finished := filepath.Join(dir, "started"), filepath.Join(dir, "finished")
+			web := fakeContainer{Name: "web", IP: "172.18.0.2", Labels: map[string]string{LabelEnable: "true", LabelHost: "web.test"}}
+			docker := newFakeDocker(web)
+			p := newTestProvider(t, docker, Config{
+				ReloadCommand: []string{"sh", "-c", fmt.Sprintf("echo >> %s; sleep 0.3; echo >> %s", started, finished)},
+				Resilience:    errors.ResilienceConfig{RetryAttempts: 1},
+			})
+
+			reloaded := make(chan error, 1)
+			go func() { reloaded <- p.loadConfiguration() }()
+			for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+				if _, err := os.Stat(started); err == nil {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("reload never started")
+				}
+			}
+
+			idle := p.Quiesce(tt.timeout)
+			_, err := os.Stat(finished)
+			if idle != tt.wantIdle {
+				t.Errorf("Quiesce = %v, want %v", idle, tt.wantIdle)
+			}
+			if idle && err != nil {
+				t.Error("Quiesce reported idle while the reload was still running")
+			}
+			if err := <-reloaded; err != nil {
+				t.Fatalf("in-flight reload failed: %v", err)
+			}
+
+			// Nothing reloads once quiesced, e.g. after nginx was stopped
+			reloads := p.GetReloadStatus().SuccessCount
+			docker.set(web, fakeContainer{Name: "api", IP: "172.18.0.3", Labels: map[string]string{LabelEnable: "true", LabelHost: "api.test"}})
+			if err := p.loadConfiguration(); err != nil {
+				t.Fatalf("loadConfiguration after Quiesce: %v", err)
+			}
+			if got := p.GetReloadStatus().SuccessCount; got != reloads {
+				t.Errorf("%d reloads after Quiesce, want none", got-reloads)
+			}
+		})
+	}
+}
+
+func TestParseInvalidContainerPolicy(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    InvalidContainerPolicy
+		wantErr string
+	}{
+		{"", InvalidContainerWarn, ""},
+		{"warn", InvalidContainerWarn, ""},
+		{" Strict ", InvalidContainerStrict, ""},
+		{"ignore", "", "invalid container policy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseInvalidContainerPolicy(tt.value)
+			checkError(t, err, tt.wantErr)
+			if got != tt.want {
+				t.Errorf("ParseInvalidContainerPolicy(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvalidContainerPolicy(t *testing.T) {
+	web := fakeContainer{Name: "web", IP: "172.18.0.2", Labels: map[string]string{LabelEnable: "true", LabelHost: "web.test"}}
+	api := fakeContainer{Name: "api", IP: "172.18.0.3", Labels: map[string]string{LabelEnable: "true", LabelHost: "api.test"}}
+	broken := fakeContainer{Name: "broken", IP: "172.18.0.4", Labels: map[string]string{LabelEnable: "true", LabelHost: "broken.test", LabelPort: "none"}}
+
+	tests := []struct {
+		name       string
+		policy     string
+		wantErr    string
+		wantUpdate bool
+	}{
+		{"warn skips invalid containers", "warn", "", true},
+		{"strict refuses the update", "strict", "refusing to update, 1 container(s) with invalid configuration: broken", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docker := newFakeDocker(web)
+			p := newTestProvider(t, docker, Config{InvalidContainerPolicy: tt.policy})
+			if err := p.loadConfiguration(); err != nil {
+				t.Fatalf("loadConfiguration: %v", err)
+			}
+
+			docker.set(web, api, broken)
+			checkError(t, p.loadConfiguration(), tt.wantErr)
+			config := readTestConfig(t, p)
+			if got := strings.Contains(config, "api.test"); got != tt.wantUpdate {
+				t.Errorf("valid container applied = %v, want %v", got, tt.wantUpdate)
+			}
+			if strings.Contains(config, "broken.test") {
+				t.Error("invalid container applied")
+			}
+
+			invalid := p.InvalidContainers()
+			if len(invalid) != 1 || invalid[0].ContainerName != "broken" || invalid[0].ContainerID != broken.id() ||
+				!strings.Contains(invalid[0].Error, "none") {
+				t.Errorf("InvalidContainers() = %+v, want broken with its port error", invalid)
+			}
+
+			// Fixing the label clears the report
+			docker.set(web, api)
+			if err := p.loadConfiguration(); err != nil {
+				t.Fatalf("loadConfiguration: %v", err)
+			}
+			if invalid := p.InvalidContainers(); len(invalid) != 0 {
+				t.Errorf("InvalidContainers() = %+v after the fix, want none", invalid)
+			}
+		})
+	}
+}
+
+func TestReadAppliedConfig(t *testing.T) {
+	web := fakeContainer{Name: "web", IP: "172.18.0.2", Labels: map[string]string{LabelEnable: "true", LabelHost: "web.test"}}
+	rejected := fakeContainer{Name: "rejected", IP: "172.18.0.3", Labels: map[string]string{LabelEnable: "true", LabelHost: "rejected.test"}}
+	docker := newFakeDocker()
+	p := newTestingProvider(t, docker)
+
+	if _, err := p.ReadAppliedConfig(); !os.IsNotExist(err) {
+		t.Fatalf("ReadAppliedConfig before any reconcile: err = %v, want not exist", err)
+	}
+
+	steps := []struct {
+		name       string
+		containers []fakeContainer
+		want       []string
+		unwanted   []string
+	}{
+		{"applied", []fakeContainer{web}, []string{"server_name web.test;"}, nil},
+		// nginx rejects it, so the previous config stays applied
+		{"rejected", []fakeContainer{web, rejected}, []string{"server_name web.test;"}, []string{"rejected.test"}},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			docker.set(step.containers...)
+			p.loadConfiguration()
+
+			config, err := p.ReadAppliedConfig()
+			if err != nil {
+				t.Fatalf("ReadAppliedConfig: %v", err)
+			}
+			if string(config) != readTestConfig(t, p) {
+				t.Error("ReadAppliedConfig differs from the config file")
+			}
+			checkContains(t, string(config), step.want, step.unwanted)
+		})
+	}
+}
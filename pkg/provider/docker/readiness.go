@@ -0,0 +1,219 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReadinessMode controls how backends that don't accept connections yet are
+// treated at startup
+type ReadinessMode string
+
+const (
+	// ReadinessOff starts nginx right away without probing backends
+	ReadinessOff ReadinessMode = "off"
+	// ReadinessWait delays starting nginx until every host has a reachable backend
+	ReadinessWait ReadinessMode = "wait"
+	// ReadinessMarkDown starts right away with unreachable backends marked down
+	ReadinessMarkDown ReadinessMode = "mark-down"
+)
+
+// ParseReadinessMode parses a readiness mode, defaulting to off when empty
+func ParseReadinessMode(value string) (ReadinessMode, error) {
+	switch mode := ReadinessMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return ReadinessOff, nil
+	case ReadinessOff, ReadinessWait, ReadinessMarkDown:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid readiness mode %q, must be off, wait or mark-down", value)
+	}
+}
+
+// DefaultReadinessTimeout bounds how long startup waits for backends
+const DefaultReadinessTimeout = time.Minute
+
+// Probing of backends during the readiness window
+const (
+	readinessProbeInterval = 2 * time.Second
+	readinessProbeTimeout  = 2 * time.Second
+)
+
+// probedBackend reports whether a container has a backend port to probe;
+// redirects and DNS-based backends don't
+func probedBackend(container *ContainerData) bool {
+	return container.IPAddress != "" &&
+		container.Config.Redirect.URL == "" &&
+		(container.Config.UpstreamHost == "" || container.Config.FastCGI.Enabled)
+}
+
+// backendReachable reports whether a container accepts TCP connections on
+// its backend port
+func backendReachable(ctx context.Context, container *ContainerData) bool {
+	probeCtx, cancel := context.WithTimeout(ctx, readinessProbeTimeout)
+	defer cancel()
+	return CheckContainerPort(probeCtx, container.IPAddress, container.Config.Port)
+}
+
+// unreadyHosts returns the hosts of which no backend accepts connections,
+// sorted. Hosts without probed backends count as ready.
+func unreadyHosts(ctx context.Context, containers []*ContainerData) []string {
+	var pending []string
+	for host, hostContainers := range GroupContainersByHost(containers) {
+		ready := true
+		for _, container := range hostContainers {
+			if !probedBackend(container) {
+				continue
+			}
+			if backendReachable(ctx, container) {
+				ready = true
+				break
+			}
+			ready = false
+		}
+		if !ready {
+			pending = append(pending, host)
+		}
+	}
+	sort.Strings(pending)
+	return pending
+}
+
+// WaitForBackends blocks until every host has at least one backend accepting
+// connections, meant to run before nginx starts in wait mode. Containers are
+// listed again on every attempt so late starters are picked up. It returns
+// an error naming the hosts still unreachable when the readiness timeout
+// passes; other modes return immediately.
+func (p *Provider) WaitForBackends() error {
+	if p.readinessMode != ReadinessWait {
+		return nil
+	}
+
+	log.Printf("Waiting up to %v for backends to accept connections...", p.readinessTimeout)
+	deadline := time.Now().Add(p.readinessTimeout)
+	for {
+		var pending []string
+		containers, err := ListContainers(p.ctx, p.client, p.listOptions())
+		if err != nil {
+			p.errorHandler.Warning("Failed to list containers while waiting for backends", err, "provider")
+		} else {
+			pending = unreadyHosts(p.ctx, FilterEnabledContainers(containers))
+			if len(pending) == 0 {
+				log.Println("All hosts have a reachable backend")
+				return nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			if err != nil {
+				return fmt.Errorf("backends not checked within %v: %w", p.readinessTimeout, err)
+			}
+			return fmt.Errorf("no reachable backend after %v for %s", p.readinessTimeout, strings.Join(pending, ", "))
+		}
+		if len(pending) > 0 {
+			log.Printf("Waiting for backends of %s", strings.Join(pending, ", "))
+		}
+
+		select {
+		case <-time.After(readinessProbeInterval):
+		case <-p.ctx.Done():
+			return p.ctx.Err()
+		}
+	}
+}
+
+// markUnready probes the backends of freshly listed containers during the
+// readiness window of mark-down mode and marks unreachable ones, so nginx
+// starts with them down. Backends that answered once aren't probed again.
+func (p *Provider) markUnready(containers []*ContainerData) {
+	if p.readinessMode != ReadinessMarkDown || time.Now().After(p.readinessUntil) {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, container := range containers {
+		p.mu.RLock()
+		ready := p.readyBackends[container.Config.ContainerID]
+		p.mu.RUnlock()
+		if ready || !probedBackend(container) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(container *ContainerData) {
+			defer wg.Done()
+			if !backendReachable(p.ctx, container) {
+				container.Unready = true
+				return
+			}
+			p.mu.Lock()
+			p.readyBackends[container.Config.ContainerID] = true
+			p.mu.Unlock()
+		}(container)
+	}
+	wg.Wait()
+}
+
+// watchReadiness reloads the configuration whenever a backend marked down by
+// markUnready starts accepting connections, and once more when the
+// readiness window ends so nothing stays marked down
+func (p *Provider) watchReadiness() {
+	ticker := time.NewTicker(readinessProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.ctx.Done():
+			return
+		}
+
+		expired := time.Now().After(p.readinessUntil)
+		if !p.unreadyChanged(expired) {
+			if expired {
+				return
+			}
+			continue
+		}
+
+		if expired {
+			log.Println("Readiness window ended, removing down marks from unreachable backends")
+		} else {
+			log.Println("A backend became reachable, reloading configuration")
+		}
+		if err := p.loadConfiguration(); err != nil {
+			p.errorHandler.Warning("Failed to reload configuration for backend readiness", err, "provider")
+		}
+		if expired {
+			return
+		}
+	}
+}
+
+// unreadyChanged reports whether a tracked container marked unready needs a
+// reload: it became reachable, or the readiness window has expired
+func (p *Provider) unreadyChanged(expired bool) bool {
+	p.mu.RLock()
+	var unready []*ContainerData
+	for _, container := range p.containers {
+		if container.Unready {
+			unready = append(unready, container)
+		}
+	}
+	p.mu.RUnlock()
+
+	if len(unready) == 0 || expired {
+		return len(unready) > 0
+	}
+	for _, container := range unready {
+		if backendReachable(p.ctx, container) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package docker
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// freePort returns a local TCP port nothing listens on
+func freePort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// listen accepts connections on a local port until the test ends
+func listen(t *testing.T, port int) {
+	t.Helper()
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+}
+
+// backendContainer is a container of host whose backend is 127.0.0.1:port
+func backendContainer(name, host string, port int) fakeContainer {
+	return fakeContainer{Name: name, IP: "127.0.0.1", Labels: map[string]string{
+		LabelEnable: "true", LabelHost: host, LabelPort: strconv.Itoa(port),
+	}}
+}
+
+// backendDown reports whether the upstream server 127.0.0.1:port of a
+// rendered config is marked down
+func backendDown(t *testing.T, rendered string, port int) bool {
+	t.Helper()
+	server := "server 127.0.0.1:" + strconv.Itoa(port) + " "
+	for _, line := range strings.Split(rendered, "\n") {
+		if line = strings.TrimSpace(line); strings.HasPrefix(line, server) {
+			return strings.HasSuffix(line, " down;")
+		}
+	}
+	t.Fatalf("no upstream server for port %d:\n%s", port, rendered)
+	return false
+}
+
+func TestParseReadinessMode(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    ReadinessMode
+		wantErr string
+	}{
+		{"", ReadinessOff, ""},
+		{"off", ReadinessOff, ""},
+		{" Wait ", ReadinessWait, ""},
+		{"mark-down", ReadinessMarkDown, ""},
+		{"block", "", "invalid readiness mode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseReadinessMode(tt.value)
+			checkError(t, err, tt.wantErr)
+			if got != tt.want {
+				t.Errorf("ParseReadinessMode(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitForBackends(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		listenIn   time.Duration // when the backend starts accepting, < 0 for never
+		timeout    time.Duration
+		wantErr    string
+		minElapsed time.Duration
+	}{
+		{name: "off doesn't wait", mode: "off", listenIn: -1, timeout: time.Minute},
+		{name: "reachable backend", mode: "wait", listenIn: 0, timeout: time.Minute},
+		{name: "backend becomes reachable", mode: "wait", listenIn: 200 * time.Millisecond, timeout: time.Minute, minElapsed: 200 * time.Millisecond},
+		{name: "backend never reachable", mode: "wait", listenIn: -1, timeout: 100 * time.Millisecond, wantErr: "no reachable backend after 100ms for app.test"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := freePort(t)
+			switch {
+			case tt.listenIn == 0:
+				listen(t, port)
+			case tt.listenIn > 0:
+				timer := time.AfterFunc(tt.listenIn, func() { listen(t, port) })
+				t.Cleanup(func() { timer.Stop() })
+			}
+			docker := newFakeDocker(backendContainer("app", "app.test", port))
+			p := newTestProvider(t, docker, Config{ReadinessMode: tt.mode, ReadinessTimeout: tt.timeout})
+
+			started := time.Now()
+			err := p.WaitForBackends()
+			checkError(t, err, tt.wantErr)
+			if elapsed := time.Since(started); elapsed < tt.minElapsed {
+				t.Errorf("returned after %v, before the backend was reachable", elapsed)
+			}
+		})
+	}
+}
+
+func TestMarkUnreadyBackends(t *testing.T) {
+	readyPort := freePort(t)
+	listen(t, readyPort)
+	unreadyPort := freePort(t)
+	docker := newFakeDocker(
+		backendContainer("ready", "ready.test", readyPort),
+		backendContainer("unready", "unready.test", unreadyPort),
+	)
+
+	tests := []struct {
+		name     string
+		mode     string
+		window   time.Duration
+		wantDown bool
+	}{
+		{"mark-down within the window", "mark-down", time.Minute, true},
+		{"mark-down after the window", "mark-down", -time.Second, false},
+		{"off", "off", time.Minute, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProvider(t, docker, Config{ReadinessMode: tt.mode})
+			p.readinessUntil = time.Now().Add(tt.window)
+			if err := p.loadConfiguration(); err != nil {
+				t.Fatalf("loadConfiguration: %v", err)
+			}
+
+			config := readTestConfig(t, p)
+			if got := backendDown(t, config, unreadyPort); got != tt.wantDown {
+				t.Errorf("unreachable backend marked down = %v, want %v", got, tt.wantDown)
+			}
+			if backendDown(t, config, readyPort) {
+				t.Error("reachable backend marked down")
+			}
+		})
+	}
+}
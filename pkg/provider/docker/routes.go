@@ -0,0 +1,93 @@
+package docker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// RouteStatus describes one host and path of the generated configuration and
+// where its requests go
+type RouteStatus struct {
+	Host     string   `json:"host"`
+	Path     string   `json:"path"`
+	Backends []string `json:"backends"`
+	TLS      bool     `json:"tls"`
+}
+
+// RoutesFromConfig lists every location of a configuration as a route,
+// sorted by host and path
+func RoutesFromConfig(config *NginxConfig) []RouteStatus {
+	if config == nil {
+		return nil
+	}
+
+	upstreams := make(map[string]UpstreamConfig, len(config.Upstreams))
+	for _, upstream := range config.Upstreams {
+		upstreams[upstream.Name] = upstream
+	}
+
+	var routes []RouteStatus
+	for _, server := range config.Servers {
+		for _, location := range server.Locations {
+			routes = append(routes, RouteStatus{
+				Host:     server.ServerName,
+				Path:     location.Path,
+				Backends: locationBackends(location, upstreams),
+				TLS:      server.SSL.Enabled,
+			})
+		}
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Host != routes[j].Host {
+			return routes[i].Host < routes[j].Host
+		}
+		return routes[i].Path < routes[j].Path
+	})
+	return routes
+}
+
+// locationBackends describes where a location sends its requests
+func locationBackends(location LocationConfig, upstreams map[string]UpstreamConfig) []string {
+	switch {
+	case location.Redirect.URL != "":
+		return []string{fmt.Sprintf("redirect %d %s", location.Redirect.Code, location.Redirect.URL)}
+	case location.ReturnStatus != 0:
+		return []string{fmt.Sprintf("return %d", location.ReturnStatus)}
+	case location.FastCGI.Enabled:
+		return []string{"fastcgi " + location.FastCGI.Pass}
+	case location.Dynamic.Enabled:
+		return []string{location.Dynamic.Address}
+	}
+
+	upstream, exists := upstreams[location.Upstream]
+	if !exists || len(upstream.Servers) == 0 {
+		return []string{location.Upstream}
+	}
+	return upstreamAddresses(upstream)
+}
+
+// FormatRouteTable renders routes as an aligned HOST / PATH / BACKENDS / TLS table
+func FormatRouteTable(routes []RouteStatus) string {
+	var b strings.Builder
+
+	if len(routes) == 0 {
+		b.WriteString("No routes configured\n")
+		return b.String()
+	}
+
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tPATH\tBACKENDS\tTLS")
+	for _, route := range routes {
+		tls := "no"
+		if route.TLS {
+			tls = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", route.Host, route.Path, strings.Join(route.Backends, ", "), tls)
+	}
+	w.Flush()
+
+	return b.String()
+}
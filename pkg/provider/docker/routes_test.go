@@ -0,0 +1,78 @@
+package docker
+
+import (
+	"reflect"
+	"testing"
+)
+
+// sampleRouteConfig is a configuration with one location of every kind
+func sampleRouteConfig() *NginxConfig {
+	return &NginxConfig{
+		Upstreams: []UpstreamConfig{
+			{Name: "backend_web", Servers: []UpstreamServer{{Address: "10.0.0.2:80"}, {Address: "10.0.0.3:80"}}},
+			{Name: "backend_empty"},
+		},
+		Servers: []ServerConfig{
+			{
+				ServerName: "web.test",
+				SSL:        SSLConfig{Enabled: true},
+				Locations: []LocationConfig{
+					{Path: "/old", Redirect: RedirectConfig{URL: "https://web.test/new", Code: 301}},
+					{Path: "/", Upstream: "backend_web"},
+				},
+			},
+			{
+				ServerName: "api.test",
+				Locations: []LocationConfig{
+					{Path: "/v1", Upstream: "backend_empty"},
+					{Path: "/php", FastCGI: FastCGILocationConfig{Enabled: true, Pass: "10.0.0.4:9000"}},
+					{Path: "/", ReturnStatus: 404},
+				},
+			},
+		},
+	}
+}
+
+func TestRoutesFromConfig(t *testing.T) {
+	want := []RouteStatus{
+		{Host: "api.test", Path: "/", Backends: []string{"return 404"}},
+		{Host: "api.test", Path: "/php", Backends: []string{"fastcgi 10.0.0.4:9000"}},
+		{Host: "api.test", Path: "/v1", Backends: []string{"backend_empty"}},
+		{Host: "web.test", Path: "/", Backends: []string{"10.0.0.2:80", "10.0.0.3:80"}, TLS: true},
+		{Host: "web.test", Path: "/old", Backends: []string{"redirect 301 https://web.test/new"}, TLS: true},
+	}
+	if got := RoutesFromConfig(sampleRouteConfig()); !reflect.DeepEqual(got, want) {
+		t.Errorf("RoutesFromConfig() =\n%+v\nwant\n%+v", got, want)
+	}
+	if got := RoutesFromConfig(nil); got != nil {
+		t.Errorf("RoutesFromConfig(nil) = %+v, want nil", got)
+	}
+}
+
+func TestFormatRouteTable(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes []RouteStatus
+		want   string
+	}{
+		{"no routes", nil, "No routes configured\n"},
+		{
+			name:   "aligned columns",
+			routes: RoutesFromConfig(sampleRouteConfig()),
+			want: "HOST      PATH  BACKENDS                           TLS\n" +
+				"api.test  /     return 404                         no\n" +
+				"api.test  /php  fastcgi 10.0.0.4:9000              no\n" +
+				"api.test  /v1   backend_empty                      no\n" +
+				"web.test  /     10.0.0.2:80, 10.0.0.3:80           yes\n" +
+				"web.test  /old  redirect 301 https://web.test/new  yes\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatRouteTable(tt.routes); got != tt.want {
+				t.Errorf("FormatRouteTable() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
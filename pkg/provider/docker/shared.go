@@ -1,7 +1,9 @@
 package docker
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -83,6 +85,44 @@ var ExampleLabels = map[string]map[string]string{
 	},
 }
 
+// GenerateConfigFromLabels builds an nginx configuration from label sets keyed by
+// container name, without a Docker client. Containers get synthetic IDs and IPs
+// (10.0.0.1, 10.0.0.2, ... in name order), and snippet / FastCGI params files
+// are not downloaded.
+func GenerateConfigFromLabels(labelSets map[string]map[string]string) (*NginxConfig, error) {
+	names := make([]string, 0, len(labelSets))
+	for name := range labelSets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	
+	var containers []*ContainerData
+	for i, name := range names {
+		containerID := fmt.Sprintf("%x", sha256.Sum256([]byte(name)))
+		networkIP := fmt.Sprintf("10.0.%d.%d", (i+1)/256, (i+1)%256)
+		
+		config, err := ExtractConfig(containerID, name, networkIP, labelSets[name])
+		if err != nil {
+			return nil, err
+		}
+		if !config.Enabled {
+			continue
+		}
+		if err := ValidateConfig(config); err != nil {
+			return nil, fmt.Errorf("container %s: %w", name, err)
+		}
+		
+		containers = append(containers, &ContainerData{
+			Config:      config,
+			IPAddress:   networkIP,
+			NetworkName: "synthetic",
+			Status:      "running",
+		})
+	}
+	
+	return GenerateNginxConfig(containers, nil, nil)
+}
+
 // GenerateDockerRunCommand generates a docker run command with nginx ingress labels
 func GenerateDockerRunCommand(image, containerName string, labels map[string]string, port int) string {
 	var cmd strings.Builder
@@ -134,6 +174,13 @@ func ValidateHostname(hostname string) error {
 		return fmt.Errorf("hostname too long (max 253 characters)")
 	}
 	
+	// Names end up in nginx directives, keep them to hostname characters
+	if i := strings.IndexFunc(hostname, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-._*", r))
+	}); i >= 0 {
+		return fmt.Errorf("hostname contains invalid character %q", hostname[i])
+	}
+	
 	if strings.HasPrefix(hostname, ".") || strings.HasSuffix(hostname, ".") {
 		return fmt.Errorf("hostname cannot start or end with a dot")
 	}
@@ -174,16 +221,66 @@ func GetLabelDocumentation() map[string]string {
 	return map[string]string{
 		LabelEnable:    "Enable nginx ingress for this container (true/false)",
 		LabelHost:      "Hostname for this service (required when enabled)",
-		LabelPort:      "Container port to proxy to (default: 80)",
+		LabelHostAliases: "Comma-separated extra hostnames served by the same server block as host",
+		LabelPort:      "Container port to proxy to (default: the only exposed TCP port, else 80)",
 		LabelPath:      "URL path prefix for this service (default: /)",
 		LabelProtocol:  "Protocol to use: http or https (default: http)",
+		LabelUpstreamHost: "Backend DNS name resolved by nginx at request time instead of the container IP",
+		LabelUpstreamName: "Fixed name of the container's upstream block instead of the generated one (letters, digits, underscores; - . / become _)",
+		LabelUpstreamResolve: "When upstream-host is resolved: continuous (by nginx per request) or once (when the config is generated)",
+		LabelUpstreamHostHeader: "Host header sent to the backend instead of the client's host",
+		LabelForwardedProto: "X-Forwarded-Proto sent to the backend: http, https or an nginx variable (default: $scheme)",
+		LabelForwardedPort:  "X-Forwarded-Port sent to the backend: a port or an nginx variable (default: $server_port)",
 		LabelPriority:  "Priority for location matching (higher = first, default: 100)",
 		LabelRule:      "Custom nginx location rule (advanced)",
+		LabelHideHeaders:         "Backend response headers to hide from clients (comma-separated)",
+		LabelClearRequestHeaders: "Request headers to clear before proxying (comma-separated)",
+		LabelMapPrefix + "<variable>.source":  "Source variable of an http-level map block, e.g. $http_x_tenant",
+		LabelMapPrefix + "<variable>.default": "Default value of the map block",
+		LabelMapPrefix + "<variable>.<input>": "Map entry: requests where the source equals <input> get this value",
+		LabelRedirectTo:   "Redirect requests to this absolute URL instead of proxying",
+		LabelRedirectCode: "Redirect status code: 301, 302, 303, 307 or 308 (default: 302)",
+		LabelPreservePath: "Pass the full request path to the backend (default: true); false strips the location prefix",
+		LabelDefaultBackend: "Also serve every path of the host no other location matches (location /)",
+		LabelDiagnosticHeaders: "Send X-Container-Name/X-Container-ID headers to the backend (default: true)",
+		LabelProxyRequestBuffering: "on/off; off streams request bodies to the backend (uploads, gRPC-web, chunked requests)",
+		LabelProxySSLVerify: "Verify the certificate of an https backend (default: false)",
+		LabelProxySSLCA:     "Path inside the container of the PEM CA bundle verifying the backend (default: the system bundle)",
+		LabelProxyRedirect: "Rewrite backend Location headers: default, off or \"<redirect> <replacement>\" (proxy_redirect)",
+		LabelAllowedMethods: "Comma-separated HTTP methods the location accepts, others are answered with 405",
+		LabelRequestID: "Pass X-Request-ID upstream, generating one when absent, and log it (default: false)",
+		LabelBackendHTTP2: "Proxy to the backend over HTTP/2 (h2c, or TLS with protocol https) using grpc_pass (default: false)",
+		LabelInterceptErrors: "Replace backend error responses with nginx error pages (proxy_intercept_errors, default: false)",
+		
+		LabelProxyCache:         "Cache backend responses in nginx (true/false)",
+		LabelProxyCacheKey:      "proxy_cache_key (default: $scheme$proxy_host$request_uri)",
+		LabelProxyCacheValid:    "Comma-separated proxy_cache_valid entries, e.g. \"200 302 10m,404 1m\" (default: 200 302 10m)",
+		LabelProxyCacheZoneSize: "Size of the cache keys zone (default: 10m)",
+		LabelProxyCacheMaxSize:  "Maximum cache size on disk, e.g. 1g (default: unlimited)",
+		LabelProxyCacheInactive: "Remove cached entries not accessed for this long, e.g. 60m (default: 10m)",
+		LabelTryFiles:  "try_files fallback list, e.g. \"$uri $uri/ /index.html\" for SPA routing",
 		
 		LabelTLS:       "Enable TLS/SSL (true/false)",
 		LabelCertName:  "SSL certificate name (when TLS enabled)",
 		
-		LabelMethod:    "Load balancing method: round_robin, least_conn, ip_hash",
+		LabelSSLProtocols: "TLS protocols for the host, e.g. TLSv1.2,TLSv1.3 (default: controller SSL_PROTOCOLS)",
+		LabelSSLCiphers:   "OpenSSL cipher string for the host (default: controller SSL_CIPHERS)",
+		LabelMinTLSVersion: "Lowest TLS version for the host: 1.0, 1.1, 1.2 or 1.3; enables it and every newer one",
+		LabelSSLStapling:  "Enable OCSP stapling (true/false); ignored for the self-signed default certificate",
+		LabelSSLTrustedCertificate: "CA chain used to verify stapled OCSP responses (required with ssl-stapling)",
+		
+		LabelClientBodyTimeout:     "client_body_timeout of the host, e.g. 30s (default: nginx default)",
+		LabelClientHeaderTimeout:   "client_header_timeout of the host, e.g. 10s (default: nginx default)",
+		LabelSendTimeout:           "send_timeout of the host, e.g. 30s (default: nginx default)",
+		LabelHSTS:                  "Emit Strict-Transport-Security header on TLS hosts (true/false)",
+		LabelHSTSMaxAge:            "HSTS max-age in seconds (default: 31536000)",
+		LabelHSTSIncludeSubdomains: "Add includeSubDomains to the HSTS header (true/false)",
+		
+		LabelMethod:    "Load balancing method: round_robin, least_conn, ip_hash, random, hash",
+		LabelHashKey:   "Key for the hash load balancing method, e.g. $request_uri",
+		LabelUpstreamMaxFails:    "Failed attempts before an upstream server is marked unavailable (max_fails)",
+		LabelUpstreamFailTimeout: "Window and ejection time for failed upstream servers, e.g. 30s (fail_timeout)",
+		LabelUpstreamZoneSize:    "Shared memory zone size for the upstream, e.g. 64k (zone directive)",
 		
 		LabelHealthCheck:     "Enable health checks (true/false)",
 		LabelHealthCheckPath: "Health check endpoint path (default: /health)",
@@ -194,11 +291,14 @@ func GetLabelDocumentation() map[string]string {
 		LabelCORS + ".methods":  "Allowed CORS methods (comma-separated)",
 		
 		LabelConfigurationSnippet: "Path to nginx location configuration file in container",
+		LabelConfigurationSnippetSHA256: "Expected sha256 of the location configuration file (optional)",
 		LabelServerSnippet:        "Path to nginx server configuration file in container",
+		LabelServerSnippetSHA256:  "Expected sha256 of the server configuration file (optional)",
 		
 		LabelBackendProtocol:    "Backend protocol: http, https, or FCGI (for FastCGI)",
 		LabelFastCGIIndex:       "FastCGI index file (e.g., index.php)",
 		LabelFastCGIParams:      "FastCGI parameters as comma-separated key=value pairs",
-		LabelFastCGIParamsFile:  "Path to FastCGI parameters file in container",
+		LabelFastCGIParamsFile:  "Comma-separated paths to FastCGI parameters files in container (later files override earlier ones)",
+		LabelFastCGIDefaults:    "Default FastCGI parameter set: php (default), cgi or none (false disables defaults)",
 	}
 }
\ No newline at end of file
@@ -0,0 +1,82 @@
+package docker
+
+import "testing"
+
+func TestGenerateConfigFromLabels(t *testing.T) {
+	tests := []struct {
+		name        string
+		labelSets   map[string]map[string]string
+		wantServers []string
+		wantErr     string
+	}{
+		{
+			name: "enabled containers",
+			labelSets: map[string]map[string]string{
+				"web": {LabelEnable: "true", LabelHost: "web.test", LabelPort: "3000"},
+				"api": {LabelEnable: "true", LabelHost: "api.test", LabelPort: "8080"},
+			},
+			wantServers: []string{"api.test", "web.test"},
+		},
+		{
+			name: "disabled containers skipped",
+			labelSets: map[string]map[string]string{
+				"web": {LabelEnable: "true", LabelHost: "web.test"},
+				"off": {LabelEnable: "false", LabelHost: "off.test"},
+			},
+			wantServers: []string{"web.test"},
+		},
+		{
+			name: "invalid labels",
+			labelSets: map[string]map[string]string{
+				"web": {LabelEnable: "true", LabelHost: "web.test", LabelPort: "70000"},
+			},
+			wantErr: "web",
+		},
+		{
+			name:      "no containers",
+			labelSets: map[string]map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := GenerateConfigFromLabels(tt.labelSets)
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+			var servers []string
+			for _, server := range config.Servers {
+				servers = append(servers, server.ServerName)
+			}
+			if len(servers) != len(tt.wantServers) {
+				t.Fatalf("servers = %v, want %v", servers, tt.wantServers)
+			}
+			for i := range servers {
+				if servers[i] != tt.wantServers[i] {
+					t.Errorf("servers = %v, want %v", servers, tt.wantServers)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateConfigFromLabelsIsDeterministic(t *testing.T) {
+	labelSets := map[string]map[string]string{}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		labelSets[name] = map[string]string{LabelEnable: "true", LabelHost: name + ".test"}
+	}
+	first, err := GenerateConfigFromLabels(labelSets)
+	if err != nil {
+		t.Fatalf("GenerateConfigFromLabels: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		again, err := GenerateConfigFromLabels(labelSets)
+		if err != nil {
+			t.Fatalf("GenerateConfigFromLabels: %v", err)
+		}
+		if renderAt(t, again, first) != renderAt(t, first, first) {
+			t.Fatal("same labels rendered differently")
+		}
+	}
+}
@@ -4,20 +4,83 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
-
-	"github.com/docker/docker/client"
+	"sync"
+	"time"
 )
 
 // SnippetManager handles downloading and caching nginx configuration snippets from containers
 type SnippetManager struct {
-	client    *client.Client
-	cacheDir  string
-	ctx       context.Context
+	client        DockerAPI
+	cacheDir      string
+	ctx           context.Context
+	cacheDisabled bool
+	readOnly      bool // never write to cacheDir, for previews
+	filePerms     FilePermissions
+	
+	mu    sync.Mutex
+	paths map[string]string // cache file name -> snippet path, for files cached by this process
+	stats SnippetCacheStats
+}
+
+// SnippetCacheStats counts snippet cache hits and downloads from containers,
+// to show whether the cache is effective and downloads slow reloads down
+type SnippetCacheStats struct {
+	Hits           int64 `json:"hits"`
+	Misses         int64 `json:"misses"` // downloads from a container
+	DownloadErrors int64 `json:"download_errors"`
+	
+	// Download durations, failed downloads included
+	DownloadMillisTotal   int64   `json:"download_ms_total"`
+	DownloadMillisMax     int64   `json:"download_ms_max"`
+	DownloadMillisAverage float64 `json:"download_ms_average"`
+}
+
+// SnippetFailurePolicy decides what happens when a snippet can't be
+// downloaded or its path is rejected
+type SnippetFailurePolicy string
+
+const (
+	// SnippetFailOpen generates the config without the snippet and logs a warning
+	SnippetFailOpen SnippetFailurePolicy = "fail-open"
+	// SnippetFailClosed aborts the update so nginx keeps the last good config
+	SnippetFailClosed SnippetFailurePolicy = "fail-closed"
+)
+
+// ParseSnippetFailurePolicy parses a snippet failure policy, defaulting to fail-open
+func ParseSnippetFailurePolicy(value string) (SnippetFailurePolicy, error) {
+	switch policy := SnippetFailurePolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case "":
+		return SnippetFailOpen, nil
+	case SnippetFailOpen, SnippetFailClosed:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid snippet failure policy %q, must be fail-open or fail-closed", value)
+	}
+}
+
+// SnippetPathError is returned when a snippet or params file path is rejected
+// before anything is read from the container
+type SnippetPathError struct {
+	Path   string
+	Reason string
+}
+
+func (e *SnippetPathError) Error() string {
+	return fmt.Sprintf("invalid file path %s: %s", e.Path, e.Reason)
+}
+
+// IsSnippetPathRejected reports whether err comes from a rejected file path
+func IsSnippetPathRejected(err error) bool {
+	var pathErr *SnippetPathError
+	return errors.As(err, &pathErr)
 }
 
 // SnippetContent represents downloaded snippet content with metadata
@@ -28,23 +91,49 @@ type SnippetContent struct {
 }
 
 // NewSnippetManager creates a new snippet manager
-func NewSnippetManager(dockerClient *client.Client, cacheDir string) *SnippetManager {
+func NewSnippetManager(dockerClient DockerAPI, cacheDir string) *SnippetManager {
 	return &SnippetManager{
 		client:   dockerClient,
 		cacheDir: cacheDir,
 		ctx:      context.Background(),
+		filePerms: DefaultFilePermissions(),
+		paths:    make(map[string]string),
 	}
 }
 
+// SetFilePermissions configures the mode and owner of cached snippet files
+func (sm *SnippetManager) SetFilePermissions(perms FilePermissions) {
+	sm.filePerms = perms
+}
+
+// SetCacheEnabled turns the on-disk snippet cache on or off. With caching
+// disabled every download fetches fresh content from the container.
+func (sm *SnippetManager) SetCacheEnabled(enabled bool) {
+	sm.cacheDisabled = !enabled
+}
+
+// SetReadOnly keeps the manager from writing to its cache directory, so a
+// preview resolves the same cached paths as the applied config without
+// touching them
+func (sm *SnippetManager) SetReadOnly(readOnly bool) {
+	sm.readOnly = readOnly
+}
+
 // DownloadSnippet downloads a configuration snippet from a container
 func (sm *SnippetManager) DownloadSnippet(containerID, filePath string) (*SnippetContent, error) {
+	return sm.DownloadSnippetWithHash(containerID, filePath, "")
+}
+
+// DownloadSnippetWithHash downloads a configuration snippet from a container and,
+// when expectedHash is set, rejects it unless its sha256 matches
+func (sm *SnippetManager) DownloadSnippetWithHash(containerID, filePath, expectedHash string) (*SnippetContent, error) {
 	if filePath == "" {
 		return nil, nil
 	}
 
 	// Validate file path (security check)
 	if err := sm.validateFilePath(filePath); err != nil {
-		return nil, fmt.Errorf("invalid file path %s: %w", filePath, err)
+		return nil, err
 	}
 
 	// Generate cache key
@@ -53,15 +142,27 @@ func (sm *SnippetManager) DownloadSnippet(containerID, filePath string) (*Snippe
 
 	// Check if we have a cached version
 	if content, err := sm.loadFromCache(cacheFile); err == nil {
-		return content, nil
+		if err := verifySnippetHash(content.Content, expectedHash); err == nil {
+			sm.mu.Lock()
+			sm.stats.Hits++
+			sm.mu.Unlock()
+			return content, nil
+		}
+		// Cached content doesn't match, fall through and download a fresh copy
 	}
 
 	// Download from container
+	started := time.Now()
 	content, err := sm.downloadFromContainer(containerID, filePath)
+	sm.recordDownload(time.Since(started), err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to download %s from container %s: %w", filePath, containerID, err)
 	}
 
+	if err := verifySnippetHash(content, expectedHash); err != nil {
+		return nil, fmt.Errorf("snippet %s from container %s rejected: %w", filePath, containerID, err)
+	}
+
 	snippet := &SnippetContent{
 		Content:  content,
 		FilePath: filePath,
@@ -77,6 +178,34 @@ func (sm *SnippetManager) DownloadSnippet(containerID, filePath string) (*Snippe
 	return snippet, nil
 }
 
+// recordDownload counts a cache miss and how long its download took
+func (sm *SnippetManager) recordDownload(elapsed time.Duration, err error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	
+	sm.stats.Misses++
+	if err != nil {
+		sm.stats.DownloadErrors++
+	}
+	millis := elapsed.Milliseconds()
+	sm.stats.DownloadMillisTotal += millis
+	if millis > sm.stats.DownloadMillisMax {
+		sm.stats.DownloadMillisMax = millis
+	}
+}
+
+// Stats returns the cache hit and download counters since startup
+func (sm *SnippetManager) Stats() SnippetCacheStats {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	
+	stats := sm.stats
+	if stats.Misses > 0 {
+		stats.DownloadMillisAverage = float64(stats.DownloadMillisTotal) / float64(stats.Misses)
+	}
+	return stats
+}
+
 // downloadFromContainer downloads a file from a Docker container
 func (sm *SnippetManager) downloadFromContainer(containerID, filePath string) (string, error) {
 	// Use docker cp equivalent - create a tar stream from the container
@@ -129,24 +258,100 @@ func (sm *SnippetManager) downloadViaExec(reader io.Reader, filename string) (st
 	return strings.TrimSpace(content), nil
 }
 
-// validateFilePath ensures the file path is safe and allowed
+// validateFilePath ensures the file path is safe and allowed, returning a
+// *SnippetPathError with the reason otherwise
 func (sm *SnippetManager) validateFilePath(filePath string) error {
 	// Security checks
 	if strings.Contains(filePath, "..") {
-		return fmt.Errorf("path traversal not allowed")
+		return &SnippetPathError{Path: filePath, Reason: "path traversal not allowed"}
 	}
 	
 	if strings.HasPrefix(filePath, "/etc/") || strings.HasPrefix(filePath, "/var/") {
-		return fmt.Errorf("system directories not allowed")
+		return &SnippetPathError{Path: filePath, Reason: "system directories not allowed"}
 	}
 	
 	if !strings.HasSuffix(filePath, ".conf") && !strings.HasSuffix(filePath, ".txt") {
-		return fmt.Errorf("only .conf and .txt files allowed")
+		return &SnippetPathError{Path: filePath, Reason: "only .conf and .txt files allowed"}
 	}
 	
 	return nil
 }
 
+// validateCertificatePath checks that a certificate path in a container is
+// absolute and names a .pem or .crt file. Unlike snippets, certificates may
+// live under /etc, where CA bundles usually are.
+func validateCertificatePath(filePath string) error {
+	if !strings.HasPrefix(filePath, "/") {
+		return fmt.Errorf("path must be absolute")
+	}
+	if strings.Contains(filePath, "..") {
+		return fmt.Errorf("path traversal not allowed")
+	}
+	if !strings.HasSuffix(filePath, ".pem") && !strings.HasSuffix(filePath, ".crt") {
+		return fmt.Errorf("only .pem and .crt files allowed")
+	}
+	return nil
+}
+
+// validateCertificateBundle checks that content is a PEM bundle of
+// certificates only, so no private key ends up in the cache directory
+func validateCertificateBundle(content string) error {
+	if strings.Contains(content, "PRIVATE KEY") {
+		return fmt.Errorf("bundle contains a private key")
+	}
+	block, _ := pem.Decode([]byte(content))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return fmt.Errorf("not a PEM certificate bundle")
+	}
+	return nil
+}
+
+// DownloadCertificate copies a PEM CA bundle from a container into the cache
+// directory and returns the local path nginx reads it from. A cached bundle
+// is reused unless caching is disabled; the file is written even then, since
+// nginx can only load it from a file. A read-only manager returns the path
+// without writing it.
+func (sm *SnippetManager) DownloadCertificate(containerID, filePath string) (string, error) {
+	if err := validateCertificatePath(filePath); err != nil {
+		return "", fmt.Errorf("invalid certificate path %s: %w", filePath, err)
+	}
+	if sm.cacheDir == "" {
+		return "", fmt.Errorf("no cache directory to copy certificate %s to", filePath)
+	}
+	
+	// Prefixed with the short container ID like snippets, so PruneCache
+	// removes it with the container
+	path := filepath.Join(sm.cacheDir, fmt.Sprintf("%s_%s.pem", containerID[:12], sm.hashPath(filePath)))
+	cached, cacheErr := os.ReadFile(path)
+	if !sm.cacheDisabled && cacheErr == nil && validateCertificateBundle(string(cached)) == nil {
+		sm.mu.Lock()
+		sm.stats.Hits++
+		sm.mu.Unlock()
+		return path, nil
+	}
+	
+	started := time.Now()
+	content, err := sm.downloadFromContainer(containerID, filePath)
+	sm.recordDownload(time.Since(started), err)
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s from container %s: %w", filePath, containerID, err)
+	}
+	if err := validateCertificateBundle(content); err != nil {
+		return "", fmt.Errorf("certificate %s from container %s rejected: %w", filePath, containerID, err)
+	}
+	if sm.readOnly || (cacheErr == nil && string(cached) == content) {
+		return path, nil
+	}
+	
+	if err := os.MkdirAll(sm.cacheDir, 0755); err != nil {
+		return "", err
+	}
+	if err := sm.filePerms.writeFile(path, []byte(content)); err != nil {
+		return "", fmt.Errorf("failed to write certificate %s: %w", path, err)
+	}
+	return path, nil
+}
+
 // hashPath creates a hash of the file path for cache keys
 func (sm *SnippetManager) hashPath(path string) string {
 	h := sha256.Sum256([]byte(path))
@@ -159,8 +364,27 @@ func (sm *SnippetManager) hashContent(content string) string {
 	return fmt.Sprintf("%x", h)[:12]
 }
 
+// verifySnippetHash checks content against an expected hex-encoded sha256
+// digest; an empty expectedHash disables the check
+func verifySnippetHash(content, expectedHash string) error {
+	if expectedHash == "" {
+		return nil
+	}
+	
+	actual := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+	if !strings.EqualFold(actual, expectedHash) {
+		return fmt.Errorf("sha256 mismatch: expected %s, got %s", expectedHash, actual)
+	}
+	
+	return nil
+}
+
 // loadFromCache loads snippet content from cache
 func (sm *SnippetManager) loadFromCache(cacheFile string) (*SnippetContent, error) {
+	if sm.cacheDisabled {
+		return nil, fmt.Errorf("snippet cache disabled")
+	}
+	
 	if _, err := os.Stat(cacheFile); os.IsNotExist(err) {
 		return nil, fmt.Errorf("cache file not found")
 	}
@@ -178,12 +402,105 @@ func (sm *SnippetManager) loadFromCache(cacheFile string) (*SnippetContent, erro
 
 // saveToCache saves snippet content to cache
 func (sm *SnippetManager) saveToCache(cacheFile string, snippet *SnippetContent) error {
+	if sm.cacheDisabled {
+		return nil
+	}
+	
 	// Ensure cache directory exists
 	if err := os.MkdirAll(sm.cacheDir, 0755); err != nil {
 		return err
 	}
 	
-	return os.WriteFile(cacheFile, []byte(snippet.Content), 0644)
+	if err := sm.filePerms.writeFile(cacheFile, []byte(snippet.Content)); err != nil {
+		return err
+	}
+	
+	sm.mu.Lock()
+	sm.paths[filepath.Base(cacheFile)] = snippet.FilePath
+	sm.mu.Unlock()
+	return nil
+}
+
+// CachedSnippet describes one file in the snippet cache
+type CachedSnippet struct {
+	File        string `json:"file"`
+	ContainerID string `json:"container_id"`   // short container ID
+	Path        string `json:"path,omitempty"` // unknown for files cached by an earlier run
+	Hash        string `json:"hash"`
+	Size        int64  `json:"size"`
+	AgeSeconds  int64  `json:"age_seconds"`
+}
+
+// CachedSnippetValidation is the syntax check result of a cached snippet
+type CachedSnippetValidation struct {
+	CachedSnippet
+	Error string `json:"error,omitempty"`
+}
+
+// ListCached returns metadata for every cached snippet, sorted by file name
+func (sm *SnippetManager) ListCached() ([]CachedSnippet, error) {
+	entries, err := os.ReadDir(sm.cacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+	
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	
+	var cached []CachedSnippet
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".conf") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // removed meanwhile
+		}
+		content, err := os.ReadFile(filepath.Join(sm.cacheDir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		
+		containerID, _, _ := strings.Cut(entry.Name(), "_")
+		cached = append(cached, CachedSnippet{
+			File:        entry.Name(),
+			ContainerID: containerID,
+			Path:        sm.paths[entry.Name()],
+			Hash:        sm.hashContent(string(content)),
+			Size:        info.Size(),
+			AgeSeconds:  int64(time.Since(info.ModTime()).Seconds()),
+		})
+	}
+	
+	sort.Slice(cached, func(i, j int) bool {
+		return cached[i].File < cached[j].File
+	})
+	return cached, nil
+}
+
+// ValidateCached runs ValidateSnippetSyntax over every cached snippet, so a
+// bad cached snippet behind a failing reload can be found
+func (sm *SnippetManager) ValidateCached() ([]CachedSnippetValidation, error) {
+	cached, err := sm.ListCached()
+	if err != nil {
+		return nil, err
+	}
+	
+	results := make([]CachedSnippetValidation, 0, len(cached))
+	for _, snippet := range cached {
+		result := CachedSnippetValidation{CachedSnippet: snippet}
+		content, err := os.ReadFile(filepath.Join(sm.cacheDir, snippet.File))
+		if err != nil {
+			result.Error = err.Error()
+		} else if err := ValidateSnippetSyntax(string(content)); err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
 }
 
 // ClearCache removes all cached snippets
@@ -195,13 +512,54 @@ func (sm *SnippetManager) ClearCache() error {
 	return os.RemoveAll(sm.cacheDir)
 }
 
+// PruneCache removes cached snippets belonging to containers that are no
+// longer active, returning the number of entries removed
+func (sm *SnippetManager) PruneCache(activeContainerIDs []string) (int, error) {
+	entries, err := os.ReadDir(sm.cacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+	
+	// Cache keys are prefixed with the short container ID
+	active := make(map[string]bool, len(activeContainerIDs))
+	for _, id := range activeContainerIDs {
+		if len(id) > 12 {
+			id = id[:12]
+		}
+		active[id] = true
+	}
+	
+	removed := 0
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		prefix, _, found := strings.Cut(entry.Name(), "_")
+		if !found || active[prefix] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(sm.cacheDir, entry.Name())); err != nil && !os.IsNotExist(err) {
+			return removed, fmt.Errorf("failed to remove cache file %s: %w", entry.Name(), err)
+		}
+		sm.mu.Lock()
+		delete(sm.paths, entry.Name())
+		sm.mu.Unlock()
+		removed++
+	}
+	
+	return removed, nil
+}
+
 // DownloadAllSnippets downloads all snippets for a container configuration
 func (sm *SnippetManager) DownloadAllSnippets(config *ContainerConfig) (map[string]*SnippetContent, error) {
 	snippets := make(map[string]*SnippetContent)
 	
 	// Download configuration snippet (location-level)
 	if config.ConfigurationSnippet != "" {
-		snippet, err := sm.DownloadSnippet(config.ContainerID, config.ConfigurationSnippet)
+		snippet, err := sm.DownloadSnippetWithHash(config.ContainerID, config.ConfigurationSnippet, config.ConfigurationSnippetSHA256)
 		if err != nil {
 			return nil, fmt.Errorf("failed to download configuration snippet: %w", err)
 		}
@@ -212,7 +570,7 @@ func (sm *SnippetManager) DownloadAllSnippets(config *ContainerConfig) (map[stri
 	
 	// Download server snippet (server-level)
 	if config.ServerSnippet != "" {
-		snippet, err := sm.DownloadSnippet(config.ContainerID, config.ServerSnippet)
+		snippet, err := sm.DownloadSnippetWithHash(config.ContainerID, config.ServerSnippet, config.ServerSnippetSHA256)
 		if err != nil {
 			return nil, fmt.Errorf("failed to download server snippet: %w", err)
 		}
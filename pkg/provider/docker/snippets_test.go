@@ -0,0 +1,566 @@
+package docker
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func sha256Hex(content string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+}
+
+func TestSnippetHashVerification(t *testing.T) {
+	const serverSnippet = "add_header X-Server-Snippet on;"
+	const locationSnippet = "add_header X-Location-Snippet on;"
+
+	tests := []struct {
+		name         string
+		hashLabels   map[string]string
+		policy       SnippetFailurePolicy
+		wantServer   bool
+		wantLocation bool
+		wantErr      bool
+	}{
+		{name: "no hashes", wantServer: true, wantLocation: true},
+		{
+			name: "matching hashes",
+			hashLabels: map[string]string{
+				LabelServerSnippetSHA256:        sha256Hex(serverSnippet),
+				LabelConfigurationSnippetSHA256: sha256Hex(locationSnippet),
+			},
+			wantServer: true, wantLocation: true,
+		},
+		{
+			name:         "server hash mismatch fails open",
+			hashLabels:   map[string]string{LabelServerSnippetSHA256: sha256Hex("other")},
+			wantLocation: true,
+		},
+		{
+			name:       "location hash mismatch fails open",
+			hashLabels: map[string]string{LabelConfigurationSnippetSHA256: sha256Hex("other")},
+			wantServer: true,
+		},
+		{
+			name:       "server hash mismatch fails closed",
+			hashLabels: map[string]string{LabelServerSnippetSHA256: sha256Hex("other")},
+			policy:     SnippetFailClosed,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := map[string]string{
+				LabelHost:                 "app.test",
+				LabelServerSnippet:        "/app/server.conf",
+				LabelConfigurationSnippet: "/app/location.conf",
+			}
+			for key, value := range tt.hashLabels {
+				labels[key] = value
+			}
+			container := newTestContainer(t, "app", "10.0.0.2", labels)
+
+			docker := newFakeDocker()
+			docker.files[container.Config.ContainerID+":/app/server.conf"] = serverSnippet
+			docker.files[container.Config.ContainerID+":/app/location.conf"] = locationSnippet
+			snippets := NewSnippetManager(docker, t.TempDir())
+			snippets.SetCacheEnabled(false)
+
+			opts := DefaultGeneratorOptions()
+			opts.ServerSnippetPolicy = tt.policy
+			opts.ConfigurationSnippetPolicy = tt.policy
+			config, err := GenerateNginxConfigWithOptions([]*ContainerData{container}, snippets, nil, opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			server := config.Servers[0]
+			if got := server.ServerSnippet == serverSnippet; got != tt.wantServer {
+				t.Errorf("server snippet included = %v, want %v (%q)", got, tt.wantServer, server.ServerSnippet)
+			}
+			if got := server.Locations[0].ConfigurationSnippet == locationSnippet; got != tt.wantLocation {
+				t.Errorf("location snippet included = %v, want %v (%q)", got, tt.wantLocation, server.Locations[0].ConfigurationSnippet)
+			}
+		})
+	}
+}
+
+func TestSnippetHashLabelValidation(t *testing.T) {
+	for _, label := range []string{LabelServerSnippetSHA256, LabelConfigurationSnippetSHA256} {
+		_, err := ExtractConfig(testContainerID("app"), "app", "10.0.0.2", map[string]string{
+			LabelEnable: "true", LabelHost: "app.test", label: "not-a-digest",
+		})
+		if err == nil || !strings.Contains(err.Error(), label) {
+			t.Errorf("%s: err = %v, want invalid value error", label, err)
+		}
+	}
+}
+
+// newCachedSnippets returns a snippet manager with a location snippet of
+// every named container cached
+func newCachedSnippets(t *testing.T, names ...string) *SnippetManager {
+	t.Helper()
+	docker := newFakeDocker()
+	snippets := NewSnippetManager(docker, t.TempDir())
+	for _, name := range names {
+		docker.files[testContainerID(name)+":/app/location.conf"] = "add_header X-" + name + " on;"
+		if _, err := snippets.DownloadSnippet(testContainerID(name), "/app/location.conf"); err != nil {
+			t.Fatalf("DownloadSnippet(%s): %v", name, err)
+		}
+	}
+	return snippets
+}
+
+func TestPruneCache(t *testing.T) {
+	tests := []struct {
+		name        string
+		active      []string
+		wantRemoved int
+		wantKept    []string
+	}{
+		{"all active", []string{"a", "b", "c"}, 0, []string{"a", "b", "c"}},
+		{"one gone", []string{"a", "c"}, 1, []string{"a", "c"}},
+		{"none active", nil, 3, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snippets := newCachedSnippets(t, "a", "b", "c")
+			var active []string
+			for _, name := range tt.active {
+				active = append(active, testContainerID(name))
+			}
+
+			removed, err := snippets.PruneCache(active)
+			if err != nil {
+				t.Fatalf("PruneCache: %v", err)
+			}
+			if removed != tt.wantRemoved {
+				t.Errorf("removed %d, want %d", removed, tt.wantRemoved)
+			}
+			cached, err := snippets.ListCached()
+			if err != nil {
+				t.Fatalf("ListCached: %v", err)
+			}
+			kept := make(map[string]bool)
+			for _, snippet := range cached {
+				kept[snippet.ContainerID] = true
+			}
+			if len(kept) != len(tt.wantKept) {
+				t.Errorf("%d containers cached, want %v", len(kept), tt.wantKept)
+			}
+			for _, name := range tt.wantKept {
+				if !kept[testContainerID(name)[:12]] {
+					t.Errorf("snippet of %s pruned", name)
+				}
+			}
+		})
+	}
+}
+
+func TestPruneCacheMissingDirectory(t *testing.T) {
+	snippets := NewSnippetManager(newFakeDocker(), t.TempDir()+"/missing")
+	if removed, err := snippets.PruneCache(nil); removed != 0 || err != nil {
+		t.Errorf("PruneCache = %d, %v, want 0, nil", removed, err)
+	}
+}
+
+func TestSnippetCacheDisabled(t *testing.T) {
+	tests := []struct {
+		name        string
+		enabled     bool
+		wantContent string
+		wantCached  int
+	}{
+		{"cache enabled serves the cached copy", true, "add_header X-Version 1;", 1},
+		{"cache disabled fetches fresh content", false, "add_header X-Version 2;", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := testContainerID("app")
+			docker := newFakeDocker()
+			docker.files[id+":/app/location.conf"] = "add_header X-Version 1;"
+			snippets := NewSnippetManager(docker, t.TempDir())
+			snippets.SetCacheEnabled(tt.enabled)
+
+			if _, err := snippets.DownloadSnippet(id, "/app/location.conf"); err != nil {
+				t.Fatalf("DownloadSnippet: %v", err)
+			}
+			docker.files[id+":/app/location.conf"] = "add_header X-Version 2;"
+			snippet, err := snippets.DownloadSnippet(id, "/app/location.conf")
+			if err != nil {
+				t.Fatalf("DownloadSnippet: %v", err)
+			}
+			if snippet.Content != tt.wantContent {
+				t.Errorf("content = %q, want %q", snippet.Content, tt.wantContent)
+			}
+			cached, err := snippets.ListCached()
+			if err != nil {
+				t.Fatalf("ListCached: %v", err)
+			}
+			if len(cached) != tt.wantCached {
+				t.Errorf("%d snippets cached, want %d", len(cached), tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestParseSnippetFailurePolicy(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    SnippetFailurePolicy
+		wantErr string
+	}{
+		{"", SnippetFailOpen, ""},
+		{"fail-open", SnippetFailOpen, ""},
+		{" Fail-Closed ", SnippetFailClosed, ""},
+		{"strict", "", "invalid snippet failure policy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseSnippetFailurePolicy(tt.value)
+			checkError(t, err, tt.wantErr)
+			if got != tt.want {
+				t.Errorf("ParseSnippetFailurePolicy(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnippetFailurePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		label   string
+		policy  SnippetFailurePolicy
+		wantErr string
+	}{
+		{"missing server snippet fails open", LabelServerSnippet, SnippetFailOpen, ""},
+		{"missing server snippet fails closed", LabelServerSnippet, SnippetFailClosed, "failed to download server snippet for container app"},
+		{"missing configuration snippet fails open", LabelConfigurationSnippet, SnippetFailOpen, ""},
+		{"missing configuration snippet fails closed", LabelConfigurationSnippet, SnippetFailClosed, "failed to download configuration snippet for container app"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			container := newTestContainer(t, "app", "10.0.0.2", map[string]string{LabelHost: "app.test", tt.label: "/app/missing.conf"})
+			snippets := NewSnippetManager(newFakeDocker(), t.TempDir())
+			snippets.SetCacheEnabled(false)
+
+			opts := DefaultGeneratorOptions()
+			opts.ServerSnippetPolicy = tt.policy
+			opts.ConfigurationSnippetPolicy = tt.policy
+			config, err := GenerateNginxConfigWithOptions([]*ContainerData{container}, snippets, nil, opts)
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+			server := config.Servers[0]
+			if server.ServerSnippet != "" || server.Locations[0].ConfigurationSnippet != "" {
+				t.Errorf("missing snippet rendered: server %q, location %q", server.ServerSnippet, server.Locations[0].ConfigurationSnippet)
+			}
+			if len(server.Locations) != 1 || server.Locations[0].Upstream == "" {
+				t.Errorf("route dropped with its snippet: %+v", server.Locations)
+			}
+		})
+	}
+}
+
+func TestSnippetFailClosedKeepsLastGoodConfig(t *testing.T) {
+	web := fakeContainer{Name: "web", IP: "172.18.0.2", Labels: hostLabels("web.test", map[string]string{LabelEnable: "true"})}
+	docker := newFakeDocker(web)
+	p := newTestProvider(t, docker, Config{ConfigurationSnippetPolicy: "fail-closed"})
+	if err := p.loadConfiguration(); err != nil {
+		t.Fatalf("loadConfiguration: %v", err)
+	}
+	good := readTestConfig(t, p)
+
+	broken := fakeContainer{Name: "broken", IP: "172.18.0.3",
+		Labels: hostLabels("broken.test", map[string]string{LabelEnable: "true", LabelConfigurationSnippet: "/app/missing.conf"})}
+	docker.set(web, broken)
+	if err := p.loadConfiguration(); err == nil {
+		t.Fatal("loadConfiguration succeeded with a missing snippet under fail-closed")
+	}
+	if config := readTestConfig(t, p); config != good {
+		t.Errorf("config changed after a fail-closed snippet failure:\n%s", config)
+	}
+}
+
+func TestSnippetPathRejected(t *testing.T) {
+	tests := []struct {
+		path       string
+		wantReason string
+	}{
+		{"/app/location.conf", ""},
+		{"/app/notes.txt", ""},
+		{"/app/../secret.conf", "path traversal not allowed"},
+		{"/etc/nginx/nginx.conf", "system directories not allowed"},
+		{"/var/www/site.conf", "system directories not allowed"},
+		{"/app/run.sh", "only .conf and .txt files allowed"},
+	}
+
+	snippets := NewSnippetManager(newFakeDocker(), t.TempDir())
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			err := snippets.validateFilePath(tt.path)
+			if tt.wantReason == "" {
+				if err != nil {
+					t.Fatalf("validateFilePath(%q) = %v, want nil", tt.path, err)
+				}
+				return
+			}
+			var pathErr *SnippetPathError
+			if !errors.As(err, &pathErr) || pathErr.Reason != tt.wantReason || pathErr.Path != tt.path {
+				t.Fatalf("validateFilePath(%q) = %#v, want a path error because %s", tt.path, err, tt.wantReason)
+			}
+			if !IsSnippetPathRejected(fmt.Errorf("wrapped: %w", err)) {
+				t.Error("IsSnippetPathRejected does not see through wrapping")
+			}
+		})
+	}
+}
+
+func TestRejectedSnippetPathPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		policy  SnippetFailurePolicy
+		wantErr string
+	}{
+		{"rejected server snippet skipped", map[string]string{LabelServerSnippet: "/etc/nginx/server.conf"}, SnippetFailOpen, ""},
+		{"rejected server snippet fails closed", map[string]string{LabelServerSnippet: "/etc/nginx/server.conf"}, SnippetFailClosed, "system directories not allowed"},
+		{"rejected configuration snippet skipped", map[string]string{LabelConfigurationSnippet: "/app/run.sh"}, SnippetFailOpen, ""},
+		{"rejected configuration snippet fails closed", map[string]string{LabelConfigurationSnippet: "/app/run.sh"}, SnippetFailClosed, "only .conf and .txt files allowed"},
+		{"rejected FastCGI params file skipped", map[string]string{LabelBackendProtocol: "FCGI", LabelFastCGIParamsFile: "/app/../params.conf"}, SnippetFailOpen, ""},
+		{"rejected FastCGI params file fails closed", map[string]string{LabelBackendProtocol: "FCGI", LabelFastCGIParamsFile: "/app/../params.conf"}, SnippetFailClosed, "path traversal not allowed"},
+		// Only path rejections are skipped; a params file that can't be
+		// downloaded still fails the update
+		{"missing FastCGI params file fails open", map[string]string{LabelBackendProtocol: "FCGI", LabelFastCGIParamsFile: "/app/missing.conf"}, SnippetFailOpen, "/app/missing.conf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broken := newTestContainer(t, "broken", "10.0.0.2", hostLabels("broken.test", tt.labels))
+			web := newTestContainer(t, "web", "10.0.0.3", hostLabels("web.test", nil))
+			docker := newFakeDocker()
+			snippets := NewSnippetManager(docker, t.TempDir())
+			snippets.SetCacheEnabled(false)
+			fastcgi := NewFastCGIParameterManager(docker, t.TempDir())
+
+			opts := DefaultGeneratorOptions()
+			opts.ServerSnippetPolicy = tt.policy
+			opts.ConfigurationSnippetPolicy = tt.policy
+			config, err := GenerateNginxConfigWithOptions([]*ContainerData{broken, web}, snippets, fastcgi, opts)
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+			if len(config.Servers) != 2 {
+				t.Fatalf("%d servers generated, want both hosts", len(config.Servers))
+			}
+			for _, server := range config.Servers {
+				if server.ServerSnippet != "" || server.Locations[0].ConfigurationSnippet != "" {
+					t.Errorf("%s: rejected snippet rendered", server.ServerName)
+				}
+			}
+		})
+	}
+}
+
+func TestListAndValidateCached(t *testing.T) {
+	snippets := []struct {
+		container string
+		path      string
+		content   string
+		wantError string
+	}{
+		{"valid", "/app/location.conf", "add_header X-Valid on;", ""},
+		{"block", "/app/block.conf", "location /health {\n    return 200;\n}", ""},
+		{"semicolon", "/app/location.conf", "add_header X-Broken on", "directive should end with semicolon"},
+		{"braces", "/app/location.conf", "if ($host) {\n    return 404;", "unmatched braces"},
+	}
+
+	docker := newFakeDocker()
+	manager := NewSnippetManager(docker, t.TempDir())
+	want := make(map[string]CachedSnippetValidation)
+	for _, snippet := range snippets {
+		id := testContainerID(snippet.container)
+		docker.files[id+":"+snippet.path] = snippet.content
+		if _, err := manager.DownloadSnippet(id, snippet.path); err != nil {
+			t.Fatalf("DownloadSnippet(%s): %v", snippet.container, err)
+		}
+		want[id[:12]] = CachedSnippetValidation{
+			CachedSnippet: CachedSnippet{
+				ContainerID: id[:12],
+				Path:        snippet.path,
+				Hash:        sha256Hex(snippet.content)[:12],
+				Size:        int64(len(snippet.content)),
+			},
+			Error: snippet.wantError,
+		}
+	}
+
+	cached, err := manager.ListCached()
+	if err != nil {
+		t.Fatalf("ListCached: %v", err)
+	}
+	if len(cached) != len(snippets) {
+		t.Fatalf("ListCached listed %d snippets, want %d", len(cached), len(snippets))
+	}
+	for i, snippet := range cached {
+		if i > 0 && cached[i-1].File >= snippet.File {
+			t.Errorf("ListCached not sorted by file: %s before %s", cached[i-1].File, snippet.File)
+		}
+		expected := want[snippet.ContainerID].CachedSnippet
+		expected.File, expected.AgeSeconds = snippet.File, snippet.AgeSeconds
+		if snippet != expected {
+			t.Errorf("cached snippet = %+v, want %+v", snippet, expected)
+		}
+	}
+
+	results, err := manager.ValidateCached()
+	if err != nil {
+		t.Fatalf("ValidateCached: %v", err)
+	}
+	for _, result := range results {
+		wantError := want[result.ContainerID].Error
+		if (wantError == "") != (result.Error == "") || !strings.Contains(result.Error, wantError) {
+			t.Errorf("%s: validation error %q, want %q", result.Path, result.Error, wantError)
+		}
+	}
+}
+
+func TestListCachedFromEarlierRun(t *testing.T) {
+	dir := t.TempDir()
+	file := testContainerID("old")[:12] + "_0123456789ab.conf"
+	if err := os.WriteFile(filepath.Join(dir, file), []byte("add_header X-Old on;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("not a snippet"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cached, err := NewSnippetManager(newFakeDocker(), dir).ListCached()
+	if err != nil {
+		t.Fatalf("ListCached: %v", err)
+	}
+	if len(cached) != 1 || cached[0].File != file || cached[0].Path != "" || cached[0].ContainerID != testContainerID("old")[:12] {
+		t.Errorf("ListCached = %+v, want only %s with an unknown path", cached, file)
+	}
+}
+
+func TestSnippetCacheStats(t *testing.T) {
+	tests := []struct {
+		name       string
+		cache      bool
+		downloads  []string
+		wantHits   int64
+		wantMisses int64
+		wantErrors int64
+	}{
+		{"first download misses", true, []string{"/app/location.conf"}, 0, 1, 0},
+		{"repeated downloads hit", true, []string{"/app/location.conf", "/app/location.conf", "/app/location.conf"}, 2, 1, 0},
+		{"every path misses once", true, []string{"/app/location.conf", "/app/server.conf", "/app/server.conf"}, 1, 2, 0},
+		{"cache disabled always misses", false, []string{"/app/location.conf", "/app/location.conf"}, 0, 2, 0},
+		{"failed downloads miss", true, []string{"/app/missing.conf", "/app/missing.conf"}, 0, 2, 2},
+		{"rejected paths don't count", true, []string{"/etc/nginx/nginx.conf"}, 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := testContainerID("app")
+			docker := newFakeDocker()
+			docker.files[id+":/app/location.conf"] = "add_header X-Location on;"
+			docker.files[id+":/app/server.conf"] = "add_header X-Server on;"
+			snippets := NewSnippetManager(docker, t.TempDir())
+			snippets.SetCacheEnabled(tt.cache)
+
+			for _, path := range tt.downloads {
+				snippets.DownloadSnippet(id, path)
+			}
+
+			stats := snippets.Stats()
+			if stats.Hits != tt.wantHits || stats.Misses != tt.wantMisses || stats.DownloadErrors != tt.wantErrors {
+				t.Errorf("stats = %d hits, %d misses, %d errors, want %d, %d, %d",
+					stats.Hits, stats.Misses, stats.DownloadErrors, tt.wantHits, tt.wantMisses, tt.wantErrors)
+			}
+			if stats.Misses > 0 && stats.DownloadMillisAverage != float64(stats.DownloadMillisTotal)/float64(stats.Misses) {
+				t.Errorf("average download %.2fms, want total %dms over %d misses", stats.DownloadMillisAverage, stats.DownloadMillisTotal, stats.Misses)
+			}
+			if stats.DownloadMillisMax > stats.DownloadMillisTotal {
+				t.Errorf("slowest download %dms exceeds the total %dms", stats.DownloadMillisMax, stats.DownloadMillisTotal)
+			}
+		})
+	}
+}
+
+func TestDownloadCertificate(t *testing.T) {
+	ca, _ := testCertificatePEM(t)
+	rotated, _ := testCertificatePEM(t)
+	const caPath = "/app/ca.pem"
+	id := testContainerID("app")
+
+	tests := []struct {
+		name          string
+		cacheDisabled bool
+		readOnly      bool
+		noCacheDir    bool
+		wantErr       string
+		wantContent   string // of the cached file after rotating the CA
+		wantDownloads int64
+		wantFile      bool
+	}{
+		{name: "cached bundle reused", wantContent: string(ca), wantDownloads: 1, wantFile: true},
+		{name: "cache disabled downloads again", cacheDisabled: true, wantContent: string(rotated), wantDownloads: 2, wantFile: true},
+		{name: "read-only writes nothing", readOnly: true, wantDownloads: 2},
+		{name: "no cache directory", noCacheDir: true, wantErr: "no cache directory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docker := newFakeDocker()
+			docker.files[id+":"+caPath] = string(ca)
+			cacheDir := filepath.Join(t.TempDir(), "cache")
+			if tt.noCacheDir {
+				cacheDir = ""
+			}
+			snippets := NewSnippetManager(docker, cacheDir)
+			snippets.SetCacheEnabled(!tt.cacheDisabled)
+			snippets.SetReadOnly(tt.readOnly)
+
+			path, err := snippets.DownloadCertificate(id, caPath)
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+			docker.files[id+":"+caPath] = string(rotated)
+			again, err := snippets.DownloadCertificate(id, caPath)
+			if err != nil {
+				t.Fatalf("second DownloadCertificate: %v", err)
+			}
+
+			if again != path || filepath.Dir(path) != cacheDir {
+				t.Errorf("paths = %s and %s, want one path in %s", path, again, cacheDir)
+			}
+			if got := snippets.Stats().Misses; got != tt.wantDownloads {
+				t.Errorf("%d downloads, want %d", got, tt.wantDownloads)
+			}
+			content, err := os.ReadFile(path)
+			if (err == nil) != tt.wantFile {
+				t.Fatalf("cached file read error = %v, want file %v", err, tt.wantFile)
+			}
+			if tt.wantFile && strings.TrimSpace(string(content)) != strings.TrimSpace(tt.wantContent) {
+				t.Errorf("cached bundle = %q, want %q", content, tt.wantContent)
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSecurityHeadersRepeatedInLocationsWithAddHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		wantHSTS bool
+	}{
+		{
+			name: "cors over tls with hsts",
+			labels: map[string]string{
+				LabelHost: "app.test", LabelTLS: "true", LabelHSTS: "true",
+				LabelCORS: "true", LabelCORS + ".origins": "https://a.test",
+			},
+			wantHSTS: true,
+		},
+		{
+			name:   "cors over http",
+			labels: map[string]string{LabelHost: "app.test", LabelCORS: "true", LabelCORS + ".origins": "https://a.test"},
+		},
+		{
+			name:     "allowed methods",
+			labels:   map[string]string{LabelHost: "app.test", LabelTLS: "true", LabelHSTS: "true", LabelAllowedMethods: "GET"},
+			wantHSTS: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered := renderTestConfig(t, DefaultGeneratorOptions(), newTestContainer(t, "app", "10.0.0.2", tt.labels))
+			location := locationBlock(t, rendered, "/")
+
+			// Every add_header scope (the location and each if block in it)
+			// must carry the security headers itself
+			scopes := strings.Count(location, "add_header 'Access-Control-Allow-Origin'") +
+				strings.Count(location, "add_header Allow ")
+			if got := strings.Count(location, "add_header X-Frame-Options DENY;"); got < scopes {
+				t.Errorf("X-Frame-Options in %d blocks, want at least %d:\n%s", got, scopes, location)
+			}
+			if got := strings.Contains(location, "Strict-Transport-Security"); got != tt.wantHSTS {
+				t.Errorf("HSTS in location = %v, want %v:\n%s", got, tt.wantHSTS, location)
+			}
+		})
+	}
+}
+
+func TestSecurityHeadersInUnavailableLocation(t *testing.T) {
+	container := newTestContainer(t, "app", "10.0.0.2", map[string]string{LabelHost: "app.test", LabelTLS: "true", LabelHSTS: "true"})
+	container.Restarting = true // all backends down
+	rendered := renderTestConfig(t, DefaultGeneratorOptions(), container)
+
+	block := locationBlock(t, rendered, "@unavailable")
+	for _, header := range []string{"Retry-After", "Strict-Transport-Security", "X-Frame-Options", "X-Content-Type-Options"} {
+		if !strings.Contains(block, header) {
+			t.Errorf("@unavailable lacks %s:\n%s", header, block)
+		}
+	}
+}
+
+func TestLocationWithoutAddHeaderInheritsServerHeaders(t *testing.T) {
+	container := newTestContainer(t, "app", "10.0.0.2", map[string]string{LabelHost: "app.test"})
+	rendered := renderTestConfig(t, DefaultGeneratorOptions(), container)
+
+	if strings.Contains(locationBlock(t, rendered, "/"), "add_header") {
+		t.Errorf("plain location repeats headers it inherits")
+	}
+	if !strings.Contains(rendered, "add_header X-Frame-Options DENY;") {
+		t.Errorf("server level security headers missing")
+	}
+}
+
+func TestHSTSHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		want    string // Strict-Transport-Security value, "" for no header
+		wantErr string
+	}{
+		{name: "default max-age", labels: map[string]string{LabelTLS: "true", LabelHSTS: "true"}, want: `"max-age=31536000"`},
+		{
+			name:   "custom max-age with subdomains",
+			labels: map[string]string{LabelTLS: "true", LabelHSTS: "true", LabelHSTSMaxAge: "600", LabelHSTSIncludeSubdomains: "true"},
+			want:   `"max-age=600; includeSubDomains"`,
+		},
+		{name: "disabled", labels: map[string]string{LabelTLS: "true"}},
+		{name: "ignored without tls", labels: map[string]string{LabelHSTS: "true"}},
+		{name: "invalid max-age", labels: map[string]string{LabelTLS: "true", LabelHSTS: "true", LabelHSTSMaxAge: "-1"}, wantErr: "invalid HSTS max-age"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := map[string]string{LabelHost: "app.test"}
+			for key, value := range tt.labels {
+				labels[key] = value
+			}
+			_, err := validateTestLabels(labels)
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+
+			rendered := renderTestConfig(t, DefaultGeneratorOptions(), newTestContainer(t, "app", "10.0.0.2", labels))
+			header := "add_header Strict-Transport-Security " + tt.want + " always;"
+			switch {
+			case tt.want == "" && strings.Contains(rendered, "Strict-Transport-Security"):
+				t.Errorf("unexpected HSTS header:\n%s", rendered)
+			case tt.want != "" && !strings.Contains(rendered, header):
+				t.Errorf("config lacks %q:\n%s", header, rendered)
+			}
+		})
+	}
+}
+
+func TestHTTPSBackend(t *testing.T) {
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		want     []string
+		unwanted []string
+	}{
+		{
+			name:     "http backend",
+			labels:   map[string]string{},
+			want:     []string{"proxy_pass http://"},
+			unwanted: []string{"proxy_ssl"},
+		},
+		{
+			name:     "https backend",
+			labels:   map[string]string{LabelProtocol: "https", LabelPort: "8443"},
+			want:     []string{"proxy_pass https://", "proxy_ssl_server_name on;", "proxy_ssl_name $host;"},
+			unwanted: []string{"proxy_ssl_verify"},
+		},
+		{
+			name:   "https backend with host header",
+			labels: map[string]string{LabelProtocol: "https", LabelUpstreamHostHeader: "internal.test"},
+			want:   []string{"proxy_set_header Host internal.test;", "proxy_ssl_name internal.test;"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := map[string]string{LabelHost: "app.test"}
+			for key, value := range tt.labels {
+				labels[key] = value
+			}
+			rendered := renderTestConfig(t, DefaultGeneratorOptions(), newTestContainer(t, "app", "10.0.0.2", labels))
+			checkContains(t, locationBlock(t, rendered, "/"), tt.want, tt.unwanted)
+		})
+	}
+}
+
+func TestTryFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr string
+	}{
+		{name: "spa fallback", value: "$uri $uri/ /index.html", want: "try_files $uri $uri/ /index.html;"},
+		{name: "comma separated", value: "$uri,/index.html", want: "try_files $uri /index.html;"},
+		{name: "empty", value: " , ", wantErr: "must list at least one file"},
+		{name: "nginx syntax", value: "$uri; return 200", wantErr: "invalid " + LabelTryFiles},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := map[string]string{LabelHost: "app.test", LabelTryFiles: tt.value}
+			_, err := validateTestLabels(labels)
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+			rendered := renderTestConfig(t, DefaultGeneratorOptions(), newTestContainer(t, "app", "10.0.0.2", labels))
+			checkContains(t, locationBlock(t, rendered, "/"), []string{tt.want, "proxy_pass"}, nil)
+		})
+	}
+}
+
+func TestUpstreamHostHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		want    string
+		wantErr string
+	}{
+		{name: "client host", want: "proxy_set_header Host $host;"},
+		{name: "fixed host", labels: map[string]string{LabelUpstreamHostHeader: "internal.test"}, want: "proxy_set_header Host internal.test;"},
+		{name: "nginx variable", labels: map[string]string{LabelUpstreamHostHeader: "$proxy_host"}, want: "proxy_set_header Host $proxy_host;"},
+		{
+			name:   "grpc backend",
+			labels: map[string]string{LabelUpstreamHostHeader: "internal.test", LabelBackendHTTP2: "true", LabelPreservePath: "true"},
+			want:   "grpc_set_header Host internal.test;",
+		},
+		{name: "empty", labels: map[string]string{LabelUpstreamHostHeader: ""}, wantErr: "invalid upstream host header"},
+		{name: "nginx syntax", labels: map[string]string{LabelUpstreamHostHeader: "a.test; return 200"}, wantErr: "invalid upstream host header"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := map[string]string{LabelHost: "app.test"}
+			for key, value := range tt.labels {
+				labels[key] = value
+			}
+			_, err := validateTestLabels(labels)
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+			rendered := renderTestConfig(t, DefaultGeneratorOptions(), newTestContainer(t, "app", "10.0.0.2", labels))
+			checkContains(t, locationBlock(t, rendered, "/"), []string{tt.want}, nil)
+		})
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		want    string
+		wantErr string
+	}{
+		{name: "default code", labels: map[string]string{LabelRedirectTo: "https://new.test/"}, want: "return 302 https://new.test/;"},
+		{
+			name:   "permanent",
+			labels: map[string]string{LabelRedirectTo: "https://new.test$request_uri", LabelRedirectCode: "301"},
+			want:   "return 301 https://new.test$request_uri;",
+		},
+		{name: "relative url", labels: map[string]string{LabelRedirectTo: "/other"}, wantErr: "absolute http(s) URL"},
+		{name: "nginx syntax", labels: map[string]string{LabelRedirectTo: "https://new.test/;return"}, wantErr: "invalid redirect URL"},
+		{name: "unsupported code", labels: map[string]string{LabelRedirectTo: "https://new.test/", LabelRedirectCode: "200"}, wantErr: "invalid redirect code"},
+		{name: "non-numeric code", labels: map[string]string{LabelRedirectTo: "https://new.test/", LabelRedirectCode: "moved"}, wantErr: "invalid redirect code"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := map[string]string{LabelHost: "old.test"}
+			for key, value := range tt.labels {
+				labels[key] = value
+			}
+			_, err := validateTestLabels(labels)
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+			rendered := renderTestConfig(t, DefaultGeneratorOptions(), newTestContainer(t, "old", "10.0.0.2", labels))
+			checkContains(t, locationBlock(t, rendered, "/"), []string{tt.want}, []string{"proxy_pass"})
+		})
+	}
+}
+
+func TestHeaderRemoval(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:   "hide response headers",
+			labels: map[string]string{LabelHideHeaders: "X-Powered-By, Server"},
+			want:   []string{"proxy_hide_header X-Powered-By;", "proxy_hide_header Server;"},
+		},
+		{
+			name:   "clear request headers",
+			labels: map[string]string{LabelClearRequestHeaders: "Cookie,X-Debug"},
+			want:   []string{`proxy_set_header Cookie "";`, `proxy_set_header X-Debug "";`},
+		},
+		{
+			name:   "grpc backend",
+			labels: map[string]string{LabelHideHeaders: "Server", LabelClearRequestHeaders: "Cookie", LabelBackendHTTP2: "true", LabelPreservePath: "true"},
+			want:   []string{"grpc_hide_header Server;", `grpc_set_header Cookie "";`},
+		},
+		{name: "invalid header name", labels: map[string]string{LabelHideHeaders: "X-Bad;"}, wantErr: "invalid header name"},
+		{name: "header with space", labels: map[string]string{LabelClearRequestHeaders: "X Debug"}, wantErr: "invalid header name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := map[string]string{LabelHost: "app.test"}
+			for key, value := range tt.labels {
+				labels[key] = value
+			}
+			_, err := validateTestLabels(labels)
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+			rendered := renderTestConfig(t, DefaultGeneratorOptions(), newTestContainer(t, "app", "10.0.0.2", labels))
+			checkContains(t, locationBlock(t, rendered, "/"), tt.want, nil)
+		})
+	}
+}
@@ -0,0 +1,512 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTestCertificate writes an empty <name>.crt and <name>.key to dir and
+// returns their paths
+func writeTestCertificate(t testing.TB, dir, name string) (cert, key string) {
+	t.Helper()
+	cert, key = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	for _, path := range []string{cert, key} {
+		if err := os.WriteFile(path, []byte("test"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cert, key
+}
+
+func TestEnsureSSLCertificates(t *testing.T) {
+	dir := t.TempDir()
+	hostCert, hostKey := writeTestCertificate(t, dir, "app.test")
+	defaultCert, defaultKey := writeTestCertificate(t, dir, "default")
+	missing := filepath.Join(dir, "missing.crt")
+
+	tests := []struct {
+		name          string
+		cert, key     string
+		stapling      bool
+		noDefault     bool
+		wantSSL       bool
+		wantCert      string
+		wantStapling  bool
+		wantSSLListen bool
+	}{
+		{"readable certificate kept", hostCert, hostKey, true, false, true, hostCert, true, true},
+		{"missing certificate falls back", missing, hostKey, false, false, true, defaultCert, false, true},
+		{"missing key falls back", hostCert, missing, false, false, true, defaultCert, false, true},
+		{"fallback disables stapling", missing, hostKey, true, false, true, defaultCert, false, true},
+		{"no default disables tls", missing, hostKey, false, true, false, "", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultGeneratorOptions()
+			opts.DefaultCertPath, opts.DefaultKeyPath = defaultCert, defaultKey
+			if tt.noDefault {
+				opts.DefaultCertPath = missing
+			}
+			config := &NginxConfig{Servers: []ServerConfig{{
+				ServerName: "app.test",
+				Listen:     []string{"80", "443 ssl"},
+				SSL:        SSLConfig{Enabled: true, Certificate: tt.cert, PrivateKey: tt.key, Stapling: tt.stapling},
+			}}}
+
+			EnsureSSLCertificates(config, opts)
+
+			server := config.Servers[0]
+			if server.SSL.Enabled != tt.wantSSL {
+				t.Fatalf("SSL enabled = %v, want %v", server.SSL.Enabled, tt.wantSSL)
+			}
+			if server.SSL.Certificate != tt.wantCert {
+				t.Errorf("certificate = %q, want %q", server.SSL.Certificate, tt.wantCert)
+			}
+			if server.SSL.Stapling != tt.wantStapling {
+				t.Errorf("stapling = %v, want %v", server.SSL.Stapling, tt.wantStapling)
+			}
+			if got := strings.Contains(strings.Join(server.Listen, ","), "ssl"); got != tt.wantSSLListen {
+				t.Errorf("listen = %v, want ssl listener %v", server.Listen, tt.wantSSLListen)
+			}
+		})
+	}
+}
+
+func TestSSLProtocolsAndCiphers(t *testing.T) {
+	tests := []struct {
+		name      string
+		protocols []string // controller SSL_PROTOCOLS
+		ciphers   string   // controller SSL_CIPHERS
+		labels    map[string]string
+		want      []string
+		wantErr   string
+	}{
+		{
+			name: "secure defaults",
+			want: []string{"ssl_protocols TLSv1.2 TLSv1.3;", "ssl_ciphers HIGH:!aNULL:!MD5;", "ssl_prefer_server_ciphers on;"},
+		},
+		{
+			name:      "controller settings",
+			protocols: []string{"TLSv1.3"},
+			ciphers:   "ECDHE+AESGCM",
+			want:      []string{"ssl_protocols TLSv1.3;", "ssl_ciphers ECDHE+AESGCM;"},
+		},
+		{
+			name:      "labels override the controller",
+			protocols: []string{"TLSv1.3"},
+			labels:    map[string]string{LabelSSLProtocols: "TLSv1.2, TLSv1.3", LabelSSLCiphers: "ECDHE-RSA-AES128-GCM-SHA256:!aNULL"},
+			want:      []string{"ssl_protocols TLSv1.2 TLSv1.3;", "ssl_ciphers ECDHE-RSA-AES128-GCM-SHA256:!aNULL;"},
+		},
+		{name: "unknown protocol", labels: map[string]string{LabelSSLProtocols: "SSLv3"}, wantErr: `invalid ssl protocol "SSLv3"`},
+		{name: "empty protocol list", labels: map[string]string{LabelSSLProtocols: ","}, wantErr: "at least one protocol"},
+		{name: "cipher injection", labels: map[string]string{LabelSSLCiphers: "HIGH; return 200"}, wantErr: "invalid ssl ciphers"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := hostLabels("app.test", tt.labels)
+			labels[LabelTLS] = "true"
+			if _, err := validateTestLabels(labels); tt.wantErr != "" || err != nil {
+				checkError(t, err, tt.wantErr)
+				return
+			}
+
+			opts := DefaultGeneratorOptions()
+			if tt.protocols != nil {
+				opts.SSLProtocols = tt.protocols
+			}
+			if tt.ciphers != "" {
+				opts.SSLCiphers = tt.ciphers
+			}
+			rendered := renderTestConfig(t, opts, newTestContainer(t, "app", "10.0.0.2", labels))
+			checkContains(t, rendered, tt.want, nil)
+		})
+	}
+}
+
+func TestOCSPStapling(t *testing.T) {
+	stapling := map[string]string{
+		LabelTLS:                   "true",
+		LabelSSLStapling:           "true",
+		LabelSSLTrustedCertificate: "/etc/nginx/ssl/chain.pem",
+	}
+	withCert := map[string]string{LabelCertName: "app.test"}
+	for key, value := range stapling {
+		withCert[key] = value
+	}
+
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		resolver string
+		want     []string
+		unwanted []string
+		wantErr  string
+	}{
+		{
+			name:   "real certificate",
+			labels: withCert,
+			want: []string{
+				"ssl_stapling on;",
+				"ssl_stapling_verify on;",
+				"ssl_trusted_certificate /etc/nginx/ssl/chain.pem;",
+				"resolver 127.0.0.11 valid=30s;",
+			},
+		},
+		{
+			name:     "controller resolver",
+			labels:   withCert,
+			resolver: "10.0.0.53",
+			want:     []string{"ssl_stapling on;", "resolver 10.0.0.53 valid=30s;"},
+		},
+		{
+			name:     "self-signed default certificate",
+			labels:   stapling,
+			unwanted: []string{"ssl_stapling", "ssl_trusted_certificate"},
+		},
+		{
+			name:     "disabled by default",
+			labels:   map[string]string{LabelTLS: "true", LabelCertName: "app.test"},
+			unwanted: []string{"ssl_stapling", "ssl_trusted_certificate"},
+		},
+		{
+			name:    "trust chain required",
+			labels:  map[string]string{LabelTLS: "true", LabelSSLStapling: "true"},
+			wantErr: "requires " + LabelSSLTrustedCertificate,
+		},
+		{
+			name:    "relative trust chain",
+			labels:  map[string]string{LabelTLS: "true", LabelSSLStapling: "true", LabelSSLTrustedCertificate: "chain.pem"},
+			wantErr: "must be an absolute path",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := hostLabels("app.test", tt.labels)
+			if _, err := validateTestLabels(labels); tt.wantErr != "" || err != nil {
+				checkError(t, err, tt.wantErr)
+				return
+			}
+
+			opts := DefaultGeneratorOptions()
+			if tt.resolver != "" {
+				opts.Resolver = tt.resolver
+			}
+			rendered := renderTestConfig(t, opts, newTestContainer(t, "app", "10.0.0.2", labels))
+			checkContains(t, rendered, tt.want, tt.unwanted)
+		})
+	}
+}
+
+func TestCertificatePerHost(t *testing.T) {
+	tests := []struct {
+		name     string
+		certName string // cert-name label, omitted when empty
+		wantCert string // file name without extension
+	}{
+		{"shop.test", "shop.test", "shop.test"},
+		{"blog.test", "blog-2024", "blog-2024"},
+		{"plain.test", "", "default"},
+	}
+
+	var containers []*ContainerData
+	for i, tt := range tests {
+		labels := hostLabels(tt.name, map[string]string{LabelTLS: "true"})
+		if tt.certName != "" {
+			labels[LabelCertName] = tt.certName
+		}
+		containers = append(containers, newTestContainer(t, tt.name, fmt.Sprintf("10.0.0.%d", i+2), labels))
+	}
+	rendered := renderTestConfig(t, DefaultGeneratorOptions(), containers...)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := serverBlock(t, rendered, tt.name)
+			want := []string{
+				"ssl_certificate /etc/nginx/ssl/" + tt.wantCert + ".crt;",
+				"ssl_certificate_key /etc/nginx/ssl/" + tt.wantCert + ".key;",
+			}
+			var unwanted []string
+			for _, other := range tests {
+				if other.wantCert != tt.wantCert {
+					unwanted = append(unwanted, "/"+other.wantCert+".crt")
+				}
+			}
+			checkContains(t, block, want, unwanted)
+		})
+	}
+}
+
+func TestResolveHostCertificate(t *testing.T) {
+	dir := t.TempDir()
+	writeTestCertificate(t, dir, "shop.example.test")
+	writeTestCertificate(t, dir, "*.example.test")
+	if err := os.WriteFile(filepath.Join(dir, "keyless.test.crt"), []byte("test"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"shop.example.test", "shop.example.test"},
+		{"blog.example.test", "*.example.test"},
+		{"api.example.test", "*.example.test"},
+		{"deep.api.example.test", ""}, // a wildcard covers one label only
+		{"example.test", ""},
+		{"other.test", ""},
+		{"keyless.test", ""},
+		{"*.example.test", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := resolveHostCertificate(tt.host, dir); got != tt.want {
+				t.Errorf("resolveHostCertificate(%q) = %q, want %q", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWildcardCertificateShared(t *testing.T) {
+	dir := t.TempDir()
+	writeTestCertificate(t, dir, "*.example.test")
+	opts := DefaultGeneratorOptions()
+	opts.DefaultCertPath, opts.DefaultKeyPath = writeTestCertificate(t, dir, "default")
+
+	var containers []*ContainerData
+	for i, host := range []string{"a.example.test", "b.example.test", "other.test"} {
+		containers = append(containers, newTestContainer(t, fmt.Sprintf("app%d", i), fmt.Sprintf("10.0.0.%d", i+2),
+			hostLabels(host, map[string]string{LabelTLS: "true"})))
+	}
+	config := generateTestConfig(t, opts, containers...)
+
+	want := map[string]string{
+		"a.example.test": filepath.Join(dir, "*.example.test.crt"),
+		"b.example.test": filepath.Join(dir, "*.example.test.crt"),
+		"other.test":     opts.DefaultCertPath,
+	}
+	if len(config.Servers) != len(want) {
+		t.Fatalf("%d servers generated, want %d", len(config.Servers), len(want))
+	}
+	for _, server := range config.Servers {
+		if server.SSL.Certificate != want[server.ServerName] {
+			t.Errorf("%s uses %s, want %s", server.ServerName, server.SSL.Certificate, want[server.ServerName])
+		}
+	}
+}
+
+func TestDisableTLS(t *testing.T) {
+	tests := []struct {
+		name       string
+		disableTLS bool
+		want       []string
+		unwanted   []string
+	}{
+		{"tls enabled", false, []string{"listen 443 ssl", "ssl_certificate "}, nil},
+		{"tls disabled everywhere", true, []string{"listen 80"}, []string{"443", "ssl_certificate", "return 301 https://"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultGeneratorOptions()
+			opts.DisableTLS = tt.disableTLS
+			container := newTestContainer(t, "app", "10.0.0.2", hostLabels("app.test", map[string]string{LabelTLS: "true"}))
+			config := generateTestConfig(t, opts, container)
+			if config.Servers[0].SSL.Enabled == tt.disableTLS {
+				t.Errorf("SSL enabled = %v with DisableTLS %v", config.Servers[0].SSL.Enabled, tt.disableTLS)
+			}
+			checkContains(t, renderTestConfig(t, opts, container), tt.want, tt.unwanted)
+		})
+	}
+}
+
+func TestDefaultCertificatePath(t *testing.T) {
+	dir := t.TempDir()
+	customCert, customKey := writeTestCertificate(t, dir, "fallback")
+
+	tests := []struct {
+		name      string
+		cert, key string // GeneratorOptions.DefaultCertPath/DefaultKeyPath
+		certName  string
+		wantCert  string
+		wantKey   string
+	}{
+		{"built-in default", DefaultSSLCertificate, DefaultSSLPrivateKey, "", DefaultSSLCertificate, DefaultSSLPrivateKey},
+		{"unset falls back to the built-in default", "", "", "", DefaultSSLCertificate, DefaultSSLPrivateKey},
+		{"configured default", customCert, customKey, "", customCert, customKey},
+		{"certname next to the configured default", customCert, customKey, "shop", filepath.Join(dir, "shop.crt"), filepath.Join(dir, "shop.key")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultGeneratorOptions()
+			opts.DefaultCertPath, opts.DefaultKeyPath = tt.cert, tt.key
+			labels := hostLabels("app.test", map[string]string{LabelTLS: "true"})
+			if tt.certName != "" {
+				labels[LabelCertName] = tt.certName
+			}
+
+			rendered := renderTestConfig(t, opts, newTestContainer(t, "app", "10.0.0.2", labels))
+			want := []string{"ssl_certificate " + tt.wantCert + ";", "ssl_certificate_key " + tt.wantKey + ";"}
+			checkContains(t, serverBlock(t, rendered, "app.test"), want, nil)
+		})
+	}
+}
+
+func TestProviderDefaultCertificatePath(t *testing.T) {
+	tests := []struct {
+		name      string
+		cert, key string
+		wantErr   string
+		wantCert  string
+		wantKey   string
+	}{
+		{"defaults", "", "", "", DefaultSSLCertificate, DefaultSSLPrivateKey},
+		{"configured", "/srv/tls/default.crt", "/srv/tls/private/default.key", "", "/srv/tls/default.crt", "/srv/tls/private/default.key"},
+		{"relative certificate", "tls/default.crt", "", `default certificate path "tls/default.crt" must be absolute`, "", ""},
+		{"relative key", "", "default.key", `default certificate path "default.key" must be absolute`, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewProvider(newFakeDocker(), Config{DefaultCertPath: tt.cert, DefaultKeyPath: tt.key})
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+			defer p.Stop()
+			if p.generatorOpts.DefaultCertPath != tt.wantCert || p.generatorOpts.DefaultKeyPath != tt.wantKey {
+				t.Errorf("default certificate = %s and %s, want %s and %s",
+					p.generatorOpts.DefaultCertPath, p.generatorOpts.DefaultKeyPath, tt.wantCert, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestParseMinTLSVersion(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"1.2", "1.2", false},
+		{"1.3", "1.3", false},
+		{" 1.1 ", "1.1", false},
+		{"1.0", "1.0", false},
+		{"1", "1.0", false},
+		{"TLSv1.2", "1.2", false},
+		{"TLSv1", "1.0", false},
+		{"1.4", "", true},
+		{"SSLv3", "", true},
+		{"", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseMinTLSVersion(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMinTLSVersion(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMinTLSVersion(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMinTLSProtocols(t *testing.T) {
+	tests := []struct {
+		version string
+		want    []string
+	}{
+		{"1.0", []string{"TLSv1", "TLSv1.1", "TLSv1.2", "TLSv1.3"}},
+		{"1.1", []string{"TLSv1.1", "TLSv1.2", "TLSv1.3"}},
+		{"1.2", []string{"TLSv1.2", "TLSv1.3"}},
+		{"1.3", []string{"TLSv1.3"}},
+		{"2.0", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			if got := MinTLSProtocols(tt.version); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MinTLSProtocols(%q) = %v, want %v", tt.version, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMinTLSVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		containers  []map[string]string // labels of each container on app.test
+		wantVersion string
+		want        string // ssl_protocols
+	}{
+		{"unset keeps the controller protocols", []map[string]string{nil}, "", "TLSv1.2 TLSv1.3"},
+		{"minimum 1.3", []map[string]string{{LabelMinTLSVersion: "1.3"}}, "1.3", "TLSv1.3"},
+		{"lower minimum widens the protocols", []map[string]string{{LabelMinTLSVersion: "1.1"}}, "1.1", "TLSv1.1 TLSv1.2 TLSv1.3"},
+		{"stricter minimum wins", []map[string]string{
+			{LabelMinTLSVersion: "1.2", LabelPath: "/a"},
+			{LabelMinTLSVersion: "1.3", LabelPath: "/b"},
+		}, "1.3", "TLSv1.3"},
+		{"stricter minimum wins in any order", []map[string]string{
+			{LabelMinTLSVersion: "1.3", LabelPath: "/a"},
+			{LabelMinTLSVersion: "1.1", LabelPath: "/b"},
+		}, "1.3", "TLSv1.3"},
+		{"container without a minimum", []map[string]string{
+			{LabelPath: "/a"},
+			{LabelMinTLSVersion: "1.3", LabelPath: "/b"},
+		}, "1.3", "TLSv1.3"},
+		{"filters explicit protocols", []map[string]string{
+			{LabelSSLProtocols: "TLSv1.1,TLSv1.2,TLSv1.3", LabelMinTLSVersion: "1.2"},
+		}, "1.2", "TLSv1.2 TLSv1.3"},
+		{"no explicit protocol left", []map[string]string{
+			{LabelSSLProtocols: "TLSv1.1,TLSv1.2", LabelMinTLSVersion: "1.3"},
+		}, "1.3", "TLSv1.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var containers []*ContainerData
+			for i, labels := range tt.containers {
+				labels = hostLabels("app.test", labels)
+				labels[LabelTLS] = "true"
+				containers = append(containers, newTestContainer(t, fmt.Sprintf("app%d", i), fmt.Sprintf("10.0.0.%d", i+2), labels))
+			}
+
+			config := generateTestConfig(t, DefaultGeneratorOptions(), containers...)
+			if got := config.Servers[0].SSL.MinTLSVersion; got != tt.wantVersion {
+				t.Errorf("MinTLSVersion = %q, want %q", got, tt.wantVersion)
+			}
+			rendered := renderTestConfig(t, DefaultGeneratorOptions(), containers...)
+			checkContains(t, serverBlock(t, rendered, "app.test"), []string{"ssl_protocols " + tt.want + ";"}, nil)
+		})
+	}
+}
+
+func TestMinTLSVersionLabel(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr string
+	}{
+		{"1.2", ""},
+		{"TLSv1.3", ""},
+		{"1.4", `invalid minimum TLS version "1.4"`},
+		{"latest", `invalid minimum TLS version "latest"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			_, err := validateTestLabels(hostLabels("app.test", map[string]string{LabelMinTLSVersion: tt.value}))
+			checkError(t, err, tt.wantErr)
+		})
+	}
+}
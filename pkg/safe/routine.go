@@ -4,6 +4,8 @@ import (
 	"context"
 	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/rs/zerolog/log"
 )
@@ -15,6 +17,8 @@ type Pool struct {
 	waitGroup sync.WaitGroup
 	ctx       context.Context
 	cancel    context.CancelFunc
+	running   atomic.Int64
+	slots     chan struct{} // limits concurrent routines when set
 }
 
 // NewPool creates a Pool.
@@ -26,21 +30,65 @@ func NewPool(parentCtx context.Context) *Pool {
 	}
 }
 
+// NewBoundedPool creates a Pool running at most limit routines at once.
+// GoCtx blocks while the pool is full.
+func NewBoundedPool(parentCtx context.Context, limit int) *Pool {
+	pool := NewPool(parentCtx)
+	if limit > 0 {
+		pool.slots = make(chan struct{}, limit)
+	}
+	return pool
+}
+
 // GoCtx starts a recoverable goroutine with a context.
 func (p *Pool) GoCtx(goroutine routineCtx) {
+	if p.slots != nil {
+		p.slots <- struct{}{}
+	}
 	p.waitGroup.Add(1)
+	p.running.Add(1)
 	Go(func() {
 		defer p.waitGroup.Done()
+		defer p.running.Add(-1)
+		if p.slots != nil {
+			defer func() { <-p.slots }()
+		}
 		goroutine(p.ctx)
 	})
 }
 
+// Wait waits for all started routines to finish without cancelling them.
+func (p *Pool) Wait() {
+	p.waitGroup.Wait()
+}
+
 // Stop stops all started routines, waiting for their termination.
 func (p *Pool) Stop() {
 	p.cancel()
 	p.waitGroup.Wait()
 }
 
+// StopWithTimeout stops all started routines, waiting at most timeout for their
+// termination. It returns false if some routines were still running.
+func (p *Pool) StopWithTimeout(timeout time.Duration) bool {
+	p.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		p.waitGroup.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		log.Warn().Int64("running", p.running.Load()).Dur("timeout", timeout).
+			Msg("Go routines did not stop before timeout")
+		return false
+	}
+}
+
 // Go starts a recoverable goroutine.
 func Go(goroutine func()) {
 	GoWithRecover(goroutine, defaultRecoverGoroutine)
@@ -0,0 +1,92 @@
+package safe
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStopWithTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		routine func(ctx context.Context, release <-chan struct{})
+		want    bool
+	}{
+		{
+			name:    "routine honoring cancellation",
+			routine: func(ctx context.Context, release <-chan struct{}) { <-ctx.Done() },
+			want:    true,
+		},
+		{
+			name:    "finished routine",
+			routine: func(ctx context.Context, release <-chan struct{}) {},
+			want:    true,
+		},
+		{
+			name:    "stuck routine",
+			routine: func(ctx context.Context, release <-chan struct{}) { <-release },
+			want:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release := make(chan struct{})
+			defer close(release)
+
+			pool := NewPool(context.Background())
+			pool.GoCtx(func(ctx context.Context) { tt.routine(ctx, release) })
+
+			started := time.Now()
+			if got := pool.StopWithTimeout(50 * time.Millisecond); got != tt.want {
+				t.Errorf("StopWithTimeout() = %v, want %v", got, tt.want)
+			}
+			if elapsed := time.Since(started); elapsed > time.Second {
+				t.Errorf("StopWithTimeout took %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestBoundedPool(t *testing.T) {
+	const routines = 10
+	tests := []struct {
+		name    string
+		limit   int
+		wantMax int32
+	}{
+		{"sequential", 1, 1},
+		{"bounded", 3, 3},
+		{"limit above the routine count", 20, routines},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := NewBoundedPool(context.Background(), tt.limit)
+			var running, maxRunning, ran int32
+			for i := 0; i < routines; i++ {
+				pool.GoCtx(func(ctx context.Context) {
+					now := atomic.AddInt32(&running, 1)
+					for {
+						prev := atomic.LoadInt32(&maxRunning)
+						if now <= prev || atomic.CompareAndSwapInt32(&maxRunning, prev, now) {
+							break
+						}
+					}
+					time.Sleep(20 * time.Millisecond)
+					atomic.AddInt32(&running, -1)
+					atomic.AddInt32(&ran, 1)
+				})
+			}
+			pool.Wait()
+
+			if ran != routines {
+				t.Errorf("%d routines ran, want %d", ran, routines)
+			}
+			if maxRunning != tt.wantMax {
+				t.Errorf("%d routines ran at once, want %d", maxRunning, tt.wantMax)
+			}
+		})
+	}
+}